@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultBackupsDir returns the backup store inside the dotman directory
+func (c *Config) defaultBackupsDir() string {
+	return filepath.Join(c.DotmanDir, "backups")
+}
+
+// BackupsDir returns the directory holding the backup store, honoring the
+// backup_dir setting
+func (c *Config) BackupsDir() string {
+	if c.Settings.BackupDir == "" {
+		return c.defaultBackupsDir()
+	}
+	return filepath.Clean(c.ExpandHome(c.Settings.BackupDir))
+}
+
+// lastBackupsDir returns the backup store recorded by the previous run.
+// recorded is false when there is no record, and the default store is
+// returned instead, as it was the only one before backup_dir existed.
+func (c *Config) lastBackupsDir() (dir string, recorded bool, err error) {
+	data, err := os.ReadFile(c.backupsDirStateFile())
+	if os.IsNotExist(err) {
+		return c.defaultBackupsDir(), false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("error reading %s: %v", c.backupsDirStateFile(), err)
+	}
+	dir = strings.TrimSpace(string(data))
+	if !filepath.IsAbs(dir) {
+		return c.defaultBackupsDir(), false, nil
+	}
+	return filepath.Clean(dir), true, nil
+}
+
+// recordBackupsDir saves dir as the backup store in use, so the next run
+// can tell when backup_dir changed
+func (c *Config) recordBackupsDir(dir string) error {
+	if err := os.MkdirAll(c.StateDir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %v", c.StateDir, err)
+	}
+	if err := os.WriteFile(c.backupsDirStateFile(), []byte(dir+"\n"), 0644); err != nil {
+		return fmt.Errorf("error recording the backup store: %v", err)
+	}
+	return nil
+}
+
+// migrateBackups moves the backups from the store the previous run used
+// into the one backup_dir selects now, so changing or clearing the setting
+// keeps existing backups restorable. Backups that already exist at the
+// destination are left in place.
+func (c *Config) migrateBackups() error {
+	src, recorded, err := c.lastBackupsDir()
+	if err != nil {
+		return err
+	}
+	dest := c.BackupsDir()
+	if dest == src {
+		if recorded {
+			return nil
+		}
+		return c.recordBackupsDir(dest)
+	}
+
+	entries, err := os.ReadDir(src)
+	if os.IsNotExist(err) {
+		return c.recordBackupsDir(dest)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", src, err)
+	}
+	if len(entries) == 0 {
+		return c.recordBackupsDir(dest)
+	}
+
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return fmt.Errorf("error creating backup store %s: %v", dest, err)
+	}
+
+	for _, entry := range entries {
+		from := filepath.Join(src, entry.Name())
+		to := filepath.Join(dest, entry.Name())
+		if _, err := os.Stat(to); err == nil {
+			continue
+		}
+		if err := os.Rename(from, to); err != nil {
+			return fmt.Errorf("error moving backup %s to %s: %v. Move the backups there manually", from, dest, err)
+		}
+	}
+
+	// Remove the old store once it is empty
+	os.Remove(src)
+	return c.recordBackupsDir(dest)
+}
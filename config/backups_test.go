@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestBackup creates a backup called id in dir
+func writeTestBackup(t *testing.T, dir, id string) {
+	t.Helper()
+
+	writeTestFile(t, filepath.Join(dir, id, "metadata.json"), "{}\n")
+	writeTestFile(t, filepath.Join(dir, id, "content"), id+"\n")
+}
+
+// checkBackupIn fails t unless the backup called id is in dir
+func checkBackupIn(t *testing.T, dir, id string) {
+	t.Helper()
+
+	if _, err := os.Stat(filepath.Join(dir, id, "content")); err != nil {
+		t.Errorf("backup %s is not in %s: %v", id, dir, err)
+	}
+}
+
+func TestMigrateBackupsFollowsBackupDir(t *testing.T) {
+	c := newTestConfig(t)
+	writeTestBackup(t, c.defaultBackupsDir(), "2024-01-02-150405")
+
+	// Setting backup_dir moves the default store there
+	first := filepath.Join(c.HomeDir, "first")
+	c.Settings.BackupDir = first
+	if err := c.migrateBackups(); err != nil {
+		t.Fatal(err)
+	}
+	checkBackupIn(t, first, "2024-01-02-150405")
+
+	// Changing it again moves them on from where they are now
+	writeTestBackup(t, first, "2024-01-03-150405")
+	second := filepath.Join(c.HomeDir, "second")
+	c.Settings.BackupDir = second
+	if err := c.migrateBackups(); err != nil {
+		t.Fatal(err)
+	}
+	checkBackupIn(t, second, "2024-01-02-150405")
+	checkBackupIn(t, second, "2024-01-03-150405")
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("the emptied store %s was not removed", first)
+	}
+
+	// Clearing it moves them back to the default store
+	c.Settings.BackupDir = ""
+	if err := c.migrateBackups(); err != nil {
+		t.Fatal(err)
+	}
+	checkBackupIn(t, c.defaultBackupsDir(), "2024-01-02-150405")
+	checkBackupIn(t, c.defaultBackupsDir(), "2024-01-03-150405")
+}
+
+func TestMigrateBackupsKeepsExisting(t *testing.T) {
+	c := newTestConfig(t)
+	writeTestBackup(t, c.defaultBackupsDir(), "2024-01-02-150405")
+	dest := filepath.Join(c.HomeDir, "backups")
+	writeTestFile(t, filepath.Join(dest, "2024-01-02-150405", "content"), "already there\n")
+
+	c.Settings.BackupDir = dest
+	if err := c.migrateBackups(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "2024-01-02-150405", "content"))
+	if err != nil || string(data) != "already there\n" {
+		t.Errorf("the backup at the destination was replaced: %q, %v", data, err)
+	}
+	checkBackupIn(t, c.defaultBackupsDir(), "2024-01-02-150405")
+}
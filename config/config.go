@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 // Config represents the dotman configuration
@@ -11,8 +14,96 @@ type Config struct {
 	HomeDir    string
 	DotmanDir  string
 	ConfigsDir string
+
+	// StateDir holds local state that is not part of the repository, such
+	// as saved health check results: $XDG_STATE_HOME/dotman, by default
+	// ~/.local/state/dotman
+	StateDir string
+
+	// CacheDir holds files that can be downloaded again, such as upgrade
+	// archives: $XDG_CACHE_HOME/dotman, by default ~/.cache/dotman
+	CacheDir string
+
+	// DirMode is the mode used for directories created while adding,
+	// linking and restoring files
+	DirMode os.FileMode
+
+	// FileMode is the mode used for files copied into place
+	FileMode os.FileMode
+
+	// GitTimeout bounds every git invocation. Zero disables the timeout.
+	GitTimeout time.Duration
+
+	// GitInteractive allows git to prompt for credentials on network
+	// operations instead of failing immediately
+	GitInteractive bool
+
+	// MaxFileSize is the largest file, in bytes, that can be added without
+	// forcing it. Zero disables the limit.
+	MaxFileSize int64
+
+	// ReadOnly makes every operation that would modify the dotman
+	// directory or the home directory fail instead
+	ReadOnly bool
+
+	// Log records operations to the log file, if one is configured. Nil
+	// disables logging.
+	Log *slog.Logger
+
+	// Settings are the user options loaded from the settings file
+	Settings Settings
 }
 
+const (
+	// DefaultDirMode is the default mode for created directories
+	DefaultDirMode os.FileMode = 0755
+
+	// DefaultFileMode is the default mode for copied files
+	DefaultFileMode os.FileMode = 0644
+
+	// DefaultGitTimeout is the default timeout for git invocations
+	DefaultGitTimeout = 60 * time.Second
+
+	// DefaultMaxFileSize is the default size limit for added files
+	DefaultMaxFileSize int64 = 5 << 20
+)
+
+// Symlink styles for the symlink_style setting
+const (
+	// SymlinkAbsolute links point at the absolute path of the managed file
+	SymlinkAbsolute = "absolute"
+
+	// SymlinkRelative links point at the managed file relative to the link
+	SymlinkRelative = "relative"
+)
+
+// Layouts for the layout setting
+const (
+	// LayoutHomeRelative stores files at their path relative to the home
+	// directory: ~/.config/nvim/init.lua is configs/.config/nvim/init.lua
+	LayoutHomeRelative = "home-relative"
+
+	// LayoutXDGSplit stores files under ~/.config in configs/config and
+	// every other file in configs/home
+	LayoutXDGSplit = "xdg-split"
+
+	// LayoutPackage stores each application's files in its own package
+	// directory, like GNU stow: configs/nvim/.config/nvim/init.lua
+	LayoutPackage = "package"
+)
+
+// Pull strategies for the pull_strategy setting
+const (
+	// PullFFOnly only fast-forwards and fails when histories diverged
+	PullFFOnly = "ff-only"
+
+	// PullRebase rebases local commits onto the remote branch
+	PullRebase = "rebase"
+
+	// PullMerge merges the remote branch, creating a merge commit if needed
+	PullMerge = "merge"
+)
+
 // NewWithoutDirectories creates a new Config without creating directories
 func NewWithoutDirectories() (*Config, error) {
 	homeDir, err := os.UserHomeDir()
@@ -24,19 +115,38 @@ func NewWithoutDirectories() (*Config, error) {
 	configsDir := filepath.Join(dotmanDir, "configs")
 
 	return &Config{
-		HomeDir:    homeDir,
-		DotmanDir:  dotmanDir,
-		ConfigsDir: configsDir,
+		HomeDir:     homeDir,
+		DotmanDir:   dotmanDir,
+		ConfigsDir:  configsDir,
+		StateDir:    xdgDir(homeDir, "XDG_STATE_HOME", filepath.Join(".local", "state")),
+		CacheDir:    xdgDir(homeDir, "XDG_CACHE_HOME", ".cache"),
+		DirMode:     DefaultDirMode,
+		FileMode:    DefaultFileMode,
+		GitTimeout:  DefaultGitTimeout,
+		MaxFileSize: DefaultMaxFileSize,
 	}, nil
 }
 
-// New creates a new Config and ensures all required directories exist
+// New creates a new Config, migrates older directory layouts and ensures all
+// required directories exist
 func New() (*Config, error) {
 	cfg, err := NewWithoutDirectories()
 	if err != nil {
 		return nil, err
 	}
 
+	if err := cfg.Migrate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.LoadSettings(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.migrateBackups(); err != nil {
+		return nil, err
+	}
+
 	if err := cfg.EnsureDirectories(); err != nil {
 		return nil, err
 	}
@@ -44,7 +154,40 @@ func New() (*Config, error) {
 	return cfg, nil
 }
 
-// EnsureDirectories creates necessary directories if they don't exist
+// NewReadOnly creates a Config in read-only mode. Settings are loaded, but
+// the directory layout is neither migrated nor created.
+func NewReadOnly() (*Config, error) {
+	cfg, err := NewWithoutDirectories()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.LoadSettings(); err != nil {
+		return nil, err
+	}
+
+	cfg.ReadOnly = true
+	return cfg, nil
+}
+
+// SetConfigsSubdir moves the configs directory to <subdir>/configs inside
+// the dotman directory and records subdir in the settings. An empty subdir
+// restores the default.
+func (c *Config) SetConfigsSubdir(subdir string) error {
+	if subdir != "" {
+		clean := filepath.Clean(subdir)
+		if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%q must be a directory inside %s", subdir, c.DotmanDir)
+		}
+		subdir = clean
+	}
+	c.Settings.ConfigsSubdir = subdir
+	c.ConfigsDir = filepath.Join(c.DotmanDir, subdir, "configs")
+	return nil
+}
+
+// EnsureDirectories creates necessary directories if they don't exist and
+// records the layout version
 func (c *Config) EnsureDirectories() error {
 	dirs := []string{c.DotmanDir, c.ConfigsDir}
 	for _, dir := range dirs {
@@ -52,5 +195,9 @@ func (c *Config) EnsureDirectories() error {
 			return err
 		}
 	}
+
+	if _, err := os.Stat(c.VersionFile()); os.IsNotExist(err) {
+		return c.WriteLayoutVersion()
+	}
 	return nil
 }
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// LayoutVersion is the version of the on-disk .dotman layout this binary understands
+const LayoutVersion = 2
+
+// versionFileName is the name of the layout version marker in the dotman directory
+const versionFileName = "version"
+
+// migrations upgrade the layout from version i to version i+1
+var migrations = []func(c *Config) error{
+	migrateV0ToV1,
+	migrateV1ToV2,
+}
+
+// VersionFile returns the path of the layout version marker
+func (c *Config) VersionFile() string {
+	return filepath.Join(c.DotmanDir, versionFileName)
+}
+
+// ReadLayoutVersion returns the layout version recorded in the dotman directory.
+// A missing marker means the directory was created before versioning (version 0).
+func (c *Config) ReadLayoutVersion() (int, error) {
+	data, err := os.ReadFile(c.VersionFile())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error reading layout version: %v", err)
+	}
+
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid layout version in %s: %v", c.VersionFile(), err)
+	}
+	return version, nil
+}
+
+// WriteLayoutVersion records the current layout version in the dotman directory
+func (c *Config) WriteLayoutVersion() error {
+	return os.WriteFile(c.VersionFile(), []byte(fmt.Sprintf("%d\n", LayoutVersion)), 0644)
+}
+
+// Migrate upgrades an older dotman directory layout to the current version.
+// It refuses to operate on a layout newer than this binary understands.
+func (c *Config) Migrate() error {
+	// Nothing to migrate in a fresh installation
+	if _, err := os.Stat(c.DotmanDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	version, err := c.ReadLayoutVersion()
+	if err != nil {
+		return err
+	}
+
+	if version > LayoutVersion {
+		return fmt.Errorf("%s uses layout version %d, but this dotman only understands up to version %d. Please upgrade dotman with 'dotman upgrade'", c.DotmanDir, version, LayoutVersion)
+	}
+
+	for ; version < LayoutVersion; version++ {
+		if err := migrations[version](c); err != nil {
+			return fmt.Errorf("error migrating layout from version %d to %d: %v", version, version+1, err)
+		}
+	}
+
+	return c.WriteLayoutVersion()
+}
+
+// migrateV0ToV1 moves backups and health reports that were written directly
+// into the dotman directory into their dedicated subdirectories
+func migrateV0ToV1(c *Config) error {
+	entries, err := os.ReadDir(c.DotmanDir)
+	if err != nil {
+		return err
+	}
+
+	backupsDir := filepath.Join(c.DotmanDir, "backups")
+	healthDir := filepath.Join(c.DotmanDir, "health")
+
+	for _, entry := range entries {
+		path := filepath.Join(c.DotmanDir, entry.Name())
+
+		var destDir string
+		switch {
+		case entry.IsDir() && isBackupDir(path):
+			destDir = backupsDir
+		case !entry.IsDir() && strings.HasPrefix(entry.Name(), "health-check-") && strings.HasSuffix(entry.Name(), ".json"):
+			destDir = healthDir
+		default:
+			continue
+		}
+
+		if err := os.MkdirAll(destDir, 0755); err != nil {
+			return err
+		}
+
+		dest := filepath.Join(destDir, entry.Name())
+		if _, err := os.Stat(dest); err == nil {
+			return fmt.Errorf("cannot move %s: %s already exists", path, dest)
+		}
+		if err := os.Rename(path, dest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateV1ToV2 moves saved health check results out of the dotman
+// directory into HealthDir, as they are local state rather than part of
+// the repository. Results already at the destination are kept.
+func migrateV1ToV2(c *Config) error {
+	src := c.legacyHealthDir()
+	entries, err := os.ReadDir(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dest := c.HealthDir()
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		from := filepath.Join(src, entry.Name())
+		to := filepath.Join(dest, entry.Name())
+		if _, err := os.Stat(to); err == nil {
+			continue
+		}
+		if err := moveFile(from, to); err != nil {
+			return fmt.Errorf("cannot move %s to %s: %v", from, to, err)
+		}
+	}
+
+	// Remove the old directory once it is empty
+	os.Remove(src)
+	return nil
+}
+
+// moveFile renames from to to, copying it when they are on different
+// filesystems, as the state directory may be
+func moveFile(from, to string) error {
+	err := os.Rename(from, to)
+	if err == nil {
+		return nil
+	}
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || !errors.Is(linkErr.Err, syscall.EXDEV) {
+		return err
+	}
+
+	data, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(to, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// isBackupDir reports whether dir looks like a backup (metadata and content)
+func isBackupDir(dir string) bool {
+	for _, name := range []string{"metadata.json", "content"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
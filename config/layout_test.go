@@ -0,0 +1,127 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestConfig returns a Config for a fresh home directory
+func newTestConfig(t *testing.T) *Config {
+	t.Helper()
+
+	home := t.TempDir()
+	return &Config{
+		HomeDir:    home,
+		DotmanDir:  filepath.Join(home, ".dotman"),
+		ConfigsDir: filepath.Join(home, ".dotman", "configs"),
+		StateDir:   filepath.Join(home, ".local", "state", "dotman"),
+		CacheDir:   filepath.Join(home, ".cache", "dotman"),
+		DirMode:    DefaultDirMode,
+		FileMode:   DefaultFileMode,
+	}
+}
+
+// writeTestFile writes content to path, creating its parent directories
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// v0Layout fills the dotman directory of c the way dotman wrote it before
+// layout versions: backups and health reports directly in it
+func v0Layout(t *testing.T, c *Config) {
+	t.Helper()
+
+	backup := filepath.Join(c.DotmanDir, "2024-01-02-150405")
+	writeTestFile(t, filepath.Join(backup, "metadata.json"), "{}\n")
+	writeTestFile(t, filepath.Join(backup, "content"), "old .bashrc\n")
+	writeTestFile(t, filepath.Join(c.DotmanDir, "health-check-2024-01-02-15-04-05.json"), "[]\n")
+
+	// Managed files and directories that only look similar stay in place
+	writeTestFile(t, filepath.Join(c.ConfigsDir, ".bashrc"), "new .bashrc\n")
+	writeTestFile(t, filepath.Join(c.DotmanDir, "notes", "content"), "not a backup\n")
+	writeTestFile(t, filepath.Join(c.DotmanDir, "health-check.txt"), "not a report\n")
+}
+
+func TestMigrateV0ToV1(t *testing.T) {
+	c := newTestConfig(t)
+	v0Layout(t, c)
+
+	if err := migrateV0ToV1(c); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		filepath.Join("backups", "2024-01-02-150405", "metadata.json"),
+		filepath.Join("backups", "2024-01-02-150405", "content"),
+		filepath.Join("health", "health-check-2024-01-02-15-04-05.json"),
+		filepath.Join("configs", ".bashrc"),
+		filepath.Join("notes", "content"),
+		"health-check.txt",
+	} {
+		if _, err := os.Stat(filepath.Join(c.DotmanDir, path)); err != nil {
+			t.Errorf("%s is missing after the migration: %v", path, err)
+		}
+	}
+	for _, path := range []string{"2024-01-02-150405", "health-check-2024-01-02-15-04-05.json"} {
+		if _, err := os.Stat(filepath.Join(c.DotmanDir, path)); !os.IsNotExist(err) {
+			t.Errorf("%s was not moved", path)
+		}
+	}
+}
+
+func TestMigrateV0ToV1RefusesToOverwrite(t *testing.T) {
+	c := newTestConfig(t)
+	v0Layout(t, c)
+	writeTestFile(t, filepath.Join(c.DotmanDir, "backups", "2024-01-02-150405", "content"), "newer\n")
+
+	err := migrateV0ToV1(c)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("migrateV0ToV1() error = %v, want a refusal to overwrite", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.DotmanDir, "2024-01-02-150405", "content")); err != nil {
+		t.Errorf("the backup that could not be moved is gone: %v", err)
+	}
+}
+
+func TestMigrateFromV0(t *testing.T) {
+	c := newTestConfig(t)
+	v0Layout(t, c)
+
+	if err := c.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := c.ReadLayoutVersion(); err != nil || version != LayoutVersion {
+		t.Errorf("layout version = %d, %v; want %d", version, err, LayoutVersion)
+	}
+
+	// Later migrations move the health reports on into the state directory
+	if _, err := os.Stat(filepath.Join(c.HealthDir(), "health-check-2024-01-02-15-04-05.json")); err != nil {
+		t.Errorf("the health report did not reach %s: %v", c.HealthDir(), err)
+	}
+	if _, err := os.Stat(filepath.Join(c.BackupsDir(), "2024-01-02-150405", "content")); err != nil {
+		t.Errorf("the backup did not reach %s: %v", c.BackupsDir(), err)
+	}
+
+	// Migrating again finds nothing to do
+	if err := c.Migrate(); err != nil {
+		t.Errorf("second Migrate() = %v", err)
+	}
+}
+
+func TestMigrateRefusesNewerLayout(t *testing.T) {
+	c := newTestConfig(t)
+	writeTestFile(t, c.VersionFile(), "99\n")
+
+	if err := c.Migrate(); err == nil || !strings.Contains(err.Error(), "upgrade dotman") {
+		t.Errorf("Migrate() error = %v, want a request to upgrade", err)
+	}
+}
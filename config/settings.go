@@ -0,0 +1,244 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// settingsFileName is the name of the settings file in the dotman directory
+const settingsFileName = "config.json"
+
+// Settings holds the user-configurable options stored in ~/.dotman/config.json
+type Settings struct {
+	// LinkBackupDir is where Link moves real files it replaces. Each file is
+	// stored under its home-relative path. Empty uses the backup store.
+	LinkBackupDir string `json:"link_backup_dir,omitempty"`
+
+	// GitTimeout bounds every git invocation, as a duration like "60s".
+	// "0" disables the timeout.
+	GitTimeout string `json:"git_timeout,omitempty"`
+
+	// GitInteractive lets git prompt for credentials on clone, pull and
+	// push instead of failing when none are configured
+	GitInteractive bool `json:"git_interactive,omitempty"`
+
+	// MaxFileSize is the largest file that can be added without --force,
+	// as a size like "5MB". "0" disables the limit.
+	MaxFileSize string `json:"max_file_size,omitempty"`
+
+	// LFSPatterns are .dotmanignore-style patterns for files that are
+	// stored in git-lfs instead of regular git objects
+	LFSPatterns []string `json:"lfs_patterns,omitempty"`
+
+	// AddExcludes are .dotmanignore-style patterns for paths skipped when
+	// adding a directory. Empty uses the default list of version control
+	// and build directories.
+	AddExcludes []string `json:"add_excludes,omitempty"`
+
+	// HealthExclude are .dotmanignore-style patterns for files that the
+	// symlink, conflict and outdated health checks skip
+	HealthExclude []string `json:"health_exclude,omitempty"`
+
+	// SymlinkStyle is "absolute" (default) or "relative" and controls how
+	// links in the home directory point at managed files
+	SymlinkStyle string `json:"symlink_style,omitempty"`
+
+	// PullStrategy is how update integrates remote changes: "ff-only"
+	// (default), "rebase" or "merge"
+	PullStrategy string `json:"pull_strategy,omitempty"`
+
+	// Layout is how managed files are arranged in the configs directory:
+	// "home-relative" (default), "xdg-split" or "package". It only takes
+	// effect for a repository without managed files; the layout a
+	// repository was created with is recorded in it and always wins.
+	Layout string `json:"layout,omitempty"`
+
+	// BackupDir is where the backup store lives. Empty uses
+	// ~/.dotman/backups; a directory outside the repository keeps
+	// backups out of git.
+	BackupDir string `json:"backup_dir,omitempty"`
+
+	// BackupEncrypt is the recipient backups are encrypted to. An age
+	// recipient (age1...) or SSH public key uses age; anything else is
+	// taken as a GPG key ID or email. Empty stores backups in plaintext.
+	BackupEncrypt string `json:"backup_encrypt,omitempty"`
+
+	// BackupCompress gzips the content of every new backup, as if
+	// backup --compress was given
+	BackupCompress bool `json:"backup_compress,omitempty"`
+
+	// BackupIdentity is the age identity file used to decrypt backups on
+	// restore. GPG backups are decrypted with the GPG keyring instead.
+	BackupIdentity string `json:"backup_identity,omitempty"`
+
+	// ConfigsSubdir is the directory inside the dotman directory that holds
+	// configs/, for dotfiles kept in a subdirectory of a larger repository.
+	// Empty keeps configs/ directly in the dotman directory.
+	ConfigsSubdir string `json:"configs_subdir,omitempty"`
+
+	// AddCommitMessage is the text/template for the commit add makes, with
+	// .Path, .Paths, .Count and .Tags. Empty uses "Add {{.Path}}".
+	AddCommitMessage string `json:"add_commit_message,omitempty"`
+
+	// DiffTool is the command 'dotman diff --tool' runs with the managed
+	// file and the home file appended, like "meld" or "code --diff --wait".
+	// Empty uses the diff.tool configured for git.
+	DiffTool string `json:"diff_tool,omitempty"`
+
+	// LogFile is a file every command, the git commands it runs and their
+	// outcomes are appended to, for debugging. Empty disables the log.
+	LogFile string `json:"log_file,omitempty"`
+
+	// Roots maps directories outside the home directory to the top-level
+	// directory in the configs directory that holds their files, like
+	// {"/etc": "__etc__"}. Files under a root are only added and linked
+	// when LinkOutsideHome is set.
+	Roots map[string]string `json:"roots,omitempty"`
+
+	// LinkOutsideHome allows adding files under Roots and linking them
+	// back into place, which usually needs root privileges
+	LinkOutsideHome bool `json:"link_outside_home,omitempty"`
+
+	// GitHubUser is the GitHub login dotman expects the GitHub CLI to be
+	// logged in as. Creating a repository on GitHub is refused for any
+	// other account. Empty accepts any account.
+	GitHubUser string `json:"github_user,omitempty"`
+
+	// LocalOnly records that the repository was created without a remote
+	// on purpose, with 'dotman init --no-remote'. A missing remote is then
+	// not reported as a problem.
+	LocalOnly bool `json:"local_only,omitempty"`
+
+	// CloneDepth records the --depth the repository was cloned with.
+	// Zero means the full history is present.
+	CloneDepth int `json:"clone_depth,omitempty"`
+}
+
+// SettingsFile returns the path of the settings file
+func (c *Config) SettingsFile() string {
+	return filepath.Join(c.DotmanDir, settingsFileName)
+}
+
+// LoadSettings reads the settings file into c.Settings. A missing file
+// leaves the defaults in place.
+func (c *Config) LoadSettings() error {
+	data, err := os.ReadFile(c.SettingsFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading settings: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &c.Settings); err != nil {
+		return fmt.Errorf("error parsing %s: %v", c.SettingsFile(), err)
+	}
+
+	return c.applySettings()
+}
+
+// applySettings copies settings that have a typed counterpart onto the config
+func (c *Config) applySettings() error {
+	if c.Settings.GitTimeout != "" {
+		timeout, err := time.ParseDuration(c.Settings.GitTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid git_timeout %q in %s: %v", c.Settings.GitTimeout, c.SettingsFile(), err)
+		}
+		c.GitTimeout = timeout
+	}
+
+	c.GitInteractive = c.Settings.GitInteractive
+
+	switch c.Settings.SymlinkStyle {
+	case "", SymlinkAbsolute, SymlinkRelative:
+	default:
+		return fmt.Errorf("invalid symlink_style %q in %s: must be %q or %q", c.Settings.SymlinkStyle, c.SettingsFile(), SymlinkAbsolute, SymlinkRelative)
+	}
+
+	switch c.Settings.PullStrategy {
+	case "", PullFFOnly, PullRebase, PullMerge:
+	default:
+		return fmt.Errorf("invalid pull_strategy %q in %s: must be %q, %q or %q", c.Settings.PullStrategy, c.SettingsFile(), PullFFOnly, PullRebase, PullMerge)
+	}
+
+	switch c.Settings.Layout {
+	case "", LayoutHomeRelative, LayoutXDGSplit, LayoutPackage:
+	default:
+		return fmt.Errorf("invalid layout %q in %s: must be %q, %q or %q", c.Settings.Layout, c.SettingsFile(), LayoutHomeRelative, LayoutXDGSplit, LayoutPackage)
+	}
+
+	if c.Settings.ConfigsSubdir != "" {
+		if err := c.SetConfigsSubdir(c.Settings.ConfigsSubdir); err != nil {
+			return fmt.Errorf("invalid configs_subdir in %s: %v", c.SettingsFile(), err)
+		}
+	}
+
+	if err := ValidateRoots(c.HomeDir, c.Settings.Roots); err != nil {
+		return fmt.Errorf("invalid roots in %s: %v", c.SettingsFile(), err)
+	}
+
+	if c.Settings.MaxFileSize != "" {
+		size, err := ParseSize(c.Settings.MaxFileSize)
+		if err != nil {
+			return fmt.Errorf("invalid max_file_size in %s: %v", c.SettingsFile(), err)
+		}
+		c.MaxFileSize = size
+	}
+
+	return nil
+}
+
+// SaveSettings writes c.Settings to the settings file
+func (c *Config) SaveSettings() error {
+	data, err := json.MarshalIndent(c.Settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding settings: %v", err)
+	}
+
+	return os.WriteFile(c.SettingsFile(), data, 0644)
+}
+
+// ExpandHome expands a leading ~ in path to the home directory
+func (c *Config) ExpandHome(path string) string {
+	if path == "~" {
+		return c.HomeDir
+	}
+	if len(path) > 1 && path[0] == '~' && path[1] == '/' {
+		return filepath.Join(c.HomeDir, path[2:])
+	}
+	return path
+}
+
+// IsRootName reports whether name has the form of a root's directory in
+// the configs directory, __<name>__. The form keeps those directories
+// apart from directories of the home directory, also on machines where the
+// root is not configured.
+func IsRootName(name string) bool {
+	return len(name) > 4 && strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__")
+}
+
+// ValidateRoots checks that every root is an absolute directory outside
+// homeDir with its own root name in the configs directory
+func ValidateRoots(homeDir string, roots map[string]string) error {
+	names := make(map[string]string)
+	for dir, name := range roots {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("%s is not an absolute path", dir)
+		}
+		if rel, err := filepath.Rel(homeDir, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("%s is inside the home directory", dir)
+		}
+		if !IsRootName(name) || strings.ContainsRune(name, filepath.Separator) {
+			return fmt.Errorf("%q for %s must be a directory name between double underscores, like \"__etc__\"", name, dir)
+		}
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("%s and %s are both stored as %q", other, dir, name)
+		}
+		names[name] = dir
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps size suffixes to their multiplier, longest suffix first so
+// that "MB" is matched before "B"
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a human-readable size like "5MB", "512K" or "1048576"
+// into bytes. Units are binary, so "1KB" is 1024 bytes.
+func ParseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(str, unit.suffix) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: must be a number with an optional unit like 5MB", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatSize formats a byte count for display, e.g. 5242880 as "5.0MB"
+func FormatSize(bytes int64) string {
+	for _, unit := range sizeUnits[:3] {
+		if bytes >= unit.bytes {
+			return fmt.Sprintf("%.1f%s", float64(bytes)/float64(unit.bytes), unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", bytes)
+}
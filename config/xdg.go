@@ -0,0 +1,47 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// xdgDir returns $<env>/dotman, or <fallback>/dotman under the home
+// directory when the variable is unset or, against the XDG Base Directory
+// specification, not an absolute path
+func xdgDir(homeDir, env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "dotman")
+	}
+	return filepath.Join(homeDir, fallback, "dotman")
+}
+
+// HealthDir returns the directory saved health check results are kept in.
+// They are local state rather than part of the repository, so they live
+// under StateDir.
+func (c *Config) HealthDir() string {
+	return filepath.Join(c.StateDir, "health")
+}
+
+// backupsDirStateFile records the backup store the previous run used, so
+// backups can be moved when backup_dir changes
+func (c *Config) backupsDirStateFile() string {
+	return filepath.Join(c.StateDir, "backup_dir")
+}
+
+// UpgradeCacheDir returns the directory 'dotman upgrade' downloads release
+// archives to, so an interrupted download can be resumed
+func (c *Config) UpgradeCacheDir() string {
+	return filepath.Join(c.CacheDir, "upgrade")
+}
+
+// CompletionCacheFile returns the file shell completion caches managed
+// files and backup IDs in between key presses
+func (c *Config) CompletionCacheFile() string {
+	return filepath.Join(c.CacheDir, "completion.json")
+}
+
+// legacyHealthDir is where health check results were saved before layout
+// version 2
+func (c *Config) legacyHealthDir() string {
+	return filepath.Join(c.DotmanDir, "health")
+}
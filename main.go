@@ -2,14 +2,25 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"cli-config-manager/config"
 	"cli-config-manager/manager"
@@ -19,6 +30,7 @@ import (
 	"io"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var (
@@ -29,6 +41,168 @@ var (
 
 var verbose bool
 
+var upgradeChangelogFlag bool
+
+var (
+	reverseImportAllFlag    bool
+	reverseImportDryRunFlag bool
+)
+
+var reconcileChooseFlag string
+
+var (
+	mirrorToFlag       string
+	mirrorApplyFlag    bool
+	mirrorFailFastFlag bool
+	mirrorForceFlag    bool
+)
+
+var (
+	removeRestoreFlag bool
+	removeNoPruneFlag bool
+)
+
+var gitTimeoutFlag time.Duration
+
+var gitInteractiveFlag bool
+
+var readOnlyFlag bool
+
+var jsonFlag bool
+
+var logFlag string
+
+// opLog records the command being run, the git commands it runs and their
+// outcomes when --log or the log_file setting names a log file
+var (
+	opLog      *slog.Logger
+	opLogFile  io.Closer
+	opLogStart time.Time
+)
+
+// readOnlyAnnotation marks commands that never modify anything and so can
+// run in read-only mode. Commands without it are refused.
+const readOnlyAnnotation = "dotman/read-only"
+
+// writesAnnotation marks read-only commands that still modify files outside
+// read-only mode, such as check saving its results, so they take the lock
+const writesAnnotation = "dotman/writes"
+
+// dotmanLock is held while a command that modifies the dotman directory runs
+var dotmanLock *manager.Lock
+
+var (
+	dirModeFlag  string
+	fileModeFlag string
+)
+
+var (
+	initFromDirFlag string
+	initLinkFlag    bool
+	initDepthFlag   int
+
+	initConfigsSubdirFlag string
+	initVerifyRemoteFlag  bool
+	initGitHubUserFlag    string
+	initNoRemoteFlag      bool
+)
+
+var (
+	addFromFlag       string
+	addForceFlag      bool
+	addStdinFlag      bool
+	addTargetFlag     string
+	addRenameFlag     bool
+	addIncludeVCSFlag bool
+	addFollowFlag     bool
+	addKeepLinkFlag   bool
+	addDerefFlag      bool
+	addMessageFlag    string
+)
+
+var (
+	linkBackupDirFlag   string
+	linkFailFastFlag    bool
+	linkTargetHomeFlag  string
+	linkInteractiveFlag bool
+	linkForceFlag       bool
+	linkSymlinksOnly    bool
+)
+
+var docsFormatFlag string
+
+var (
+	diffRemoteFlag bool
+	diffToolFlag   bool
+	diffBackupFlag bool
+)
+
+var (
+	exportSinceFlag  string
+	exportFormatFlag string
+)
+
+var (
+	updateNoRelinkFlag bool
+	updatePruneFlag    bool
+	updateRebaseFlag   bool
+	updateMergeFlag    bool
+	updateDryRunFlag   bool
+)
+
+var (
+	checkNoEmojiFlag bool
+	checkOutputFlag  string
+	checkFailOnFlag  string
+	checkExcludeFlag string
+	checkReportFlag  string
+	checkFormatFlag  string
+	checkSaveFlag    bool
+	checkNoSaveFlag  bool
+	checkParallel    int
+)
+
+// Exit codes of 'dotman check'. Any other failure of dotman exits with 1.
+const (
+	exitHealthWarning = 2
+	exitHealthError   = 3
+)
+
+var (
+	listBrokenFlag    bool
+	listConflictsFlag bool
+	listNotesFlag     bool
+	listTreeFlag      bool
+	listDepthFlag     int
+	listWatchFlag     bool
+	listIntervalFlag  time.Duration
+)
+
+var (
+	restoreLatestFlag     bool
+	restoreAuthorDateFlag bool
+	restoreDryRunFlag     bool
+	restoreStdoutFlag     bool
+	restoreSessionFlag    string
+	restoreForceFlag      bool
+)
+
+var (
+	backupCompressFlag bool
+	backupNoteFlag     string
+)
+
+var (
+	commitSummaryFlag bool
+	commitYesFlag     bool
+)
+
+var (
+	gcDryRunFlag     bool
+	gcKeepHealthFlag int
+	gcYesFlag        bool
+)
+
 var rootCmd = &cobra.Command{
 	Use:   "dotman",
 	Short: "A better dotfile manager",
@@ -45,6 +219,19 @@ dotman helps you:
 
 For more information about a command, use 'dotman help <command>'.`,
 	Version: fmt.Sprintf("dotman version %s (commit: %s, built: %s)", version, commit, date),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		openOperationLog(cmd)
+		if readOnlyMode() && !allowedInReadOnly(cmd) {
+			fatalf(manager.CodeReadOnly, "'dotman %s' modifies files and cannot run in read-only mode (--read-only or DOTMAN_READONLY)", cmd.Name())
+		}
+		lockDotmanDir(cmd)
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		if dotmanLock != nil {
+			dotmanLock.Unlock()
+		}
+		closeOperationLog(0, "")
+	},
 }
 
 var initCmd = &cobra.Command{
@@ -61,76 +248,254 @@ This command will:
 4. Initialize git and push the initial commit (if creating new)
 5. Link all configuration files
 
+With --from-dir, init imports a local folder of dotfiles instead of using a
+GitHub repository. The folder is either laid out like your home directory
+(e.g. .bashrc, .config/nvim/init.lua) or is a dotman directory containing
+configs/. The files are copied into ~/.dotman/configs and committed to a new
+local git repository; add a remote later with 'git remote add'. Pass --link
+to link the imported files right away.
+
+With --depth, an existing repository is cloned with only that many commits
+of history, which is much faster for large repositories. Commit, push and
+update keep working; run 'dotman unshallow' to fetch the full history later.
+
+With --configs-subdir, the existing repository is a larger one, such as a
+personal monorepo, that keeps the dotfiles in a subdirectory: managed files
+live in <subdir>/configs and the repository's own .gitignore is left alone.
+The setting is saved as configs_subdir in ~/.dotman/config.json.
+
+When a new repository is created, init first checks which account the
+GitHub CLI is logged in as. With --github-user, it refuses to create the
+repository under any other account, which matters when gh is logged in to
+several; the login is saved as github_user for 'dotman whoami'.
+
+With --no-remote, the new repository stays on this machine: init commits the
+scaffolding on main but creates nothing on GitHub and pushes nothing, so gh
+is not needed. This is saved as local_only, and 'dotman check' then reports
+the missing remote as information instead of an error. Add a remote later
+with 'git remote add'.
+
+After cloning, init checks that the repository looks like a dotman
+repository: it should have a configs/ directory and not look like a
+software project (go.mod, package.json and the like). Problems are printed
+as warnings before configs/ is created. With --verify-remote, init instead
+asks whether to scaffold the repository, and removes the clone when you
+decline or when there is no terminal to ask on, so a wrong URL does not
+leave a confusing state behind.
+
+For scripted setups, init runs without prompts when these are set:
+  DOTMAN_INIT_MODE  'existing' or 'new'
+  DOTMAN_REPO_URL   repository to clone (implies 'existing')
+  DOTMAN_REPO_NAME  name of the new GitHub repository (default 'configs')
+
 Examples:
   # Create a new repository
   dotman init
 
   # Use an existing repository
-  dotman init  # Then choose 'y' and enter the URL when prompted`,
+  dotman init  # Then choose 'y' and enter the URL when prompted
+
+  # Non-interactive setup
+  DOTMAN_REPO_URL=github.com/user/configs.git dotman init
+
+  # Version the dotfiles locally, without GitHub
+  DOTMAN_INIT_MODE=new dotman init --no-remote
+
+  # Shallow clone of a large repository
+  DOTMAN_REPO_URL=github.com/user/configs.git dotman init --depth 1
+
+  # Clone a monorepo that keeps the dotfiles in dotfiles/configs
+  DOTMAN_REPO_URL=github.com/user/monorepo.git dotman init --configs-subdir dotfiles
+
+  # Import a local dotfiles folder and link it
+  dotman init --from-dir ~/dotfiles --link`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Create config without ensuring directories
 		cfg, err := config.NewWithoutDirectories()
 		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
+			fatal(err, "Error creating config")
+		}
+		applyGlobalFlags(cfg)
+
+		if initDepthFlag < 0 {
+			fatalf(manager.CodeInvalidArgument, "--depth must not be negative")
 		}
 
 		// Check if directory exists and is not empty
 		if entries, err := os.ReadDir(cfg.DotmanDir); err == nil && len(entries) > 0 {
-			fmt.Printf("Error: %s is not empty. Please remove it first or use a different directory.\n", cfg.DotmanDir)
-			os.Exit(1)
+			fatalf(manager.CodeInvalidArgument, "%s is not empty. Please remove it first or use a different directory.", cfg.DotmanDir)
+		}
+
+		if initFromDirFlag != "" {
+			if initConfigsSubdirFlag != "" {
+				fatalf(manager.CodeInvalidArgument, "--configs-subdir can only be used when cloning an existing repository")
+			}
+			initFromDir(cmd, cfg)
+			return
+		}
+
+		if err := cfg.SetConfigsSubdir(initConfigsSubdirFlag); err != nil {
+			fatalf(manager.CodeInvalidArgument, "invalid --configs-subdir: %v", err)
+		}
+
+		// Decide between interactive prompts and environment configuration
+		initMode := strings.ToLower(strings.TrimSpace(os.Getenv("DOTMAN_INIT_MODE")))
+		repoURL := strings.TrimSpace(os.Getenv("DOTMAN_REPO_URL"))
+		if initMode == "" && repoURL != "" {
+			initMode = "existing"
+		}
+		if initMode == "" && initNoRemoteFlag {
+			initMode = "new"
+		}
+
+		switch initMode {
+		case "", "existing", "new":
+		default:
+			fatalf(manager.CodeInvalidArgument, "invalid DOTMAN_INIT_MODE %q (expected 'existing' or 'new')", initMode)
+		}
+
+		interactive := initMode == "" || (initMode == "existing" && repoURL == "")
+		if interactive && !isTerminal(os.Stdin) {
+			fatalf(manager.CodeInvalidArgument, "stdin is not a terminal, so dotman init cannot prompt for input.\n"+
+				"Set DOTMAN_INIT_MODE=existing with DOTMAN_REPO_URL, or DOTMAN_INIT_MODE=new, to run non-interactively.")
 		}
 
 		// Create the directory
 		if err := os.MkdirAll(cfg.DotmanDir, 0755); err != nil {
-			fmt.Printf("Error creating directory: %v\n", err)
-			os.Exit(1)
+			fatal(err, "Error creating directory")
 		}
 
 		fmt.Println("Initialized dotman repository at:", cfg.DotmanDir)
 
 		reader := bufio.NewReader(os.Stdin)
-		fmt.Print("Do you want to use an existing repository? (y/N): ")
-		useExisting, _ := reader.ReadString('\n')
-		useExisting = strings.TrimSpace(strings.ToLower(useExisting))
+		if initMode == "" {
+			fmt.Print("Do you want to use an existing repository? (y/N): ")
+			useExisting, _ := reader.ReadString('\n')
+			if strings.TrimSpace(strings.ToLower(useExisting)) == "y" {
+				initMode = "existing"
+			} else {
+				initMode = "new"
+			}
+		}
+		if initMode == "new" && initConfigsSubdirFlag != "" {
+			fatalf(manager.CodeInvalidArgument, "--configs-subdir can only be used when cloning an existing repository")
+		}
+		if initMode == "existing" && initGitHubUserFlag != "" {
+			fatalf(manager.CodeInvalidArgument, "--github-user can only be used when creating a new repository")
+		}
+		if initMode == "existing" && initNoRemoteFlag {
+			fatalf(manager.CodeInvalidArgument, "--no-remote can only be used when creating a new repository")
+		}
 
-		m := manager.New(cfg)
+		m := manager.NewWithLogger(cfg, os.Stdout)
 
-		if useExisting == "y" {
-			fmt.Print("Enter the repository URL (e.g., github.com/user/repo.git): ")
-			repoURL, _ := reader.ReadString('\n')
-			repoURL = strings.TrimSpace(repoURL)
+		if initMode == "existing" {
+			if repoURL == "" {
+				fmt.Print("Enter the repository URL (e.g., github.com/user/repo.git): ")
+				repoURL, _ = reader.ReadString('\n')
+				repoURL = strings.TrimSpace(repoURL)
+			}
 
-			// Add https:// if not present
-			if !strings.HasPrefix(repoURL, "http://") && !strings.HasPrefix(repoURL, "https://") {
+			// Add https:// if no scheme is present and it is not an SSH address
+			if !strings.Contains(repoURL, "://") && !strings.HasPrefix(repoURL, "git@") {
 				repoURL = "https://" + repoURL
 			}
 
-			if err := m.InitializeFromExistingRepo(repoURL); err != nil {
-				fmt.Printf("Error initializing from existing repository: %v\n", err)
-				os.Exit(1)
+			opts := manager.CloneOptions{
+				Depth:           initDepthFlag,
+				VerifyRemote:    initVerifyRemoteFlag,
+				ConfirmScaffold: confirmScaffold,
+			}
+			if err := m.InitializeFromExistingRepoWith(repoURL, opts); err != nil {
+				if errors.Is(err, errScaffoldDeclined) {
+					fmt.Println("Removed the clone; check the repository URL and run 'dotman init' again")
+					exit(1)
+				}
+				fatal(err, "Error initializing from existing repository")
+			}
+
+			// Remember the shallow clone so 'dotman unshallow' can undo it,
+			// and where the dotfiles live in the repository
+			if initDepthFlag > 0 || initConfigsSubdirFlag != "" {
+				cfg.Settings.CloneDepth = initDepthFlag
+				if err := cfg.SaveSettings(); err != nil {
+					fmt.Printf("Warning: failed to save settings: %v\n", err)
+				}
 			}
 			fmt.Printf("Successfully initialized from repository: %s\n", repoURL)
 		} else {
-			// Ask for repository name
-			fmt.Print("Enter GitHub repository name (press Enter to use 'configs'): ")
-			repoName, _ := reader.ReadString('\n')
-			repoName = strings.TrimSpace(repoName)
+			repoName := strings.TrimSpace(os.Getenv("DOTMAN_REPO_NAME"))
+			if repoName == "" && interactive && !initNoRemoteFlag {
+				// Ask for repository name
+				fmt.Print("Enter GitHub repository name (press Enter to use 'configs'): ")
+				repoName, _ = reader.ReadString('\n')
+				repoName = strings.TrimSpace(repoName)
+			}
 
 			// Use "configs" as default if no name provided
 			if repoName == "" {
 				repoName = "configs"
 			}
 
-			if err := m.InitializeGitRepo(repoName); err != nil {
-				fmt.Printf("Error initializing git repository: %v\n", err)
-				os.Exit(1)
+			cfg.Settings.GitHubUser = initGitHubUserFlag
+			cfg.Settings.LocalOnly = initNoRemoteFlag
+			if err := m.InitializeGitRepoWith(repoName, manager.InitOptions{NoRemote: initNoRemoteFlag}); err != nil {
+				fatal(err, "Error initializing git repository")
+			}
+			if initGitHubUserFlag != "" || initNoRemoteFlag {
+				if err := cfg.SaveSettings(); err != nil {
+					fmt.Printf("Warning: failed to save settings: %v\n", err)
+				}
+			}
+			if initNoRemoteFlag {
+				fmt.Println("Successfully initialized a local repository without a remote")
+			} else {
+				fmt.Printf("Successfully created and initialized GitHub repository: %s\n", repoName)
 			}
-			fmt.Printf("Successfully created and initialized GitHub repository: %s\n", repoName)
+		}
+
+		// Record the layout version of the new dotman directory
+		if err := cfg.EnsureDirectories(); err != nil {
+			fatal(err, "Error finalizing dotman directory")
 		}
 	},
 }
 
+// initFromDir runs init --from-dir, importing a local dotfiles folder
+func initFromDir(cmd *cobra.Command, cfg *config.Config) {
+	if err := os.MkdirAll(cfg.DotmanDir, 0755); err != nil {
+		fatal(err, "Error creating directory")
+	}
+
+	m := manager.NewWithLogger(cfg, os.Stdout)
+	count, err := m.InitializeFromDir(initFromDirFlag)
+	if err != nil {
+		fatal(err, "Error importing from %s", initFromDirFlag)
+	}
+
+	// Record the layout version of the new dotman directory
+	if err := cfg.EnsureDirectories(); err != nil {
+		fatal(err, "Error finalizing dotman directory")
+	}
+
+	fmt.Printf("Imported %d file(s) from %s\n", count, initFromDirFlag)
+
+	if initNoRemoteFlag {
+		cfg.Settings.LocalOnly = true
+		if err := cfg.SaveSettings(); err != nil {
+			fmt.Printf("Warning: failed to save settings: %v\n", err)
+		}
+	}
+
+	if initLinkFlag {
+		links, err := m.Link(cmd.Context(), manager.LinkOptions{})
+		printLinks(links)
+		if err != nil {
+			fatal(err, "Error linking files")
+		}
+	}
+}
+
 var addCmd = &cobra.Command{
 	Use:   "add [file]",
 	Short: "Add a new configuration file to manage",
@@ -143,28 +508,185 @@ This command will:
 
 The file path can be absolute or relative to your home directory.
 
+With --from, paths are read one per line from a file (or stdin with '-').
+Blank lines and anything after a '#' are ignored, so the output of
+'dotman suggest' can be piped in directly.
+
+With --stdin, the content of the file is read from stdin instead, which is
+useful for generated configs. --target names the path in your home
+directory the content belongs to; it is written into the dotman repository,
+linked there and committed. A real file already at the target is backed up,
+or with --rename-on-conflict kept next to it as <name>.dotman-orig-<time>;
+'dotman remove --restore' moves it back.
+
+Adding a directory adds every file in it, each linked on its own, in one
+commit. Version control and build directories such as .git and node_modules
+are skipped, with a warning when the directory is itself a git repository;
+pass --include-vcs to add them too. Set add_excludes in
+~/.dotman/config.json to change what is skipped.
+
+A path that is already a symlink to somewhere else can be managed two ways:
+--follow-symlink stores the content it points to, like any other file, and
+--keep-symlink stores the link itself, so the repository records where it
+points and the file it points to is left alone. Without either flag dotman
+asks, or fails when stdin is not a terminal. --dereference is like
+--follow-symlink, but the managed copy also keeps the permissions of the
+file at the end of the link chain, and symlinks to files inside an added
+directory are stored as regular files instead of being skipped.
+
+Files larger than max_file_size (default 5MB) are refused so they do not
+bloat the git history; pass --force to add them anyway. Files that look
+binary are added with a warning.
+
+Each add is committed as "Add <path>". --commit-message, or the
+add_commit_message setting, replaces that with a Go template that can use
+{{.Path}} (the file or directory added), {{.Count}} and {{.Paths}} (the
+files in the commit) and {{.Tags}} (the tags 'dotman docs' detects).
+
 Examples:
   dotman add ~/.bashrc
   dotman add ~/.config/i3/config
-  dotman add .vimrc`,
-	Args: cobra.ExactArgs(1),
+  dotman add .vimrc
+  dotman add ~/.config/nvim
+  dotman suggest | dotman add --from -
+  dotman add --force ~/.local/share/fonts/custom.ttf
+  dotman add --keep-symlink ~/.config/monitors.xml
+  dotman add --commit-message "Add {{.Path}} ({{.Count}} files)" ~/.config/nvim
+  generate-config | dotman add --stdin --target ~/.config/tool/config
+  generate-config | dotman add --stdin --rename-on-conflict --target ~/.config/tool/config`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if addFromFlag != "" || addStdinFlag {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
+		cfg, err := loadConfig()
 		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
+			fatal(err, "Error creating config")
 		}
 
-		m := manager.New(cfg)
-		if err := m.AddFile(args[0]); err != nil {
-			fmt.Printf("Error adding file: %v\n", err)
-			os.Exit(1)
+		if err := applyModeFlags(cfg); err != nil {
+			fatal(err, "Error")
+		}
+
+		if addStdinFlag {
+			addFromStdin(cfg)
+			return
+		}
+		if addTargetFlag != "" {
+			fatalf(manager.CodeInvalidArgument, "--target can only be used with --stdin")
+		}
+		if addRenameFlag {
+			// Adding a file replaces that very file, so only --stdin can
+			// find a different file in the way
+			fatalf(manager.CodeInvalidArgument, "--rename-on-conflict can only be used with --stdin")
+		}
+
+		paths := args
+		if addFromFlag != "" {
+			paths, err = readPathList(addFromFlag)
+			if err != nil {
+				fatal(err, "Error reading paths")
+			}
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		failed := 0
+		var skipped []string
+		for _, path := range paths {
+			opts := manager.AddOptions{Force: addForceFlag, IncludeVCS: addIncludeVCSFlag, Symlink: addSymlinkMode(), CommitMessage: addMessageFlag}
+			err := m.AddFileWith(path, opts)
+			if errors.Is(err, manager.ErrIsSymlink) && isTerminal(os.Stdin) {
+				if opts.Symlink, err = askSymlinkMode(err); err == nil {
+					err = m.AddFileWith(path, opts)
+				}
+			}
+			if err != nil {
+				if errors.Is(err, manager.ErrFileTooLarge) {
+					skipped = append(skipped, path)
+				}
+				switch {
+				case jsonFlag:
+					printJSONError(manager.ErrorCodeOf(err), fmt.Sprintf("%s: %v", path, err))
+				case errors.Is(err, manager.ErrFileTooLarge):
+					fmt.Printf("Skipped %s: %v\n", path, err)
+				default:
+					fmt.Printf("Error adding file %s: %v\n", path, err)
+				}
+				failed++
+				continue
+			}
+			fmt.Printf("Successfully added %s to managed files\n", path)
+		}
+
+		if len(skipped) > 1 && !jsonFlag {
+			fmt.Printf("Skipped %d files above the size limit: %s\n", len(skipped), strings.Join(skipped, ", "))
 		}
 
-		fmt.Printf("Successfully added %s to managed files\n", args[0])
+		if failed > 0 {
+			exit(1)
+		}
 	},
 }
 
+// addSymlinkMode returns how add treats symlinks according to its flags
+func addSymlinkMode() manager.SymlinkMode {
+	switch {
+	case addFollowFlag:
+		return manager.SymlinkFollow
+	case addKeepLinkFlag:
+		return manager.SymlinkKeep
+	case addDerefFlag:
+		return manager.SymlinkDereference
+	}
+	return manager.SymlinkAsk
+}
+
+// askSymlinkMode asks whether to manage the content a symlink points to or
+// the link itself. reason is the error describing the symlink.
+func askSymlinkMode(reason error) (manager.SymlinkMode, error) {
+	fmt.Println(reason)
+	fmt.Print("Manage the [c]ontent it points to or the [l]ink itself? [c/l/N]: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	switch strings.TrimSpace(strings.ToLower(response)) {
+	case "c", "content":
+		return manager.SymlinkFollow, nil
+	case "l", "link":
+		return manager.SymlinkKeep, nil
+	}
+	return manager.SymlinkAsk, fmt.Errorf("skipped symlink (use --follow-symlink or --keep-symlink)")
+}
+
+// addFromStdin runs add --stdin, managing content piped into dotman
+func addFromStdin(cfg *config.Config) {
+	if addFromFlag != "" {
+		fatalf(manager.CodeInvalidArgument, "--stdin cannot be combined with --from")
+	}
+	if addTargetFlag == "" {
+		fatalf(manager.CodeInvalidArgument, "--stdin requires --target with the path the content belongs to")
+	}
+	if isTerminal(os.Stdin) {
+		fatalf(manager.CodeInvalidArgument, "--stdin expects content piped into dotman, but stdin is a terminal")
+	}
+
+	content, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fatal(err, "Error reading stdin")
+	}
+
+	m := manager.NewWithLogger(cfg, os.Stdout)
+	if err := m.AddContent(addTargetFlag, content, manager.AddOptions{Force: addForceFlag, RenameOnConflict: addRenameFlag, CommitMessage: addMessageFlag}); err != nil {
+		if errors.Is(err, manager.ErrEmptyContent) {
+			fatalf(manager.CodeEmptyContent, "stdin was empty, nothing to add")
+		}
+		fatal(err, "Error adding %s", addTargetFlag)
+	}
+	fmt.Printf("Successfully added %s to managed files\n", addTargetFlag)
+}
+
 var linkCmd = &cobra.Command{
 	Use:   "link",
 	Short: "Link all managed configuration files",
@@ -181,650 +703,3754 @@ Use this command after:
 - Pulling changes from remote
 - Adding new files
 
-Example:
-  dotman link`,
+Parent directories are created with --dir-mode (default 0755). Sensitive
+directories like ~/.ssh and ~/.gnupg always use 0700.
+
+Real files that are replaced by a link are backed up first. By default they
+go to the backup store (see 'dotman restore'). With --backup-dir, or the
+link_backup_dir setting in ~/.dotman/config.json, they are copied to that
+directory under their home-relative path instead.
+
+A directory with content where a file should be linked is likely your data,
+so it is never replaced by default; the file fails to link instead. With
+--force-link the files in the directory are backed up, as one backup
+session or into the backup directory, and the directory is replaced by
+the link. Empty directories are replaced without asking.
+
+With --overwrite-symlinks-only, link only creates links where nothing
+exists and replaces links that already point into ~/.dotman/configs. Real
+files, directories and symlinks pointing elsewhere are skipped and listed
+at the end, so nothing that is not dotman's is removed. Use it to relink a
+home directory you do not trust.
+
+With --target-home, links are created under another directory instead of
+your home directory, for example a mounted root filesystem being provisioned
+or a scratch directory for testing. The links still point at the files in
+~/.dotman/configs.
+
+A file that cannot be linked does not stop the others. Every failure is
+reported at the end and the command exits non-zero. Use --fail-fast to stop
+at the first failure instead.
+
+With --interactive, you are asked about every file before it is linked:
+  y  link this file
+  n  skip this file
+  a  link this file and all remaining files without asking
+  q  stop; the remaining files are not linked
+This needs a terminal to ask on.
+
+Examples:
+  dotman link
+  dotman link --interactive
+  dotman link --fail-fast
+  dotman link --force-link
+  dotman link --overwrite-symlinks-only
+  dotman link --dir-mode 0750
+  dotman link --backup-dir ~/dotman-displaced
+  dotman link --target-home /mnt/newroot/home/user`,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
+		cfg, err := loadConfig()
 		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
+			fatal(err, "Error creating config")
 		}
 
-		m := manager.New(cfg)
-		if err := m.Link(); err != nil {
-			fmt.Printf("Error linking files: %v\n", err)
-			os.Exit(1)
+		if err := applyModeFlags(cfg); err != nil {
+			fatal(err, "Error")
+		}
+
+		if linkBackupDirFlag != "" {
+			cfg.Settings.LinkBackupDir = linkBackupDirFlag
+		}
+
+		if linkTargetHomeFlag != "" {
+			if err := applyTargetHome(cfg, "--target-home", linkTargetHomeFlag); err != nil {
+				fatal(err, "Error")
+			}
+		}
+
+		opts := manager.LinkOptions{FailFast: linkFailFastFlag, ForceLink: linkForceFlag, SymlinksOnly: linkSymlinksOnly}
+		var skipped []string
+		opts.Skipped = func(relPath, reason string) {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", relPath, reason))
+		}
+		if linkInteractiveFlag {
+			if !isTerminal(os.Stdin) {
+				fatalf(manager.CodeInvalidArgument, "--interactive needs a terminal on stdin to ask which files to link")
+			}
+			opts.Select = newLinkSelector()
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		links, err := m.Link(cmd.Context(), opts)
+		printLinks(links)
+		fmt.Printf("Linked %d file(s)\n", len(links))
+		if len(skipped) > 0 {
+			fmt.Printf("Skipped %d file(s) that are not dotman's to replace:\n", len(skipped))
+			for _, file := range skipped {
+				fmt.Printf("  %s\n", file)
+			}
+		}
+		if errors.Is(err, errLinkQuit) {
+			fmt.Println("Stopped; the remaining files were not linked")
+			return
+		}
+		if err != nil {
+			fatal(err, "Error linking files")
 		}
 
+		if linkInteractiveFlag {
+			fmt.Println("Successfully linked the selected files")
+			return
+		}
+		if len(skipped) > 0 {
+			fmt.Println("Successfully linked every file that was safe to link")
+			return
+		}
 		fmt.Println("Successfully linked all managed files")
 	},
 }
 
-var listCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all managed configuration files",
-	Long: `Display a list of all configuration files currently being managed by dotman.
+// errLinkQuit is returned by the link selector when the user quits
+var errLinkQuit = errors.New("linking stopped")
+
+// newLinkSelector returns a LinkOptions.Select that asks on the terminal
+// whether to link each file. After 'a' it links the rest without asking.
+func newLinkSelector() func(relPath string) (bool, error) {
+	reader := bufio.NewReader(os.Stdin)
+	all := false
+	return func(relPath string) (bool, error) {
+		if all {
+			return true, nil
+		}
+		for {
+			fmt.Printf("Link %s? [y/n/a/q]: ", relPath)
+			response, err := reader.ReadString('\n')
+			switch strings.TrimSpace(strings.ToLower(response)) {
+			case "y", "yes":
+				return true, nil
+			case "n", "no":
+				return false, nil
+			case "a", "all":
+				all = true
+				return true, nil
+			case "q", "quit":
+				return false, errLinkQuit
+			}
+			// Treat the end of input like quitting rather than asking forever
+			if err != nil {
+				fmt.Println()
+				return false, errLinkQuit
+			}
+			fmt.Println("Please answer y (link), n (skip), a (link all remaining) or q (quit)")
+		}
+	}
+}
 
-This command will:
-1. Scan the dotman repository
-2. Show all files being managed
-3. Display their relative paths
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Audit the dotman repository",
+	Long: `Audit the dotman repository for problems that checks of the working tree
+cannot find.`,
+}
 
-Use this command to:
-- Check which files are being managed
-- Verify your configuration
-- Plan your next changes
+var auditSecretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Find secrets committed anywhere in the history",
+	Long: `Scan every line ever added to the dotman repository, on all branches and
+tags, for credentials: private keys, AWS, GitHub, Slack and Google tokens,
+and assignments of passwords, secrets, API keys and tokens.
 
-Example:
-  dotman list`,
+Each finding names the commit that added the line, the file and line
+number, and the start of the match; the rest is masked. The command exits
+with status 1 when anything is found.
+
+Deleting a file or line in a new commit does not remove it from the
+history. Treat every finding as leaked and rotate it, then rewrite the
+history, for example with git filter-repo, and force-push.
+
+Examples:
+  dotman audit secrets
+  dotman audit secrets --json`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
+		cfg, err := loadConfig()
 		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
+			fatal(err, "Error creating config")
 		}
 
-		m := manager.New(cfg)
-		files, err := m.ListFiles()
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		findings, err := m.AuditSecrets()
 		if err != nil {
-			fmt.Printf("Error listing files: %v\n", err)
-			os.Exit(1)
+			fatal(err, "Error auditing history")
 		}
 
-		if len(files) == 0 {
-			fmt.Println("No files are currently being managed")
-			return
+		if jsonFlag {
+			if findings == nil {
+				findings = []manager.SecretFinding{}
+			}
+			data, err := json.MarshalIndent(findings, "", "  ")
+			if err != nil {
+				fatal(err, "Error encoding JSON")
+			}
+			fmt.Println(string(data))
+		} else if len(findings) == 0 {
+			fmt.Println("No secrets found in the history")
+		} else {
+			for _, finding := range findings {
+				short := finding.Commit
+				if len(short) > 7 {
+					short = short[:7]
+				}
+				fmt.Printf("%s %s %s:%d: %s (%s)\n", short, finding.Date, finding.File, finding.Line, finding.Rule, finding.Match)
+			}
+			fmt.Printf("\nFound %d possible secret(s). Rotate them: removing them from the history\n", len(findings))
+			fmt.Println("requires rewriting it, e.g. with git filter-repo (https://github.com/newren/git-filter-repo),")
+			fmt.Println("and force-pushing.")
 		}
 
-		fmt.Println("Managed files:")
-		for _, file := range files {
-			fmt.Printf("  - %s\n", file)
+		if len(findings) > 0 {
+			exit(1)
 		}
 	},
 }
 
-var commitCmd = &cobra.Command{
-	Use:   "commit [message]",
-	Short: "Commit and push changes to the remote repository",
-	Long: `Commit and push your configuration changes to the remote repository.
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror",
+	Short: "Copy managed files as regular files instead of linking them",
+	Long: `Copy every managed file as a regular file instead of linking it.
 
-This command will:
-1. Add all changes to git
-2. Create a commit with your message
-3. Push the changes to the remote repository
+Some environments cannot use symlinks: containers that copy a home directory
+without following links, backup tools that skip them, or filesystems that do
+not support them. mirror is 'dotman link' with copies:
 
-Use this command to:
-- Save your configuration changes
-- Sync changes across machines
-- Keep your dotfiles in version control
+  --to <dir>  copy the managed files into dir under their home-relative
+              paths, leaving your home directory alone
+  --apply     replace the links in your home directory with copies
+
+Prefer links wherever they work. A copy does not follow changes to the
+managed file, and an edit to a copy is not seen by dotman until the file is
+added again; 'dotman list' and 'dotman check' report copies as conflicts.
+Run 'dotman link' to go back to links.
+
+As with link, real files that a copy replaces are backed up first, and copies
+that are already up to date are left alone, so mirroring again is cheap.
+Directories with content in the way are only replaced with --force-link.
 
 Examples:
-  dotman commit "Update vim configuration"
-  dotman commit "Add new i3 workspace settings"`,
-	Args: cobra.ExactArgs(1),
+  dotman mirror --to /srv/container-home
+  dotman mirror --apply`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
+		cfg, err := loadConfig()
 		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
+			fatal(err, "Error creating config")
 		}
 
-		m := manager.New(cfg)
-		if err := m.CommitAndPush(args[0]); err != nil {
-			fmt.Printf("Error committing changes: %v\n", err)
-			os.Exit(1)
+		if err := applyModeFlags(cfg); err != nil {
+			fatal(err, "Error")
 		}
 
-		fmt.Println("Successfully committed and pushed changes")
+		if mirrorToFlag != "" {
+			if err := applyTargetHome(cfg, "--to", mirrorToFlag); err != nil {
+				fatal(err, "Error")
+			}
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		copies, err := m.Mirror(cmd.Context(), manager.LinkOptions{FailFast: mirrorFailFastFlag, ForceLink: mirrorForceFlag})
+		for _, copied := range copies {
+			if copied.BackupPath != "" {
+				fmt.Printf("Backed up existing file: %s -> %s\n", copied.Target, copied.BackupPath)
+			}
+			fmt.Printf("Copied: %s -> %s\n", copied.Source, copied.Target)
+		}
+		fmt.Printf("Mirrored %d file(s)\n", len(copies))
+		if err != nil {
+			fatal(err, "Error mirroring files")
+		}
 	},
 }
 
-var updateCmd = &cobra.Command{
-	Use:   "update",
-	Short: "Pull latest changes from the remote repository",
-	Long: `Pull the latest changes from the remote repository and update your configuration.
+var reverseImportCmd = &cobra.Command{
+	Use:   "reverse-import [file]",
+	Short: "Pull home files that are ahead of the repository into it",
+	Long: `Copy the content of home files into the managed files they replace.
 
-This command will:
-1. Pull the latest changes from the remote repository
-2. Update all managed files
-3. Relink files to their original locations
+This is the opposite of 'dotman link' for a home directory that is ahead of
+the repository, for example when a file was edited on this machine before
+the repository was cloned here and the copy in your home directory is the
+one to keep.
 
-Use this command to:
-- Sync changes from another machine
-- Update your configuration
-- Get the latest changes
+For the given file, or every managed file with --all, this command will:
+1. Compare the file in your home directory with the managed file
+2. Copy it over the managed file if it is a real file with other content
+3. Commit the imported files
+4. Replace them in your home directory with links, as 'dotman link' does
 
-Example:
-  dotman update`,
+Each file is reported, with the reason when it was left alone: files that
+are already linked, missing or identical are not touched. Use --dry-run to
+only see which files would be imported.
+
+Examples:
+  dotman reverse-import ~/.bashrc
+  dotman reverse-import --all --dry-run
+  dotman reverse-import --all`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
+		if reverseImportAllFlag == (len(args) > 0) {
+			fatalf(manager.CodeInvalidArgument, "give either a file or --all")
+		}
+
+		cfg, err := loadConfig()
 		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
+			fatal(err, "Error creating config")
 		}
 
-		m := manager.New(cfg)
-		if err := m.Update(); err != nil {
-			fmt.Printf("Error updating: %v\n", err)
-			os.Exit(1)
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		results, err := m.ReverseImport(manager.ReverseImportOptions{Paths: args, DryRun: reverseImportDryRunFlag})
+		imported := 0
+		for _, result := range results {
+			if !result.Imported {
+				fmt.Printf("Skipped: %s (%s)\n", result.HomePath, result.Reason)
+				continue
+			}
+			imported++
+			if reverseImportDryRunFlag {
+				fmt.Printf("Would import: %s -> %s\n", result.HomePath, result.Source)
+				continue
+			}
+			if result.BackupPath != "" {
+				fmt.Printf("Backed up existing file: %s -> %s\n", result.HomePath, result.BackupPath)
+			}
+			fmt.Printf("Imported: %s -> %s\n", result.HomePath, result.Source)
+		}
+		if err != nil {
+			fatal(err, "Error importing files")
 		}
 
-		fmt.Println("Successfully updated and relinked files")
+		if reverseImportDryRunFlag {
+			fmt.Printf("%d file(s) would be imported\n", imported)
+			return
+		}
+		fmt.Printf("Imported %d file(s)\n", imported)
 	},
 }
 
-var versionCmd = &cobra.Command{
-	Use:   "version",
-	Short: "Print the version number",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("dotman version %s\n", version)
-		fmt.Printf("commit: %s\n", commit)
-		fmt.Printf("built: %s\n", date)
-		fmt.Println("repo: https://github.com/Snupai/cli-config-manager")
-	},
-}
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile [file...]",
+	Short: "Resolve home files that diverged from the repository",
+	Long: `Resolve managed files whose home file became a separate copy.
 
-var upgradeCmd = &cobra.Command{
-	Use:   "upgrade",
-	Short: "Upgrade dotman to the latest version",
-	Long: `Check for and install the latest version of dotman.
+While a file is linked, editing it in your home directory edits the managed
+file. After a conflict, such as a file that was in the way when the
+repository was cloned or a program that replaced the link with a copy, the
+home file and the managed file are separate and drift apart. reconcile finds
+those files, the ones 'dotman diff' shows, and for each one shows the diff
+and asks which version to keep:
 
-This command will:
-1. Check the latest version available on GitHub
-2. Compare it with your current version
-3. Download and install the new version if available
-4. Preserve your configuration and managed files
-5. Create a backup of the current version
-6. Verify the downloaded binary
+  h  keep-home  copy the home file into the repository and link it
+  r  keep-repo  link the managed file; the home file is backed up first
+  s  skip       leave both files alone
+
+Nothing is changed until every file has an answer, and answering q stops
+without changing anything. The kept home files are then committed together
+in a single commit.
+
+Without a terminal, or to give the same answer for every file, pass
+--choose keep-home, keep-repo or skip.
 
 Examples:
-  dotman upgrade  # Check and install updates`,
+  dotman reconcile
+  dotman reconcile ~/.bashrc ~/.gitconfig
+  dotman reconcile --choose keep-repo`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Get current version
-		currentVersion := version
-		if currentVersion == "dev" {
-			fmt.Println("Cannot check for updates in development version")
-			os.Exit(1)
+		choose := manager.ReconcileChoice(reconcileChooseFlag)
+		if choose != "" && !validReconcileChoice(choose) {
+			fatalf(manager.CodeInvalidArgument, "invalid --choose %q (expected keep-home, keep-repo or skip)", reconcileChooseFlag)
 		}
-
-		currentVersion = strings.TrimPrefix(currentVersion, "v")
-
-		if verbose {
-			fmt.Printf("Current version: %s\n", currentVersion)
+		if choose == "" && (jsonFlag || !isTerminal(os.Stdin)) {
+			fatalf(manager.CodeInvalidArgument, "reconcile asks about each file on the terminal; pass --choose keep-home, keep-repo or skip to answer for every file")
 		}
 
-		// Check if we can write to the binary location
-		currentBinary, err := os.Executable()
+		cfg, err := loadConfig()
 		if err != nil {
-			fmt.Printf("Error getting current binary path: %v\n", err)
-			os.Exit(1)
+			fatal(err, "Error creating config")
 		}
 
-		// Create backup of current binary
-		backupPath := currentBinary + ".bak"
-		if err := copyFile(currentBinary, backupPath); err != nil {
-			fmt.Printf("Error creating backup: %v\n", err)
-			os.Exit(1)
+		// Progress goes to stderr with --json, so the output can be parsed
+		logOutput := os.Stdout
+		if jsonFlag {
+			logOutput = os.Stderr
 		}
-		defer os.Remove(backupPath) // Clean up backup if everything succeeds
+		m := manager.NewWithLogger(cfg, logOutput)
 
-		fmt.Println("Checking for updates...")
-		resp, err := http.Get("https://api.github.com/repos/Snupai/cli-config-manager/releases/latest")
-		if err != nil {
-			fmt.Printf("Error checking for updates: %v\n", err)
-			os.Exit(1)
+		opts := manager.ReconcileOptions{Paths: args}
+		if choose != "" {
+			opts.Choose = func(manager.LocalChange) (manager.ReconcileChoice, error) {
+				return choose, nil
+			}
+		} else {
+			opts.Choose = newReconcileChooser(m)
 		}
-		defer resp.Body.Close()
 
-		var release struct {
-			TagName string `json:"tag_name"`
-		}
-		if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-			fmt.Printf("Error parsing release info: %v\n", err)
-			os.Exit(1)
+		results, err := m.Reconcile(opts)
+		if errors.Is(err, errReconcileQuit) {
+			fmt.Println("Stopped; nothing was changed")
+			return
 		}
 
-		latestVersion := strings.TrimPrefix(release.TagName, "v")
-
-		if verbose {
-			fmt.Printf("Latest version: %s\n", latestVersion)
+		if jsonFlag {
+			data, jsonErr := json.MarshalIndent(results, "", "  ")
+			if jsonErr != nil {
+				fatal(jsonErr, "Error encoding JSON")
+			}
+			fmt.Println(string(data))
+		} else {
+			printReconcileResults(results)
 		}
-
-		if latestVersion == currentVersion {
-			fmt.Printf("You are already using the latest version: %s\n", currentVersion)
-			return
+		if err != nil {
+			fatal(err, "Error reconciling files")
 		}
+	},
+}
 
-		fmt.Printf("New version available: %s (current: %s)\n", latestVersion, currentVersion)
-		fmt.Print("Do you want to upgrade? [y/N]: ")
-
-		reader := bufio.NewReader(os.Stdin)
-		response, _ := reader.ReadString('\n')
-		response = strings.TrimSpace(strings.ToLower(response))
+// validReconcileChoice reports whether choice is one of manager.ReconcileChoices
+func validReconcileChoice(choice manager.ReconcileChoice) bool {
+	for _, valid := range manager.ReconcileChoices {
+		if choice == valid {
+			return true
+		}
+	}
+	return false
+}
 
-		if response != "y" {
-			fmt.Println("Upgrade cancelled")
-			return
+// errReconcileQuit is returned by the reconcile chooser when the user quits
+var errReconcileQuit = errors.New("reconciling stopped")
+
+// newReconcileChooser returns a ReconcileOptions.Choose that shows the diff
+// of each diverged file and asks on the terminal which version to keep
+func newReconcileChooser(m *manager.Manager) func(change manager.LocalChange) (manager.ReconcileChoice, error) {
+	reader := bufio.NewReader(os.Stdin)
+	return func(change manager.LocalChange) (manager.ReconcileChoice, error) {
+		fmt.Printf("%s differs from the repository:\n", change.HomePath)
+		if err := m.WriteLocalDiff(os.Stdout, change); err != nil {
+			return "", err
+		}
+		for {
+			fmt.Printf("Keep [h]ome, keep [r]epo, [s]kip or [q]uit? [h/r/s/q]: ")
+			response, err := reader.ReadString('\n')
+			switch strings.TrimSpace(strings.ToLower(response)) {
+			case "h", "home", "keep-home":
+				return manager.ReconcileKeepHome, nil
+			case "r", "repo", "keep-repo":
+				return manager.ReconcileKeepRepo, nil
+			case "s", "skip":
+				return manager.ReconcileSkip, nil
+			case "q", "quit":
+				return "", errReconcileQuit
+			}
+			// Treat the end of input like quitting rather than asking forever
+			if err != nil {
+				fmt.Println()
+				return "", errReconcileQuit
+			}
+			fmt.Println("Please answer h (keep the home file), r (keep the repository file), s (skip) or q (quit)")
 		}
+	}
+}
 
-		// Determine OS and architecture for archive naming
-		goos := runtime.GOOS
-		goarch := runtime.GOARCH
-		var releaseOS, releaseArch string
+// printReconcileResults prints what 'dotman reconcile' did with each file
+func printReconcileResults(results []manager.ReconcileResult) {
+	if len(results) == 0 {
+		fmt.Println("No home file differs from its managed file")
+		return
+	}
 
-		switch goos {
-		case "linux":
-			releaseOS = "Linux"
-		case "darwin":
-			releaseOS = "Darwin"
+	kept := 0
+	for _, result := range results {
+		switch result.Choice {
+		case manager.ReconcileKeepHome:
+			fmt.Printf("Kept home file: %s -> %s\n", result.HomePath, result.Source)
+		case manager.ReconcileKeepRepo:
+			fmt.Printf("Kept repository file: %s -> %s\n", result.HomePath, result.Source)
 		default:
-			fmt.Printf("Unsupported OS: %s\n", goos)
-			os.Exit(1)
+			fmt.Printf("Skipped: %s\n", result.HomePath)
+			continue
 		}
-
-		switch goarch {
-		case "amd64":
-			releaseArch = "x86_64"
-		case "arm64":
-			releaseArch = "arm64"
-		default:
-			fmt.Printf("Unsupported architecture: %s\n", goarch)
-			os.Exit(1)
+		if result.BackupPath != "" {
+			fmt.Printf("  Backed up the home file to %s\n", result.BackupPath)
 		}
+		kept++
+	}
+	fmt.Printf("Reconciled %d of %d file(s)\n", kept, len(results))
+}
 
-		archiveName := fmt.Sprintf("cli-config-manager-%s-%s.tar.gz", releaseOS, releaseArch)
-		downloadURL := fmt.Sprintf(
-			"https://github.com/Snupai/cli-config-manager/releases/download/%s/%s",
-			release.TagName,
-			archiveName,
-		)
+var listCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"status"},
+	Short:   "List all managed configuration files",
+	Long: `Display a list of all configuration files currently being managed by dotman.
 
-		if verbose {
-			fmt.Printf("Download URL: %s\n", downloadURL)
-		}
+This command will:
+1. Scan the dotman repository
+2. Show all files being managed
+3. Display their relative paths
 
-		tempDir, err := os.MkdirTemp("", "dotman-upgrade")
-		if err != nil {
-			fmt.Printf("Error creating temp directory: %v\n", err)
-			os.Exit(1)
-		}
-		defer os.RemoveAll(tempDir)
+Use this command to:
+- Check which files are being managed
+- Verify your configuration
+- Plan your next changes
 
-		archivePath := filepath.Join(tempDir, archiveName)
+Quick filters show only files that need attention, using the same
+classification as 'dotman check':
+  --broken     the link in the home directory is missing
+  --conflicts  a real file, or a link to somewhere else, is in the way
+With a filter, the command exits non-zero when any file matches, so it can
+be used in CI. --json prints each file with its link state and note.
+--notes shows the note attached to each file with 'dotman note set'.
 
-		fmt.Println("Downloading new version...")
-		resp, err = http.Get(downloadURL)
+--tree shows the files as a tree of their directories, each file with its
+link state. --depth limits how deep the tree goes; a directory cut off by
+it shows how many files it holds and how many of them are not linked.
+
+--watch turns the terminal into a live view of the link state of every
+file, redrawn every --interval (default 2s), for immediate feedback when a
+link breaks while you experiment. The filters, --tree and --notes apply.
+Press Ctrl-C to quit; the terminal is restored. 'dotman status' is another
+name for this command.
+
+Examples:
+  dotman list
+  dotman list --notes
+  dotman list --tree --depth 2
+  dotman list --broken
+  dotman list --conflicts --json
+  dotman status --watch --interval 5s`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
 		if err != nil {
-			fmt.Printf("Error downloading new version: %v\n", err)
-			os.Exit(1)
+			fatal(err, "Error creating config")
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			fmt.Printf("Error downloading new version: HTTP %d\n", resp.StatusCode)
-			os.Exit(1)
+		if listDepthFlag < 0 {
+			fatalf(manager.CodeInvalidArgument, "--depth must not be negative")
+		}
+		if cmd.Flags().Changed("depth") && !listTreeFlag {
+			fatalf(manager.CodeInvalidArgument, "--depth only applies to --tree")
 		}
 
-		// Create a progress bar
-		fileSize := resp.ContentLength
-		progress := 0
-		lastProgress := 0
-
-		out, err := os.Create(archivePath)
-		if err != nil {
-			fmt.Printf("Error creating archive file: %v\n", err)
-			os.Exit(1)
+		if listIntervalFlag <= 0 {
+			fatalf(manager.CodeInvalidArgument, "--interval must be positive")
+		}
+		if cmd.Flags().Changed("interval") && !listWatchFlag {
+			fatalf(manager.CodeInvalidArgument, "--interval only applies to --watch")
 		}
 
-		// Download with progress
-		buf := make([]byte, 32*1024)
-		for {
-			nr, er := resp.Body.Read(buf)
-			if nr > 0 {
-				nw, ew := out.Write(buf[0:nr])
-				if nw > 0 {
-					progress += nw
-					// Update progress every 5%
-					if fileSize > 0 {
-						currentProgress := int(float64(progress) / float64(fileSize) * 100)
-						if currentProgress >= lastProgress+5 {
-							fmt.Printf("\rDownloading: %d%%", currentProgress)
-							lastProgress = currentProgress
-						}
-					}
-				}
-				if ew != nil {
-					err = ew
-					break
-				}
-				if nr != nw {
-					err = io.ErrShortWrite
-					break
-				}
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if listWatchFlag {
+			if jsonFlag {
+				fatalf(manager.CodeInvalidArgument, "--watch cannot be combined with --json")
 			}
-			if er != nil {
-				if er != io.EOF {
-					err = er
-				}
-				break
+			if !isTerminal(os.Stdout) {
+				fatalf(manager.CodeInvalidArgument, "--watch needs a terminal to draw on")
 			}
+			watchStatuses(cmd.Context(), m, listIntervalFlag)
+			return
+		}
+		if listBrokenFlag || listConflictsFlag || listTreeFlag || jsonFlag {
+			listStatuses(m)
+			return
 		}
-		fmt.Println() // New line after progress
-		out.Close()
 
+		files, err := m.ListFiles()
 		if err != nil {
-			fmt.Printf("Error downloading: %v\n", err)
-			os.Exit(1)
+			fatal(err, "Error listing files")
 		}
 
-		if verbose {
-			fmt.Printf("Archive downloaded to: %s\n", archivePath)
+		if len(files) == 0 {
+			fmt.Println("No files are currently being managed")
+			return
 		}
 
-		fmt.Println("Extracting archive...")
-		if err := untar(archivePath, tempDir, verbose); err != nil {
-			fmt.Printf("Error extracting archive: %v\n", err)
-			os.Exit(1)
+		var notes map[string]string
+		if listNotesFlag {
+			if notes, err = m.Notes(); err != nil {
+				fatal(err, "Error reading notes")
+			}
 		}
 
-		dotmanPath := filepath.Join(tempDir, "dotman")
-		if _, err := os.Stat(dotmanPath); os.IsNotExist(err) {
-			// Try to find it in a subdirectory
-			dotmanPath = ""
-			err = filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
-				if info != nil && info.Name() == "dotman" && !info.IsDir() {
-					dotmanPath = path
-					return io.EOF // stop walking
-				}
-				return nil
-			})
-			if dotmanPath == "" {
-				fmt.Println("dotman binary not found in the archive.")
-				os.Exit(1)
+		fmt.Println("Managed files:")
+		for _, file := range files {
+			if note := notes[filepath.ToSlash(file)]; note != "" {
+				fmt.Printf("  - %s  # %s\n", file, note)
+			} else {
+				fmt.Printf("  - %s\n", file)
 			}
 		}
+	},
+}
 
-		if verbose {
-			fmt.Printf("dotman binary found at: %s\n", dotmanPath)
-		}
+var commitCmd = &cobra.Command{
+	Use:   "commit [message]",
+	Short: "Commit and push changes to the remote repository",
+	Long: `Commit and push your configuration changes to the remote repository.
 
-		fmt.Println("Installing new version...")
+This command will:
+1. Add all changes to git
+2. Create a commit with your message
+3. Push the changes to the remote repository
 
-		// Create a temporary file in the same directory as the target
-		tempBinary := currentBinary + ".new"
-		if err := copyFile(dotmanPath, tempBinary); err != nil {
-			fmt.Printf("Error copying new version: %v\n", err)
-			os.Exit(1)
+A repository created with 'dotman init --no-remote', or without an origin
+remote, is committed to but not pushed.
+
+Use this command to:
+- Save your configuration changes
+- Sync changes across machines
+- Keep your dotfiles in version control
+
+With --summary, the diffstat of the staged changes is printed before
+anything is committed, and you are asked to confirm unless --yes is given.
+
+Examples:
+  dotman commit "Update vim configuration"
+  dotman commit "Add new i3 workspace settings"
+  dotman commit --summary "Tidy shell configs"`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
 		}
 
-		// Make the temporary file executable
-		if err := os.Chmod(tempBinary, 0755); err != nil {
-			fmt.Printf("Error setting permissions: %v\n", err)
-			os.Remove(tempBinary)
-			os.Exit(1)
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		var opts manager.CommitOptions
+		if commitSummaryFlag {
+			opts.Review = reviewCommit
+		}
+		if err := m.CommitAndPushWith(cmd.Context(), args[0], opts); err != nil {
+			if errors.Is(err, errCommitCancelled) {
+				fmt.Println("Commit cancelled; the changes are still staged")
+				return
+			}
+			fatal(err, "Error committing changes")
 		}
 
-		// Create a temporary script to handle the replacement
-		scriptContent := fmt.Sprintf(`#!/bin/sh
-# Wait a moment for the parent process to exit
-sleep 1
+		if m.HasRemote() {
+			fmt.Println("Successfully committed and pushed changes")
+		} else {
+			fmt.Println("Successfully committed changes")
+		}
+	},
+}
 
-# Replace the binary
-mv %s %s
+// errScaffoldDeclined is returned by confirmScaffold when the user does not
+// want to scaffold an unexpected repository
+var errScaffoldDeclined = errors.New("scaffolding declined")
 
-# Clean up
-rm "$0"
-`, tempBinary, currentBinary)
+// confirmScaffold asks whether to create the dotman layout in a cloned
+// repository that lacks it. Without a terminal to ask on, it declines.
+func confirmScaffold(check manager.RemoteCheck) error {
+	if !isTerminal(os.Stdin) {
+		return errScaffoldDeclined
+	}
 
-		scriptPath := filepath.Join(tempDir, "replace.sh")
-		if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
-			fmt.Printf("Error creating replacement script: %v\n", err)
-			os.Remove(tempBinary)
-			os.Exit(1)
+	fmt.Print("Create configs/ and a .gitignore in this repository anyway? [y/N]: ")
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	if strings.TrimSpace(strings.ToLower(response)) != "y" {
+		return errScaffoldDeclined
+	}
+	return nil
+}
+
+// errCommitCancelled is returned by reviewCommit when the user declines
+var errCommitCancelled = errors.New("commit cancelled")
+
+// reviewCommit prints the diffstat of a commit about to be made and asks
+// to go ahead unless --yes was given
+func reviewCommit(stat string) error {
+	fmt.Println("Changes to commit and push:")
+	fmt.Print(stat)
+	if commitYesFlag {
+		return nil
+	}
+
+	fmt.Print("Commit and push these changes? [y/N]: ")
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	if strings.TrimSpace(strings.ToLower(response)) != "y" {
+		return errCommitCancelled
+	}
+	return nil
+}
+
+var relinkCmd = &cobra.Command{
+	Use:   "relink",
+	Short: "Normalize managed symlinks to the configured style",
+	Long: `Rewrite the symlinks in your home directory so they all use the
+symlink_style setting from ~/.dotman/config.json: "absolute" (default) or
+"relative".
+
+Only links that point at a managed file in ~/.dotman/configs are rewritten.
+Links created by older dotman versions or with a different setting are
+converted; other links are left alone.
+
+Examples:
+  dotman relink`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		relinked, err := m.Relink()
+		for _, path := range relinked {
+			fmt.Printf("Relinked: %s\n", path)
+		}
+		if err != nil {
+			fatal(err, "Error relinking files")
+		}
+
+		if len(relinked) == 0 {
+			fmt.Println("All managed links already use the configured style")
+			return
+		}
+		fmt.Printf("Relinked %d file(s)\n", len(relinked))
+	},
+}
+
+var migrateLinksFromFlag string
+
+var migrateLinksCmd = &cobra.Command{
+	Use:   "migrate-links",
+	Short: "Repoint home symlinks after the dotman directory moved",
+	Long: `Repoint the symlinks in your home directory at the current dotman directory
+after it, or your whole home directory, was moved.
+
+Absolute links keep pointing at the old location, so after moving, every
+managed file appears broken. This command rewrites each link of a managed
+file that points into the old dotman directory, given with --from, to the
+managed file in ~/.dotman, using the symlink_style setting. Every rewritten
+link is reported; links pointing anywhere else are left alone.
+
+Without --from, the old location is worked out from the broken links: a link
+to /home/olduser/.dotman/configs/.bashrc for the managed file .bashrc means
+the directory was at /home/olduser/.dotman. If broken links disagree, the
+candidates are listed and you pick one with --from.
+
+To avoid this in the future, set symlink_style to "relative"; relative links
+keep working when the home directory moves as a whole.
+
+Examples:
+  dotman migrate-links
+  dotman migrate-links --from /home/olduser/.dotman`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		migrated, err := m.MigrateLinks(migrateLinksFromFlag)
+		for _, link := range migrated {
+			fmt.Printf("Migrated: %s -> %s (was %s)\n", link.Path, link.NewTarget, link.OldTarget)
+		}
+		if err != nil {
+			fatal(err, "Error migrating links")
+		}
+
+		if len(migrated) == 0 {
+			fmt.Println("No links point into the old dotman directory")
+			return
+		}
+		fmt.Printf("Migrated %d link(s)\n", len(migrated))
+	},
+}
+
+var reinitCmd = &cobra.Command{
+	Use:   "reinit",
+	Short: "Regenerate the dotman directory scaffolding",
+	Long: `Regenerate the scaffolding of an existing dotman directory after manual
+changes or repository surgery.
+
+This command will:
+1. Recreate the configs directory if it is missing
+2. Regenerate .gitignore, saving a modified one as .gitignore.bak
+3. Restore the layout version marker
+
+Managed files and git history are never touched. Each fix is reported.
+
+Examples:
+  dotman reinit`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Load without config.New, which would silently fix the layout itself
+		cfg, err := config.NewWithoutDirectories()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+		if err := cfg.LoadSettings(); err != nil {
+			fatal(err, "Error loading settings")
+		}
+		applyGlobalFlags(cfg)
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		fixed, err := m.Reinit()
+		for _, fix := range fixed {
+			fmt.Printf("Fixed: %s\n", fix)
+		}
+		if err != nil {
+			fatal(err, "Error reinitializing")
+		}
+
+		if len(fixed) == 0 {
+			fmt.Println("Scaffolding is intact, nothing to fix")
+			return
+		}
+		fmt.Printf("Fixed %d issue(s)\n", len(fixed))
+	},
+}
+
+// listStatuses runs list with --broken, --conflicts, --tree or --json
+func listStatuses(m *manager.Manager) {
+	statuses, err := m.FileStatuses()
+	if err != nil {
+		fatal(err, "Error listing files")
+	}
+
+	matched := matchStatuses(statuses)
+	if jsonFlag {
+		data, err := json.MarshalIndent(matched, "", "  ")
+		if err != nil {
+			fatal(err, "Error encoding JSON")
+		}
+		fmt.Println(string(data))
+	} else {
+		printStatuses(matched)
+	}
+
+	if (listBrokenFlag || listConflictsFlag) && len(matched) > 0 {
+		exit(1)
+	}
+}
+
+// matchStatuses returns the statuses that pass the --broken and
+// --conflicts filters, or all of them without a filter
+func matchStatuses(statuses []manager.FileStatus) []manager.FileStatus {
+	filtered := listBrokenFlag || listConflictsFlag
+	matched := []manager.FileStatus{}
+	for _, status := range statuses {
+		if !filtered ||
+			(listBrokenFlag && status.State == manager.StateMissing) ||
+			(listConflictsFlag && status.State == manager.StateConflict) {
+			matched = append(matched, status)
+		}
+	}
+	return matched
+}
+
+// printStatuses prints the statuses as a list or, with --tree, as a tree
+func printStatuses(matched []manager.FileStatus) {
+	if len(matched) == 0 {
+		fmt.Println("No matching files")
+	} else if listTreeFlag {
+		if !listBrokenFlag && !listConflictsFlag {
+			fmt.Println("Managed files:")
+		}
+		printFileTree(buildFileTree(matched), "  ", 1)
+	} else {
+		for _, status := range matched {
+			line := fmt.Sprintf("  - %s [%s]", status.Path, status.State)
+			if status.Detail != "" {
+				line = fmt.Sprintf("  - %s [%s: %s]", status.Path, status.State, status.Detail)
+			}
+			if listNotesFlag && status.Note != "" {
+				line += "  # " + status.Note
+			}
+			fmt.Println(line)
+		}
+	}
+}
+
+// watchStatuses redraws the link state of the managed files, filtered as
+// for listStatuses, every interval until ctx is cancelled by Ctrl-C. It
+// draws on the terminal's alternate screen, which is left again on return
+// so the previous terminal content comes back.
+func watchStatuses(ctx context.Context, m *manager.Manager, interval time.Duration) {
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		statuses, err := m.FileStatuses()
+		fmt.Print("\x1b[H\x1b[2J")
+		fmt.Printf("dotman status, every %s; press Ctrl-C to quit   %s\n\n", interval, time.Now().Format("15:04:05"))
+		if err != nil {
+			fmt.Printf("Error listing files: %v\n", err)
+		} else {
+			printStatuses(matchStatuses(statuses))
+			linked := 0
+			for _, status := range statuses {
+				if status.State == manager.StateLinked {
+					linked++
+				}
+			}
+			fmt.Printf("\n%d of %d file(s) linked\n", linked, len(statuses))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fileTree is a directory of managed files, or a file when status is set
+type fileTree struct {
+	status   *manager.FileStatus
+	children map[string]*fileTree
+}
+
+// buildFileTree arranges statuses by the directories of their paths
+func buildFileTree(statuses []manager.FileStatus) *fileTree {
+	root := &fileTree{children: make(map[string]*fileTree)}
+	for i := range statuses {
+		node := root
+		parts := strings.Split(filepath.ToSlash(statuses[i].Path), "/")
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node.children[part]
+			if !ok {
+				child = &fileTree{children: make(map[string]*fileTree)}
+				node.children[part] = child
+			}
+			node = child
+		}
+		node.children[parts[len(parts)-1]] = &fileTree{status: &statuses[i]}
+	}
+	return root
+}
+
+// countStates counts the files below t by link state
+func (t *fileTree) countStates(counts map[manager.LinkState]int) {
+	if t.status != nil {
+		counts[t.status.State]++
+		return
+	}
+	for _, child := range t.children {
+		child.countStates(counts)
+	}
+}
+
+// printFileTree prints the children of t, indented by prefix, down to
+// --depth levels below the top, where depth is the level of t's children
+func printFileTree(t *fileTree, prefix string, depth int) {
+	names := make([]string, 0, len(t.children))
+	for name := range t.children {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for i, name := range names {
+		child := t.children[name]
+		branch, indent := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		if status := child.status; status != nil {
+			line := fmt.Sprintf("%s%s%s [%s]", prefix, branch, name, status.State)
+			if status.Detail != "" {
+				line = fmt.Sprintf("%s%s%s [%s: %s]", prefix, branch, name, status.State, status.Detail)
+			}
+			if listNotesFlag && status.Note != "" {
+				line += "  # " + status.Note
+			}
+			fmt.Println(line)
+			continue
+		}
+
+		if listDepthFlag > 0 && depth >= listDepthFlag {
+			fmt.Printf("%s%s%s/ %s\n", prefix, branch, name, treeSummary(child))
+			continue
+		}
+		fmt.Printf("%s%s%s/\n", prefix, branch, name)
+		printFileTree(child, prefix+indent, depth+1)
+	}
+}
+
+// treeSummary describes the files in a directory cut off by --depth, like
+// "(5 files: 1 missing, 1 conflict)"
+func treeSummary(t *fileTree) string {
+	counts := make(map[manager.LinkState]int)
+	t.countStates(counts)
+
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	var problems []string
+	for _, state := range []manager.LinkState{manager.StateMissing, manager.StateConflict, manager.StateFrozen, manager.StateUnavailable} {
+		if counts[state] > 0 {
+			problems = append(problems, fmt.Sprintf("%d %s", counts[state], state))
+		}
+	}
+
+	summary := fmt.Sprintf("(%d file", total)
+	if total != 1 {
+		summary += "s"
+	}
+	if len(problems) > 0 {
+		summary += ": " + strings.Join(problems, ", ")
+	}
+	return summary + ")"
+}
+
+var unshallowCmd = &cobra.Command{
+	Use:   "unshallow",
+	Short: "Fetch the full history of a shallow clone",
+	Long: `Fetch the full git history of a dotman repository that was cloned with
+'dotman init --depth'.
+
+Examples:
+  dotman unshallow`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if err := m.Unshallow(cmd.Context()); err != nil {
+			fatal(err, "Error")
+		}
+
+		fmt.Println("Repository has its full history")
+	},
+}
+
+var whichCmd = &cobra.Command{
+	Use:   "which [file]",
+	Short: "Show which managed file provides a path",
+	Long: `Show the managed file in ~/.dotman/configs that provides a path in your
+home directory, and whether the link in the home directory currently
+resolves to it.
+
+Examples:
+  dotman which ~/.bashrc
+  dotman which ~/.config/nvim/init.lua`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		info, err := m.ResolveSource(args[0])
+		if err != nil {
+			fatal(err, "Error")
+		}
+
+		fmt.Printf("%s\n", info.HomePath)
+		fmt.Printf("  source: %s\n", info.Source)
+		if info.Detail != "" {
+			fmt.Printf("  state:  %s (%s)\n", info.State, info.Detail)
+		} else {
+			fmt.Printf("  state:  %s\n", info.State)
+		}
+	},
+}
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the GitHub account dotman acts as",
+	Long: `Show the GitHub account the GitHub CLI (gh) is logged in as, which is the
+account 'dotman init' creates the repository under.
+
+Set github_user in ~/.dotman/config.json to the account you expect. When gh
+is logged in as another account, whoami exits with an error and init refuses
+to create the repository. Switch accounts with 'gh auth switch'.
+
+Examples:
+  dotman whoami
+  dotman whoami --json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		id, err := m.GitHubIdentity(cmd.Context())
+		if err != nil {
+			fatal(err, "Error")
+		}
+
+		if jsonFlag {
+			data, err := json.MarshalIndent(struct {
+				manager.GitHubIdentity
+				Matches bool `json:"matches"`
+			}{id, id.Matches()}, "", "  ")
+			if err != nil {
+				fatal(err, "Error encoding JSON")
+			}
+			fmt.Println(string(data))
+		} else {
+			fmt.Printf("GitHub account: %s\n", id.Login)
+			if id.Expected != "" {
+				fmt.Printf("Expected:       %s\n", id.Expected)
+			}
+		}
+
+		if err := manager.GitHubAccountError(id); err != nil {
+			fatal(err, "Error")
+		}
+	},
+}
+
+var infoCmd = &cobra.Command{
+	Use:   "info [file]",
+	Short: "Show everything dotman knows about a managed file",
+	Long: `Show everything dotman knows about one managed file: where it is stored in
+~/.dotman/configs, where it is linked in your home directory and the state of
+that link, the tags and dependencies 'dotman docs' detects for it, the last
+commit that touched it and its backups.
+
+Examples:
+  dotman info ~/.bashrc
+  dotman info --json ~/.config/nvim/init.lua`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		info, err := m.Info(args[0])
+		if err != nil {
+			fatal(err, "Error")
+		}
+
+		if jsonFlag {
+			data, err := json.MarshalIndent(info, "", "  ")
+			if err != nil {
+				fatal(err, "Error encoding JSON")
+			}
+			fmt.Println(string(data))
+			return
+		}
+		printFileDetails(info)
+	},
+}
+
+// printFileDetails prints the sections of 'dotman info'
+func printFileDetails(info manager.FileDetails) {
+	fmt.Println(info.HomePath)
+	fmt.Printf("  source: %s\n", info.Source)
+	if info.Detail != "" {
+		fmt.Printf("  state:  %s (%s)\n", info.State, info.Detail)
+	} else {
+		fmt.Printf("  state:  %s\n", info.State)
+	}
+
+	if info.Note != "" {
+		fmt.Printf("  note:   %s\n", info.Note)
+	}
+
+	fmt.Println("\nDetected:")
+	fmt.Printf("  tags:         %s\n", joinOrNone(info.Tags))
+	fmt.Printf("  dependencies: %s\n", joinOrNone(info.Dependencies))
+
+	fmt.Println("\nLast commit:")
+	if c := info.LastCommit; c != nil {
+		fmt.Printf("  %.12s %s\n", c.Hash, c.Subject)
+		fmt.Printf("  by %s on %s\n", c.Author, c.Date.Format("2006-01-02 15:04:05"))
+	} else {
+		fmt.Println("  not committed")
+	}
+
+	fmt.Println("\nBackups:")
+	if len(info.Backups) == 0 {
+		fmt.Println("  none")
+	}
+	for _, backup := range info.Backups {
+		if backup.Note != "" {
+			fmt.Printf("  %s  %s  # %s\n", backup.ID, backup.Timestamp.Format("2006-01-02 15:04:05"), backup.Note)
+		} else {
+			fmt.Printf("  %s  %s\n", backup.ID, backup.Timestamp.Format("2006-01-02 15:04:05"))
+		}
+	}
+}
+
+// joinOrNone joins values with commas, or returns "none" when there are none
+func joinOrNone(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect dotman's own configuration files",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check dotman's configuration and metadata files for mistakes",
+	Long: `Parse every file dotman keeps its own state in and report all problems
+at once, with the file and line they are on:
+
+- ~/.dotman/config.json: syntax errors, unknown settings and invalid values
+- ~/.dotman/configs: files that do not fit the layout of the directory
+- ~/.dotman/.dotmanignore: invalid patterns
+- ~/.dotman/frozen.json: entries for files that are not managed
+- ~/.dotman/links.json: malformed conditions and paths that are not managed
+- ~/.dotman/notes.json: notes that are not strings or belong to no managed file
+- backup metadata: malformed or missing fields and content that does not
+  match its checksum
+
+Unlike 'dotman check', which looks at the links in your home directory,
+this only checks the files themselves. It exits with status 1 when any
+problem is found.
+
+Examples:
+  dotman config validate
+  dotman config validate --json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Settings are validated from disk, so they must not be loaded here:
+		// an invalid config.json would stop the command before validating it
+		cfg, err := config.NewWithoutDirectories()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+		applyGlobalFlags(cfg)
+		cfg.ReadOnly = true
+
+		m := manager.New(cfg)
+		issues := m.Validate()
+
+		if jsonFlag {
+			if issues == nil {
+				issues = []manager.ValidationIssue{}
+			}
+			data, err := json.MarshalIndent(issues, "", "  ")
+			if err != nil {
+				fatal(err, "Error encoding JSON")
+			}
+			fmt.Println(string(data))
+		} else {
+			for _, issue := range issues {
+				fmt.Println(issue)
+			}
+		}
+
+		if len(issues) > 0 {
+			if !jsonFlag {
+				fmt.Printf("Found %d problem(s)\n", len(issues))
+			}
+			exit(1)
+		}
+		if !jsonFlag {
+			fmt.Println("Configuration is valid")
+		}
+	},
+}
+
+var freezeCmd = &cobra.Command{
+	Use:   "freeze [file]",
+	Short: "Temporarily disable a managed file",
+	Long: `Temporarily disable a managed file by renaming its link in your home
+directory to <name>.disabled, so applications stop reading it. Unlike
+'dotman remove', the file stays managed; 'dotman thaw' turns it back on.
+
+Frozen files are recorded in ~/.dotman/frozen.json, which is not committed,
+so freezing only affects this machine. 'dotman link' and 'dotman update'
+leave frozen files disabled, and 'dotman check' does not report them as
+broken. Run without arguments to list frozen files.
+
+Examples:
+  dotman freeze ~/.config/nvim/init.lua
+  dotman freeze  # List frozen files`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if len(args) == 0 {
+			frozen, err := m.Frozen()
+			if err != nil {
+				fatal(err, "Error listing frozen files")
+			}
+			if len(frozen) == 0 {
+				fmt.Println("No files are frozen")
+				return
+			}
+			fmt.Println("Frozen files:")
+			for _, path := range frozen {
+				fmt.Printf("  - %s\n", path)
+			}
+			return
+		}
+
+		if err := m.Freeze(args[0]); err != nil {
+			fatal(err, "Error freezing %s", args[0])
+		}
+		fmt.Printf("Froze %s; run 'dotman thaw %s' to enable it again\n", args[0], args[0])
+	},
+}
+
+var noteCmd = &cobra.Command{
+	Use:   "note",
+	Short: "Attach short notes to managed files",
+	Long: `Attach a short note to a managed file, such as "reload with prefix+r"
+or "machine-specific, edit with care". Notes are shown by 'dotman info'
+and 'dotman list --notes'.
+
+Notes are kept in ~/.dotman/notes.json rather than in the generated
+documentation, so 'dotman docs --update' leaves them alone. Commit with
+'dotman commit' to share them with your other machines.
+
+Examples:
+  dotman note set ~/.tmux.conf reload with prefix+r
+  dotman note get ~/.tmux.conf
+  dotman note rm ~/.tmux.conf`,
+}
+
+var noteSetCmd = &cobra.Command{
+	Use:   "set [file] [note...]",
+	Short: "Attach a note to a managed file, replacing any previous one",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if err := m.SetNote(args[0], strings.Join(args[1:], " ")); err != nil {
+			fatal(err, "Error setting note for %s", args[0])
+		}
+		fmt.Printf("Set note for %s\n", args[0])
+	},
+}
+
+var noteGetCmd = &cobra.Command{
+	Use:   "get [file]",
+	Short: "Print the note of a managed file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		note, err := m.Note(args[0])
+		if err != nil {
+			fatal(err, "Error reading note for %s", args[0])
+		}
+		fmt.Println(note)
+	},
+}
+
+var noteRmCmd = &cobra.Command{
+	Use:   "rm [file]",
+	Short: "Remove the note of a file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if err := m.RemoveNote(args[0]); err != nil {
+			fatal(err, "Error removing note for %s", args[0])
+		}
+		fmt.Printf("Removed note for %s\n", args[0])
+	},
+}
+
+var thawCmd = &cobra.Command{
+	Use:   "thaw [file]",
+	Short: "Re-enable a file disabled with freeze",
+	Long: `Re-enable a managed file that was disabled with 'dotman freeze' by
+restoring its link in your home directory.
+
+Examples:
+  dotman thaw ~/.config/nvim/init.lua`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if err := m.Thaw(args[0]); err != nil {
+			fatal(err, "Error thawing %s", args[0])
+		}
+		fmt.Printf("Thawed %s\n", args[0])
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export [archive]",
+	Short: "Bundle managed files into a tar.gz or zip archive",
+	Long: `Write managed files into a gzip-compressed tar archive. Files are stored at
+their path relative to your home directory, so the archive can be shared for
+review or unpacked into a home directory directly. Use '-' to write the
+archive to stdout.
+
+--archive-format chooses between tar.gz and zip, which is easier to open on
+Windows. Without it, an archive named *.zip is written as zip and anything
+else as tar.gz. Both formats keep the mode of each file.
+
+With --since, only the files whose content changed since the given commit
+are bundled, including changes that are not committed yet. Files deleted
+since then are left out. Any git revision works: a commit, a tag, a branch
+or an expression like HEAD~3.
+
+Examples:
+  dotman export dotfiles.tar.gz
+  dotman export dotfiles.zip
+  dotman export --since HEAD~5 review.tar.gz
+  dotman export --since v1.0 - | tar -tz`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeFilePath,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		format := exportFormatFlag
+		if format == "" {
+			format = manager.ArchiveFormatFor(args[0])
+		}
+		if !slices.Contains(manager.ArchiveFormats, format) {
+			fatalf(manager.CodeInvalidArgument, "unknown --archive-format %q (supported: %s)", format, strings.Join(manager.ArchiveFormats, ", "))
+		}
+		opts := manager.ExportOptions{Format: format}
+
+		m := manager.New(cfg)
+		var files []string
+		if exportSinceFlag != "" {
+			files, err = m.ChangedFilesSince(exportSinceFlag)
+		} else {
+			files, err = m.ListFiles()
+		}
+		if err != nil {
+			fatal(err, "Error selecting files")
+		}
+		if len(files) == 0 {
+			if exportSinceFlag != "" {
+				fmt.Fprintf(os.Stderr, "No managed files changed since %s; nothing exported\n", exportSinceFlag)
+			} else {
+				fmt.Fprintln(os.Stderr, "No managed files; nothing exported")
+			}
+			return
+		}
+
+		if args[0] == "-" {
+			if err := m.ExportWith(os.Stdout, files, opts); err != nil {
+				fatal(err, "Error exporting")
+			}
+			return
+		}
+
+		out, err := os.Create(args[0])
+		if err != nil {
+			fatal(err, "Error creating archive")
+		}
+		if err := m.ExportWith(out, files, opts); err != nil {
+			out.Close()
+			os.Remove(args[0])
+			fatal(err, "Error exporting")
+		}
+		if err := out.Close(); err != nil {
+			fatal(err, "Error writing archive")
+		}
+
+		for _, file := range files {
+			fmt.Printf("  %s\n", file)
+		}
+		fmt.Printf("Exported %d file(s) to %s\n", len(files), args[0])
+	},
+}
+
+var openCmd = &cobra.Command{
+	Use:   "open [repo|dir]",
+	Short: "Open the repository in a browser or the dotman directory in a file manager",
+	Long: `Open your dotfiles in a graphical application.
+
+  repo  open the web page of the origin remote in your browser. SSH remotes
+        like git@github.com:user/configs.git are opened over https.
+  dir   open ~/.dotman in the system file manager
+
+The system opener is used: xdg-open on Linux, open on macOS and explorer on
+Windows.
+
+Examples:
+  dotman open repo
+  dotman open dir`,
+	ValidArgs: []string{"repo", "dir"},
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		target := cfg.DotmanDir
+		if args[0] == "repo" {
+			m := manager.NewWithLogger(cfg, os.Stdout)
+			target, err = m.RemoteWebURL()
+			if errors.Is(err, manager.ErrNoRemote) && !jsonFlag {
+				fmt.Println("This repository has no remote to open.")
+				fmt.Printf("Add one with: git -C %s remote add origin <url>\n", cfg.DotmanDir)
+				exit(1)
+			}
+			if err != nil {
+				fatal(err, "Error")
+			}
+		}
+
+		fmt.Printf("Opening %s\n", target)
+		if err := openInSystem(target); err != nil {
+			fatal(err, "Error opening %s", target)
+		}
+	},
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Pull latest changes from the remote repository",
+	Long: `Pull the latest changes from the remote repository and update your configuration.
+
+This command will:
+1. Pull the latest changes from the remote repository
+2. Update all managed files and submodules
+3. Relink files to their original locations
+
+Use this command to:
+- Sync changes from another machine
+- Update your configuration
+- Get the latest changes
+
+With --no-relink, only the pull and submodule update happen. Links in your
+home directory are left as they are, which keeps files you unlinked on
+purpose unlinked; run 'dotman link' to relink explicitly.
+
+With --prune, links in your home directory to managed files that the pull
+deleted are removed afterwards, so configs deleted on another machine do not
+leave dangling links behind. Only links into ~/.dotman/configs whose target
+is gone are removed, along with the directories they leave empty.
+
+Updates only fast-forward by default. When this machine has commits the
+remote does not have, the update stops without changing anything; rerun it
+with --rebase to replay the local commits on top of the remote, or --merge
+to merge them. The default can be changed with pull_strategy in
+~/.dotman/config.json.
+
+With --dry-run, the remote is only fetched. The incoming new, modified,
+renamed and deleted configs are listed, along with the links relinking
+would create or replace and the links that would be pruned or left
+dangling. Nothing is pulled or linked.
+
+Examples:
+  dotman update
+  dotman update --dry-run
+  dotman update --no-relink
+  dotman update --prune
+  dotman update --rebase`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		var strategy string
+		switch {
+		case updateRebaseFlag:
+			strategy = config.PullRebase
+		case updateMergeFlag:
+			strategy = config.PullMerge
+		}
+
+		opts := manager.UpdateOptions{
+			NoRelink: updateNoRelinkFlag,
+			Prune:    updatePruneFlag,
+			Strategy: strategy,
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if updateDryRunFlag {
+			plan, err := m.PlanUpdate(opts)
+			if err != nil {
+				fatal(err, "Error comparing with remote")
+			}
+			printUpdatePlan(plan)
+			return
+		}
+
+		result, err := m.UpdateWith(cmd.Context(), opts)
+		printLinks(result.Links)
+		for _, path := range result.Pruned {
+			fmt.Printf("Pruned: %s\n", path)
+		}
+		if updatePruneFlag {
+			fmt.Printf("Pruned %d dangling link(s)\n", len(result.Pruned))
+		}
+		if err != nil {
+			fatal(err, "Error updating")
+		}
+
+		if updateNoRelinkFlag {
+			fmt.Println("Successfully updated; relinking was skipped")
+			fmt.Println("Run 'dotman link' to relink the managed files")
+			return
+		}
+		fmt.Println("Successfully updated and relinked files")
+	},
+}
+
+// printUpdatePlan prints what 'dotman update' would change, grouped by the
+// kind of change
+func printUpdatePlan(plan manager.UpdatePlan) {
+	if jsonFlag {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			fatal(err, "Error encoding JSON")
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if len(plan.Changes) == 0 {
+		fmt.Println("No incoming changes to managed files")
+	}
+	groups := []struct {
+		title    string
+		statuses string
+	}{
+		{"New", "AC"},
+		{"Modified", "MT"},
+		{"Renamed", "R"},
+		{"Deleted", "D"},
+	}
+	for _, group := range groups {
+		var lines []string
+		for _, change := range plan.Changes {
+			if !strings.Contains(group.statuses, change.Status) {
+				continue
+			}
+			if change.OldPath != "" {
+				lines = append(lines, fmt.Sprintf("%s -> %s", change.OldPath, change.Path))
+			} else {
+				lines = append(lines, change.Path)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%d):\n", group.title, len(lines))
+		for _, line := range lines {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+
+	if len(plan.Links) > 0 {
+		fmt.Printf("Would link %d file(s):\n", len(plan.Links))
+		for _, link := range plan.Links {
+			if link.Replaces != "" {
+				fmt.Printf("  %s -> %s (replaces %s)\n", link.HomePath, link.Source, link.Replaces)
+			} else {
+				fmt.Printf("  %s -> %s\n", link.HomePath, link.Source)
+			}
+		}
+	}
+	for _, path := range plan.Pruned {
+		fmt.Printf("Would prune: %s\n", path)
+	}
+	if len(plan.Dangling) > 0 {
+		fmt.Printf("%d link(s) would be left dangling; use --prune to remove them:\n", len(plan.Dangling))
+		for _, path := range plan.Dangling {
+			fmt.Printf("  %s\n", path)
+		}
+	}
+	fmt.Println("Dry run: nothing was pulled or linked")
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version number",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("dotman version %s\n", version)
+		fmt.Printf("commit: %s\n", commit)
+		fmt.Printf("built: %s\n", date)
+		fmt.Println("repo: https://github.com/Snupai/cli-config-manager")
+	},
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade dotman to the latest version",
+	Long: `Check for and install the latest version of dotman.
+
+This command will:
+1. Check the latest version available on GitHub
+2. Compare it with your current version
+3. Download and install the new version if available
+4. Preserve your configuration and managed files
+5. Create a backup of the current version
+6. Verify the downloaded binary
+
+The download resumes where it stopped when the connection breaks, and
+when upgrade is run again after an interrupted download. The archive is
+checked against the checksums published with the release; a release
+without checksums is not installed.
+
+The release notes of the new version are shown before you are asked to
+upgrade, shortened to their first lines. With --changelog, the full notes
+of the latest release are printed and nothing is upgraded.
+
+Examples:
+  dotman upgrade  # Check and install updates
+  dotman upgrade --changelog  # Read the latest release notes`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if upgradeChangelogFlag {
+			release, err := latestRelease(cmd.Context(), githubToken(cmd.Context()))
+			if err != nil {
+				fmt.Printf("Error checking for updates: %v\n", err)
+				exit(1)
+			}
+			fmt.Printf("dotman %s\n\n", release.TagName)
+			fmt.Println(plainMarkdown(release.Body))
+			return
+		}
+
+		// Get current version
+		currentVersion := version
+		if currentVersion == "dev" {
+			fmt.Println("Cannot check for updates in development version")
+			exit(1)
+		}
+
+		currentVersion = strings.TrimPrefix(currentVersion, "v")
+
+		if verbose {
+			fmt.Printf("Current version: %s\n", currentVersion)
+		}
+
+		// Check if we can write to the binary location
+		currentBinary, err := os.Executable()
+		if err != nil {
+			fatal(err, "Error getting current binary path")
+		}
+
+		// Create backup of current binary
+		backupPath := currentBinary + ".bak"
+		if err := copyFile(currentBinary, backupPath); err != nil {
+			fatal(err, "Error creating backup")
+		}
+		defer os.Remove(backupPath) // Clean up backup if everything succeeds
+
+		ctx := cmd.Context()
+
+		// Authenticate when a token is available, which raises the rate
+		// limit and gives access to private forks
+		token := githubToken(ctx)
+		if verbose && token != "" {
+			fmt.Println("Using a GitHub token for API requests")
+		}
+
+		fmt.Println("Checking for updates...")
+		release, err := latestRelease(ctx, token)
+		if err != nil {
+			fmt.Printf("Error checking for updates: %v\n", err)
+			os.Remove(backupPath)
+			exit(1)
+		}
+
+		latestVersion := strings.TrimPrefix(release.TagName, "v")
+
+		if verbose {
+			fmt.Printf("Latest version: %s\n", latestVersion)
+		}
+
+		if latestVersion == currentVersion {
+			fmt.Printf("You are already using the latest version: %s\n", currentVersion)
+			return
+		}
+
+		fmt.Printf("New version available: %s (current: %s)\n", latestVersion, currentVersion)
+		if notes := releaseNotesPreview(release.Body); notes != "" {
+			fmt.Printf("\n%s\n\n", notes)
+		}
+		fmt.Print("Do you want to upgrade? [y/N]: ")
+
+		reader := bufio.NewReader(os.Stdin)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+
+		if response != "y" {
+			fmt.Println("Upgrade cancelled")
+			return
+		}
+
+		// Determine OS and architecture for archive naming
+		goos := runtime.GOOS
+		goarch := runtime.GOARCH
+		var releaseOS, releaseArch string
+
+		switch goos {
+		case "linux":
+			releaseOS = "Linux"
+		case "darwin":
+			releaseOS = "Darwin"
+		default:
+			fmt.Printf("Unsupported OS: %s\n", goos)
+			exit(1)
+		}
+
+		switch goarch {
+		case "amd64":
+			releaseArch = "x86_64"
+		case "arm64":
+			releaseArch = "arm64"
+		default:
+			fmt.Printf("Unsupported architecture: %s\n", goarch)
+			exit(1)
+		}
+
+		archiveName := fmt.Sprintf("cli-config-manager-%s-%s.tar.gz", releaseOS, releaseArch)
+		downloadURL := fmt.Sprintf(
+			"https://github.com/Snupai/cli-config-manager/releases/download/%s/%s",
+			release.TagName,
+			archiveName,
+		)
+
+		if verbose {
+			fmt.Printf("Download URL: %s\n", downloadURL)
+		}
+
+		tempDir, err := os.MkdirTemp("", "dotman-upgrade")
+		if err != nil {
+			fatal(err, "Error creating temp directory")
+		}
+		defer os.RemoveAll(tempDir)
+
+		// The archive is downloaded to the per-user cache rather than
+		// tempDir, which is removed on every run, so an interrupted download
+		// can be resumed. A partial file in a shared directory could be
+		// planted by another user, so without the cache the download goes
+		// to tempDir and starts over every time.
+		archivePath := filepath.Join(tempDir, archiveName)
+		resumable := false
+		if cfg, err := config.NewWithoutDirectories(); err == nil {
+			if err := os.MkdirAll(cfg.UpgradeCacheDir(), 0700); err == nil {
+				archivePath = filepath.Join(cfg.UpgradeCacheDir(), release.TagName+"-"+archiveName)
+				resumable = true
+			} else if verbose {
+				fmt.Printf("Cannot use %s (%v); the download cannot be resumed\n", cfg.UpgradeCacheDir(), err)
+			}
+		}
+
+		fmt.Println("Downloading new version...")
+		lastProgress := -1
+		err = downloadFile(ctx, downloadURL, token, archivePath, func(done, total int64) {
+			// Update progress every 5%
+			if total <= 0 {
+				return
+			}
+			currentProgress := int(float64(done) / float64(total) * 100)
+			if lastProgress < 0 && done > 0 && currentProgress < 100 {
+				fmt.Printf("Resuming download at %d%%\n", currentProgress)
+			}
+			if currentProgress >= lastProgress+5 {
+				fmt.Printf("\rDownloading: %d%%", currentProgress)
+				lastProgress = currentProgress
+			}
+		})
+		fmt.Println() // New line after progress
+
+		if err != nil {
+			if ctx.Err() != nil {
+				err = fmt.Errorf("download cancelled")
+				if resumable {
+					err = fmt.Errorf("download cancelled; run 'dotman upgrade' again to resume it")
+				}
+			}
+			fmt.Printf("Error downloading new version: %v\n", err)
+			// os.Exit skips deferred cleanup, so remove temp files explicitly
+			os.RemoveAll(tempDir)
+			os.Remove(backupPath)
+			exit(1)
+		}
+		defer os.Remove(archivePath)
+
+		if err := verifyReleaseChecksum(ctx, release.TagName, archiveName, archivePath, token); err != nil {
+			fmt.Printf("Error verifying download: %v\n", err)
+			os.Remove(archivePath)
+			os.RemoveAll(tempDir)
+			os.Remove(backupPath)
+			exit(1)
+		}
+
+		if verbose {
+			fmt.Printf("Archive downloaded to: %s\n", archivePath)
+		}
+
+		fmt.Println("Extracting archive...")
+		if err := untar(archivePath, tempDir, verbose); err != nil {
+			fatal(err, "Error extracting archive")
+		}
+
+		dotmanPath := filepath.Join(tempDir, "dotman")
+		if _, err := os.Stat(dotmanPath); os.IsNotExist(err) {
+			// Try to find it in a subdirectory
+			dotmanPath = ""
+			err = filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
+				if info != nil && info.Name() == "dotman" && !info.IsDir() {
+					dotmanPath = path
+					return io.EOF // stop walking
+				}
+				return nil
+			})
+			if dotmanPath == "" {
+				fmt.Println("dotman binary not found in the archive.")
+				exit(1)
+			}
+		}
+
+		if verbose {
+			fmt.Printf("dotman binary found at: %s\n", dotmanPath)
+		}
+
+		fmt.Println("Installing new version...")
+
+		// Create a temporary file in the same directory as the target
+		tempBinary := currentBinary + ".new"
+		if err := copyFile(dotmanPath, tempBinary); err != nil {
+			fatal(err, "Error copying new version")
+		}
+
+		// Make the temporary file executable
+		if err := os.Chmod(tempBinary, 0755); err != nil {
+			fmt.Printf("Error setting permissions: %v\n", err)
+			os.Remove(tempBinary)
+			exit(1)
+		}
+
+		// Create a temporary script to handle the replacement
+		scriptContent := fmt.Sprintf(`#!/bin/sh
+# Wait a moment for the parent process to exit
+sleep 1
+
+# Replace the binary
+mv %s %s
+
+# Clean up
+rm "$0"
+`, tempBinary, currentBinary)
+
+		scriptPath := filepath.Join(tempDir, "replace.sh")
+		if err := os.WriteFile(scriptPath, []byte(scriptContent), 0755); err != nil {
+			fmt.Printf("Error creating replacement script: %v\n", err)
+			os.Remove(tempBinary)
+			exit(1)
+		}
+
+		// Execute the replacement script in the background
+		replaceCmd := exec.Command(scriptPath)
+		if err := replaceCmd.Start(); err != nil {
+			fmt.Printf("Error starting replacement script: %v\n", err)
+			os.Remove(tempBinary)
+			exit(1)
+		}
+
+		// Wait for the script to complete
+		if err := replaceCmd.Wait(); err != nil {
+			fmt.Printf("Error during binary replacement: %v\n", err)
+			os.Remove(tempBinary)
+			exit(1)
+		}
+
+		fmt.Printf("Successfully upgraded to version %s\n", latestVersion)
+		fmt.Println("\nTo update shell completions, run:")
+		fmt.Println("  source <(dotman completion bash)  # for bash")
+		fmt.Println("  source <(dotman completion zsh)   # for zsh")
+		fmt.Println("  dotman completion fish > ~/.config/fish/completions/dotman.fish  # for fish")
+	},
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup [file...]",
+	Short: "Create a backup of managed configuration files",
+	Long: `Create a backup of managed configuration files.
+
+This command will:
+1. Create a backup of the specified file
+2. Store the backup in the backup store (.dotman/backups, or backup_dir)
+3. Save metadata about the backup including original path and symlink target
+
+With --compress, the content is stored gzipped. Set backup_compress in
+~/.dotman/config.json to compress every backup. Restoring decompresses
+transparently.
+
+Backing up several files at once records them as a session. Its ID is
+printed, and 'dotman restore --session <id>' restores all of them together.
+'dotman backup sessions' lists the recorded sessions.
+
+--note stores why the backup was made. It is shown next to the backup by
+'dotman restore' and 'dotman info', which helps to find the right one later.
+
+Examples:
+  dotman backup ~/.bashrc
+  dotman backup ~/.zshrc --note "before switching to starship"
+  dotman backup ~/.config/i3/config
+  dotman backup --compress ~/.config/nvim/init.lua
+  dotman backup ~/.bashrc ~/.profile ~/.inputrc  # Back up a session`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		opts := manager.BackupOptions{Compress: backupCompressFlag, Note: strings.TrimSpace(backupNoteFlag)}
+		if len(args) > 1 {
+			session, err := m.BackupFiles(args, opts)
+			if err != nil {
+				fatal(err, "Error creating backups")
+			}
+			fmt.Printf("Successfully created backups of %d files in session %s\n", len(args), session.ID)
+			return
+		}
+
+		if err := m.BackupFileWith(args[0], opts); err != nil {
+			fatal(err, "Error creating backup")
+		}
+
+		fmt.Printf("Successfully created backup of %s\n", args[0])
+	},
+}
+
+var backupSessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List backup sessions",
+	Long: `List backup sessions, oldest first.
+
+A session is recorded when several files are backed up with one 'dotman
+backup' command. Restore one with 'dotman restore --session <id>'.
+
+Examples:
+  dotman backup sessions
+  dotman backup sessions --json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		sessions, err := m.ListSessions()
+		if err != nil {
+			fatal(err, "Error listing sessions")
+		}
+
+		if jsonFlag {
+			if sessions == nil {
+				sessions = []manager.BackupSession{}
+			}
+			data, err := json.MarshalIndent(sessions, "", "  ")
+			if err != nil {
+				fatal(err, "Error encoding JSON")
+			}
+			fmt.Println(string(data))
+			return
+		}
+
+		if len(sessions) == 0 {
+			fmt.Println("No backup sessions available")
+			return
+		}
+
+		fmt.Println("Available backup sessions:")
+		for _, session := range sessions {
+			fmt.Printf("  %s - %s (%d files)\n", session.ID, session.Timestamp.Format("2006-01-02 15:04:05"), len(session.Backups))
+		}
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [backup_id]",
+	Short: "Restore a file from a backup",
+	Long: `Restore a file from a backup.
+
+This command will:
+1. List available backups if no backup_id is provided
+2. Restore the specified backup to its original location
+3. Recreate the symlink if it existed
+
+With --latest, the argument is a file path instead of a backup ID and the
+most recent backup of that file is restored.
+
+With --author-date, restoring a managed file commits it to the dotman
+repository with the backup's timestamp as the author date and the backup ID
+in the commit message, so the history shows when that version was current.
+
+With --dry-run, nothing is written. Instead the plan is printed: the path
+that would be restored, whether an existing file would be overwritten and
+whether a symlink would be recreated. This also works in read-only mode.
+
+With --stdout, the backed-up content is written to stdout instead of being
+restored, decrypted and decompressed as needed.
+
+With --session, every backup of a session recorded by 'dotman backup' with
+several files is restored. All backups are read and verified first, and if
+restoring one fails, the files already restored are put back, so the
+session is restored completely or not at all.
+
+If the file being restored over was modified after the backup was taken
+and differs from it, restoring would throw away those edits. restore then
+shows both times and asks for confirmation, or fails when stdin is not a
+terminal. --force restores without asking.
+
+Examples:
+  dotman restore  # List available backups
+  dotman restore 2024-02-20-123456  # Restore specific backup
+  dotman restore --latest ~/.bashrc  # Restore the newest backup of a file
+  dotman restore --author-date 2024-02-20-123456  # Restore and commit with the backup's date
+  dotman restore --dry-run --latest ~/.bashrc  # Show what restoring would do
+  dotman restore --stdout --latest ~/.bashrc | diff - ~/.bashrc  # Compare with a backup
+  dotman restore --session 2024-02-20-123456  # Restore every file of a session
+  dotman restore --force --latest ~/.bashrc  # Overwrite newer edits without asking`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		if err := applyModeFlags(cfg); err != nil {
+			fatal(err, "Error")
+		}
+
+		if restoreLatestFlag && len(args) == 0 {
+			fatalf(manager.CodeInvalidArgument, "--latest requires a file path")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if restoreSessionFlag != "" {
+			if len(args) > 0 {
+				fatalf(manager.CodeInvalidArgument, "--session takes no backup ID")
+			}
+			restoreSession(m, restoreSessionFlag)
+			return
+		}
+
+		if len(args) == 0 {
+			// List available backups
+			backups, err := m.ListBackups()
+			if err != nil {
+				fatal(err, "Error listing backups")
+			}
+
+			if len(backups) == 0 {
+				fmt.Println("No backups available")
+				return
+			}
+
+			fmt.Println("Available backups:")
+			for _, backup := range backups {
+				if backup.Note != "" {
+					fmt.Printf("  %s - %s  # %s\n", backup.ID, backup.OriginalPath, backup.Note)
+				} else {
+					fmt.Printf("  %s - %s\n", backup.ID, backup.OriginalPath)
+				}
+			}
+			return
+		}
+
+		backupID := args[0]
+		if restoreLatestFlag {
+			backup, ok := m.LatestBackupFor(args[0])
+			if !ok {
+				fatalf(manager.CodeNotFound, "no backups found for %s", args[0])
+			}
+			backupID = backup.ID
+		}
+
+		if restoreStdoutFlag {
+			content, err := m.BackupContent(backupID)
+			if err != nil {
+				fatal(err, "Error reading backup")
+			}
+			if _, err := os.Stdout.Write(content); err != nil {
+				fatal(err, "Error writing backup")
+			}
+			return
+		}
+
+		opts := restoreOptions()
+		if restoreDryRunFlag {
+			plan, err := m.PlanRestore(backupID, opts)
+			if err != nil {
+				fatal(err, "Error planning restore")
+			}
+			printRestorePlan(plan)
+			return
+		}
+
+		// Restore specific backup
+		if err := m.RestoreBackupWith(backupID, opts); err != nil {
+			if errors.Is(err, errRestoreCancelled) {
+				fmt.Println("Restore cancelled")
+				return
+			}
+			fatal(err, "Error restoring backup")
+		}
+
+		fmt.Printf("Successfully restored backup %s\n", backupID)
+	},
+}
+
+// restoreSession restores or, with --dry-run, plans restoring a session
+func restoreSession(m *manager.Manager, sessionID string) {
+	opts := restoreOptions()
+	if restoreDryRunFlag {
+		plans, err := m.PlanRestoreSession(sessionID, opts)
+		if err != nil {
+			fatal(err, "Error planning restore")
+		}
+		if jsonFlag {
+			data, err := json.MarshalIndent(plans, "", "  ")
+			if err != nil {
+				fatal(err, "Error encoding JSON")
+			}
+			fmt.Println(string(data))
+			return
+		}
+		for _, plan := range plans {
+			printRestorePlan(plan)
+		}
+		return
+	}
+
+	if err := m.RestoreSession(sessionID, opts); err != nil {
+		if errors.Is(err, errRestoreCancelled) {
+			fmt.Println("Restore cancelled")
+			return
+		}
+		fatal(err, "Error restoring session")
+	}
+	fmt.Printf("Successfully restored session %s\n", sessionID)
+}
+
+// restoreOptions returns the RestoreOptions the restore flags ask for. Newer
+// files are confirmed on the terminal; without one, restoring over them
+// fails unless --force is given.
+func restoreOptions() manager.RestoreOptions {
+	opts := manager.RestoreOptions{AuthorDate: restoreAuthorDateFlag, Force: restoreForceFlag}
+	if isTerminal(os.Stdin) {
+		opts.ConfirmNewer = confirmNewerRestore
+	}
+	return opts
+}
+
+// errRestoreCancelled is returned by confirmNewerRestore when the user
+// keeps the newer file
+var errRestoreCancelled = errors.New("restore cancelled")
+
+// confirmNewerRestore asks whether to restore over a file that was modified
+// after the backup was taken
+func confirmNewerRestore(plan manager.RestorePlan) error {
+	fmt.Printf("%s was modified after the backup was taken:\n", plan.WriteTarget)
+	fmt.Printf("  current file:  %s\n", plan.ExistingModTime.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  backup %s: %s\n", plan.Backup.ID, plan.Backup.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Print("Overwrite it with the older backup? [y/N]: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	if strings.TrimSpace(strings.ToLower(response)) != "y" {
+		return errRestoreCancelled
+	}
+	return nil
+}
+
+// printRestorePlan prints what restoring a backup would do
+func printRestorePlan(plan manager.RestorePlan) {
+	if jsonFlag {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			fatal(err, "Error encoding JSON")
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if plan.Backup.Note != "" {
+		fmt.Printf("Restoring backup %s (%s) would:\n", plan.Backup.ID, plan.Backup.Note)
+	} else {
+		fmt.Printf("Restoring backup %s would:\n", plan.Backup.ID)
+	}
+	if plan.CreateParents {
+		fmt.Printf("  - create the directory %s\n", filepath.Dir(plan.Destination))
+	}
+	switch {
+	case plan.Overwrites && plan.WriteTarget != plan.Destination:
+		fmt.Printf("  - overwrite %s, which %s links to\n", plan.WriteTarget, plan.Destination)
+	case plan.Overwrites:
+		fmt.Printf("  - overwrite the existing file %s\n", plan.Destination)
+	default:
+		fmt.Printf("  - create %s\n", plan.WriteTarget)
+	}
+	if plan.Newer {
+		fmt.Printf("    which was modified %s, after the backup was taken %s\n",
+			plan.ExistingModTime.Format("2006-01-02 15:04:05"), plan.Backup.Timestamp.Format("2006-01-02 15:04:05"))
+	}
+	if plan.Symlink != "" {
+		fmt.Printf("  - recreate the symlink %s -> %s\n", plan.Destination, plan.Symlink)
+	}
+	if plan.Commit {
+		fmt.Printf("  - commit the restored file dated %s\n", plan.Backup.Timestamp.Format(time.RFC3339))
+	}
+	fmt.Println("Nothing was changed (dry run)")
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove files dotman no longer needs",
+	Long: `Remove files that accumulate in the dotman directory over time:
+
+- saved health check results beyond the newest --keep-health (default 10)
+- documentation of files that are no longer managed
+- invalid backups: those with missing metadata or content, or content that
+  does not match its checksum
+- dotman.bak and dotman.new binaries left by an interrupted upgrade, and
+  partial downloads in $XDG_CACHE_HOME/dotman/upgrade
+
+Invalid backups are only removed after confirmation, or with --yes. Managed
+files and valid backups are never touched. With --dry-run nothing is
+removed; the files that would be are listed instead, which also works in
+read-only mode.
+
+Examples:
+  dotman gc --dry-run
+  dotman gc
+  dotman gc --keep-health 3 --yes`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+		if gcKeepHealthFlag < 0 {
+			fatalf(manager.CodeInvalidArgument, "--keep-health must not be negative")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		opts := manager.GCOptions{DryRun: true, KeepHealth: gcKeepHealthFlag, InvalidBackups: true}
+		if exe, err := os.Executable(); err == nil {
+			opts.Executable = exe
+		}
+
+		report, err := m.GarbageCollect(opts)
+		if err != nil {
+			fatal(err, "Error collecting garbage")
+		}
+		if !gcDryRunFlag {
+			opts.DryRun = false
+			opts.InvalidBackups = gcYesFlag || confirmInvalidBackups(report)
+			if report, err = m.GarbageCollect(opts); err != nil {
+				fatal(err, "Error collecting garbage")
+			}
+		}
+
+		printGCReport(report)
+	},
+}
+
+// confirmInvalidBackups asks whether the invalid backups in report may be
+// removed. Without a terminal to ask on, they are kept.
+func confirmInvalidBackups(report manager.GCReport) bool {
+	var backups []manager.GCItem
+	for _, item := range report.Removed {
+		if item.Kind == "backup" {
+			backups = append(backups, item)
+		}
+	}
+	if len(backups) == 0 || jsonFlag || !isTerminal(os.Stdin) {
+		return false
+	}
+
+	fmt.Printf("Found %d invalid backup(s):\n", len(backups))
+	for _, item := range backups {
+		fmt.Printf("  %s (%s)\n", item.Path, item.Reason)
+	}
+	fmt.Print("Remove them? [y/N]: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	response, _ := reader.ReadString('\n')
+	return strings.TrimSpace(strings.ToLower(response)) == "y"
+}
+
+// printGCReport prints what 'dotman gc' removed
+func printGCReport(report manager.GCReport) {
+	if jsonFlag {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fatal(err, "Error encoding JSON")
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	verb := "Removed"
+	if gcDryRunFlag {
+		verb = "Would remove"
+	}
+	for _, item := range report.Removed {
+		fmt.Printf("%s %s (%s, %s)\n", verb, item.Path, item.Reason, config.FormatSize(item.Size))
+	}
+	for _, item := range report.Kept {
+		fmt.Printf("Kept %s (%s); rerun with --yes to remove it\n", item.Path, item.Reason)
+	}
+
+	switch {
+	case len(report.Removed) == 0:
+		fmt.Println("Nothing to clean up")
+	case gcDryRunFlag:
+		fmt.Printf("Would reclaim %s (dry run, nothing was removed)\n", config.FormatSize(report.Reclaimed))
+	default:
+		fmt.Printf("Reclaimed %s\n", config.FormatSize(report.Reclaimed))
+	}
+}
+
+var healthCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the health of your dotfile configuration",
+	Long: `Verify the health and integrity of your dotfile configuration.
+
+This command will:
+1. Check for broken symbolic links
+2. Verify file permissions
+3. Check git repository status
+4. Verify backup integrity
+5. Check for file conflicts
+6. Check for outdated configurations
+7. Monitor disk space
+8. Check for uncommitted changes
+9. Check that sensitive directories (~/.ssh, ~/.gnupg) are not world-readable
+10. Check for overlapping managed paths
+11. Check for managed files above max_file_size
+12. Check that managed links use the configured symlink_style
+13. Check for configs that are not committed, or have uncommitted changes
+
+The results are saved for future reference in $XDG_STATE_HOME/dotman/health
+(~/.local/state/dotman/health by default), except in read-only mode or
+with --no-save.
+
+With --report, the results are also written to a file of your choice, as
+JSON (the same summary --output json prints) or, with --format junit, as
+JUnit XML that CI systems can display like test results. Each check is a
+test case; errors are failures, and warnings pass with their message as
+output.
+
+Results are marked with emoji when the locale (LC_ALL, LC_CTYPE or LANG)
+is UTF-8, and with [OK], [WARN] and [FAIL] otherwise. Use --no-emoji to
+always use the plain labels. With --output json, a summary with the number
+of results per severity and every result is printed instead.
+
+Files that are intentionally unlinked or old can be left out of the symlink,
+conflict and outdated checks with .dotmanignore-style patterns, listed in
+health_exclude in ~/.dotman/config.json or in a file given with
+--exclude-from. Excluded files are listed after the results.
+
+Exit codes:
+  0  no result reached the --fail-on severity
+  1  dotman could not run the checks
+  2  the most severe result is a warning
+  3  at least one result is an error
+
+--fail-on sets the lowest severity that makes the command exit non-zero:
+  none     always exit 0 once the checks ran
+  warning  exit 2 on warnings and 3 on errors
+  error    exit 3 on errors only (default)
+
+Examples:
+  dotman check  # Run all health checks
+  dotman check --no-emoji  # Use plain [OK]/[WARN]/[FAIL] labels
+  dotman check --output json --fail-on warning  # For monitoring
+  dotman check --report health.xml --format junit --no-save  # For CI
+  dotman check --fix  # Run checks and attempt to fix issues
+  dotman check --exclude-from ~/.config/dotman/health-exclude  # Skip known exceptions`,
+	Run: func(cmd *cobra.Command, args []string) {
+		switch checkOutputFlag {
+		case "text", "json":
+		default:
+			fatalf(manager.CodeInvalidArgument, "invalid --output %q (expected 'text' or 'json')", checkOutputFlag)
+		}
+		switch checkFailOnFlag {
+		case "none", manager.SeverityWarning, manager.SeverityError:
+		default:
+			fatalf(manager.CodeInvalidArgument, "invalid --fail-on %q (expected 'none', 'warning' or 'error')", checkFailOnFlag)
+		}
+		if cmd.Flags().Changed("format") && checkReportFlag == "" {
+			fatalf(manager.CodeInvalidArgument, "--format can only be used with --report")
+		}
+		if !slices.Contains(manager.HealthReportFormats, checkFormatFlag) {
+			fatalf(manager.CodeInvalidArgument, "invalid --format %q (expected %s)", checkFormatFlag, strings.Join(manager.HealthReportFormats, " or "))
+		}
+		if checkParallel < 0 {
+			fatalf(manager.CodeInvalidArgument, "--parallel must not be negative")
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		if jsonFlag {
+			checkOutputFlag = "json"
+		}
+
+		// Keep progress messages out of the JSON document
+		logOut := io.Writer(os.Stdout)
+		if checkOutputFlag == "json" {
+			logOut = os.Stderr
+		}
+
+		m := manager.NewWithLogger(cfg, logOut)
+		// Failed checks are reported through the results; an error without
+		// results means the checks could not run at all
+		opts := manager.HealthOptions{
+			ExcludeFrom: checkExcludeFlag,
+			NoSave:      checkNoSaveFlag || !checkSaveFlag,
+			Parallel:    checkParallel,
+		}
+		if isTerminal(os.Stderr) {
+			opts.Progress = backupVerifyProgress
+		}
+		results, err := m.HealthCheckWith(opts)
+		if results == nil && err != nil {
+			fatal(err, "Error running health check")
+		}
+		summary := manager.SummarizeHealth(results)
+
+		if checkReportFlag != "" {
+			if err := manager.WriteHealthReport(checkReportFlag, checkFormatFlag, summary); err != nil {
+				fatal(err, "Error writing health report")
+			}
+			fmt.Fprintf(logOut, "Wrote %s report to %s\n", checkFormatFlag, checkReportFlag)
+		}
+
+		if checkOutputFlag == "json" {
+			data, err := json.MarshalIndent(summary, "", "  ")
+			if err != nil {
+				fatal(err, "Error encoding JSON")
+			}
+			fmt.Println(string(data))
+		} else {
+			printHealthResults(results, !checkNoEmojiFlag && supportsEmoji())
+			fmt.Printf("Health check completed: %d error(s), %d warning(s)\n", summary.Errors, summary.Warnings)
+			if len(summary.Excluded) > 0 {
+				fmt.Printf("Excluded %d file(s): %s\n", len(summary.Excluded), strings.Join(summary.Excluded, ", "))
+			}
+		}
+
+		exit(healthExitCode(summary.Severity, checkFailOnFlag))
+	},
+}
+
+// backupVerifyProgress shows how many backups 'dotman check' verified on
+// one line of stderr, and clears it once all are done
+func backupVerifyProgress(done, total int) {
+	if done < total {
+		fmt.Fprintf(os.Stderr, "\rVerifying backups: %d/%d", done, total)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r%s\r", strings.Repeat(" ", len(fmt.Sprintf("Verifying backups: %d/%d", total, total))))
+}
+
+// healthExitCode returns the exit code of 'dotman check' for the most severe
+// result, or 0 when it is below the failOn severity
+func healthExitCode(severity, failOn string) int {
+	switch {
+	case failOn == "none":
+		return 0
+	case severity == manager.SeverityError:
+		return exitHealthError
+	case severity == manager.SeverityWarning && failOn == manager.SeverityWarning:
+		return exitHealthWarning
+	}
+	return 0
+}
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema <backup|health|doc>",
+	Short: "Print the JSON Schema of a file dotman writes",
+	Long: `Print the JSON Schema of one of the JSON files dotman writes, for
+validators and for editors that complete and check JSON:
+
+  backup  metadata.json of a backup in the backup store
+  health  the results saved by 'dotman check' in the health state directory
+  doc     the .json metadata 'dotman docs' writes next to each file's page
+
+The schemas are generated from the structures dotman writes the files from,
+so they always match the running version.
+
+Examples:
+  dotman schema backup > backup.schema.json
+  dotman schema health`,
+	ValidArgs: manager.SchemaNames,
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	Run: func(cmd *cobra.Command, args []string) {
+		schema, err := manager.Schema(args[0])
+		if err != nil {
+			fatal(err, "Error")
+		}
+		fmt.Println(string(schema))
+	},
+}
+
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate documentation for your configuration files",
+	Long: `Generate comprehensive documentation for your managed configuration files.
+
+This command will:
+1. Create a main README with an overview of all configurations
+2. Generate individual documentation for each configuration file
+3. Detect and document dependencies and tags
+4. Save metadata in JSON format for programmatic access
+
+The documentation is generated in the .dotman/docs directory.
+
+Formats (--format):
+  markdown  README.md plus a Markdown page and JSON metadata per file (default)
+  html      Self-contained HTML pages with an index.html, ready to serve statically
+  json      A single aggregated index.json
+
+Examples:
+  dotman docs  # Generate all documentation
+  dotman docs --update  # Update existing documentation
+  dotman docs --format html`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		renderer, err := manager.NewDocRenderer(docsFormatFlag)
+		if err != nil {
+			fatal(err, "Error")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if err := m.GenerateDocsWith(renderer); err != nil {
+			fatal(err, "Error generating documentation")
+		}
+
+		fmt.Println("Documentation generated successfully")
+	},
+}
+
+var pushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Push changes to the remote repository",
+	Long: `Push your committed changes to the remote repository.
+
+This command will:
+1. Push all committed changes to the remote repository
+2. Show the status of the push operation
+
+Use this command after:
+- Adding new files
+- Making changes to existing files
+- Committing changes
+
+Example:
+  dotman push`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if err := m.Push(); err != nil {
+			fatal(err, "Error pushing changes")
+		}
+
+		fmt.Println("Successfully pushed changes to remote repository")
+	},
+}
+
+var removeCmd = &cobra.Command{
+	Use:   "remove [file]",
+	Short: "Remove a file from dotman management",
+	Long: `Remove a file from dotman management.
+
+This command will:
+1. Copy the file back to its original location
+2. Remove the symbolic link
+3. Remove the file from git tracking
+4. Commit the removal
+
+The file will no longer be managed by dotman but will remain in its original location.
+
+With --restore, the real file that 'dotman add --rename-on-conflict' renamed
+out of the way is moved back instead, and the managed content is dropped
+from the home directory.
+
+Directories in ~/.dotman/configs that the removal leaves empty are removed
+as well. Use --no-prune to keep them.
+
+Examples:
+  dotman remove ~/.bashrc
+  dotman remove ~/.config/i3/config
+  dotman remove .vimrc
+  dotman remove --restore ~/.config/tool/config  # Put back the renamed original`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if err := m.RemoveFileWith(args[0], manager.RemoveOptions{
+			RestoreOriginal: removeRestoreFlag,
+			KeepEmptyDirs:   removeNoPruneFlag,
+		}); err != nil {
+			fatal(err, "Error removing file")
+		}
+
+		fmt.Printf("Successfully removed %s from dotman management\n", args[0])
+	},
+}
+
+var suggestCmd = &cobra.Command{
+	Use:   "suggest",
+	Short: "Suggest unmanaged dotfiles that could be added",
+	Long: `Scan common locations for dotfiles that are not managed by dotman yet.
+
+This command will:
+1. Look at ~/.*rc files and files in ~/.config
+2. Skip files that are already managed or matched by .dotmanignore
+3. Print each candidate with its detected tags
+
+Nothing is modified. Patterns in ~/.dotman/.dotmanignore (one glob per line)
+exclude matching paths from the suggestions.
+
+Examples:
+  dotman suggest
+  dotman suggest | dotman add --from -`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		suggestions, err := m.Suggest()
+		if err != nil {
+			fatal(err, "Error scanning for dotfiles")
+		}
+
+		if len(suggestions) == 0 {
+			fmt.Println("# No unmanaged dotfiles found")
+			return
+		}
+
+		for _, suggestion := range suggestions {
+			if len(suggestion.Tags) > 0 {
+				fmt.Printf("%s  # %s\n", suggestion.Path, strings.Join(suggestion.Tags, ", "))
+			} else {
+				fmt.Println(suggestion.Path)
+			}
+		}
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [file] | --backup <id1> <id2>",
+	Short: "Show differences in managed configuration files",
+	Long: `Show differences in managed configuration files.
+
+Without --remote, this command compares managed files with the files in
+your home directory. A linked file is always identical, so only files with
+a real file in place of the link are compared: copies made by 'dotman
+mirror', or files that were in the way when the repository was cloned.
+The unified diff goes from the managed file to the home file. Give a file
+to compare just that one.
+
+With --tool, each differing file is opened in an external diff tool
+instead: the diff_tool command from ~/.dotman/config.json, called with the
+managed file and the home file, or otherwise the diff.tool configured for
+git (see 'git difftool'). Without a configured tool or a terminal, the
+built-in diff is printed.
+
+With --remote, this command will:
+1. Fetch the latest changes from the remote repository
+2. Compare them with your local repository
+3. List the managed files that 'dotman update' would add, modify or delete
+
+Nothing in your working tree is changed.
+
+With --backup, two backups are compared instead, to see how a config
+changed between them. The unified diff goes from the first backup to the
+second. Comparing backups of different files works, with a warning.
+
+Examples:
+  dotman diff
+  dotman diff ~/.bashrc --tool
+  dotman diff --remote
+  dotman diff --backup 2024-01-02-150405-1 2024-03-01-091500-1`,
+	Args: cobra.MaximumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		if diffBackupFlag {
+			diffBackups(cfg, args)
+			return
+		}
+		if len(args) > 1 {
+			fatalf(manager.CodeInvalidArgument, "diff compares one file at a time; use --backup to compare two backups")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if !diffRemoteFlag {
+			diffLocal(cfg, m, args)
+			return
+		}
+
+		if len(args) > 0 {
+			fatalf(manager.CodeInvalidArgument, "--remote compares the whole repository and takes no file")
+		}
+		changes, err := m.RemoteDiff()
+		if err != nil {
+			fatal(err, "Error comparing with remote")
+		}
+
+		if len(changes) == 0 {
+			fmt.Println("No incoming changes to managed files")
+			return
+		}
+
+		fmt.Println("Incoming changes:")
+		for _, change := range changes {
+			if change.OldPath != "" {
+				fmt.Printf("  %-9s %s -> %s\n", change.Description(), change.OldPath, change.Path)
+			} else {
+				fmt.Printf("  %-9s %s\n", change.Description(), change.Path)
+			}
+		}
+	},
+}
+
+// diffBackups prints the diff between the two backups named by args. The
+// warning about backups of different files goes to stderr, so the diff
+// can be piped.
+func diffBackups(cfg *config.Config, args []string) {
+	if len(args) != 2 {
+		fatalf(manager.CodeInvalidArgument, "--backup compares two backups; give both IDs (see 'dotman restore')")
+	}
+
+	m := manager.NewWithLogger(cfg, os.Stderr)
+	diff, err := m.DiffBackups(args[0], args[1])
+	if err != nil {
+		fatal(err, "Error comparing backups")
+	}
+	if diff == "" {
+		fmt.Printf("Backups %s and %s have the same content\n", args[0], args[1])
+		return
+	}
+	fmt.Print(diff)
+}
+
+// diffLocal shows how the home files named by args, or all of them, differ
+// from their managed files, in the diff tool with --tool
+func diffLocal(cfg *config.Config, m *manager.Manager, args []string) {
+	changes, err := m.LocalChanges(args)
+	if err != nil {
+		fatal(err, "Error comparing files")
+	}
+	if len(changes) == 0 {
+		fmt.Println("No home file differs from its managed file")
+		return
+	}
+
+	tool := diffTool(cfg)
+	for _, change := range changes {
+		if tool == nil {
+			if err := m.WriteLocalDiff(os.Stdout, change); err != nil {
+				fatal(err, "Error")
+			}
+			continue
+		}
+
+		fmt.Printf("Comparing %s with %s\n", change.Source, change.HomePath)
+		if err := tool(change.Source, change.HomePath); err != nil {
+			fatal(err, "Error running diff tool")
+		}
+	}
+}
+
+// diffTool returns a function that opens two files in the external diff
+// tool for --tool, or nil when the built-in diff should be printed: without
+// --tool, without a terminal to run the tool on, or without a configured
+// tool, which is reported
+func diffTool(cfg *config.Config) func(managed, home string) error {
+	if !diffToolFlag {
+		return nil
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		fmt.Fprintln(os.Stderr, "Not running in a terminal; showing the built-in diff")
+		return nil
+	}
+
+	command := strings.Fields(cfg.Settings.DiffTool)
+	if len(command) == 0 {
+		output, _ := exec.Command("git", "config", "diff.tool").Output()
+		if strings.TrimSpace(string(output)) == "" {
+			fmt.Fprintln(os.Stderr, "No diff tool configured (set diff_tool in ~/.dotman/config.json or diff.tool for git); showing the built-in diff")
+			return nil
+		}
+		command = []string{"git", "difftool", "--no-index", "--no-prompt", "--"}
+	}
+
+	return func(managed, home string) error {
+		tool := exec.Command(command[0], append(command[1:], managed, home)...)
+		tool.Stdin, tool.Stdout, tool.Stderr = os.Stdin, os.Stdout, os.Stderr
+		// Like diff, tools may exit with 1 to say that the files differ
+		var exitErr *exec.ExitError
+		if err := tool.Run(); err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+			return fmt.Errorf("%s: %v", command[0], err)
+		}
+		return nil
+	}
+}
+
+var submoduleCmd = &cobra.Command{
+	Use:   "submodule",
+	Short: "Manage git submodules inside the configs directory",
+	Long: `Manage configuration directories that come from other git repositories.
+
+Submodules let you share a set of configs (like a vim plugin set) between
+your dotfiles and another repository. Files inside a submodule are linked
+like any other managed file.
+
+Limitations:
+- Submodule contents are committed in their own repository; dotman only
+  records the submodule revision in your dotfiles repository
+- 'dotman add' cannot add files that live inside a submodule
+- 'dotman remove' does not remove submodules
+
+Examples:
+  dotman submodule add https://github.com/user/vim-plugins.git .vim/pack/shared`,
+}
+
+var submoduleAddCmd = &cobra.Command{
+	Use:   "add [url] [configs-path]",
+	Short: "Register a directory in the configs directory as a git submodule",
+	Long: `Register a directory in the configs directory as a git submodule.
+
+This command will:
+1. Add the repository as a submodule at the given configs-relative path
+2. Commit the submodule to your dotfiles repository
+
+The configs path is relative to the configs directory, which mirrors your
+home directory.
+
+Examples:
+  dotman submodule add https://github.com/user/vim-plugins.git .vim/pack/shared`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := loadConfig()
+		if err != nil {
+			fatal(err, "Error creating config")
+		}
+
+		m := manager.NewWithLogger(cfg, os.Stdout)
+		if err := m.AddSubmodule(args[0], args[1]); err != nil {
+			fatal(err, "Error adding submodule")
+		}
+
+		fmt.Printf("Successfully added submodule %s\n", args[1])
+		fmt.Println("Run 'dotman link' to link the submodule contents")
+	},
+}
+
+// readPathList reads paths one per line from a file, or from stdin when source is "-"
+func readPathList(source string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if source != "-" {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, scanner.Err()
+}
+
+// httpGet performs a GET request that is aborted when ctx is cancelled. A
+// non-empty token is sent as a bearer token; the client drops it when a
+// download redirects to another host.
+func httpGet(ctx context.Context, url, token string) (*http.Response, error) {
+	return httpGetFrom(ctx, url, token, 0)
+}
+
+// httpGetFrom is httpGet asking only for the content from byte offset on.
+// The server may ignore the range and send everything.
+func httpGetFrom(ctx context.Context, url, token string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// maxDownloadAttempts is how often downloadFile resumes a download that
+// broke off before giving up
+const maxDownloadAttempts = 5
+
+// downloadFile downloads url to dest. The content is written to
+// dest+".part" first, which is kept when the download fails, so the next
+// call resumes from where it stopped; within one call, a download that
+// breaks off is resumed up to maxDownloadAttempts times. The partial file
+// is locked, so two upgrades running at once do not write to it together.
+// Servers that do not support range requests get the file downloaded from
+// the start. progress, if set, is called with the bytes downloaded so far
+// and the total size, which is -1 when the server does not report it.
+func downloadFile(ctx context.Context, url, token, dest string, progress func(done, total int64)) error {
+	partPath := dest + ".part"
+	part, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", partPath, err)
+	}
+	defer part.Close()
+	if err := syscall.Flock(int(part.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return fmt.Errorf("another upgrade is already downloading to %s", partPath)
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := downloadRange(ctx, url, token, part, progress)
+		if err == nil {
+			break
+		}
+		if !retry || attempt == maxDownloadAttempts || ctx.Err() != nil {
+			return err
+		}
+		if verbose {
+			fmt.Printf("\nDownload interrupted (%v), resuming...\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+
+	if err := part.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partPath, dest)
+}
+
+// downloadRange appends the part of url that part does not hold yet and
+// checks that the result is complete. retry reports whether another
+// attempt may succeed, as opposed to errors such as a missing release.
+func downloadRange(ctx context.Context, url, token string, part *os.File, progress func(done, total int64)) (retry bool, err error) {
+	offset, err := part.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := httpGetFrom(ctx, url, token, offset)
+	if err != nil {
+		return true, fmt.Errorf("network error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	total := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return true, restartDownload(part, "unexpected range in response")
+		}
+		total = size
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file does not belong to the file being downloaded
+		return true, restartDownload(part, "partial download does not match")
+	case http.StatusOK:
+		// The range was ignored, so the whole file is coming
+		if offset > 0 {
+			if err := part.Truncate(0); err != nil {
+				return false, err
+			}
+			if _, err := part.Seek(0, io.SeekStart); err != nil {
+				return false, err
+			}
+			offset = 0
+		}
+		total = resp.ContentLength
+	default:
+		return false, githubResponseError(resp, token != "")
+	}
+
+	done := offset
+	if progress != nil {
+		progress(done, total)
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		nr, er := resp.Body.Read(buf)
+		if nr > 0 {
+			if _, ew := part.Write(buf[:nr]); ew != nil {
+				return false, ew
+			}
+			done += int64(nr)
+			if progress != nil {
+				progress(done, total)
+			}
+		}
+		if er == io.EOF {
+			break
+		}
+		if er != nil {
+			return true, er
+		}
+	}
+
+	if total >= 0 && done != total {
+		return true, fmt.Errorf("download incomplete: got %d of %d bytes", done, total)
+	}
+	return false, nil
+}
+
+// restartDownload empties the partial file so the next attempt downloads
+// everything, returning an error that explains why
+func restartDownload(part *os.File, reason string) error {
+	if err := part.Truncate(0); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s, starting over", reason)
+}
+
+// parseContentRange parses a Content-Range header like
+// "bytes 100-199/1000" into the first byte and the total size
+func parseContentRange(header string) (start, total int64, ok bool) {
+	var end int64
+	if _, err := fmt.Sscanf(header, "bytes %d-%d/%d", &start, &end, &total); err != nil {
+		return 0, 0, false
+	}
+	return start, total, start <= end && end < total
+}
+
+// verifyReleaseChecksum compares the SHA-256 of the downloaded archive with
+// the checksums file published with the release. A release without one is
+// refused, as the archive cannot be verified.
+func verifyReleaseChecksum(ctx context.Context, tag, archiveName, archivePath, token string) error {
+	checksumsName := fmt.Sprintf("cli-config-manager_%s_checksums.txt", strings.TrimPrefix(tag, "v"))
+	resp, err := httpGet(ctx, fmt.Sprintf("https://github.com/Snupai/cli-config-manager/releases/download/%s/%s", tag, checksumsName), token)
+	if err != nil {
+		return fmt.Errorf("network error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("release %s publishes no %s, so the download cannot be verified; install it manually from the release page if you trust it", tag, checksumsName)
+	}
+	if err := githubResponseError(resp, token != ""); err != nil {
+		return err
+	}
+
+	var want string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == archiveName {
+			want = strings.ToLower(fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading %s: %v", checksumsName, err)
+	}
+	if want == "" {
+		return fmt.Errorf("%s has no checksum for %s", checksumsName, archiveName)
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", archiveName, want, got)
+	}
+	if verbose {
+		fmt.Printf("Checksum verified: %s\n", want)
+	}
+	return nil
+}
+
+// githubToken returns a token for the GitHub API from GITHUB_TOKEN, GH_TOKEN
+// or the GitHub CLI, or "" to make anonymous requests
+func githubToken(ctx context.Context) string {
+	for _, name := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if token := strings.TrimSpace(os.Getenv(name)); token != "" {
+			return token
+		}
+	}
+
+	if _, err := exec.LookPath("gh"); err != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "gh", "auth", "token").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// githubRelease is the part of a GitHub release that upgrade uses
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Body    string `json:"body"`
+}
+
+// latestRelease fetches the latest dotman release from GitHub
+func latestRelease(ctx context.Context, token string) (githubRelease, error) {
+	resp, err := httpGet(ctx, "https://api.github.com/repos/Snupai/cli-config-manager/releases/latest", token)
+	if err != nil {
+		return githubRelease{}, fmt.Errorf("network error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if err := githubResponseError(resp, token != ""); err != nil {
+		return githubRelease{}, err
+	}
+
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return githubRelease{}, fmt.Errorf("error parsing release info: %v", err)
+	}
+	return release, nil
+}
+
+// releaseNotesPreviewLines is how many lines of release notes upgrade shows
+// before asking to upgrade
+const releaseNotesPreviewLines = 15
+
+// releaseNotesPreview returns the first lines of release notes as plain
+// text, pointing at --changelog when there is more
+func releaseNotesPreview(body string) string {
+	lines := strings.Split(plainMarkdown(body), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return ""
+	}
+	if len(lines) <= releaseNotesPreviewLines {
+		return strings.Join(lines, "\n")
+	}
+	preview := strings.Join(lines[:releaseNotesPreviewLines], "\n")
+	return fmt.Sprintf("%s\n... %d more lines, see 'dotman upgrade --changelog'", preview, len(lines)-releaseNotesPreviewLines)
+}
+
+// Markdown syntax that plainMarkdown rewrites
+var (
+	markdownComment = regexp.MustCompile(`(?s)<!--.*?-->`)
+	markdownHeading = regexp.MustCompile(`^#{1,6}\s+`)
+	markdownBullet  = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	markdownImage   = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+	markdownStrong  = regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`)
+	markdownCode    = regexp.MustCompile("`([^`]+)`")
+)
+
+// plainMarkdown turns the Markdown of release notes into plain text for the
+// terminal: headings and emphasis lose their markers, bullets become "- ",
+// links keep their URL and code fences and comments are dropped
+func plainMarkdown(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = markdownComment.ReplaceAllString(text, "")
+
+	var lines []string
+	blank := true
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			continue
+		}
+		line = markdownHeading.ReplaceAllString(line, "")
+		line = markdownBullet.ReplaceAllString(line, "$1- ")
+		line = markdownImage.ReplaceAllString(line, "$1")
+		line = markdownLink.ReplaceAllString(line, "$1 ($2)")
+		line = markdownStrong.ReplaceAllString(line, "$2")
+		line = markdownCode.ReplaceAllString(line, "$1")
+
+		// Collapse runs of blank lines
+		if line == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// githubResponseError describes an unsuccessful GitHub response, telling
+// rate limiting and rejected tokens apart from other failures
+func githubResponseError(resp *http.Response, authenticated bool) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	rateLimited := resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0")
+	switch {
+	case rateLimited:
+		msg := "GitHub API rate limit exceeded"
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			msg += fmt.Sprintf("; it resets at %s", time.Unix(reset, 0).Format("15:04:05"))
+		}
+		if !authenticated {
+			msg += ". Set GITHUB_TOKEN or log in with 'gh auth login' for a higher limit"
 		}
+		return errors.New(msg)
+	case resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("GitHub rejected the token (HTTP 401); check GITHUB_TOKEN or 'gh auth status'")
+	case resp.StatusCode == http.StatusNotFound && !authenticated:
+		return fmt.Errorf("not found (HTTP 404); for a private repository, set GITHUB_TOKEN or log in with 'gh auth login'")
+	}
+	return fmt.Errorf("HTTP %d", resp.StatusCode)
+}
 
-		// Execute the replacement script in the background
-		replaceCmd := exec.Command(scriptPath)
-		if err := replaceCmd.Start(); err != nil {
-			fmt.Printf("Error starting replacement script: %v\n", err)
-			os.Remove(tempBinary)
-			os.Exit(1)
+// printLinks prints the symlinks created by a link operation
+func printLinks(links []manager.LinkResult) {
+	for _, link := range links {
+		if link.BackupPath != "" {
+			fmt.Printf("Backed up existing file: %s -> %s\n", link.Target, link.BackupPath)
 		}
+		fmt.Printf("Linked: %s -> %s\n", link.Target, link.Source)
+	}
+}
 
-		// Wait for the script to complete
-		if err := replaceCmd.Wait(); err != nil {
-			fmt.Printf("Error during binary replacement: %v\n", err)
-			os.Remove(tempBinary)
-			os.Exit(1)
+// printHealthResults prints health check results with status icons
+func printHealthResults(results []manager.HealthCheckResult, emoji bool) {
+	for _, result := range results {
+		icon := "✅"
+		label := "[OK]"
+		if result.Error != nil {
+			icon, label = "❌", "[FAIL]"
+		} else if result.Severity == manager.SeverityWarning {
+			icon, label = "⚠️", "[WARN]"
+		}
+		if emoji {
+			fmt.Printf("%s %s: %s\n", icon, result.Status, result.Message)
+		} else {
+			fmt.Printf("%-6s %s: %s\n", label, result.Status, result.Message)
 		}
+	}
+}
 
-		fmt.Printf("Successfully upgraded to version %s\n", latestVersion)
-		fmt.Println("\nTo update shell completions, run:")
-		fmt.Println("  source <(dotman completion bash)  # for bash")
-		fmt.Println("  source <(dotman completion zsh)   # for zsh")
-		fmt.Println("  dotman completion fish > ~/.config/fish/completions/dotman.fish  # for fish")
-	},
+// supportsEmoji reports whether the locale uses UTF-8, following the usual
+// precedence of LC_ALL over LC_CTYPE over LANG
+func supportsEmoji() bool {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			value = strings.ToLower(value)
+			return strings.Contains(value, "utf-8") || strings.Contains(value, "utf8")
+		}
+	}
+	return false
 }
 
-var backupCmd = &cobra.Command{
-	Use:   "backup [file]",
-	Short: "Create a backup of a managed configuration file",
-	Long: `Create a backup of a managed configuration file.
+// openInSystem opens a URL or directory with the desktop's default application
+func openInSystem(target string) error {
+	var opener *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		opener = exec.Command("open", target)
+	case "windows":
+		opener = exec.Command("explorer", target)
+	default:
+		opener = exec.Command("xdg-open", target)
+	}
 
-This command will:
-1. Create a backup of the specified file
-2. Store the backup in the .dotman/backups directory
-3. Save metadata about the backup including original path and symlink target
+	if err := opener.Start(); err != nil {
+		return fmt.Errorf("could not run %s: %v", opener.Path, err)
+	}
+	// The opener hands off to the application; don't wait for it to exit
+	return opener.Process.Release()
+}
 
-Examples:
-  dotman backup ~/.bashrc
-  dotman backup ~/.config/i3/config`,
-	Args: cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
-		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
-		}
+// isTerminal reports whether f is connected to a terminal
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
 
-		m := manager.New(cfg)
-		if err := m.BackupFile(args[0]); err != nil {
-			fmt.Printf("Error creating backup: %v\n", err)
-			os.Exit(1)
-		}
+// completionConfig loads the config for shell completion without migrating
+// or creating anything, so pressing TAB never changes files
+func completionConfig() (*config.Config, bool) {
+	cfg, err := config.NewReadOnly()
+	if err != nil {
+		return nil, false
+	}
+	applyGlobalFlags(cfg)
+	return cfg, true
+}
 
-		fmt.Printf("Successfully created backup of %s\n", args[0])
-	},
+// completeDiffArgs completes backup IDs for 'diff --backup' and managed
+// files otherwise
+func completeDiffArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if diffBackupFlag {
+		return completeBackups(cmd, args, toComplete)
+	}
+	return completeManagedFiles(cmd, args, toComplete)
 }
 
-var restoreCmd = &cobra.Command{
-	Use:   "restore [backup_id]",
-	Short: "Restore a file from a backup",
-	Long: `Restore a file from a backup.
+// completeManagedFiles completes the home directory paths of managed files
+func completeManagedFiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg, ok := completionConfig()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
 
-This command will:
-1. List available backups if no backup_id is provided
-2. Restore the specified backup to its original location
-3. Recreate the symlink if it existed
+	files, err := manager.New(cfg).CompletionFiles()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
 
-Examples:
-  dotman restore  # List available backups
-  dotman restore 2024-02-20-123456  # Restore specific backup`,
-	Args: cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
-		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
-		}
+	completions := make([]string, 0, len(files))
+	for _, file := range files {
+		completions = append(completions, filepath.Join(cfg.HomeDir, file))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
 
-		m := manager.New(cfg)
-		if len(args) == 0 {
-			// List available backups
-			backups, err := m.ListBackups()
-			if err != nil {
-				fmt.Printf("Error listing backups: %v\n", err)
-				os.Exit(1)
-			}
+// completeBackups completes backup IDs with the backed up path as description,
+// or the backed up paths themselves when --latest is set. 'diff --backup'
+// completes two IDs.
+func completeBackups(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 && !(diffBackupFlag && len(args) == 1) {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg, ok := completionConfig()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
 
-			if len(backups) == 0 {
-				fmt.Println("No backups available")
-				return
-			}
+	backups, err := manager.New(cfg).CompletionBackups()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
 
-			fmt.Println("Available backups:")
-			for _, backup := range backups {
-				fmt.Printf("  %s - %s\n", backup.ID, backup.OriginalPath)
+	seen := make(map[string]bool)
+	var completions []string
+	for _, backup := range backups {
+		if restoreLatestFlag {
+			if !seen[backup.OriginalPath] {
+				seen[backup.OriginalPath] = true
+				completions = append(completions, backup.OriginalPath)
 			}
-			return
+			continue
 		}
-
-		// Restore specific backup
-		if err := m.RestoreBackup(args[0]); err != nil {
-			fmt.Printf("Error restoring backup: %v\n", err)
-			os.Exit(1)
+		description := backup.OriginalPath
+		if backup.Note != "" {
+			description += " (" + backup.Note + ")"
 		}
-
-		fmt.Printf("Successfully restored backup %s\n", args[0])
-	},
+		completions = append(completions, backup.ID+"\t"+description)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
 }
 
-var healthCheckCmd = &cobra.Command{
-	Use:   "check",
-	Short: "Check the health of your dotfile configuration",
-	Long: `Verify the health and integrity of your dotfile configuration.
-
-This command will:
-1. Check for broken symbolic links
-2. Verify file permissions
-3. Check git repository status
-4. Verify backup integrity
-5. Check for file conflicts
-6. Check for outdated configurations
-7. Monitor disk space
-8. Check for uncommitted changes
+// completeFilePath completes a single filesystem path argument
+func completeFilePath(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 || addFromFlag != "" || addStdinFlag {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return nil, cobra.ShellCompDirectiveDefault
+}
 
-The results are saved in the .dotman/health directory for future reference.
+// fatal reports err, prefixed with a context message, and exits. With --json
+// the error is printed to stderr as {"error":{"code":...,"message":...}}.
+func fatal(err error, format string, args ...interface{}) {
+	closeOperationLog(1, fmt.Sprintf("%s: %v", fmt.Sprintf(format, args...), err))
+	if jsonFlag {
+		printJSONError(manager.ErrorCodeOf(err), err.Error())
+	} else {
+		fmt.Printf("%s: %v\n", fmt.Sprintf(format, args...), err)
+	}
+	exit(1)
+}
 
-Examples:
-  dotman check  # Run all health checks
-  dotman check --fix  # Run checks and attempt to fix issues`,
-	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
-		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
-		}
+// fatalf reports an error that has no underlying error value and exits
+func fatalf(code manager.ErrorCode, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	closeOperationLog(1, msg)
+	if jsonFlag {
+		printJSONError(code, msg)
+	} else {
+		fmt.Printf("Error: %s\n", msg)
+	}
+	exit(1)
+}
 
-		m := manager.New(cfg)
-		if err := m.HealthCheck(); err != nil {
-			fmt.Printf("Health check failed: %v\n", err)
-			os.Exit(1)
-		}
+// printJSONError prints an error in the --json format to stderr
+func printJSONError(code manager.ErrorCode, message string) {
+	type jsonError struct {
+		Code    manager.ErrorCode `json:"code"`
+		Message string            `json:"message"`
+	}
+	data, _ := json.Marshal(map[string]jsonError{"error": {Code: code, Message: message}})
+	fmt.Fprintln(os.Stderr, string(data))
+}
 
-		fmt.Println("Health check completed successfully")
-	},
+// readOnlyMode reports whether --read-only or DOTMAN_READONLY is set.
+// Unrecognized DOTMAN_READONLY values err on the side of read-only.
+func readOnlyMode() bool {
+	if readOnlyFlag {
+		return true
+	}
+	value := strings.TrimSpace(os.Getenv("DOTMAN_READONLY"))
+	if value == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(value)
+	return err != nil || enabled
 }
 
-var docsCmd = &cobra.Command{
-	Use:   "docs",
-	Short: "Generate documentation for your configuration files",
-	Long: `Generate comprehensive documentation for your managed configuration files.
+// lockDotmanDir takes the lock on the dotman directory for commands that may
+// modify it, so two dotman processes never race on git or the filesystem.
+// init is exempt because it needs the directory to be empty.
+func lockDotmanDir(cmd *cobra.Command) {
+	if readOnlyMode() || cmd.Name() == "init" && cmd.Parent() == cmd.Root() {
+		return
+	}
+	if allowedInReadOnly(cmd) && cmd.Annotations[writesAnnotation] != "true" {
+		return
+	}
 
-This command will:
-1. Create a main README with an overview of all configurations
-2. Generate individual documentation for each configuration file
-3. Detect and document dependencies and tags
-4. Save metadata in JSON format for programmatic access
+	cfg, err := config.NewWithoutDirectories()
+	if err != nil {
+		return
+	}
+	// Nothing to protect before the dotman directory exists
+	if _, err := os.Stat(cfg.DotmanDir); err != nil {
+		return
+	}
 
-The documentation is generated in the .dotman/docs directory.
+	lock, err := manager.New(cfg).Lock()
+	if err != nil {
+		fatal(err, "Error")
+	}
+	dotmanLock = lock
+}
 
-Examples:
-  dotman docs  # Generate all documentation
-  dotman docs --update  # Update existing documentation`,
-	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
-		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
-		}
+// allowedInReadOnly reports whether cmd may run in read-only mode
+func allowedInReadOnly(cmd *cobra.Command) bool {
+	if !cmd.HasParent() || cmd.Name() == "help" || strings.HasPrefix(cmd.Name(), cobra.ShellCompRequestCmd) {
+		return true
+	}
+	return cmd.Annotations[readOnlyAnnotation] == "true"
+}
 
-		m := manager.New(cfg)
-		if err := m.GenerateDocs(); err != nil {
-			fmt.Printf("Error generating documentation: %v\n", err)
-			os.Exit(1)
-		}
+// loadConfig creates the config and applies global flag overrides. In
+// read-only mode the directory layout is left exactly as it is.
+func loadConfig() (*config.Config, error) {
+	newConfig := config.New
+	if readOnlyMode() {
+		newConfig = config.NewReadOnly
+	}
 
-		fmt.Println("Documentation generated successfully")
-	},
-}
+	cfg, err := newConfig()
+	if err != nil {
+		return nil, err
+	}
 
-var pushCmd = &cobra.Command{
-	Use:   "push",
-	Short: "Push changes to the remote repository",
-	Long: `Push your committed changes to the remote repository.
+	applyGlobalFlags(cfg)
+	return cfg, nil
+}
 
-This command will:
-1. Push all committed changes to the remote repository
-2. Show the status of the push operation
+// applyGlobalFlags applies persistent flag overrides to cfg
+func applyGlobalFlags(cfg *config.Config) {
+	if rootCmd.PersistentFlags().Changed("timeout") {
+		cfg.GitTimeout = gitTimeoutFlag
+	}
+	if gitInteractiveFlag {
+		cfg.GitInteractive = true
+	}
+	if readOnlyMode() {
+		cfg.ReadOnly = true
+	}
+	cfg.Log = opLog
+}
 
-Use this command after:
-- Adding new files
-- Making changes to existing files
-- Committing changes
+// openOperationLog opens the log file named by --log or the log_file
+// setting and records the command about to run. A log that cannot be
+// opened is reported but does not stop the command. Shell completion is
+// not logged, as it runs on every TAB.
+func openOperationLog(cmd *cobra.Command) {
+	if strings.HasPrefix(cmd.Name(), cobra.ShellCompRequestCmd) {
+		return
+	}
 
-Example:
-  dotman push`,
-	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
-		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
-		}
+	path := logFlag
+	cfg, err := config.NewWithoutDirectories()
+	if err != nil {
+		return
+	}
+	if path == "" {
+		// An invalid settings file is reported by the command itself
+		cfg.LoadSettings()
+		path = cfg.Settings.LogFile
+	}
+	if path == "" {
+		return
+	}
 
-		m := manager.New(cfg)
-		if err := m.Push(); err != nil {
-			fmt.Printf("Error pushing changes: %v\n", err)
-			os.Exit(1)
-		}
+	logger, file, err := manager.OpenLog(cfg.ExpandHome(path))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not open log file %s: %v\n", path, err)
+		return
+	}
+	opLog, opLogFile, opLogStart = logger, file, time.Now()
+	opLog.Info("command", "command", cmd.CommandPath(), "args", strings.Join(manager.RedactArgs(os.Args[1:]), " "), "pid", os.Getpid())
+}
 
-		fmt.Println("Successfully pushed changes to remote repository")
-	},
+// closeOperationLog records how the command ended, with its exit code and
+// the error it failed with, if known, and closes the log
+func closeOperationLog(code int, errMsg string) {
+	if opLog == nil {
+		return
+	}
+	attrs := []interface{}{"exit_code", code, "duration", time.Since(opLogStart).Round(time.Millisecond)}
+	switch {
+	case errMsg != "":
+		opLog.Error("command failed", append(attrs, "error", manager.RedactArgs([]string{errMsg})[0])...)
+	case code != 0:
+		opLog.Error("command failed", attrs...)
+	default:
+		opLog.Info("command finished", attrs...)
+	}
+	opLogFile.Close()
+	opLog = nil
 }
 
-var removeCmd = &cobra.Command{
-	Use:   "remove [file]",
-	Short: "Remove a file from dotman management",
-	Long: `Remove a file from dotman management.
+// exit records the exit code in the operation log and exits with it
+func exit(code int) {
+	closeOperationLog(code, "")
+	os.Exit(code)
+}
 
-This command will:
-1. Copy the file back to its original location
-2. Remove the symbolic link
-3. Remove the file from git tracking
-4. Commit the removal
+// applyTargetHome makes cfg link into dir, given with flag, instead of the
+// real home directory. Settings that refer to ~ keep resolving against the
+// real home directory.
+func applyTargetHome(cfg *config.Config, flag, dir string) error {
+	target, err := filepath.Abs(cfg.ExpandHome(dir))
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %v", flag, dir, err)
+	}
+	info, err := os.Stat(target)
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("%s %s is not an existing directory", flag, target)
+	}
+	if rel, err := filepath.Rel(cfg.DotmanDir, target); err == nil && (rel == "." || !strings.HasPrefix(rel, "..")) {
+		return fmt.Errorf("%s %s is inside the dotman directory", flag, target)
+	}
 
-The file will no longer be managed by dotman but will remain in its original location.
+	if cfg.Settings.LinkBackupDir != "" {
+		cfg.Settings.LinkBackupDir = cfg.ExpandHome(cfg.Settings.LinkBackupDir)
+	}
+	cfg.HomeDir = target
+	return nil
+}
 
-Examples:
-  dotman remove ~/.bashrc
-  dotman remove ~/.config/i3/config
-  dotman remove .vimrc`,
-	Args: cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.New()
+// applyModeFlags overrides the configured directory and file modes from flags
+func applyModeFlags(cfg *config.Config) error {
+	if dirModeFlag != "" {
+		mode, err := parseModeFlag("--dir-mode", dirModeFlag, "0755")
 		if err != nil {
-			fmt.Printf("Error creating config: %v\n", err)
-			os.Exit(1)
+			return err
 		}
-
-		m := manager.New(cfg)
-		if err := m.RemoveFile(args[0]); err != nil {
-			fmt.Printf("Error removing file: %v\n", err)
-			os.Exit(1)
+		cfg.DirMode = mode
+	}
+	if fileModeFlag != "" {
+		mode, err := parseModeFlag("--file-mode", fileModeFlag, "0644")
+		if err != nil {
+			return err
 		}
+		cfg.FileMode = mode
+	}
+	return nil
+}
 
-		fmt.Printf("Successfully removed %s from dotman management\n", args[0])
-	},
+// parseModeFlag parses the octal permission bits given to flag. Setuid,
+// setgid and sticky bits are refused, so created files never get them.
+func parseModeFlag(flag, value, example string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: must be an octal mode like %s", flag, value, example)
+	}
+	if mode&^0777 != 0 {
+		return 0, fmt.Errorf("invalid %s %q: only permission bits up to 0777 are allowed, not setuid, setgid or sticky bits", flag, value)
+	}
+	return os.FileMode(mode), nil
 }
 
 func untar(src, dest string, verbose bool) error {
@@ -888,23 +4514,173 @@ func copyFile(src, dst string) error {
 }
 
 func init() {
+	rootCmd.PersistentFlags().DurationVar(&gitTimeoutFlag, "timeout", config.DefaultGitTimeout, "Timeout for each git operation (0 disables it)")
+	rootCmd.PersistentFlags().BoolVar(&gitInteractiveFlag, "git-prompt", false, "Allow git to prompt for credentials on clone, pull and push")
+	rootCmd.PersistentFlags().BoolVar(&jsonFlag, "json", false, "Print JSON output where supported, and errors as JSON on stderr")
+	rootCmd.PersistentFlags().StringVar(&logFlag, "log", "", "Append a log of the command and the git commands it runs to this file")
+	rootCmd.PersistentFlags().BoolVar(&readOnlyFlag, "read-only", false, "Refuse every operation that would modify files (also DOTMAN_READONLY=1)")
+
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(addCmd)
 	rootCmd.AddCommand(linkCmd)
+	rootCmd.AddCommand(mirrorCmd)
+	rootCmd.AddCommand(reverseImportCmd)
+	rootCmd.AddCommand(reconcileCmd)
+	rootCmd.AddCommand(migrateLinksCmd)
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditSecretsCmd)
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(commitCmd)
 	rootCmd.AddCommand(updateCmd)
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(upgradeCmd)
 	rootCmd.AddCommand(backupCmd)
+	backupCmd.AddCommand(backupSessionsCmd)
 	rootCmd.AddCommand(restoreCmd)
 	rootCmd.AddCommand(healthCheckCmd)
+	rootCmd.AddCommand(gcCmd)
 	rootCmd.AddCommand(docsCmd)
+	rootCmd.AddCommand(schemaCmd)
 	rootCmd.AddCommand(pushCmd)
 	rootCmd.AddCommand(removeCmd)
+	rootCmd.AddCommand(submoduleCmd)
+	rootCmd.AddCommand(suggestCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(relinkCmd)
+	rootCmd.AddCommand(reinitCmd)
+	rootCmd.AddCommand(unshallowCmd)
+	rootCmd.AddCommand(whichCmd)
+	rootCmd.AddCommand(infoCmd)
+	rootCmd.AddCommand(whoamiCmd)
+	rootCmd.AddCommand(openCmd)
+	rootCmd.AddCommand(freezeCmd)
+	rootCmd.AddCommand(thawCmd)
+	rootCmd.AddCommand(noteCmd)
+	noteCmd.AddCommand(noteSetCmd, noteGetCmd, noteRmCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(exportCmd)
+
+	submoduleCmd.AddCommand(submoduleAddCmd)
+	configCmd.AddCommand(configValidateCmd)
+
+	// Complete file arguments from what dotman manages
+	addCmd.ValidArgsFunction = completeFilePath
+	backupCmd.ValidArgsFunction = completeManagedFiles
+	removeCmd.ValidArgsFunction = completeManagedFiles
+	whichCmd.ValidArgsFunction = completeManagedFiles
+	reverseImportCmd.ValidArgsFunction = completeManagedFiles
+	reconcileCmd.ValidArgsFunction = completeManagedFiles
+	diffCmd.ValidArgsFunction = completeDiffArgs
+	infoCmd.ValidArgsFunction = completeManagedFiles
+	freezeCmd.ValidArgsFunction = completeManagedFiles
+	thawCmd.ValidArgsFunction = completeManagedFiles
+	noteSetCmd.ValidArgsFunction = completeManagedFiles
+	noteGetCmd.ValidArgsFunction = completeManagedFiles
+	noteRmCmd.ValidArgsFunction = completeManagedFiles
+	restoreCmd.ValidArgsFunction = completeBackups
+
+	// Commands that only inspect and so keep working in read-only mode.
+	// restore is listed for listing backups; restoring itself is refused.
+	for _, c := range []*cobra.Command{listCmd, whichCmd, infoCmd, healthCheckCmd, diffCmd, suggestCmd, restoreCmd, versionCmd, openCmd, configValidateCmd, gcCmd, backupSessionsCmd, auditSecretsCmd, noteGetCmd, whoamiCmd, schemaCmd} {
+		c.Annotations = map[string]string{readOnlyAnnotation: "true"}
+	}
+	for _, c := range []*cobra.Command{healthCheckCmd, restoreCmd, gcCmd} {
+		c.Annotations[writesAnnotation] = "true"
+	}
 
 	upgradeCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output for upgrade")
+	upgradeCmd.Flags().BoolVar(&upgradeChangelogFlag, "changelog", false, "Print the notes of the latest release and exit without upgrading")
 	docsCmd.Flags().BoolP("update", "u", false, "Update existing documentation")
+	docsCmd.Flags().StringVar(&docsFormatFlag, "format", "markdown", "Documentation format: "+strings.Join(manager.DocFormats, ", "))
+	linkCmd.Flags().StringVar(&linkBackupDirFlag, "backup-dir", "", "Copy replaced files into this directory instead of the backup store")
+	listCmd.Flags().BoolVar(&listBrokenFlag, "broken", false, "Only show files whose home symlink is missing")
+	listCmd.Flags().BoolVar(&listConflictsFlag, "conflicts", false, "Only show files blocked by a real file or a link elsewhere")
+	listCmd.Flags().BoolVar(&listNotesFlag, "notes", false, "Show the note attached to each file")
+	listCmd.Flags().BoolVar(&listTreeFlag, "tree", false, "Show the files as a tree of their directories")
+	listCmd.Flags().IntVar(&listDepthFlag, "depth", 0, "With --tree, how many directory levels to show (0 shows all)")
+	listCmd.Flags().BoolVar(&listWatchFlag, "watch", false, "Keep showing the link state of the files, redrawn every --interval")
+	listCmd.Flags().DurationVar(&listIntervalFlag, "interval", 2*time.Second, "How often --watch redraws")
+	healthCheckCmd.Flags().BoolVar(&checkNoEmojiFlag, "no-emoji", false, "Use plain [OK]/[WARN]/[FAIL] labels instead of emoji")
+	healthCheckCmd.Flags().StringVar(&checkOutputFlag, "output", "text", "Output format: text or json")
+	healthCheckCmd.Flags().StringVar(&checkFailOnFlag, "fail-on", manager.SeverityError, "Lowest severity that exits non-zero: none, warning or error")
+	healthCheckCmd.Flags().StringVar(&checkExcludeFlag, "exclude-from", "", "File of patterns for files the symlink, conflict and outdated checks skip")
+	healthCheckCmd.Flags().StringVar(&checkReportFlag, "report", "", "Also write the results to this file")
+	healthCheckCmd.Flags().StringVar(&checkFormatFlag, "format", "json", "Format of the --report file: "+strings.Join(manager.HealthReportFormats, ", "))
+	healthCheckCmd.Flags().BoolVar(&checkSaveFlag, "save", true, "Save the results in the health state directory")
+	healthCheckCmd.Flags().BoolVar(&checkNoSaveFlag, "no-save", false, "Do not save the results in the health state directory")
+	healthCheckCmd.Flags().IntVar(&checkParallel, "parallel", 0, "Number of backups to verify at once (0 uses one per CPU)")
+	healthCheckCmd.MarkFlagsMutuallyExclusive("save", "no-save")
+	restoreCmd.Flags().BoolVar(&restoreLatestFlag, "latest", false, "Restore the most recent backup of the given file path")
+	restoreCmd.Flags().BoolVar(&restoreAuthorDateFlag, "author-date", false, "Commit a restored managed file dated at the backup's timestamp")
+	restoreCmd.Flags().BoolVar(&restoreDryRunFlag, "dry-run", false, "Print what restoring would do without changing anything")
+	restoreCmd.Flags().BoolVar(&restoreForceFlag, "force", false, "Restore over a file modified after the backup without asking")
+	restoreCmd.Flags().BoolVar(&restoreStdoutFlag, "stdout", false, "Write the backed-up content to stdout instead of restoring it")
+	restoreCmd.MarkFlagsMutuallyExclusive("dry-run", "stdout")
+	restoreCmd.MarkFlagsMutuallyExclusive("author-date", "stdout")
+	restoreCmd.Flags().StringVar(&restoreSessionFlag, "session", "", "Restore every backup of the given backup session")
+	restoreCmd.MarkFlagsMutuallyExclusive("session", "latest")
+	restoreCmd.MarkFlagsMutuallyExclusive("session", "stdout")
+	commitCmd.Flags().BoolVar(&commitSummaryFlag, "summary", false, "Show the diffstat of the staged changes and confirm before committing")
+	commitCmd.Flags().BoolVar(&commitYesFlag, "yes", false, "Do not ask for confirmation after --summary")
+	gcCmd.Flags().BoolVar(&gcDryRunFlag, "dry-run", false, "List what would be removed without removing anything")
+	gcCmd.Flags().IntVar(&gcKeepHealthFlag, "keep-health", manager.DefaultKeepHealth, "Number of saved health check results to keep")
+	gcCmd.Flags().BoolVar(&gcYesFlag, "yes", false, "Remove invalid backups without asking")
+	backupCmd.Flags().BoolVar(&backupCompressFlag, "compress", false, "Store the backup content gzipped")
+	backupCmd.Flags().StringVar(&backupNoteFlag, "note", "", "Store why the backup was made with it")
+	linkCmd.Flags().StringVar(&linkTargetHomeFlag, "target-home", "", "Create links under this directory instead of the home directory")
+	linkCmd.Flags().BoolVar(&linkFailFastFlag, "fail-fast", false, "Stop at the first file that cannot be linked")
+	linkCmd.Flags().BoolVarP(&linkInteractiveFlag, "interactive", "i", false, "Ask before linking each file")
+	linkCmd.Flags().BoolVar(&linkForceFlag, "force-link", false, "Back up and replace non-empty directories where a link should go")
+	linkCmd.Flags().BoolVar(&linkSymlinksOnly, "overwrite-symlinks-only", false, "Only replace links into the configs directory; skip real files and other links")
+	linkCmd.MarkFlagsMutuallyExclusive("force-link", "overwrite-symlinks-only")
+	mirrorCmd.Flags().StringVar(&mirrorToFlag, "to", "", "Copy managed files into this directory under their home-relative paths")
+	mirrorCmd.Flags().BoolVar(&mirrorApplyFlag, "apply", false, "Replace the links in the home directory with copies")
+	mirrorCmd.Flags().BoolVar(&mirrorFailFastFlag, "fail-fast", false, "Stop at the first file that cannot be copied")
+	mirrorCmd.Flags().BoolVar(&mirrorForceFlag, "force-link", false, "Back up and replace non-empty directories where a copy should go")
+	mirrorCmd.MarkFlagsOneRequired("to", "apply")
+	mirrorCmd.MarkFlagsMutuallyExclusive("to", "apply")
+	migrateLinksCmd.Flags().StringVar(&migrateLinksFromFlag, "from", "", "The old dotman directory the links point into (detected when omitted)")
+	reverseImportCmd.Flags().BoolVar(&reverseImportAllFlag, "all", false, "Import every managed file that differs from its home file")
+	reverseImportCmd.Flags().BoolVar(&reverseImportDryRunFlag, "dry-run", false, "Only report which files would be imported")
+	reconcileCmd.Flags().StringVar(&reconcileChooseFlag, "choose", "", "Answer for every file without asking: keep-home, keep-repo or skip")
+	updateCmd.Flags().BoolVar(&updateNoRelinkFlag, "no-relink", false, "Only pull; do not relink managed files")
+	updateCmd.Flags().BoolVar(&updatePruneFlag, "prune", false, "Remove home links to managed files deleted upstream")
+	updateCmd.Flags().BoolVar(&updateRebaseFlag, "rebase", false, "Rebase local commits onto the remote when histories diverged")
+	updateCmd.Flags().BoolVar(&updateMergeFlag, "merge", false, "Merge the remote when histories diverged")
+	updateCmd.Flags().BoolVar(&updateDryRunFlag, "dry-run", false, "Only fetch and show what the update would change")
+	updateCmd.MarkFlagsMutuallyExclusive("rebase", "merge")
+	diffCmd.Flags().BoolVar(&diffRemoteFlag, "remote", false, "Compare with the remote repository")
+	diffCmd.Flags().BoolVar(&diffToolFlag, "tool", false, "Open differing files in the configured diff tool")
+	diffCmd.Flags().BoolVar(&diffBackupFlag, "backup", false, "Compare two backups, given by their IDs")
+	diffCmd.MarkFlagsMutuallyExclusive("remote", "tool", "backup")
+	exportCmd.Flags().StringVar(&exportSinceFlag, "since", "", "Only export files changed since this git revision")
+	exportCmd.Flags().StringVar(&exportFormatFlag, "archive-format", "", "Archive format: "+strings.Join(manager.ArchiveFormats, ", ")+" (default: from the archive name, else tar.gz)")
+	initCmd.Flags().StringVar(&initFromDirFlag, "from-dir", "", "Import dotfiles from a local directory instead of a GitHub repository")
+	initCmd.Flags().IntVar(&initDepthFlag, "depth", 0, "Clone an existing repository with only this many commits of history")
+	initCmd.Flags().StringVar(&initConfigsSubdirFlag, "configs-subdir", "", "Directory of the cloned repository that holds configs/, for dotfiles inside a larger repository")
+	initCmd.Flags().BoolVar(&initVerifyRemoteFlag, "verify-remote", false, "Ask before scaffolding a cloned repository that does not look like a dotman repository")
+	initCmd.Flags().StringVar(&initGitHubUserFlag, "github-user", "", "Only create the new repository when gh is logged in as this GitHub account")
+	initCmd.Flags().BoolVar(&initNoRemoteFlag, "no-remote", false, "Create a local repository only, without a GitHub repository or push")
+	initCmd.MarkFlagsMutuallyExclusive("no-remote", "github-user")
+	initCmd.Flags().BoolVar(&initLinkFlag, "link", false, "Link the imported files (with --from-dir)")
+	addCmd.Flags().StringVar(&addFromFlag, "from", "", "Read paths to add from a file, or '-' for stdin")
+	addCmd.Flags().BoolVar(&addForceFlag, "force", false, "Add files above the max_file_size limit")
+	addCmd.Flags().BoolVar(&addIncludeVCSFlag, "include-vcs", false, "Also add .git, node_modules and other excluded directories when adding a directory")
+	addCmd.Flags().BoolVar(&addFollowFlag, "follow-symlink", false, "Manage the content a symlink points to, replacing the link")
+	addCmd.Flags().BoolVar(&addKeepLinkFlag, "keep-symlink", false, "Manage a symlink as a link, keeping where it points")
+	addCmd.Flags().BoolVar(&addDerefFlag, "dereference", false, "Store the content and mode a symlink chain resolves to; also adds linked files inside directories")
+	addCmd.MarkFlagsMutuallyExclusive("follow-symlink", "keep-symlink", "dereference")
+	addCmd.Flags().BoolVar(&addStdinFlag, "stdin", false, "Read the file content from stdin (requires --target)")
+	addCmd.Flags().StringVar(&addTargetFlag, "target", "", "Home directory path for content read with --stdin")
+	addCmd.Flags().StringVar(&addMessageFlag, "commit-message", "", "Template for the commit message, e.g. \"Add {{.Path}} ({{.Tags}})\"")
+	addCmd.Flags().BoolVar(&addRenameFlag, "rename-on-conflict", false, "Rename a real file at the --target to <name>.dotman-orig-<time> instead of backing it up")
+	removeCmd.Flags().BoolVar(&removeRestoreFlag, "restore", false, "Move back the original that add --rename-on-conflict renamed")
+	removeCmd.Flags().BoolVar(&removeNoPruneFlag, "no-prune", false, "Keep directories in the configs directory that the removal leaves empty")
+
+	for _, c := range []*cobra.Command{addCmd, linkCmd, mirrorCmd, restoreCmd} {
+		c.Flags().StringVar(&dirModeFlag, "dir-mode", "", "Mode for created directories (octal, default 0755)")
+		c.Flags().StringVar(&fileModeFlag, "file-mode", "", "Mode for copied files (octal, default 0644)")
+	}
 
 	// Add completion commands
 	rootCmd.AddCommand(&cobra.Command{
@@ -934,6 +4710,7 @@ Fish:
 
 Note: You may need to restart your shell or run 'hash -r' for the changes to take effect.`,
 		DisableFlagsInUseLine: true,
+		Annotations:           map[string]string{readOnlyAnnotation: "true"},
 		ValidArgs:             []string{"bash", "zsh", "fish"},
 		Args:                  cobra.ExactValidArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
@@ -949,9 +4726,93 @@ Note: You may need to restart your shell or run 'hash -r' for the changes to tak
 	})
 }
 
+// pluginPrefix is the prefix of executables on PATH that provide commands
+// dotman does not have itself: 'dotman foo' runs dotman-foo
+const pluginPrefix = "dotman-"
+
+// findPlugin returns the plugin executable for args when the first argument
+// names a command that is neither built in nor reserved by cobra
+func findPlugin(args []string) (string, bool) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", false
+	}
+	name := args[0]
+	if name == "help" || strings.HasPrefix(name, "__") || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == name || c.HasAlias(name) {
+			return "", false
+		}
+	}
+
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// runPlugin runs the plugin executable with args and the dotman environment
+// and returns the exit code to leave with
+func runPlugin(path string, args []string) int {
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), pluginEnv()...)
+
+	// The plugin gets Ctrl-C itself; main's handler keeps dotman waiting
+	// for it instead of exiting first
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintf(os.Stderr, "Error running plugin %s: %v\n", path, err)
+		return 1
+	}
+	return 0
+}
+
+// pluginEnv describes the dotman installation to plugins
+func pluginEnv() []string {
+	env := []string{"DOTMAN_VERSION=" + version}
+	if exe, err := os.Executable(); err == nil {
+		env = append(env, "DOTMAN_BIN="+exe)
+	}
+
+	cfg, err := config.NewWithoutDirectories()
+	if err != nil {
+		return env
+	}
+	// Broken settings are the plugin's to report; the defaults still apply
+	cfg.LoadSettings()
+	return append(env,
+		"DOTMAN_HOME="+cfg.HomeDir,
+		"DOTMAN_DIR="+cfg.DotmanDir,
+		"DOTMAN_CONFIGS_DIR="+cfg.ConfigsDir,
+		"DOTMAN_BACKUPS_DIR="+cfg.BackupsDir(),
+	)
+}
+
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	// Cancel long-running operations on Ctrl-C; a second Ctrl-C exits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if plugin, ok := findPlugin(os.Args[1:]); ok {
+		os.Exit(runPlugin(plugin, os.Args[2:]))
+	}
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		if jsonFlag {
+			fatalf(manager.CodeInvalidArgument, "%v", err)
+		}
 		fmt.Println(err)
-		os.Exit(1)
+		exit(1)
 	}
 }
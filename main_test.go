@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cli-config-manager/manager"
+)
+
+// TestMain runs dotman itself instead of the tests when DOTMAN_TEST_MAIN is
+// set, so runDotman can test commands in a child process
+func TestMain(m *testing.M) {
+	if os.Getenv("DOTMAN_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runDotman runs dotman with args in home and returns its stdout, stderr
+// and exit code
+func runDotman(t *testing.T, home string, args ...string) (string, string, int) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(),
+		"DOTMAN_TEST_MAIN=1",
+		"DOTMAN_INIT_MODE=new",
+		"HOME="+home,
+		"XDG_STATE_HOME=",
+		"XDG_CACHE_HOME=",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=dotman", "GIT_AUTHOR_EMAIL=dotman@example.com",
+		"GIT_COMMITTER_NAME=dotman", "GIT_COMMITTER_EMAIL=dotman@example.com",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), code
+}
+
+// releaseContent stands in for a release archive
+var releaseContent = bytes.Repeat([]byte("dotman release archive\n"), 4096)
+
+// rangeServer serves releaseContent with support for range requests and
+// records the Range header of every request
+func rangeServer(t *testing.T, ranges *[]string) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*ranges = append(*ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "archive.tar.gz", time.Time{}, bytes.NewReader(releaseContent))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// checkDownloaded fails t unless dest holds releaseContent and the partial
+// file is gone
+func checkDownloaded(t *testing.T, dest string) {
+	t.Helper()
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, releaseContent) {
+		t.Errorf("downloaded %d bytes, want the %d bytes of the release", len(data), len(releaseContent))
+	}
+	if _, err := os.Stat(dest + ".part"); !os.IsNotExist(err) {
+		t.Errorf("the partial file was left behind")
+	}
+}
+
+func TestDownloadFileResumes(t *testing.T) {
+	var ranges []string
+	server := rangeServer(t, &ranges)
+
+	dest := filepath.Join(t.TempDir(), "archive.tar.gz")
+	half := len(releaseContent) / 2
+	if err := os.WriteFile(dest+".part", releaseContent[:half], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var lastDone, lastTotal int64
+	err := downloadFile(context.Background(), server.URL, "", dest, func(done, total int64) {
+		lastDone, lastTotal = done, total
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest)
+	if len(ranges) != 1 || ranges[0] != "bytes="+strconv.Itoa(half)+"-" {
+		t.Errorf("requested ranges = %q, want one request from byte %d", ranges, half)
+	}
+	if lastDone != int64(len(releaseContent)) || lastTotal != int64(len(releaseContent)) {
+		t.Errorf("last progress = %d of %d, want the full size", lastDone, lastTotal)
+	}
+}
+
+func TestDownloadFileWithoutRangeSupport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(releaseContent)
+	}))
+	defer server.Close()
+
+	// The server sends everything, so the partial content is replaced
+	dest := filepath.Join(t.TempDir(), "archive.tar.gz")
+	if err := os.WriteFile(dest+".part", []byte("stale"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloadFile(context.Background(), server.URL, "", dest, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest)
+}
+
+func TestDownloadFileResumesAfterBreakingOff(t *testing.T) {
+	var ranges []string
+	served := rangeServer(t, &ranges)
+
+	// The first response breaks off halfway; later ones are served normally
+	var mu sync.Mutex
+	first := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		broken := first
+		first = false
+		mu.Unlock()
+		if !broken {
+			served.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(releaseContent)))
+		w.Write(releaseContent[:len(releaseContent)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+
+	dest := filepath.Join(t.TempDir(), "archive.tar.gz")
+	if err := downloadFile(context.Background(), server.URL, "", dest, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest)
+	if len(ranges) != 1 || !strings.HasPrefix(ranges[0], "bytes=") {
+		t.Errorf("requested ranges = %q, want the second attempt to resume", ranges)
+	}
+}
+
+func TestDownloadFileRestartsForForeignPart(t *testing.T) {
+	var ranges []string
+	server := rangeServer(t, &ranges)
+
+	// A partial file longer than the release cannot belong to it
+	dest := filepath.Join(t.TempDir(), "archive.tar.gz")
+	if err := os.WriteFile(dest+".part", append(releaseContent, "extra"...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloadFile(context.Background(), server.URL, "", dest, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkDownloaded(t, dest)
+	if len(ranges) != 2 || ranges[1] != "" {
+		t.Errorf("requested ranges = %q, want a range and then the whole file", ranges)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header       string
+		start, total int64
+		ok           bool
+	}{
+		{"bytes 100-199/1000", 100, 1000, true},
+		{"bytes 0-999/1000", 0, 1000, true},
+		{"bytes 200-100/1000", 0, 0, false},
+		{"bytes 0-1000/1000", 0, 0, false},
+		{"bytes 0-99/*", 0, 0, false},
+		{"bytes */1000", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, total, ok := parseContentRange(tt.header)
+		if ok != tt.ok || (ok && (start != tt.start || total != tt.total)) {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v; want %d, %d, %v",
+				tt.header, start, total, ok, tt.start, tt.total, tt.ok)
+		}
+	}
+}
+
+func TestJSONAddMissingPath(t *testing.T) {
+	home := t.TempDir()
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[user]\n\tname = dotman\n\temail = dotman@example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := runDotman(t, home, "init", "--no-remote"); code != 0 {
+		t.Fatalf("init failed with %d: %s", code, stderr)
+	}
+
+	missing := filepath.Join(home, "nonexistent")
+	stdout, stderr, code := runDotman(t, home, "--json", "add", missing)
+	if code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if strings.Contains(stdout, "Error adding file") {
+		t.Errorf("the error was printed as text: %q", stdout)
+	}
+
+	var report struct {
+		Error struct {
+			Code    manager.ErrorCode `json:"code"`
+			Message string            `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(stderr), &report); err != nil {
+		t.Fatalf("stderr is not a JSON error: %v\n%s", err, stderr)
+	}
+	if report.Error.Code != manager.CodeNotFound || !strings.Contains(report.Error.Message, missing) {
+		t.Errorf("error = %+v, want %s naming %s", report.Error, manager.CodeNotFound, missing)
+	}
+}
+
+func TestParseModeFlag(t *testing.T) {
+	tests := []struct {
+		value string
+		want  os.FileMode
+		ok    bool
+	}{
+		{"0755", 0755, true},
+		{"644", 0644, true},
+		{"0", 0, true},
+		{"0777", 0777, true},
+		{"1777", 0, false},
+		{"2755", 0, false},
+		{"4755", 0, false},
+		{"7777", 0, false},
+		{"01000", 0, false},
+		{"0888", 0, false},
+		{"rwxr-xr-x", 0, false},
+		{"-1", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseModeFlag("--file-mode", tt.value, "0644")
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseModeFlag(%q) = %v, %v; want %v, ok %v", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
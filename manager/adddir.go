@@ -0,0 +1,188 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultAddExcludes are skipped when adding a directory unless the
+// add_excludes setting replaces them: version control metadata and build or
+// dependency directories that do not belong in a dotfiles repository
+var defaultAddExcludes = []string{
+	".git", ".hg", ".svn", ".bzr", "_darcs",
+	"node_modules", "__pycache__", ".venv",
+}
+
+// keepMarker is the file that keeps an empty directory in the configs
+// directory, since git does not track empty directories. It is not a
+// managed file: Link creates its directory in the home directory instead.
+const keepMarker = ".keep"
+
+// addExcludes returns the patterns for paths skipped when adding a directory
+func (m *Manager) addExcludes() []string {
+	if len(m.config.Settings.AddExcludes) > 0 {
+		return m.config.Settings.AddExcludes
+	}
+	return defaultAddExcludes
+}
+
+// addDirectory adds every regular file below dir, each linked on its own,
+// and commits them together. Empty directories, including dir itself, are
+// kept with a keepMarker. Excluded paths are skipped unless
+// opts.IncludeVCS is set. Sizes are checked before anything is changed, so
+// one large file does not leave the directory half added.
+func (m *Manager) addDirectory(dir string, opts AddOptions, message *template.Template) error {
+	relDir, inHome := m.homeRelPath(dir)
+	if !inHome || relDir == "." {
+		return newError(CodeInvalidArgument, "can only add directories inside the home directory: %s", dir)
+	}
+	if err := m.checkOutsideHome(relDir); err != nil {
+		return err
+	}
+	if within(dir, m.config.DotmanDir) || within(m.config.DotmanDir, dir) {
+		return newError(CodeInvalidArgument, "cannot add %s: it overlaps the dotman directory", dir)
+	}
+
+	var excludes *IgnoreMatcher
+	if !opts.IncludeVCS {
+		excludes = &IgnoreMatcher{patterns: m.addExcludes()}
+	}
+
+	var files, emptyDirs []string
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+		emptyDirs = append(emptyDirs, relDir)
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+
+		if info.Name() == ".git" {
+			if excludes != nil {
+				m.logf("Warning: %s is a git repository; its .git directory was skipped (consider 'dotman submodule add' for it instead)\n", filepath.Dir(path))
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			m.logf("Warning: adding the git repository metadata in %s\n", path)
+		}
+
+		if excludes != nil && excludes.Match(relPath) {
+			m.logf("Skipped %s: excluded (use --include-vcs to add it)\n", path)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			if entries, err := os.ReadDir(path); err == nil && len(entries) == 0 {
+				emptyDirs = append(emptyDirs, filepath.Join(relDir, relPath))
+			}
+			return nil
+		}
+		// Dereferencing stores the file a symlink resolves to in its place
+		if info.Mode()&os.ModeSymlink != 0 && opts.Symlink == SymlinkDereference {
+			resolved, err := os.Stat(path)
+			switch {
+			case err != nil:
+				m.logf("Skipped %s: broken symlink\n", path)
+				return nil
+			case !resolved.Mode().IsRegular():
+				m.logf("Skipped %s: symlink to something other than a regular file\n", path)
+				return nil
+			}
+			info = resolved
+		}
+		if !info.Mode().IsRegular() {
+			m.logf("Skipped %s: not a regular file\n", path)
+			return nil
+		}
+
+		if !opts.Force && !m.lfsTracked(filepath.Join(relDir, relPath)) {
+			if err := m.checkFileSize(path, info.Size()); err != nil {
+				return err
+			}
+		}
+
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 && len(emptyDirs) == 0 {
+		return newError(CodeEmptyContent, "no files to add in %s", dir)
+	}
+
+	var targetPaths []string
+	anyLFS := false
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("error reading file: %v", err)
+		}
+		targetPath, _, lfs, err := m.addFile(path, info, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if targetPath != "" {
+			targetPaths = append(targetPaths, targetPath)
+		}
+		anyLFS = anyLFS || lfs
+	}
+	for _, emptyDir := range emptyDirs {
+		marker, err := m.addKeepMarker(emptyDir)
+		if err != nil {
+			return err
+		}
+		if marker != "" {
+			targetPaths = append(targetPaths, marker)
+		}
+	}
+
+	if len(targetPaths) == 0 {
+		return nil
+	}
+	return m.commitAdded(targetPaths, relDir, anyLFS, message)
+}
+
+// addKeepMarker writes the keepMarker of the empty home directory relDir
+// into the configs directory and returns its path, or "" when it exists
+func (m *Manager) addKeepMarker(relDir string) (string, error) {
+	if err := m.recordLayout(); err != nil {
+		return "", err
+	}
+
+	relPath := filepath.Join(relDir, keepMarker)
+	sourceRel := m.sourceRel(relPath)
+	if err := m.mkdirAll(m.config.ConfigsDir, filepath.Dir(sourceRel)); err != nil {
+		return "", fmt.Errorf("error creating target directory: %v", err)
+	}
+
+	marker := filepath.Join(m.config.ConfigsDir, sourceRel)
+	if _, err := os.Lstat(marker); err == nil {
+		return "", nil
+	}
+	if err := os.WriteFile(marker, nil, m.fileModeFor(relPath)); err != nil {
+		return "", fmt.Errorf("error keeping empty directory %s: %v", relDir, err)
+	}
+
+	m.logf("Kept empty directory: %s\n", m.targetPath(relDir))
+	return marker, nil
+}
+
+// within reports whether path is parent or below it
+func within(parent, path string) bool {
+	rel, err := filepath.Rel(parent, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
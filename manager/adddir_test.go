@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAddDirectorySkipsGitMetadata(t *testing.T) {
+	m := newTestManager(t)
+	var log bytes.Buffer
+	m.log = &log
+
+	dir := filepath.Join(m.config.HomeDir, ".config", "tool")
+	writeTestFile(t, filepath.Join(dir, "a.conf"), "a = 1\n")
+	writeTestFile(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/main\n")
+	writeTestFile(t, filepath.Join(dir, ".git", "config"), "[core]\n")
+	writeTestFile(t, filepath.Join(dir, "node_modules", "dep", "index.js"), "\n")
+
+	if err := m.AddFile(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := m.ListFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(".config", "tool", "a.conf")}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Errorf("managed files = %v, want %v", files, want)
+	}
+	if _, err := os.Lstat(filepath.Join(m.config.ConfigsDir, ".config", "tool", ".git")); !os.IsNotExist(err) {
+		t.Errorf(".git was copied into the configs directory")
+	}
+
+	// The working tree files are added; only the metadata is skipped
+	if target, err := os.Readlink(filepath.Join(dir, "a.conf")); err != nil || target != m.sourcePath(want[0]) {
+		t.Errorf("a.conf is not linked to its managed file: %q, %v", target, err)
+	}
+	if !strings.Contains(log.String(), "its .git directory was skipped") {
+		t.Errorf("no warning about the nested repository in %q", log.String())
+	}
+}
+
+func TestAddDirectoryIncludeVCS(t *testing.T) {
+	m := newTestManager(t)
+
+	dir := filepath.Join(m.config.HomeDir, ".config", "tool")
+	writeTestFile(t, filepath.Join(dir, "a.conf"), "a = 1\n")
+	writeTestFile(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/main\n")
+
+	if err := m.AddFileWith(dir, AddOptions{IncludeVCS: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(m.config.ConfigsDir, ".config", "tool", ".git", "HEAD")); err != nil {
+		t.Errorf("--include-vcs did not add the .git directory: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// SymlinkMode decides how AddFileWith treats a path that is a symlink to
+// somewhere other than its managed copy
+type SymlinkMode string
+
+const (
+	// SymlinkAsk refuses such paths with ErrIsSymlink, so the caller can
+	// ask the user and try again
+	SymlinkAsk SymlinkMode = ""
+
+	// SymlinkFollow manages the content the link points to. The link is
+	// replaced by a link to the managed copy, as for any other file.
+	SymlinkFollow SymlinkMode = "follow"
+
+	// SymlinkKeep manages the link itself: the configs directory stores a
+	// symlink to the same place, and the home path links to it
+	SymlinkKeep SymlinkMode = "keep"
+
+	// SymlinkDereference is SymlinkFollow that also keeps the permissions
+	// of the file at the end of the link chain, and that stores symlinks
+	// to files inside an added directory as regular files instead of
+	// skipping them. The managed copy is never a link.
+	SymlinkDereference SymlinkMode = "dereference"
+)
+
+// ErrIsSymlink is returned by AddFileWith for a symlink when opts.Symlink
+// does not say how to add it
+var ErrIsSymlink = newError(CodeIsSymlink, "path is a symlink")
+
+// foreignLink reports whether absPath is a symlink that does not point at
+// its own managed copy, and returns where it points
+func (m *Manager) foreignLink(absPath string) (string, bool) {
+	info, err := os.Lstat(absPath)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return "", false
+	}
+	target, err := resolveLink(absPath)
+	if err != nil {
+		return "", false
+	}
+	if relPath, inHome := m.homeRelPath(absPath); inHome && target == m.sourcePath(relPath) {
+		return "", false
+	}
+	return target, true
+}
+
+// addLink manages the symlink at absPath, which points to target, as a link:
+// a symlink to target is committed to the configs directory and absPath is
+// linked to it. Where the link points is recorded in the repository this
+// way, and the file it points to is left alone.
+func (m *Manager) addLink(absPath, target string, message *template.Template) error {
+	relPath, inHome := m.homeRelPath(absPath)
+	if !inHome {
+		return newError(CodeInvalidArgument, "can only add files inside the home directory: %s", absPath)
+	}
+	if err := m.checkOutsideHome(relPath); err != nil {
+		return err
+	}
+	if within(m.config.ConfigsDir, target) {
+		return newError(CodeInvalidArgument, "%s points into the configs directory at %s; it cannot be kept as a link", absPath, target)
+	}
+
+	// Refuse to manage a path that overlaps an already-managed one
+	managed, err := m.ListFiles()
+	if err != nil {
+		return fmt.Errorf("error listing managed files: %v", err)
+	}
+	if overlaps := m.findOverlaps(relPath, managed); len(overlaps) > 0 {
+		return fmt.Errorf("%s overlaps already-managed paths: %s", relPath, strings.Join(overlaps, ", "))
+	}
+
+	// The first managed file fixes the layout of the configs directory
+	if err := m.recordLayout(); err != nil {
+		return err
+	}
+
+	sourceRel := m.sourceRel(relPath)
+	if err := m.mkdirAll(m.config.ConfigsDir, filepath.Dir(sourceRel)); err != nil {
+		return fmt.Errorf("error creating target directory: %v", err)
+	}
+
+	// The stored link is absolute: a relative one would resolve against
+	// the configs directory instead of where the link was
+	targetPath := filepath.Join(m.config.ConfigsDir, sourceRel)
+	if err := os.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error replacing managed copy: %v", err)
+	}
+	if err := os.Symlink(target, targetPath); err != nil {
+		return fmt.Errorf("error storing symbolic link: %v", err)
+	}
+
+	if err := os.Remove(absPath); err != nil {
+		return fmt.Errorf("error removing existing link: %v", err)
+	}
+	if err := os.Symlink(m.symlinkTarget(targetPath, absPath), absPath); err != nil {
+		return fmt.Errorf("error creating symbolic link: %v", err)
+	}
+
+	m.logf("Added the link itself: %s -> %s -> %s\n", absPath, targetPath, target)
+
+	return m.commitAdded([]string{targetPath}, relPath, false, message)
+}
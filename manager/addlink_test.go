@@ -0,0 +1,167 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// symlinkedDotfile creates ~/.vimrc as a symlink to ~/dotfiles/vimrc and
+// returns both paths
+func symlinkedDotfile(t *testing.T, m *Manager) (string, string) {
+	t.Helper()
+
+	target := filepath.Join(m.config.HomeDir, "dotfiles", "vimrc")
+	writeTestFile(t, target, "set number\n")
+	link := filepath.Join(m.config.HomeDir, ".vimrc")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	return link, target
+}
+
+func TestAddSymlinkAsks(t *testing.T) {
+	m := newTestManager(t)
+	link, target := symlinkedDotfile(t, m)
+
+	if err := m.AddFile(link); !errors.Is(err, ErrIsSymlink) {
+		t.Fatalf("AddFile() error = %v, want ErrIsSymlink", err)
+	}
+	if got, err := os.Readlink(link); err != nil || got != target {
+		t.Errorf("the link was changed to %q, %v", got, err)
+	}
+}
+
+func TestAddSymlinkKeep(t *testing.T) {
+	m := newTestManager(t)
+	link, target := symlinkedDotfile(t, m)
+
+	if err := m.AddFileWith(link, AddOptions{Symlink: SymlinkKeep}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The configs directory stores the link, and the home path links to it
+	managed := m.sourcePath(".vimrc")
+	if got, err := os.Readlink(managed); err != nil || got != target {
+		t.Errorf("managed copy links to %q, %v; want %s", got, err, target)
+	}
+	if got, err := os.Readlink(link); err != nil || got != managed {
+		t.Errorf("%s links to %q, %v; want %s", link, got, err, managed)
+	}
+	if got := readTestFile(t, target); got != "set number\n" {
+		t.Errorf("the link target was changed to %q", got)
+	}
+	if files := testGit(t, m, "ls-files", "--", "configs"); !strings.Contains(files, "configs/.vimrc") {
+		t.Errorf("the link was not committed: %q", files)
+	}
+}
+
+func TestAddSymlinkFollow(t *testing.T) {
+	m := newTestManager(t)
+	link, target := symlinkedDotfile(t, m)
+
+	if err := m.AddFileWith(link, AddOptions{Symlink: SymlinkFollow}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The content is managed like any other file
+	managed := m.sourcePath(".vimrc")
+	info, err := os.Lstat(managed)
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("managed copy is not a regular file: %v", err)
+	}
+	if got := readTestFile(t, managed); got != "set number\n" {
+		t.Errorf("managed copy = %q, want the content of the link target", got)
+	}
+	if got, err := os.Readlink(link); err != nil || got != managed {
+		t.Errorf("%s links to %q, %v; want %s", link, got, err, managed)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("the link target was removed: %v", err)
+	}
+}
+
+func TestAddSymlinkDereferenceChain(t *testing.T) {
+	m := newTestManager(t)
+	var log bytes.Buffer
+	m.log = &log
+
+	// ~/.tool.conf -> ~/dotfiles/current -> ~/dotfiles/v2/tool.conf
+	dotfiles := filepath.Join(m.config.HomeDir, "dotfiles")
+	final := filepath.Join(dotfiles, "v2", "tool.conf")
+	writeTestFile(t, final, "level = 2\n")
+	if err := os.Chmod(final, 0640); err != nil {
+		t.Fatal(err)
+	}
+	middle := filepath.Join(dotfiles, "current")
+	if err := os.Symlink(final, middle); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(m.config.HomeDir, ".tool.conf")
+	if err := os.Symlink(middle, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.AddFileWith(link, AddOptions{Symlink: SymlinkDereference}); err != nil {
+		t.Fatal(err)
+	}
+
+	managed := m.sourcePath(".tool.conf")
+	info, err := os.Lstat(managed)
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("managed copy is not a regular file: %v", err)
+	}
+	if got := readTestFile(t, managed); got != "level = 2\n" {
+		t.Errorf("managed copy = %q, want the content at the end of the chain", got)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("managed copy mode = %v, want the 0640 of the resolved file", info.Mode().Perm())
+	}
+	if !strings.Contains(log.String(), final) {
+		t.Errorf("log does not name the end of the chain: %q", log.String())
+	}
+	if got, err := os.Readlink(link); err != nil || got != managed {
+		t.Errorf("%s links to %q, %v; want %s", link, got, err, managed)
+	}
+	if _, err := os.Stat(final); err != nil {
+		t.Errorf("the end of the chain was removed: %v", err)
+	}
+}
+
+func TestAddDirectoryDereferencesChain(t *testing.T) {
+	m := newTestManager(t)
+
+	dir := filepath.Join(m.config.HomeDir, ".config", "tool")
+	final := filepath.Join(m.config.HomeDir, "dotfiles", "theme.conf")
+	writeTestFile(t, final, "dark\n")
+	middle := filepath.Join(m.config.HomeDir, "dotfiles", "theme")
+	if err := os.Symlink(final, middle); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "a.conf"), "a = 1\n")
+	if err := os.Symlink(middle, filepath.Join(dir, "theme.conf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "broken")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.AddFileWith(dir, AddOptions{Symlink: SymlinkDereference}); err != nil {
+		t.Fatal(err)
+	}
+
+	managed := m.sourcePath(filepath.Join(".config", "tool", "theme.conf"))
+	info, err := os.Lstat(managed)
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("managed copy is not a regular file: %v", err)
+	}
+	if got := readTestFile(t, managed); got != "dark\n" {
+		t.Errorf("managed copy = %q, want the content at the end of the chain", got)
+	}
+	if _, err := os.Lstat(m.sourcePath(filepath.Join(".config", "tool", "broken"))); !os.IsNotExist(err) {
+		t.Errorf("a broken symlink was added")
+	}
+}
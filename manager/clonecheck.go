@@ -0,0 +1,128 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// projectMarkers are files at the top of a repository that suggest a
+// software project rather than a dotfiles repository
+var projectMarkers = []string{
+	"go.mod", "package.json", "Cargo.toml", "pyproject.toml", "setup.py",
+	"pom.xml", "build.gradle", "Gemfile", "composer.json", "CMakeLists.txt",
+}
+
+// RemoteCheck describes how a freshly cloned repository compares to the
+// layout dotman expects
+type RemoteCheck struct {
+	// Empty is set when the repository has no files yet, as a newly
+	// created one does. Scaffolding it is expected.
+	Empty bool `json:"empty"`
+	// HasConfigs is set when the repository has a configs directory
+	HasConfigs bool `json:"has_configs"`
+	// ProjectMarkers lists the files that make the repository look like a
+	// software project, such as go.mod or package.json
+	ProjectMarkers []string `json:"project_markers,omitempty"`
+}
+
+// OK reports whether the repository can be used as it is
+func (c RemoteCheck) OK() bool {
+	return c.Empty || (c.HasConfigs && len(c.ProjectMarkers) == 0)
+}
+
+// Problems describes what does not look like a dotman repository
+func (c RemoteCheck) Problems() []string {
+	if c.Empty {
+		return nil
+	}
+	var problems []string
+	if !c.HasConfigs {
+		problems = append(problems, "the repository has no configs/ directory, so it was not created by dotman")
+	}
+	if len(c.ProjectMarkers) > 0 {
+		problems = append(problems, fmt.Sprintf("the repository looks like a software project rather than dotfiles (found %s)", strings.Join(c.ProjectMarkers, ", ")))
+	}
+	return problems
+}
+
+// checkClone inspects the repository just cloned into the dotman directory
+func (m *Manager) checkClone() (RemoteCheck, error) {
+	var check RemoteCheck
+
+	entries, err := os.ReadDir(m.config.DotmanDir)
+	if err != nil {
+		return check, fmt.Errorf("error reading cloned repository: %v", err)
+	}
+	check.Empty = true
+	for _, entry := range entries {
+		if entry.Name() != ".git" {
+			check.Empty = false
+			break
+		}
+	}
+
+	if info, err := os.Stat(m.config.ConfigsDir); err == nil && info.IsDir() {
+		check.HasConfigs = true
+	}
+
+	// Dotfiles in a subdirectory are expected to share the repository with
+	// a project, so only the configs directory is checked then
+	if m.config.Settings.ConfigsSubdir != "" {
+		return check, nil
+	}
+	for _, marker := range projectMarkers {
+		if _, err := os.Lstat(filepath.Join(m.config.DotmanDir, marker)); err == nil {
+			check.ProjectMarkers = append(check.ProjectMarkers, marker)
+		}
+	}
+	sort.Strings(check.ProjectMarkers)
+	return check, nil
+}
+
+// verifyClone checks the cloned repository, warning about anything that
+// does not fit. With opts.VerifyRemote, opts.ConfirmScaffold decides
+// whether to go on; when it declines, the clone is removed again so init
+// can be retried with the right URL.
+func (m *Manager) verifyClone(opts CloneOptions) error {
+	check, err := m.checkClone()
+	if err != nil {
+		return err
+	}
+	if check.OK() {
+		return nil
+	}
+
+	for _, problem := range check.Problems() {
+		m.logf("Warning: %s\n", problem)
+	}
+	if !opts.VerifyRemote || opts.ConfirmScaffold == nil {
+		return nil
+	}
+
+	if err := opts.ConfirmScaffold(check); err != nil {
+		if cleanupErr := m.removeClone(); cleanupErr != nil {
+			m.logf("Warning: failed to remove the cloned repository: %v\n", cleanupErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// removeClone empties the dotman directory again after a clone was
+// rejected. The directory was empty before cloning, so everything in it
+// came from the clone.
+func (m *Manager) removeClone() error {
+	entries, err := os.ReadDir(m.config.DotmanDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(m.config.DotmanDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// defaultAddCommitMessage is the commit message of add without a template
+const defaultAddCommitMessage = "Add {{.Path}}"
+
+// AddCommitData is what add commit message templates can refer to
+type AddCommitData struct {
+	// Path is the added file or directory, relative to the home directory
+	Path string
+	// Paths are the files the commit adds, relative to the home directory
+	Paths []string
+	// Count is the number of files the commit adds
+	Count int
+	// Tags are the tags 'dotman docs' detects for the files, comma-separated
+	Tags string
+}
+
+// addCommitTemplate parses the commit message template for add: the one in
+// opts, the add_commit_message setting, or "Add {{.Path}}". The template is
+// tried on sample data so mistakes are reported before any file is touched.
+func (m *Manager) addCommitTemplate(opts AddOptions) (*template.Template, error) {
+	text := opts.CommitMessage
+	if text == "" {
+		text = m.config.Settings.AddCommitMessage
+	}
+	if text == "" {
+		text = defaultAddCommitMessage
+	}
+
+	tmpl, err := parseAddCommitMessage(text)
+	if err != nil {
+		return nil, newError(CodeInvalidArgument, "invalid commit message template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// parseAddCommitMessage parses and test-runs an add commit message template
+func parseAddCommitMessage(text string) (*template.Template, error) {
+	tmpl, err := template.New("commit").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := AddCommitData{Path: ".bashrc", Paths: []string{".bashrc"}, Count: 1}
+	if err := tmpl.Execute(&strings.Builder{}, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// addCommitMessage renders the commit message for adding relPath, which
+// consists of targetPaths in the configs directory
+func (m *Manager) addCommitMessage(tmpl *template.Template, relPath string, targetPaths []string) (string, error) {
+	data := AddCommitData{Path: relPath, Count: len(targetPaths)}
+	seen := make(map[string]bool)
+	var tags []string
+	for _, targetPath := range targetPaths {
+		if rel, err := m.homeRelFor(targetPath); err == nil {
+			data.Paths = append(data.Paths, rel)
+		}
+		for _, tag := range m.detectConfigTags(targetPath) {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	data.Tags = strings.Join(tags, ", ")
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	message := strings.TrimSpace(b.String())
+	if message == "" {
+		return "Add " + filepath.ToSlash(relPath), nil
+	}
+	return message, nil
+}
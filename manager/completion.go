@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// completionCacheTTL bounds how long cached completions are used. Adding or
+// removing a file through dotman changes the stamps below, so the TTL only
+// matters for edits made behind dotman's back.
+const completionCacheTTL = time.Minute
+
+// completionEntry is one cached list of completions
+type completionEntry struct {
+	Stamp   string          `json:"stamp"`
+	Created time.Time       `json:"created"`
+	Values  json.RawMessage `json:"values"`
+}
+
+// CompletionFiles returns the managed files like ListFiles, but answers from
+// the completion cache while it is fresh, so pressing TAB does not walk the
+// configs directory every time. The cache lives in the XDG cache directory
+// rather than the dotman directory, so using it is fine in read-only mode.
+func (m *Manager) CompletionFiles() ([]string, error) {
+	var files []string
+	err := m.cachedCompletion("files:"+m.config.ConfigsDir, m.filesStamp(), &files, func() (interface{}, error) {
+		return m.ListFiles()
+	})
+	return files, err
+}
+
+// CompletionBackups returns the backups like ListBackups, answering from the
+// completion cache while it is fresh
+func (m *Manager) CompletionBackups() ([]BackupMetadata, error) {
+	var backups []BackupMetadata
+	err := m.cachedCompletion("backups:"+m.config.BackupsDir(), modStamp(m.config.BackupsDir()), &backups, func() (interface{}, error) {
+		return m.ListBackups()
+	})
+	return backups, err
+}
+
+// filesStamp changes whenever the set of managed files may have: the
+// top-level configs directory changes when a file is added there, the git
+// index when one is committed anywhere below it, and the settings file when
+// the configs layout changes
+func (m *Manager) filesStamp() string {
+	stamp := modStamp(m.config.ConfigsDir) + " " + modStamp(m.config.SettingsFile())
+	if root, ok := m.gitRoot(); ok {
+		stamp += " " + modStamp(filepath.Join(root, ".git", "index"))
+	}
+	return stamp
+}
+
+// modStamp returns the modification time of path, or "-" when it is missing
+func modStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "-"
+	}
+	return fmt.Sprint(info.ModTime().UnixNano())
+}
+
+// cachedCompletion decodes the cached values for key into out when their
+// stamp matches and they are younger than completionCacheTTL. Otherwise it
+// calls compute and caches the result. Failing to read or write the cache
+// is not an error; it only makes completion slower.
+func (m *Manager) cachedCompletion(key, stamp string, out interface{}, compute func() (interface{}, error)) error {
+	path := m.config.CompletionCacheFile()
+	entries := make(map[string]completionEntry)
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &entries)
+	}
+
+	if entry, ok := entries[key]; ok && entry.Stamp == stamp && time.Since(entry.Created) < completionCacheTTL {
+		if err := json.Unmarshal(entry.Values, out); err == nil {
+			return nil
+		}
+	}
+
+	values, err := compute()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return err
+	}
+
+	entries[key] = completionEntry{Stamp: stamp, Created: time.Now(), Values: data}
+	m.saveCompletionCache(path, entries)
+	return nil
+}
+
+// saveCompletionCache writes the cache through a temporary file, so a
+// completion running concurrently never reads half of it
+func (m *Manager) saveCompletionCache(path string, entries map[string]completionEntry) {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".completion-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// compressBackup gzips the content of a backup
+func compressBackup(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(content); err != nil {
+		return nil, fmt.Errorf("error compressing backup: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing backup: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressBackup reverses compressBackup
+func decompressBackup(compressed []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing backup: %v", err)
+	}
+	defer gz.Close()
+
+	content, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing backup: %v", err)
+	}
+	return content, nil
+}
+
+// backupChecksumMatches reports whether the stored content of backup matches
+// its checksum. Compressed content is checked after decompressing, so the
+// checksum is the file's own; encrypted content is checked as stored, so no
+// key is needed. Backups taken before checksums were recorded always match.
+func backupChecksumMatches(backup BackupMetadata, stored []byte) bool {
+	if backup.Checksum == "" {
+		return true
+	}
+	if backup.Compressed && !backup.Encrypted {
+		content, err := decompressBackup(stored)
+		return err == nil && checksum(content) == backup.Checksum
+	}
+	return checksum(stored) == backup.Checksum
+}
+
+// backupContent returns the file content of backup from its stored content,
+// decrypting and then decompressing as needed
+func (m *Manager) backupContent(backup BackupMetadata, stored []byte) ([]byte, error) {
+	content := stored
+	if backup.Encrypted {
+		var err error
+		if content, err = m.decryptBackup(backup, content); err != nil {
+			return nil, err
+		}
+	}
+	if backup.Compressed {
+		return decompressBackup(content)
+	}
+	return content, nil
+}
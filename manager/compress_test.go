@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressedBackupRoundTrip(t *testing.T) {
+	m := newTestManager(t)
+
+	path := filepath.Join(m.config.HomeDir, ".bashrc")
+	content := strings.Repeat("export PATH=$HOME/bin:$PATH\n", 100)
+	writeTestFile(t, path, content)
+
+	backup, err := m.backupFile(path, BackupOptions{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !backup.Compressed {
+		t.Fatal("backup is not marked as compressed")
+	}
+	if backup.OriginalSize != int64(len(content)) || backup.CompressedSize >= backup.OriginalSize {
+		t.Errorf("sizes = %d compressed of %d original, want %d original and smaller compressed",
+			backup.CompressedSize, backup.OriginalSize, len(content))
+	}
+
+	_, stored, err := m.readBackup(backup.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(stored, []byte(content)) {
+		t.Error("stored content is not compressed")
+	}
+	if !backupChecksumMatches(backup, stored) {
+		t.Error("checksum of the decompressed content does not match")
+	}
+	if backupChecksumMatches(backup, append(stored[:len(stored)-1:len(stored)-1], stored[len(stored)-1]^0xff)) {
+		t.Error("checksum matches corrupted content")
+	}
+
+	writeTestFile(t, path, "changed\n")
+	if err := m.RestoreBackupWith(backup.ID, RestoreOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, path); got != content {
+		t.Errorf("restored content = %q, want the original content", got)
+	}
+}
@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// linkConditionsFileName holds the conditions under which managed files are
+// linked. It is committed, so a shared repository only links what each
+// machine can use.
+const linkConditionsFileName = "links.json"
+
+// LinkCondition restricts when a managed file, or every file in a managed
+// directory, is linked
+type LinkCondition struct {
+	// Requires lists programs that must all be found on PATH. A single
+	// program may be given as a string.
+	Requires programList `json:"requires"`
+}
+
+// programList is a list of program names that also accepts a single name
+type programList []string
+
+// UnmarshalJSON accepts either a string or a list of strings
+func (p *programList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*p = programList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("requires must be a program name or a list of them")
+	}
+	*p = list
+	return nil
+}
+
+// loadLinkConditions reads the link conditions, keyed by home-relative path.
+// A missing file has no conditions.
+func (m *Manager) loadLinkConditions() (map[string]LinkCondition, error) {
+	conditions := make(map[string]LinkCondition)
+	data, err := os.ReadFile(filepath.Join(m.config.DotmanDir, linkConditionsFileName))
+	if os.IsNotExist(err) {
+		return conditions, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", linkConditionsFileName, err)
+	}
+	var raw map[string]LinkCondition
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", linkConditionsFileName, err)
+	}
+	for path, condition := range raw {
+		conditions[filepath.ToSlash(filepath.Clean(path))] = condition
+	}
+	return conditions, nil
+}
+
+// missingPrograms returns the programs required for relPath by conditions
+// that are not installed. Conditions on a directory apply to every file
+// below it.
+func missingPrograms(conditions map[string]LinkCondition, relPath string) []string {
+	var missing []string
+	for path := filepath.Clean(relPath); path != "." && path != string(filepath.Separator); path = filepath.Dir(path) {
+		condition, ok := conditions[filepath.ToSlash(path)]
+		if !ok {
+			continue
+		}
+		for _, program := range condition.Requires {
+			if _, err := exec.LookPath(program); err != nil {
+				missing = append(missing, program)
+			}
+		}
+	}
+	return missing
+}
+
+// unavailableReason describes why relPath is not linked on this machine, or
+// returns "" when every program it requires is installed
+func (m *Manager) unavailableReason(relPath string) string {
+	conditions, err := m.loadLinkConditions()
+	if err != nil {
+		return ""
+	}
+	return requiresReason(missingPrograms(conditions, relPath))
+}
+
+// requiresReason describes missing programs for messages
+func requiresReason(missing []string) string {
+	if len(missing) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("requires %s, which is not installed", strings.Join(missing, ", "))
+}
@@ -0,0 +1,123 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrEmptyContent is returned by AddContent when there is nothing to write
+var ErrEmptyContent = newError(CodeEmptyContent, "no content to add")
+
+// AddContent manages content that does not exist as a file yet, such as
+// generated output. The content is written into the configs directory at the
+// path that target maps to, target is linked to it and the file is committed.
+// A real file already at target is backed up before it is replaced, or
+// renamed out of the way with opts.RenameOnConflict.
+func (m *Manager) AddContent(target string, content []byte, opts AddOptions) error {
+	if err := m.checkWritable("add files"); err != nil {
+		return err
+	}
+
+	if len(content) == 0 {
+		return ErrEmptyContent
+	}
+
+	message, err := m.addCommitTemplate(opts)
+	if err != nil {
+		return err
+	}
+
+	absPath, err := filepath.Abs(m.config.ExpandHome(target))
+	if err != nil {
+		return fmt.Errorf("error getting absolute path: %v", err)
+	}
+
+	relPath, inHome := m.homeRelPath(absPath)
+	if !inHome || relPath == "." {
+		return newError(CodeInvalidArgument, "target must be a file inside the home directory: %s", absPath)
+	}
+	if err := m.checkOutsideHome(relPath); err != nil {
+		return err
+	}
+
+	if info, err := os.Lstat(absPath); err == nil && info.IsDir() {
+		return newError(CodeInvalidArgument, "target is a directory: %s", absPath)
+	}
+
+	// Apply the same size and binary rules as AddFile
+	lfs := m.lfsTracked(relPath)
+	if !opts.Force && !lfs {
+		if err := m.checkFileSize(absPath, int64(len(content))); err != nil {
+			return err
+		}
+	}
+	if !lfs && bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) >= 0 {
+		m.logf("Warning: %s looks like binary content; consider adding it to lfs_patterns\n", absPath)
+	}
+	if lfs {
+		if err := m.ensureLFS(); err != nil {
+			return err
+		}
+	}
+
+	managed, err := m.ListFiles()
+	if err != nil {
+		return fmt.Errorf("error listing managed files: %v", err)
+	}
+	if overlaps := m.findOverlaps(relPath, managed); len(overlaps) > 0 {
+		return fmt.Errorf("%s overlaps already-managed paths: %s", relPath, strings.Join(overlaps, ", "))
+	}
+
+	// The first managed file fixes the layout of the configs directory
+	if err := m.recordLayout(); err != nil {
+		return err
+	}
+
+	// Write the content into the configs directory
+	sourceRel := m.sourceRel(relPath)
+	if err := m.mkdirAll(m.config.ConfigsDir, filepath.Dir(sourceRel)); err != nil {
+		return fmt.Errorf("error creating target directory: %v", err)
+	}
+	targetPath := filepath.Join(m.config.ConfigsDir, sourceRel)
+	fileMode := m.fileModeFor(relPath)
+	if err := os.WriteFile(targetPath, content, fileMode); err != nil {
+		return fmt.Errorf("error writing file: %v", err)
+	}
+	if err := os.Chmod(targetPath, fileMode); err != nil {
+		return fmt.Errorf("error setting file mode: %v", err)
+	}
+
+	// Link target to the managed file, saving a real file that is in the way
+	if err := m.mkdirTargetParents(relPath); err != nil {
+		return fmt.Errorf("error creating parent directories: %v", err)
+	}
+	if opts.RenameOnConflict {
+		renamedPath, err := m.renameOriginal(absPath, relPath)
+		if err != nil {
+			return fmt.Errorf("error renaming %s: %v", absPath, err)
+		}
+		if renamedPath != "" {
+			m.logf("Renamed existing file: %s -> %s\n", absPath, renamedPath)
+		}
+	}
+	backupPath, err := m.backupOverwritten(absPath, relPath, LinkOptions{})
+	if err != nil {
+		return err
+	}
+	if backupPath != "" {
+		m.logf("Backed up existing file: %s -> %s\n", absPath, backupPath)
+	}
+	if err := os.Remove(absPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing existing file: %v", err)
+	}
+	if err := os.Symlink(m.symlinkTarget(targetPath, absPath), absPath); err != nil {
+		return fmt.Errorf("error creating symbolic link: %v", err)
+	}
+
+	m.logf("Added and linked: %s -> %s\n", absPath, targetPath)
+
+	return m.commitAdded([]string{targetPath}, relPath, lfs, message)
+}
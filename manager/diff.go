@@ -0,0 +1,222 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// FileChange describes a change to a managed file between two revisions
+type FileChange struct {
+	// Status is the git status letter: A (added), M (modified), D (deleted),
+	// R (renamed), C (copied) or T (type changed)
+	Status string `json:"status"`
+	// Path is the path relative to the configs directory
+	Path string `json:"path"`
+	// OldPath is the previous path for renames and copies
+	OldPath string `json:"old_path,omitempty"`
+}
+
+// Description returns a human-readable name for the change status
+func (c FileChange) Description() string {
+	switch c.Status {
+	case "A":
+		return "added"
+	case "M":
+		return "modified"
+	case "D":
+		return "deleted"
+	case "R":
+		return "renamed"
+	case "C":
+		return "copied"
+	case "T":
+		return "type changed"
+	default:
+		return c.Status
+	}
+}
+
+// RemoteDiff fetches the remote and returns the managed files that would
+// change when pulling, without modifying the working tree
+func (m *Manager) RemoteDiff() ([]FileChange, error) {
+	// Check if we're in a git repository
+	if !m.isGitRepo() {
+		return nil, ErrNotGitRepo
+	}
+
+	if output, err := m.git("fetch").CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("error fetching from remote: %v\nOutput: %s", err, string(output))
+	}
+
+	// Compare against the merge base so local commits are not reported as incoming
+	output, err := m.git("diff", "--name-status", "HEAD...FETCH_HEAD", "--", m.configsDirRel()).Output()
+	if err != nil {
+		return nil, fmt.Errorf("error comparing with remote: %v", err)
+	}
+
+	return m.parseNameStatus(string(output)), nil
+}
+
+// configsRepoPath returns the configs directory relative to the repository
+// root, which git uses for the paths it prints
+func (m *Manager) configsRepoPath() string {
+	root, ok := m.gitRoot()
+	if !ok {
+		return m.configsDirRel()
+	}
+	relPath, err := filepath.Rel(root, m.config.ConfigsDir)
+	if err != nil {
+		return m.configsDirRel()
+	}
+	return filepath.ToSlash(relPath)
+}
+
+// parseNameStatus parses `git diff --name-status` output into file changes
+// with paths relative to the configs directory
+func (m *Manager) parseNameStatus(output string) []FileChange {
+	prefix := m.configsRepoPath() + "/"
+
+	var changes []FileChange
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+
+		// Renames and copies carry a similarity score, e.g. R100
+		change := FileChange{Status: fields[0][:1]}
+		if len(fields) >= 3 {
+			change.OldPath = strings.TrimPrefix(fields[1], prefix)
+			change.Path = strings.TrimPrefix(fields[2], prefix)
+		} else {
+			change.Path = strings.TrimPrefix(fields[1], prefix)
+		}
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// LocalChange is a managed file whose home path holds a real file with
+// other content instead of a link, such as a copy edited after 'dotman
+// mirror' or a file that was in the way when the repository was cloned
+type LocalChange struct {
+	// Path is the path relative to the home directory
+	Path string `json:"path"`
+	// HomePath is the file in the home directory
+	HomePath string `json:"home_path"`
+	// Source is the managed file in the configs directory
+	Source string `json:"source"`
+}
+
+// LocalChanges returns the managed files named by homePaths, or all managed
+// files when none are named, whose home file differs from the managed file
+func (m *Manager) LocalChanges(homePaths []string) ([]LocalChange, error) {
+	relPaths, err := m.managedRelPaths(homePaths)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []LocalChange
+	for _, relPath := range relPaths {
+		change := LocalChange{
+			Path:     relPath,
+			HomePath: m.targetPath(relPath),
+			Source:   m.sourcePath(relPath),
+		}
+		if m.homeCopyReason(change.HomePath, change.Source) == "" {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// WriteLocalDiff writes the unified diff from the managed file of change to
+// its home file to w
+func (m *Manager) WriteLocalDiff(w io.Writer, change LocalChange) error {
+	if err := m.diffFiles(w, "", change.Source, change.HomePath); err != nil {
+		return fmt.Errorf("error comparing %s: %v", change.HomePath, err)
+	}
+	return nil
+}
+
+// diffFiles writes the unified diff from file a to file b to w, running git
+// in dir when it is not empty so relative paths name the files
+func (m *Manager) diffFiles(w io.Writer, dir, a, b string) error {
+	var stderr strings.Builder
+	cmd := m.newGitCmd(context.Background(), dir, "diff", "--no-index", "--no-ext-diff", "--no-color", "--", a, b)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	// Several files are diffed in a row, so do not page each of them
+	cmd.Env = append(os.Environ(), "GIT_PAGER=cat")
+
+	// git diff --no-index exits with 1 when the files differ
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err == nil || errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil
+	}
+	return fmt.Errorf("%v\nOutput: %s", err, stderr.String())
+}
+
+// DiffBackups returns the unified diff from the content of backup id1 to
+// that of backup id2, or "" when they are the same. Both backups are
+// verified, decrypted and decompressed as for restoring. Backups of
+// different files can be compared, with a warning.
+func (m *Manager) DiffBackups(id1, id2 string) (string, error) {
+	backup1, stored1, err := m.readBackup(id1)
+	if err != nil {
+		return "", err
+	}
+	backup2, stored2, err := m.readBackup(id2)
+	if err != nil {
+		return "", err
+	}
+	if backup1.OriginalPath != backup2.OriginalPath {
+		m.logf("Warning: the backups are of different files: %s and %s\n", backup1.OriginalPath, backup2.OriginalPath)
+	}
+
+	content1, err := m.backupContent(backup1, stored1)
+	if err != nil {
+		return "", err
+	}
+	content2, err := m.backupContent(backup2, stored2)
+	if err != nil {
+		return "", err
+	}
+
+	// Write each content as <id>/<file name>, so the diff headers name the
+	// backup and the file
+	dir, err := os.MkdirTemp("", "dotman-diff-")
+	if err != nil {
+		return "", fmt.Errorf("error comparing backups: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	for _, side := range []struct {
+		backup  BackupMetadata
+		content []byte
+	}{{backup1, content1}, {backup2, content2}} {
+		path := filepath.Join(side.backup.ID, filepath.Base(side.backup.OriginalPath))
+		if err := os.MkdirAll(filepath.Join(dir, side.backup.ID), 0700); err != nil {
+			return "", fmt.Errorf("error comparing backups: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, path), side.content, 0600); err != nil {
+			return "", fmt.Errorf("error comparing backups: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	var diff strings.Builder
+	if err := m.diffFiles(&diff, dir, paths[0], paths[1]); err != nil {
+		return "", fmt.Errorf("error comparing backups: %v", err)
+	}
+	return diff.String(), nil
+}
@@ -0,0 +1,23 @@
+// Package manager implements dotman's dotfile operations and can be used as
+// a library independently of the dotman command line interface.
+//
+// Create a Manager from a config.Config with New, or with NewWithLogger to
+// receive human-readable progress messages on an io.Writer. Manager methods
+// never print to stdout on their own; they return results and errors that
+// callers can present however they like.
+//
+// The stable library surface is:
+//
+//   - ListFiles, AddFile, RemoveFile
+//   - Link, Update
+//   - CommitAndPush, Push
+//   - BackupFile, ListBackups, RestoreBackup
+//   - HealthCheck
+//   - GenerateDocs, GenerateDocsWith and the DocRenderer interface
+//   - AddSubmodule, UpdateSubmodules
+//   - InitializeGitRepo, InitializeGitRepoWith, InitializeFromExistingRepo
+//   - DotmanError, ErrorCodeOf and the Code constants
+//
+// Unexported helpers and the layout of files under the dotman directory are
+// not part of the stable surface and may change between releases.
+package manager
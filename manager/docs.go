@@ -1,116 +1,238 @@
 package manager
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
 // ConfigDoc represents documentation for a configuration file
 type ConfigDoc struct {
-	Path         string    `json:"path"`
+	Path string `json:"path"`
+	// DocPath is where the file's documentation is written, relative to
+	// the docs directory and without an extension. It is Path made safe
+	// for every filesystem and unique among all documented files.
+	DocPath      string    `json:"doc_path"`
 	Description  string    `json:"description"`
 	LastUpdated  time.Time `json:"last_updated"`
 	Tags         []string  `json:"tags"`
 	Dependencies []string  `json:"dependencies"`
 	Notes        string    `json:"notes"`
+	// Mode is the permission mode of the managed file in octal, like 0600
+	Mode string `json:"mode"`
+	// Warning points out a permission problem, like a world-readable file
+	// in a sensitive directory such as ~/.ssh
+	Warning string `json:"warning,omitempty"`
 }
 
-// GenerateDocs generates documentation for all managed configuration files
+// GenerateDocs generates Markdown documentation for all managed configuration files
 func (m *Manager) GenerateDocs() error {
+	return m.GenerateDocsWith(NewMarkdownRenderer())
+}
+
+// GenerateDocsWith generates documentation for all managed configuration files
+// using the given renderer
+func (m *Manager) GenerateDocsWith(r DocRenderer) error {
+	if err := m.checkWritable("generate documentation"); err != nil {
+		return err
+	}
+
 	docsDir := filepath.Join(m.config.DotmanDir, "docs")
 	if err := os.MkdirAll(docsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create docs directory: %v", err)
 	}
 
-	// Generate main README
-	if err := m.generateMainReadme(docsDir); err != nil {
-		return fmt.Errorf("failed to generate main README: %v", err)
-	}
-
 	// Generate individual config docs
-	if err := m.generateConfigDocs(docsDir); err != nil {
+	docs, err := m.generateConfigDocs(docsDir, r)
+	if err != nil {
 		return fmt.Errorf("failed to generate config docs: %v", err)
 	}
+	for _, doc := range docs {
+		if doc.Warning != "" {
+			m.logf("Warning: %s: %s\n", doc.Path, doc.Warning)
+		}
+	}
+
+	// Generate the index
+	if err := r.RenderIndex(docsDir, docs); err != nil {
+		return fmt.Errorf("failed to generate docs index: %v", err)
+	}
 
 	return nil
 }
 
-// generateMainReadme generates the main README file
-func (m *Manager) generateMainReadme(docsDir string) error {
-	readmePath := filepath.Join(docsDir, "README.md")
-
-	// Get list of all managed files
+// generateConfigDocs generates documentation for individual configuration files
+// and returns the collected docs sorted by path. Files are processed
+// concurrently by a pool of workers; each file is read once.
+func (m *Manager) generateConfigDocs(docsDir string, r DocRenderer) ([]ConfigDoc, error) {
 	files, err := m.ListFiles()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Generate README content
-	var content strings.Builder
-	content.WriteString("# Dotman Configuration Documentation\n\n")
-	content.WriteString(fmt.Sprintf("Generated on: %s\n\n", time.Now().Format("2006-01-02 15:04:05")))
+	docPaths := assignDocPaths(files)
+
+	jobs := make(chan string)
+	results := make(chan ConfigDoc, len(files))
+	errs := make(chan error, len(files))
+
+	workers := runtime.NumCPU()
+	if workers > len(files) {
+		workers = len(files)
+	}
 
-	content.WriteString("## Managed Configuration Files\n\n")
-	for _, file := range files {
-		content.WriteString(fmt.Sprintf("- [%s](%s.md)\n", file, file))
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for relPath := range jobs {
+				doc, err := m.buildConfigDoc(relPath)
+				doc.DocPath = docPaths[relPath]
+				if err == nil {
+					err = r.RenderDoc(docsDir, doc)
+				}
+				if err != nil {
+					errs <- fmt.Errorf("%s: %v", relPath, err)
+					continue
+				}
+				results <- doc
+			}
+		}()
 	}
 
-	content.WriteString("\n## Quick Start\n\n")
-	content.WriteString("1. Clone this repository\n")
-	content.WriteString("2. Run `dotman link` to create symbolic links\n")
-	content.WriteString("3. Run `dotman check` to verify your configuration\n\n")
+	for _, relPath := range files {
+		jobs <- relPath
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+	close(errs)
+
+	// Report the first error in file order for deterministic output
+	var failures []error
+	for err := range errs {
+		failures = append(failures, err)
+	}
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool {
+			return failures[i].Error() < failures[j].Error()
+		})
+		return nil, failures[0]
+	}
 
-	content.WriteString("## Maintenance\n\n")
-	content.WriteString("- Run `dotman check` regularly to monitor configuration health\n")
-	content.WriteString("- Use `dotman backup` before making significant changes\n")
-	content.WriteString("- Keep your configuration up to date with `dotman update`\n")
+	docs := make([]ConfigDoc, 0, len(files))
+	for doc := range results {
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Path < docs[j].Path
+	})
 
-	return os.WriteFile(readmePath, []byte(content.String()), 0644)
+	return docs, nil
 }
 
-// generateConfigDocs generates documentation for individual configuration files
-func (m *Manager) generateConfigDocs(docsDir string) error {
-	return filepath.Walk(m.config.ConfigsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+// reservedDocNames are the index pages of the renderers, which no file's
+// documentation may replace
+var reservedDocNames = map[string]bool{"readme": true, "index": true}
 
-		if info.IsDir() {
-			return nil
-		}
+// windowsDeviceNames cannot be used as file names on Windows, with or
+// without an extension
+var windowsDeviceNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
 
-		// Get relative path
-		relPath, err := filepath.Rel(m.config.ConfigsDir, path)
-		if err != nil {
-			return err
+// assignDocPaths maps each managed file to the path its documentation is
+// written to. Paths are escaped by docPathFor, and a path that would clash
+// with an index page or, ignoring case, with another file's documentation
+// gets a suffix derived from the full relative path, so no two files share
+// documentation on any filesystem.
+func assignDocPaths(relPaths []string) map[string]string {
+	sorted := append([]string(nil), relPaths...)
+	sort.Strings(sorted)
+
+	docPaths := make(map[string]string, len(sorted))
+	taken := make(map[string]bool, len(sorted))
+	for _, relPath := range sorted {
+		docPath := docPathFor(relPath)
+		key := strings.ToLower(filepath.ToSlash(docPath))
+		if reservedDocNames[key] || taken[key] {
+			docPath += "~" + checksum([]byte(relPath))[:8]
+			key = strings.ToLower(filepath.ToSlash(docPath))
 		}
+		taken[key] = true
+		docPaths[relPath] = docPath
+	}
+	return docPaths
+}
 
-		// Create documentation
-		doc := ConfigDoc{
-			Path:         relPath,
-			LastUpdated:  info.ModTime(),
-			Tags:         m.detectConfigTags(path),
-			Dependencies: m.detectDependencies(path),
+// docPathFor escapes each element of relPath so it is a valid file name on
+// Linux, macOS and Windows. Characters Windows rejects, control characters,
+// trailing dots and spaces, device names like CON and the escape character
+// itself are written as %XX, which keeps different paths distinct.
+func docPathFor(relPath string) string {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	for i, part := range parts {
+		var b strings.Builder
+		for j := 0; j < len(part); j++ {
+			c := part[j]
+			trailing := j == len(part)-1 && (c == '.' || c == ' ')
+			if c < 0x20 || c == 0x7f || strings.IndexByte(`<>:"\|?*%`, c) >= 0 || trailing {
+				fmt.Fprintf(&b, "%%%02X", c)
+				continue
+			}
+			b.WriteByte(c)
 		}
+		escaped := b.String()
 
-		// Generate markdown documentation
-		docPath := filepath.Join(docsDir, relPath+".md")
-		if err := m.writeConfigDoc(docPath, doc); err != nil {
-			return err
+		stem := strings.ToUpper(strings.SplitN(escaped, ".", 2)[0])
+		if windowsDeviceNames[stem] {
+			escaped = fmt.Sprintf("%%%02X", escaped[0]) + escaped[1:]
 		}
+		parts[i] = escaped
+	}
+	return filepath.Join(parts...)
+}
 
-		// Save JSON metadata
-		jsonPath := filepath.Join(docsDir, relPath+".json")
-		if err := m.saveConfigMetadata(jsonPath, doc); err != nil {
-			return err
-		}
+// buildConfigDoc collects the documentation for one managed file
+func (m *Manager) buildConfigDoc(relPath string) (ConfigDoc, error) {
+	path := m.sourcePath(relPath)
 
-		return nil
-	})
+	info, err := os.Stat(path)
+	if err != nil {
+		return ConfigDoc{}, err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ConfigDoc{}, err
+	}
+
+	return ConfigDoc{
+		Path:         relPath,
+		LastUpdated:  info.ModTime(),
+		Tags:         m.detectConfigTags(path),
+		Dependencies: m.detectDependencies(content),
+		Mode:         fmt.Sprintf("%04o", info.Mode().Perm()),
+		Warning:      permissionWarning(relPath, info.Mode()),
+	}, nil
+}
+
+// permissionWarning returns a warning for a file in a sensitive directory
+// that other users can read, or an empty string
+func permissionWarning(relPath string, mode os.FileMode) string {
+	root, ok := sensitiveRoot(relPath)
+	if !ok || mode.Perm()&0004 == 0 {
+		return ""
+	}
+	return fmt.Sprintf("This file is world-readable (%04o) although it is in %s; files there should have mode %04o", mode.Perm(), root, sensitiveModes[root].file)
 }
 
 // detectConfigTags detects relevant tags for a configuration file
@@ -145,13 +267,9 @@ func (m *Manager) detectConfigTags(path string) []string {
 	return tags
 }
 
-// detectDependencies detects dependencies for a configuration file
-func (m *Manager) detectDependencies(path string) []string {
+// detectDependencies detects dependencies from a configuration file's content
+func (m *Manager) detectDependencies(content []byte) []string {
 	var deps []string
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return deps
-	}
 
 	// Look for common dependency patterns
 	contentStr := string(content)
@@ -167,59 +285,3 @@ func (m *Manager) detectDependencies(path string) []string {
 
 	return deps
 }
-
-// writeConfigDoc writes markdown documentation for a configuration file
-func (m *Manager) writeConfigDoc(path string, doc ConfigDoc) error {
-	var content strings.Builder
-
-	// Create parent directories
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return err
-	}
-
-	content.WriteString(fmt.Sprintf("# %s\n\n", doc.Path))
-	content.WriteString(fmt.Sprintf("Last Updated: %s\n\n", doc.LastUpdated.Format("2006-01-02 15:04:05")))
-
-	if len(doc.Tags) > 0 {
-		content.WriteString("## Tags\n\n")
-		for _, tag := range doc.Tags {
-			content.WriteString(fmt.Sprintf("- %s\n", tag))
-		}
-		content.WriteString("\n")
-	}
-
-	if len(doc.Dependencies) > 0 {
-		content.WriteString("## Dependencies\n\n")
-		for _, dep := range doc.Dependencies {
-			content.WriteString(fmt.Sprintf("- %s\n", dep))
-		}
-		content.WriteString("\n")
-	}
-
-	if doc.Description != "" {
-		content.WriteString("## Description\n\n")
-		content.WriteString(doc.Description + "\n\n")
-	}
-
-	if doc.Notes != "" {
-		content.WriteString("## Notes\n\n")
-		content.WriteString(doc.Notes + "\n\n")
-	}
-
-	return os.WriteFile(path, []byte(content.String()), 0644)
-}
-
-// saveConfigMetadata saves JSON metadata for a configuration file
-func (m *Manager) saveConfigMetadata(path string, doc ConfigDoc) error {
-	// Create parent directories
-	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return err
-	}
-
-	data, err := json.MarshalIndent(doc, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(path, data, 0644)
-}
@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssignDocPathsDistinct(t *testing.T) {
+	relPaths := []string{
+		filepath.Join("a", "config"),
+		filepath.Join("b", "config"),
+		".vimrc",
+		".VIMRC",
+		"README",
+		"what?",
+		"what%3F",
+	}
+	docPaths := assignDocPaths(relPaths)
+
+	// Files with the same basename keep their own directories
+	if got := docPaths[filepath.Join("a", "config")]; got != filepath.Join("a", "config") {
+		t.Errorf("a/config -> %s", got)
+	}
+	if got := docPaths[filepath.Join("b", "config")]; got != filepath.Join("b", "config") {
+		t.Errorf("b/config -> %s", got)
+	}
+
+	// No two files share documentation, even on case-insensitive
+	// filesystems, and none replaces an index page
+	seen := make(map[string]string)
+	for _, relPath := range relPaths {
+		docPath, ok := docPaths[relPath]
+		if !ok {
+			t.Fatalf("%s has no documentation path", relPath)
+		}
+		key := strings.ToLower(docPath)
+		if other, ok := seen[key]; ok {
+			t.Errorf("%s and %s both map to %s", other, relPath, docPath)
+		}
+		seen[key] = relPath
+		if reservedDocNames[key] {
+			t.Errorf("%s replaces the index page %s", relPath, docPath)
+		}
+	}
+	if got := docPaths[".VIMRC"]; got != ".VIMRC" {
+		t.Errorf(".VIMRC -> %s, want it unchanged as the first of its clash", got)
+	}
+	if got := docPaths[".vimrc"]; !strings.HasPrefix(got, ".vimrc~") {
+		t.Errorf(".vimrc -> %s, want a suffix for the clash with .VIMRC", got)
+	}
+}
+
+func TestDocPathForUnsafeNames(t *testing.T) {
+	tests := []struct {
+		relPath string
+		want    string
+	}{
+		{".bashrc", ".bashrc"},
+		{filepath.Join(".config", "app", "settings.json"), filepath.Join(".config", "app", "settings.json")},
+		{"a:b", "a%3Ab"},
+		{`x<>"|?*`, "x%3C%3E%22%7C%3F%2A"},
+		{"tab\there", "tab%09here"},
+		{"100%", "100%25"},
+		{"trailing.", "trailing%2E"},
+		{"trailing ", "trailing%20"},
+		{"con", "%63on"},
+		{"NUL.txt", "%4EUL.txt"},
+		{filepath.Join("aux", "file"), filepath.Join("%61ux", "file")},
+		{"console", "console"},
+	}
+	for _, tt := range tests {
+		if got := docPathFor(tt.relPath); got != tt.want {
+			t.Errorf("docPathFor(%q) = %q, want %q", tt.relPath, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkGenerateConfigDocs measures the worker pool that reads and
+// renders the documentation of the managed files
+func BenchmarkGenerateConfigDocs(b *testing.B) {
+	m := newTestManager(b)
+	for i := 0; i < 200; i++ {
+		path := filepath.Join(m.config.ConfigsDir, ".config", fmt.Sprintf("tool%03d", i), "config")
+		writeTestFile(b, path, fmt.Sprintf("# Settings of tool %d\nkey = %d\n", i, i))
+	}
+
+	for _, format := range DocFormats {
+		b.Run(format, func(b *testing.B) {
+			r, err := NewDocRenderer(format)
+			if err != nil {
+				b.Fatal(err)
+			}
+			docsDir := b.TempDir()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := m.generateConfigDocs(docsDir, r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Backup encryption tools recorded in backup metadata
+const (
+	encryptionAge = "age"
+	encryptionGPG = "gpg"
+)
+
+// encryptionTool returns the tool that encrypts to recipient: age for age
+// recipients and SSH public keys, gpg for everything else
+func encryptionTool(recipient string) string {
+	if strings.HasPrefix(recipient, "age1") || strings.HasPrefix(recipient, "ssh-") {
+		return encryptionAge
+	}
+	return encryptionGPG
+}
+
+// encryptBackup encrypts content to the backup_encrypt recipient and returns
+// the ciphertext with the tool that produced it
+func (m *Manager) encryptBackup(content []byte) ([]byte, string, error) {
+	recipient := m.config.Settings.BackupEncrypt
+	tool := encryptionTool(recipient)
+
+	var cmd *exec.Cmd
+	if tool == encryptionAge {
+		cmd = exec.Command("age", "--encrypt", "--recipient", recipient)
+	} else {
+		cmd = exec.Command("gpg", "--batch", "--yes", "--trust-model", "always", "--encrypt", "--recipient", recipient, "--output", "-")
+	}
+
+	ciphertext, err := runFilter(cmd, content)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encrypting backup with %s: %v", tool, err)
+	}
+	return ciphertext, tool, nil
+}
+
+// decryptBackup decrypts the content of the backup described by backup
+func (m *Manager) decryptBackup(backup BackupMetadata, ciphertext []byte) ([]byte, error) {
+	var cmd *exec.Cmd
+	switch backup.Encryption {
+	case encryptionAge:
+		identity := m.config.Settings.BackupIdentity
+		if identity == "" {
+			return nil, fmt.Errorf("backup %s is encrypted with age but no identity is configured; set backup_identity in %s to your age identity file",
+				backup.ID, m.config.SettingsFile())
+		}
+		identity = m.config.ExpandHome(identity)
+		if _, err := os.Stat(identity); err != nil {
+			return nil, fmt.Errorf("backup %s is encrypted with age but the identity %s is not available: %v", backup.ID, identity, err)
+		}
+		cmd = exec.Command("age", "--decrypt", "--identity", identity)
+	case encryptionGPG:
+		cmd = exec.Command("gpg", "--batch", "--quiet", "--decrypt")
+	default:
+		return nil, fmt.Errorf("backup %s uses unknown encryption %q", backup.ID, backup.Encryption)
+	}
+
+	content, err := runFilter(cmd, ciphertext)
+	if err != nil {
+		if backup.Encryption == encryptionGPG && strings.Contains(err.Error(), "No secret key") {
+			return nil, fmt.Errorf("backup %s is encrypted with gpg but the secret key is not in your keyring", backup.ID)
+		}
+		return nil, fmt.Errorf("error decrypting backup %s with %s: %v", backup.ID, backup.Encryption, err)
+	}
+	return content, nil
+}
+
+// runFilter runs cmd with input on stdin and returns its stdout. A missing
+// binary and the tool's own error output are reported in the error.
+func runFilter(cmd *exec.Cmd, input []byte) ([]byte, error) {
+	if _, err := exec.LookPath(cmd.Args[0]); err != nil {
+		return nil, fmt.Errorf("%s is not installed", cmd.Args[0])
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// checksum returns the hex SHA-256 checksum of data
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
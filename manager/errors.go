@@ -0,0 +1,96 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode classifies errors returned by Manager methods so callers can
+// react to them without parsing messages
+type ErrorCode string
+
+const (
+	// CodeUnknown is reported for errors that carry no code
+	CodeUnknown ErrorCode = "error"
+
+	// CodeInvalidArgument means the caller passed an unusable value
+	CodeInvalidArgument ErrorCode = "invalid_argument"
+
+	// CodeNotFound means a file or backup does not exist
+	CodeNotFound ErrorCode = "not_found"
+
+	// CodeNotManaged means a path is not managed by dotman
+	CodeNotManaged ErrorCode = "not_managed"
+
+	// CodeNotGitRepo means the dotman directory is not a git repository
+	CodeNotGitRepo ErrorCode = "not_git_repo"
+
+	// CodeNoRemote means the repository has no origin remote
+	CodeNoRemote ErrorCode = "no_remote"
+
+	// CodeReadOnly means the operation was refused in read-only mode
+	CodeReadOnly ErrorCode = "read_only"
+
+	// CodeFileTooLarge means a file is above max_file_size
+	CodeFileTooLarge ErrorCode = "file_too_large"
+
+	// CodeEmptyContent means there was no content to add
+	CodeEmptyContent ErrorCode = "empty_content"
+
+	// CodeDiverged means local and remote histories diverged and the pull
+	// strategy only allows fast-forwards
+	CodeDiverged ErrorCode = "diverged"
+
+	// CodeIsSymlink means a path to add is a symlink and the caller did
+	// not say whether to manage the link or the file it points to
+	CodeIsSymlink ErrorCode = "is_symlink"
+
+	// CodeLocked means another dotman process holds the lock on the
+	// dotman directory
+	CodeLocked ErrorCode = "locked"
+
+	// CodeNewerFile means a restore would overwrite a file that was
+	// changed after the backup was taken
+	CodeNewerFile ErrorCode = "newer_file"
+
+	// CodeDirectoryInWay means a non-empty real directory is where a
+	// link should go and replacing it was not forced
+	CodeDirectoryInWay ErrorCode = "directory_in_way"
+
+	// CodeGitHubAuth means the GitHub CLI is missing or not logged in
+	CodeGitHubAuth ErrorCode = "github_auth"
+
+	// CodeGitHubAccount means the GitHub CLI is logged in as another
+	// account than the github_user setting expects
+	CodeGitHubAccount ErrorCode = "github_account"
+)
+
+// DotmanError is an error with a machine-readable code
+type DotmanError struct {
+	Code    ErrorCode
+	Message string
+}
+
+// Error returns the human-readable message
+func (e *DotmanError) Error() string {
+	return e.Message
+}
+
+// newError returns a DotmanError with a formatted message
+func newError(code ErrorCode, format string, args ...interface{}) *DotmanError {
+	return &DotmanError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrNotGitRepo is returned by operations that need the dotman directory to
+// be a git repository
+var ErrNotGitRepo = newError(CodeNotGitRepo, "not a git repository. Please initialize git first")
+
+// ErrorCodeOf returns the code of the first DotmanError in err's chain, or
+// CodeUnknown when there is none
+func ErrorCodeOf(err error) ErrorCode {
+	var dotmanErr *DotmanError
+	if errors.As(err, &dotmanErr) {
+		return dotmanErr.Code
+	}
+	return CodeUnknown
+}
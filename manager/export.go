@@ -0,0 +1,197 @@
+package manager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChangedFilesSince returns the managed files, relative to the home
+// directory, whose content differs between ref and the working tree.
+// Files deleted since ref are not included.
+func (m *Manager) ChangedFilesSince(ref string) ([]string, error) {
+	if !m.isGitRepo() {
+		return nil, ErrNotGitRepo
+	}
+
+	// A ref starting with a dash would be taken as an option by git
+	if strings.HasPrefix(ref, "-") || m.git("rev-parse", "--verify", "--quiet", ref+"^{commit}").Run() != nil {
+		return nil, newError(CodeInvalidArgument, "unknown revision %q: not a commit in %s", ref, m.config.DotmanDir)
+	}
+
+	output, err := m.git("diff", "--name-only", "-z", ref, "--", m.configsDirRel()).Output()
+	if err != nil {
+		return nil, fmt.Errorf("error comparing with %s: %v", ref, err)
+	}
+
+	// git prints paths relative to the repository root
+	root, _ := m.gitRoot()
+
+	var files []string
+	for _, name := range strings.Split(string(output), "\x00") {
+		if name == "" {
+			continue
+		}
+		source := filepath.Join(root, filepath.FromSlash(name))
+		if _, err := os.Lstat(source); os.IsNotExist(err) {
+			continue
+		}
+		relPath, err := m.homeRelFor(source)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, relPath)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// ArchiveFormats lists the archive formats Export can write
+var ArchiveFormats = []string{"tar.gz", "zip"}
+
+// ArchiveFormatFor returns the archive format matching the extension of
+// path: zip for .zip, and tar.gz, the default, for anything else
+func ArchiveFormatFor(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return "zip"
+	}
+	return "tar.gz"
+}
+
+// ExportOptions controls ExportWith
+type ExportOptions struct {
+	// Format is one of ArchiveFormats. Empty writes tar.gz.
+	Format string
+}
+
+// Export writes the managed files relPaths to w as a gzip-compressed tar
+// archive. Entries are named by their path relative to the home directory,
+// so the archive can be unpacked into a home directory as is.
+func (m *Manager) Export(w io.Writer, relPaths []string) error {
+	return m.ExportWith(w, relPaths, ExportOptions{})
+}
+
+// ExportWith writes the managed files relPaths to w like Export, in the
+// archive format of opts. File modes and modification times are kept in
+// both formats.
+func (m *Manager) ExportWith(w io.Writer, relPaths []string, opts ExportOptions) error {
+	var archive archiveWriter
+	switch opts.Format {
+	case "", "tar.gz":
+		archive = newTarGzArchive(w)
+	case "zip":
+		archive = zipArchive{zip.NewWriter(w)}
+	default:
+		return newError(CodeInvalidArgument, "unknown archive format %q (supported: %s)", opts.Format, strings.Join(ArchiveFormats, ", "))
+	}
+
+	for _, relPath := range relPaths {
+		if err := m.exportFile(archive, relPath); err != nil {
+			return fmt.Errorf("error exporting %s: %v", relPath, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("error finishing archive: %v", err)
+	}
+	return nil
+}
+
+// exportFile adds the managed file relPath to archive
+func (m *Manager) exportFile(archive archiveWriter, relPath string) error {
+	source := m.sourcePath(relPath)
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not a regular file")
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return archive.Add(filepath.ToSlash(relPath), info, f)
+}
+
+// archiveWriter writes the entries of an export archive
+type archiveWriter interface {
+	// Add writes the regular file described by info with the content of r
+	// as name
+	Add(name string, info os.FileInfo, r io.Reader) error
+	// Close finishes the archive
+	Close() error
+}
+
+// tarGzArchive writes a gzip-compressed tar archive
+type tarGzArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+// newTarGzArchive returns a tarGzArchive writing to w
+func newTarGzArchive(w io.Writer) *tarGzArchive {
+	gz := gzip.NewWriter(w)
+	return &tarGzArchive{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+// Add writes a tar entry with the mode and modification time of info
+func (a *tarGzArchive) Add(name string, info os.FileInfo, r io.Reader) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := a.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(a.tw, r)
+	return err
+}
+
+// Close finishes the tar archive and the gzip stream around it
+func (a *tarGzArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// zipArchive writes a zip archive with deflated entries
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+// Add writes a zip entry. The Unix mode of info is stored in the external
+// attributes, which unzip and most other Unix tools restore.
+func (a zipArchive) Add(name string, info os.FileInfo, r io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	w, err := a.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// Close writes the zip central directory
+func (a zipArchive) Close() error {
+	return a.zw.Close()
+}
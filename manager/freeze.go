@@ -0,0 +1,160 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// frozenFileName is the index of frozen files in the dotman directory. It is
+// not committed, so freezing only affects the current machine.
+const frozenFileName = "frozen.json"
+
+// disabledSuffix is appended to the home symlink of a frozen file
+const disabledSuffix = ".disabled"
+
+// loadFrozen reads the frozen index, keyed by the path relative to the home
+// directory with the time the file was frozen. Under the xdg-split and
+// package layouts this differs from the path in the configs directory. A
+// missing index is empty.
+func (m *Manager) loadFrozen() (map[string]time.Time, error) {
+	frozen := make(map[string]time.Time)
+	data, err := os.ReadFile(filepath.Join(m.config.DotmanDir, frozenFileName))
+	if os.IsNotExist(err) {
+		return frozen, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", frozenFileName, err)
+	}
+	if err := json.Unmarshal(data, &frozen); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", frozenFileName, err)
+	}
+	return frozen, nil
+}
+
+// saveFrozen writes the frozen index, removing it once nothing is frozen
+func (m *Manager) saveFrozen(frozen map[string]time.Time) error {
+	path := filepath.Join(m.config.DotmanDir, frozenFileName)
+	if len(frozen) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %v", frozenFileName, err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(frozen, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %v", frozenFileName, err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// isFrozen reports whether the managed file relPath is frozen
+func (m *Manager) isFrozen(relPath string) bool {
+	frozen, err := m.loadFrozen()
+	if err != nil {
+		return false
+	}
+	_, ok := frozen[relPath]
+	return ok
+}
+
+// Frozen returns the paths of the frozen files relative to the home
+// directory
+func (m *Manager) Frozen() ([]string, error) {
+	frozen, err := m.loadFrozen()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(frozen))
+	for path := range frozen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Freeze temporarily disables a managed file by renaming its home symlink to
+// <name>.disabled, so applications stop reading it until Thaw. Link skips
+// frozen files and health checks do not report them as broken.
+func (m *Manager) Freeze(homePath string) error {
+	if err := m.checkWritable("freeze files"); err != nil {
+		return err
+	}
+
+	info, err := m.ResolveSource(homePath)
+	if err != nil {
+		return err
+	}
+	if info.State != StateLinked {
+		return newError(CodeInvalidArgument, "%s is not linked (%s); only linked files can be frozen", info.HomePath, info.State)
+	}
+
+	frozen, err := m.loadFrozen()
+	if err != nil {
+		return err
+	}
+
+	disabledPath := info.HomePath + disabledSuffix
+	if _, err := os.Lstat(disabledPath); err == nil {
+		return fmt.Errorf("%s already exists", disabledPath)
+	}
+	if err := os.Rename(info.HomePath, disabledPath); err != nil {
+		return fmt.Errorf("error disabling %s: %v", info.HomePath, err)
+	}
+
+	frozen[info.Path] = time.Now()
+	if err := m.saveFrozen(frozen); err != nil {
+		// Undo the rename so the index and the home directory agree
+		os.Rename(disabledPath, info.HomePath)
+		return err
+	}
+
+	return nil
+}
+
+// Thaw re-enables a file disabled by Freeze by restoring its home symlink
+func (m *Manager) Thaw(homePath string) error {
+	if err := m.checkWritable("thaw files"); err != nil {
+		return err
+	}
+
+	relPath, inHome := m.homeRelPath(m.config.ExpandHome(homePath))
+	if !inHome {
+		return newError(CodeInvalidArgument, "%s is not inside the home directory", homePath)
+	}
+
+	frozen, err := m.loadFrozen()
+	if err != nil {
+		return err
+	}
+	if _, ok := frozen[relPath]; !ok {
+		return newError(CodeInvalidArgument, "%s is not frozen", homePath)
+	}
+
+	target := m.targetPath(relPath)
+	disabledPath := target + disabledSuffix
+	if _, err := os.Lstat(target); err == nil {
+		return fmt.Errorf("%s already exists; move it away before thawing", target)
+	}
+
+	if _, err := os.Lstat(disabledPath); os.IsNotExist(err) {
+		// The disabled link is gone, so relink the managed file instead
+		if _, err := m.linkFile(m.sourcePath(relPath), LinkOptions{}); err != nil {
+			return fmt.Errorf("error relinking %s: %v", target, err)
+		}
+	} else if err := os.Rename(disabledPath, target); err != nil {
+		return fmt.Errorf("error enabling %s: %v", target, err)
+	}
+
+	delete(frozen, relPath)
+	if err := m.saveFrozen(frozen); err != nil {
+		return err
+	}
+
+	return nil
+}
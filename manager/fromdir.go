@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"cli-config-manager/config"
+)
+
+// InitializeFromDir initializes the dotman directory from a local folder of
+// dotfiles and returns the number of files imported. The folder is either
+// laid out like the home directory, or is an existing dotman directory whose
+// files live under configs/. A local git repository is created and the
+// imported files are committed; no remote is configured.
+func (m *Manager) InitializeFromDir(srcDir string) (int, error) {
+	if err := m.checkWritable("initialize the repository"); err != nil {
+		return 0, err
+	}
+
+	srcDir, err := filepath.Abs(m.config.ExpandHome(srcDir))
+	if err != nil {
+		return 0, fmt.Errorf("error getting absolute path: %v", err)
+	}
+	if info, err := os.Stat(srcDir); err != nil || !info.IsDir() {
+		return 0, fmt.Errorf("not a directory: %s", srcDir)
+	}
+
+	// A folder with a configs/ directory is already configs-relative
+	root := srcDir
+	if info, err := os.Stat(filepath.Join(srcDir, "configs")); err == nil && info.IsDir() {
+		root = filepath.Join(srcDir, "configs")
+		m.logf("Found configs/ in %s, importing from it\n", srcDir)
+	}
+
+	if root == m.config.ConfigsDir || root == m.config.DotmanDir {
+		return 0, fmt.Errorf("cannot import the dotman directory into itself")
+	}
+
+	if err := os.MkdirAll(m.config.ConfigsDir, m.config.DirMode); err != nil {
+		return 0, fmt.Errorf("error creating configs directory: %v", err)
+	}
+
+	// A dotman directory brings its own layout along. A folder laid out like
+	// the home directory is mapped into the layout from the settings.
+	layout := config.LayoutHomeRelative
+	if root == srcDir {
+		if err := m.recordLayout(); err != nil {
+			return 0, err
+		}
+		layout = m.configsLayout()
+	} else if data, err := os.ReadFile(filepath.Join(srcDir, layoutFileName)); err == nil {
+		if err := os.WriteFile(filepath.Join(m.config.DotmanDir, layoutFileName), data, 0644); err != nil {
+			return 0, fmt.Errorf("error copying %s: %v", layoutFileName, err)
+		}
+	}
+
+	count := 0
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip the source's own git metadata
+		if info.Name() == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			m.logf("Skipped %s: not a regular file\n", relPath)
+			return nil
+		}
+
+		sourceRel := layoutSourceRel(layout, relPath)
+		if err := m.mkdirAll(m.config.ConfigsDir, filepath.Dir(sourceRel)); err != nil {
+			return err
+		}
+		if err := copyFile(path, filepath.Join(m.config.ConfigsDir, sourceRel), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("error copying %s: %v", relPath, err)
+		}
+		m.logf("Imported: %s\n", relPath)
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no files found in %s", root)
+	}
+
+	// Initialize a local git repository with the imported files
+	if err := os.WriteFile(filepath.Join(m.config.DotmanDir, ".gitignore"), []byte(defaultGitignore), 0644); err != nil {
+		return count, fmt.Errorf("error creating .gitignore: %v", err)
+	}
+
+	initCmd := m.git("init")
+	if output, err := initCmd.CombinedOutput(); err != nil {
+		return count, fmt.Errorf("error initializing git repository: %v\nOutput: %s", err, string(output))
+	}
+
+	// The generated .gitignore matches files inside configs/, so force them in
+	addCmd := m.git(append([]string{"add", "-f"}, m.trackedPaths()...)...)
+	if output, err := addCmd.CombinedOutput(); err != nil {
+		return count, fmt.Errorf("error adding files: %v\nOutput: %s", err, string(output))
+	}
+
+	commitCmd := m.git("commit", "-m", fmt.Sprintf("Import dotfiles from %s", srcDir))
+	if output, err := commitCmd.CombinedOutput(); err != nil {
+		return count, fmt.Errorf("error committing files: %v\nOutput: %s", err, string(output))
+	}
+
+	return count, nil
+}
@@ -0,0 +1,210 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultKeepHealth is how many saved health check results GarbageCollect
+// keeps by default
+const DefaultKeepHealth = 10
+
+// GCOptions controls what GarbageCollect removes
+type GCOptions struct {
+	// DryRun only reports what would be removed. It works in read-only mode.
+	DryRun bool
+
+	// KeepHealth is how many of the newest saved health check results are
+	// kept; older ones are removed
+	KeepHealth int
+
+	// InvalidBackups removes backups that fail the backup integrity check:
+	// those with missing metadata or content, or content that does not
+	// match its checksum. They are only reported otherwise.
+	InvalidBackups bool
+
+	// Executable is the dotman binary, whose .bak and .new copies left by
+	// an interrupted upgrade are removed. Empty skips them.
+	Executable string
+}
+
+// GCItem is a file or directory found by GarbageCollect
+type GCItem struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	Size   int64  `json:"size"`
+
+	// Kind is "health", "docs", "backup" or "upgrade"
+	Kind string `json:"kind"`
+}
+
+// GCReport lists what GarbageCollect found
+type GCReport struct {
+	// Removed are the items that were removed, or would be on a dry run
+	Removed []GCItem `json:"removed"`
+
+	// Kept are invalid backups left alone because GCOptions.InvalidBackups
+	// was not set
+	Kept []GCItem `json:"kept"`
+
+	// Reclaimed is the total size of Removed in bytes
+	Reclaimed int64 `json:"reclaimed"`
+}
+
+// GarbageCollect removes files dotman created that are no longer needed:
+// health check results beyond opts.KeepHealth, documentation of files that
+// are no longer managed, invalid backups when opts.InvalidBackups is set and
+// leftovers of interrupted upgrades, including their cached downloads. Managed files and valid backups are
+// never touched.
+func (m *Manager) GarbageCollect(opts GCOptions) (GCReport, error) {
+	if !opts.DryRun {
+		if err := m.checkWritable("collect garbage"); err != nil {
+			return GCReport{}, err
+		}
+	}
+
+	var report GCReport
+	var candidates []GCItem
+	candidates = append(candidates, m.staleHealthResults(opts.KeepHealth)...)
+
+	docs, err := m.staleDocs()
+	if err != nil {
+		return GCReport{}, err
+	}
+	candidates = append(candidates, docs...)
+
+	backups := m.invalidBackups()
+	if opts.InvalidBackups {
+		candidates = append(candidates, backups...)
+	} else {
+		report.Kept = backups
+	}
+
+	if opts.Executable != "" {
+		for _, suffix := range []string{".bak", ".new"} {
+			if item, ok := gcItem(opts.Executable+suffix, "upgrade", "left over from an interrupted upgrade"); ok {
+				candidates = append(candidates, item)
+			}
+		}
+	}
+	if item, ok := gcItem(m.config.UpgradeCacheDir(), "upgrade", "partial downloads of interrupted upgrades"); ok {
+		candidates = append(candidates, item)
+	}
+
+	for _, item := range candidates {
+		if !opts.DryRun {
+			if err := os.RemoveAll(item.Path); err != nil {
+				m.logf("Warning: could not remove %s: %v\n", item.Path, err)
+				continue
+			}
+		}
+		report.Removed = append(report.Removed, item)
+		report.Reclaimed += item.Size
+	}
+
+	return report, nil
+}
+
+// staleHealthResults returns the saved health check results beyond the
+// keep newest ones. Their names sort by the time they were saved.
+func (m *Manager) staleHealthResults(keep int) []GCItem {
+	if keep < 0 {
+		keep = 0
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(m.config.HealthDir(), "health-check-*.json"))
+	sort.Strings(matches)
+	if len(matches) <= keep {
+		return nil
+	}
+
+	var items []GCItem
+	for _, path := range matches[:len(matches)-keep] {
+		if item, ok := gcItem(path, "health", "older than the newest saved health checks"); ok {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// staleDocs returns the documentation pages of files that are no longer
+// managed. Index pages and files dotman does not write are kept.
+func (m *Manager) staleDocs() ([]GCItem, error) {
+	docsDir := filepath.Join(m.config.DotmanDir, "docs")
+	if _, err := os.Stat(docsDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	files, err := m.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]bool)
+	for _, docPath := range assignDocPaths(files) {
+		current[docPath] = true
+	}
+
+	var items []GCItem
+	err = filepath.Walk(docsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(docsDir, path)
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(rel)
+		if (ext != ".md" && ext != ".html") || rel == "README.md" || rel == "index.html" {
+			return nil
+		}
+		if current[strings.TrimSuffix(rel, ext)] {
+			return nil
+		}
+		items = append(items, GCItem{Path: path, Kind: "docs", Reason: "documents a file that is no longer managed", Size: info.Size()})
+		return nil
+	})
+	return items, err
+}
+
+// invalidBackups returns the backups the backup integrity check reports as
+// invalid
+func (m *Manager) invalidBackups() []GCItem {
+	verdicts, err := m.verifyBackups(0, nil)
+	if err != nil {
+		return nil
+	}
+
+	var items []GCItem
+	for _, verdict := range verdicts {
+		if verdict.Problem == "" {
+			continue
+		}
+		if item, ok := gcItem(verdict.Dir, "backup", verdict.Problem); ok {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// gcItem describes path for GarbageCollect, with the total size of a
+// directory. It reports false when path does not exist.
+func gcItem(path, kind, reason string) (GCItem, bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return GCItem{}, false
+	}
+
+	item := GCItem{Path: path, Kind: kind, Reason: reason, Size: info.Size()}
+	if info.IsDir() {
+		item.Size = 0
+		filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				item.Size += info.Size()
+			}
+			return nil
+		})
+	}
+	return item, true
+}
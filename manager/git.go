@@ -0,0 +1,190 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// gitCmd is a git command bounded by the configured git timeout
+type gitCmd struct {
+	*exec.Cmd
+	ctx     context.Context
+	cancel  context.CancelFunc
+	op      string
+	timeout time.Duration
+
+	// interactive is set when git may prompt for credentials
+	interactive bool
+
+	// log records the command and its outcome; nil disables logging
+	log *slog.Logger
+}
+
+// newGitCmd returns a git command bound to ctx and the configured timeout.
+// When dir is non-empty the command runs inside that directory.
+func (m *Manager) newGitCmd(ctx context.Context, dir string, args ...string) *gitCmd {
+	timeout := m.config.GitTimeout
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	op := ""
+	if len(args) > 0 {
+		op = args[0]
+	}
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if networkOps[op] && !m.config.GitInteractive {
+		cmd.Env = nonInteractiveEnv()
+	}
+
+	return &gitCmd{
+		Cmd:         cmd,
+		ctx:         ctx,
+		cancel:      cancel,
+		op:          op,
+		timeout:     timeout,
+		interactive: m.config.GitInteractive,
+		log:         m.config.Log,
+	}
+}
+
+// networkOps are the git subcommands that may contact a remote and prompt for credentials
+var networkOps = map[string]bool{
+	"clone":     true,
+	"fetch":     true,
+	"pull":      true,
+	"push":      true,
+	"submodule": true,
+	"ls-remote": true,
+	"lfs":       true,
+}
+
+// nonInteractiveEnv returns the environment for git commands that must fail
+// instead of waiting for credentials. Terminal and askpass prompts are
+// disabled and ssh runs in batch mode; credential helpers and ssh keys keep working.
+func nonInteractiveEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "GIT_ASKPASS=") || strings.HasPrefix(kv, "SSH_ASKPASS=") {
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	env = append(env, "GIT_TERMINAL_PROMPT=0")
+	if os.Getenv("GIT_SSH_COMMAND") == "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+	return env
+}
+
+// authFailureMarkers are fragments of git output that indicate missing credentials
+var authFailureMarkers = []string{
+	"terminal prompts disabled",
+	"could not read Username",
+	"Authentication failed",
+	"Permission denied (publickey",
+	"Host key verification failed",
+}
+
+// gitCommand returns a git command bound to ctx that runs inside the dotman directory
+func (m *Manager) gitCommand(ctx context.Context, args ...string) *gitCmd {
+	return m.newGitCmd(ctx, m.config.DotmanDir, args...)
+}
+
+// git returns a git command that runs inside the dotman directory
+func (m *Manager) git(args ...string) *gitCmd {
+	return m.gitCommand(context.Background(), args...)
+}
+
+// Run runs the command and reports timeouts and authentication failures distinctly
+func (c *gitCmd) Run() error {
+	// Capture the output so failures can be diagnosed; Run discards it otherwise
+	if c.Stdout == nil && c.Stderr == nil {
+		_, err := c.CombinedOutput()
+		return err
+	}
+
+	defer c.cancel()
+	start := time.Now()
+	err := c.wrap(c.Cmd.Run(), nil)
+	c.record(start, err)
+	return err
+}
+
+// Output runs the command, returns its standard output and reports
+// timeouts and authentication failures distinctly
+func (c *gitCmd) Output() ([]byte, error) {
+	defer c.cancel()
+	start := time.Now()
+	output, err := c.Cmd.Output()
+
+	var stderr []byte
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		stderr = exitErr.Stderr
+	}
+	err = c.wrap(err, stderr)
+	c.record(start, err)
+	return output, err
+}
+
+// CombinedOutput runs the command, returns its combined output and reports
+// timeouts and authentication failures distinctly
+func (c *gitCmd) CombinedOutput() ([]byte, error) {
+	defer c.cancel()
+	start := time.Now()
+	output, err := c.Cmd.CombinedOutput()
+	err = c.wrap(err, output)
+	c.record(start, err)
+	return output, err
+}
+
+// record logs the command, with credentials in its arguments masked, and
+// its outcome to the operation log
+func (c *gitCmd) record(start time.Time, err error) {
+	if c.log == nil {
+		return
+	}
+	attrs := []interface{}{"args", strings.Join(RedactArgs(c.Args[1:]), " "), "duration", time.Since(start).Round(time.Millisecond)}
+	if err != nil {
+		c.log.Warn("git failed", append(attrs, "error", redactArg(err.Error()))...)
+		return
+	}
+	c.log.Info("git", attrs...)
+}
+
+// wrap replaces the error of a command killed by the timeout, or of a
+// non-interactive command that could not authenticate, with a clear message
+func (c *gitCmd) wrap(err error, output []byte) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(c.ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("git %s timed out after %s", c.op, c.timeout)
+	}
+
+	if !c.interactive && networkOps[c.op] {
+		for _, marker := range authFailureMarkers {
+			if bytes.Contains(output, []byte(marker)) {
+				return fmt.Errorf("git %s could not authenticate with the remote: %v. "+
+					"Set up SSH keys or a credential helper (git config --global credential.helper), "+
+					"or set \"git_interactive\": true in ~/.dotman/config.json to allow git to prompt", c.op, err)
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,84 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// githubTimeout bounds the GitHub CLI call that looks up the account
+const githubTimeout = 15 * time.Second
+
+// githubLogin matches valid GitHub logins: letters, digits and single
+// hyphens, not at either end
+var githubLogin = regexp.MustCompile(`^[A-Za-z0-9]+(?:-[A-Za-z0-9]+)*$`)
+
+// GitHubIdentity is the GitHub account the GitHub CLI (gh) acts as, and the
+// account the github_user setting expects
+type GitHubIdentity struct {
+	Login    string `json:"login"`
+	Expected string `json:"expected,omitempty"`
+}
+
+// Matches reports whether the account is the expected one. It is always true
+// when no account is expected. GitHub logins are case-insensitive.
+func (id GitHubIdentity) Matches() bool {
+	return id.Expected == "" || strings.EqualFold(id.Login, id.Expected)
+}
+
+// GitHubIdentity asks the GitHub CLI which account it is logged in as. It
+// fails with CodeGitHubAuth when gh is not installed or not authenticated.
+func (m *Manager) GitHubIdentity(ctx context.Context) (GitHubIdentity, error) {
+	id := GitHubIdentity{Expected: m.config.Settings.GitHubUser}
+
+	if _, err := exec.LookPath("gh"); err != nil {
+		return id, newError(CodeGitHubAuth, "the GitHub CLI (gh) is not installed; install it from https://cli.github.com")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, githubTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "gh", "api", "user", "--jq", ".login").Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return id, newError(CodeGitHubAuth, "gh did not answer within %s", githubTimeout)
+		}
+		msg := err.Error()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			msg = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		return id, newError(CodeGitHubAuth, "gh is not authenticated (%s); log in with 'gh auth login'", msg)
+	}
+
+	id.Login = strings.TrimSpace(string(output))
+	if id.Login == "" {
+		return id, newError(CodeGitHubAuth, "gh did not report a GitHub login; check 'gh auth status'")
+	}
+	return id, nil
+}
+
+// checkGitHubAccount makes sure gh is authenticated as the expected account
+// before dotman creates or pushes to a repository in its name
+func (m *Manager) checkGitHubAccount() error {
+	id, err := m.GitHubIdentity(context.Background())
+	if err != nil {
+		return err
+	}
+	if err := GitHubAccountError(id); err != nil {
+		return err
+	}
+	m.logf("Using GitHub account %s\n", id.Login)
+	return nil
+}
+
+// GitHubAccountError returns the CodeGitHubAccount error for an identity
+// that does not match the expected account, or nil when it matches
+func GitHubAccountError(id GitHubIdentity) error {
+	if id.Matches() {
+		return nil
+	}
+	return newError(CodeGitHubAccount, "gh is logged in as %s, but github_user is %s; switch with 'gh auth switch --user %s' or change github_user", id.Login, id.Expected, id.Expected)
+}
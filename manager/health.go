@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
+
+	"cli-config-manager/config"
 )
 
 // HealthCheckResult represents the result of a health check
@@ -18,14 +20,127 @@ type HealthCheckResult struct {
 	Error     error     `json:"error,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 	Severity  string    `json:"severity"` // "info", "warning", "error"
+
+	// Excluded are the files the check skipped because they match a
+	// health exclude pattern
+	Excluded []string `json:"excluded,omitempty"`
+}
+
+// Health check severities, from least to most severe
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// severityRank orders severities so the most severe result can be found
+var severityRank = map[string]int{
+	SeverityInfo:    0,
+	SeverityWarning: 1,
+	SeverityError:   2,
+}
+
+// MarshalJSON encodes the result with its error as a message string, since
+// error values have no JSON representation of their own
+func (r HealthCheckResult) MarshalJSON() ([]byte, error) {
+	type result HealthCheckResult
+	var errMsg string
+	if r.Error != nil {
+		errMsg = r.Error.Error()
+	}
+	return json.Marshal(struct {
+		result
+		Error string `json:"error,omitempty"`
+	}{result(r), errMsg})
 }
 
-// HealthCheck performs various checks on the dotfile configuration
-func (m *Manager) HealthCheck() error {
+// HealthSummary condenses health check results for scripts and monitoring
+type HealthSummary struct {
+	// Severity is the most severe severity among the results
+	Severity string `json:"severity"`
+	Info     int    `json:"info"`
+	Warnings int    `json:"warnings"`
+	Errors   int    `json:"errors"`
+
+	// Excluded are the files skipped by any check, sorted
+	Excluded []string `json:"excluded,omitempty"`
+
+	Results []HealthCheckResult `json:"results"`
+}
+
+// SummarizeHealth counts results by severity and finds the most severe one
+func SummarizeHealth(results []HealthCheckResult) HealthSummary {
+	summary := HealthSummary{Severity: SeverityInfo, Results: results}
+	excluded := make(map[string]bool)
+	for _, result := range results {
+		for _, path := range result.Excluded {
+			if !excluded[path] {
+				excluded[path] = true
+				summary.Excluded = append(summary.Excluded, path)
+			}
+		}
+		switch result.Severity {
+		case SeverityError:
+			summary.Errors++
+		case SeverityWarning:
+			summary.Warnings++
+		default:
+			summary.Info++
+		}
+		if severityRank[result.Severity] > severityRank[summary.Severity] {
+			summary.Severity = result.Severity
+		}
+	}
+	sort.Strings(summary.Excluded)
+	return summary
+}
+
+// HealthOptions controls HealthCheckWith
+type HealthOptions struct {
+	// ExcludeFrom is a file of .dotmanignore-style patterns for files the
+	// symlink, conflict and outdated checks skip, in addition to the
+	// health_exclude setting
+	ExcludeFrom string
+	// NoSave skips saving the results in the health directory
+	NoSave bool
+	// Parallel is the number of backups whose checksums are verified at
+	// once; 0 uses one worker per CPU and 1 verifies them one by one
+	Parallel int
+	// Progress, if not nil, is called after each verified backup with the
+	// number verified so far and the number of backups in the store
+	Progress func(done, total int)
+}
+
+// HealthCheck performs various checks on the dotfile configuration and
+// returns the individual results. The returned error is non-nil when any
+// check reported an error.
+func (m *Manager) HealthCheck() ([]HealthCheckResult, error) {
+	return m.HealthCheckWith(HealthOptions{})
+}
+
+// HealthCheckWith is HealthCheck with options. Files matching an exclude
+// pattern are left out of the symlink, conflict and outdated checks, which
+// list them in the Excluded field of their results instead.
+func (m *Manager) HealthCheckWith(opts HealthOptions) ([]HealthCheckResult, error) {
+	patterns := append([]string(nil), m.config.Settings.HealthExclude...)
+	if opts.ExcludeFrom != "" {
+		filePatterns, err := readPatterns(m.config.ExpandHome(opts.ExcludeFrom))
+		if err != nil {
+			return nil, newError(CodeInvalidArgument, "cannot read exclude patterns: %v", err)
+		}
+		patterns = append(patterns, filePatterns...)
+	}
+	for _, pattern := range patterns {
+		if !validPattern(pattern) {
+			return nil, newError(CodeInvalidArgument, "invalid health exclude pattern %q", pattern)
+		}
+	}
+	exclude := &IgnoreMatcher{patterns: patterns}
+
 	var results []HealthCheckResult
 
 	// Check for broken symlinks
-	results = append(results, m.checkBrokenSymlinks())
+	results = append(results, m.checkBrokenSymlinks(exclude))
 
 	// Check file permissions
 	results = append(results, m.checkFilePermissions())
@@ -34,13 +149,13 @@ func (m *Manager) HealthCheck() error {
 	results = append(results, m.checkGitStatus())
 
 	// Check backup integrity
-	results = append(results, m.checkBackupIntegrity())
+	results = append(results, m.checkBackupIntegrity(opts))
 
 	// Check for file conflicts
-	results = append(results, m.checkFileConflicts())
+	results = append(results, m.checkFileConflicts(exclude))
 
 	// Check for outdated configurations
-	results = append(results, m.checkOutdatedConfigs())
+	results = append(results, m.checkOutdatedConfigs(exclude))
 
 	// Check for disk space
 	results = append(results, m.checkDiskSpace())
@@ -48,34 +163,40 @@ func (m *Manager) HealthCheck() error {
 	// Check for file changes
 	results = append(results, m.checkFileChanges())
 
-	// Save health check results
-	if err := m.saveHealthCheckResults(results); err != nil {
-		fmt.Printf("Warning: Failed to save health check results: %v\n", err)
+	// Check sensitive directory permissions
+	results = append(results, m.checkSensitivePermissions())
+
+	// Check for overlapping managed paths
+	results = append(results, m.checkOverlappingPaths())
+
+	// Check for managed files above the size limit
+	results = append(results, m.checkLargeFiles())
+
+	// Check that managed links use the configured symlink style
+	results = append(results, m.checkSymlinkStyle())
+
+	// Check for configs that differ from what is committed
+	results = append(results, m.checkUntrackedConfigs())
+
+	// Save health check results, unless nothing may be written
+	if !m.config.ReadOnly && !opts.NoSave {
+		if err := m.saveHealthCheckResults(results); err != nil {
+			m.logf("Warning: Failed to save health check results: %v\n", err)
+		}
 	}
 
-	// Print results
-	hasErrors := false
 	for _, result := range results {
-		icon := "✅"
 		if result.Error != nil {
-			hasErrors = true
-			icon = "❌"
-		} else if result.Severity == "warning" {
-			icon = "⚠️"
+			return results, fmt.Errorf("health check found issues")
 		}
-		fmt.Printf("%s %s: %s\n", icon, result.Status, result.Message)
-	}
-
-	if hasErrors {
-		return fmt.Errorf("health check found issues")
 	}
 
-	return nil
+	return results, nil
 }
 
 // saveHealthCheckResults saves the health check results to a file
 func (m *Manager) saveHealthCheckResults(results []HealthCheckResult) error {
-	healthDir := filepath.Join(m.config.DotmanDir, "health")
+	healthDir := m.config.HealthDir()
 	if err := os.MkdirAll(healthDir, 0755); err != nil {
 		return err
 	}
@@ -93,33 +214,44 @@ func (m *Manager) saveHealthCheckResults(results []HealthCheckResult) error {
 	return os.WriteFile(filename, data, 0644)
 }
 
-// checkBrokenSymlinks checks for broken symbolic links
-func (m *Manager) checkBrokenSymlinks() HealthCheckResult {
-	var brokenLinks []string
-
-	err := filepath.Walk(m.config.ConfigsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+// withUnreadable adds the paths a check could not read to its result. A
+// check that otherwise passed becomes a warning, so problems that kept parts
+// of the configs directory from being checked are never reported as healthy.
+func withUnreadable(result HealthCheckResult, unreadable []error) HealthCheckResult {
+	if len(unreadable) == 0 {
+		return result
+	}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
+	paths := make([]string, 0, len(unreadable))
+	for _, err := range unreadable {
+		paths = append(paths, err.Error())
+	}
+	result.Message = fmt.Sprintf("%s; could not read %d path(s): %s", result.Message, len(paths), strings.Join(paths, ", "))
+	if result.Severity == "info" {
+		result.Severity = "warning"
+	}
+	if result.Error == nil {
+		result.Error = fmt.Errorf("unreadable paths found")
+	}
+	return result
+}
 
-		// Get relative path from configs directory
-		relPath, err := filepath.Rel(m.config.ConfigsDir, path)
-		if err != nil {
-			return err
+// splitExcluded separates the paths that match exclude from the others
+func splitExcluded(paths []string, exclude *IgnoreMatcher) (kept, excluded []string) {
+	for _, path := range paths {
+		if exclude.Match(path) {
+			excluded = append(excluded, path)
+		} else {
+			kept = append(kept, path)
 		}
+	}
+	return kept, excluded
+}
 
-		// Check if the symlink exists in home directory
-		homePath := filepath.Join(m.config.HomeDir, relPath)
-		if _, err := os.Lstat(homePath); os.IsNotExist(err) {
-			brokenLinks = append(brokenLinks, relPath)
-		}
-		return nil
-	})
+// checkBrokenSymlinks checks for broken symbolic links
+func (m *Manager) checkBrokenSymlinks(exclude *IgnoreMatcher) HealthCheckResult {
+	statuses, unreadable, err := m.fileStatuses()
+	brokenLinks, excluded := splitExcluded(filterStatuses(statuses, StateMissing), exclude)
 
 	if err != nil {
 		return HealthCheckResult{
@@ -132,43 +264,34 @@ func (m *Manager) checkBrokenSymlinks() HealthCheckResult {
 	}
 
 	if len(brokenLinks) > 0 {
-		return HealthCheckResult{
+		return withUnreadable(HealthCheckResult{
 			Status:    "Symlink Check",
 			Message:   fmt.Sprintf("Found %d broken symlinks: %s", len(brokenLinks), strings.Join(brokenLinks, ", ")),
 			Error:     fmt.Errorf("broken symlinks found"),
 			Timestamp: time.Now(),
 			Severity:  "warning",
-		}
+			Excluded:  excluded,
+		}, unreadable)
 	}
 
-	return HealthCheckResult{
+	return withUnreadable(HealthCheckResult{
 		Status:    "Symlink Check",
 		Message:   "All symlinks are valid",
 		Timestamp: time.Now(),
 		Severity:  "info",
-	}
+		Excluded:  excluded,
+	}, unreadable)
 }
 
 // checkFilePermissions checks file permissions
 func (m *Manager) checkFilePermissions() HealthCheckResult {
 	var invalidPerms []string
 
-	err := filepath.Walk(m.config.ConfigsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
-
+	unreadable, err := m.walkConfigs(func(relPath string, info os.FileInfo) {
 		// Check if file is readable
 		if info.Mode()&0400 == 0 {
-			relPath, _ := filepath.Rel(m.config.ConfigsDir, path)
 			invalidPerms = append(invalidPerms, relPath)
 		}
-		return nil
 	})
 
 	if err != nil {
@@ -182,21 +305,21 @@ func (m *Manager) checkFilePermissions() HealthCheckResult {
 	}
 
 	if len(invalidPerms) > 0 {
-		return HealthCheckResult{
+		return withUnreadable(HealthCheckResult{
 			Status:    "Permission Check",
 			Message:   fmt.Sprintf("Found %d files with invalid permissions: %s", len(invalidPerms), strings.Join(invalidPerms, ", ")),
 			Error:     fmt.Errorf("invalid permissions found"),
 			Timestamp: time.Now(),
 			Severity:  "warning",
-		}
+		}, unreadable)
 	}
 
-	return HealthCheckResult{
+	return withUnreadable(HealthCheckResult{
 		Status:    "Permission Check",
 		Message:   "All files have correct permissions",
 		Timestamp: time.Now(),
 		Severity:  "info",
-	}
+	}, unreadable)
 }
 
 // checkGitStatus checks the git repository status
@@ -212,7 +335,7 @@ func (m *Manager) checkGitStatus() HealthCheckResult {
 	}
 
 	// Check for uncommitted changes
-	statusCmd := exec.Command("git", "-C", m.config.DotmanDir, "status", "--porcelain")
+	statusCmd := m.git("status", "--porcelain")
 	output, err := statusCmd.Output()
 	if err != nil {
 		return HealthCheckResult{
@@ -235,8 +358,16 @@ func (m *Manager) checkGitStatus() HealthCheckResult {
 	}
 
 	// Check if remote is configured
-	remoteCmd := exec.Command("git", "-C", m.config.DotmanDir, "remote", "get-url", "origin")
+	remoteCmd := m.git("remote", "get-url", "origin")
 	if err := remoteCmd.Run(); err != nil {
+		if m.config.Settings.LocalOnly {
+			return HealthCheckResult{
+				Status:    "Git Status",
+				Message:   "Repository is clean; it is local only and has no remote",
+				Timestamp: time.Now(),
+				Severity:  "info",
+			}
+		}
 		return HealthCheckResult{
 			Status:    "Git Status",
 			Message:   "No remote repository configured",
@@ -254,9 +385,10 @@ func (m *Manager) checkGitStatus() HealthCheckResult {
 	}
 }
 
-// checkBackupIntegrity checks the integrity of backups
-func (m *Manager) checkBackupIntegrity() HealthCheckResult {
-	backupsDir := filepath.Join(m.config.DotmanDir, "backups")
+// checkBackupIntegrity checks the integrity of backups, verifying their
+// checksums with opts.Parallel workers
+func (m *Manager) checkBackupIntegrity(opts HealthOptions) HealthCheckResult {
+	backupsDir := m.config.BackupsDir()
 	if _, err := os.Stat(backupsDir); os.IsNotExist(err) {
 		return HealthCheckResult{
 			Status:    "Backup Check",
@@ -267,9 +399,7 @@ func (m *Manager) checkBackupIntegrity() HealthCheckResult {
 		}
 	}
 
-	var invalidBackups []string
-
-	entries, err := os.ReadDir(backupsDir)
+	verdicts, err := m.verifyBackups(opts.Parallel, opts.Progress)
 	if err != nil {
 		return HealthCheckResult{
 			Status:    "Backup Check",
@@ -280,23 +410,10 @@ func (m *Manager) checkBackupIntegrity() HealthCheckResult {
 		}
 	}
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-
-		backupDir := filepath.Join(backupsDir, entry.Name())
-		metadataPath := filepath.Join(backupDir, "metadata.json")
-		contentPath := filepath.Join(backupDir, "content")
-
-		// Check if both metadata and content exist
-		if _, err := os.Stat(metadataPath); os.IsNotExist(err) {
-			invalidBackups = append(invalidBackups, entry.Name())
-			continue
-		}
-		if _, err := os.Stat(contentPath); os.IsNotExist(err) {
-			invalidBackups = append(invalidBackups, entry.Name())
-			continue
+	var invalidBackups []string
+	for _, verdict := range verdicts {
+		if verdict.Problem != "" {
+			invalidBackups = append(invalidBackups, verdict.Name)
 		}
 	}
 
@@ -318,37 +435,47 @@ func (m *Manager) checkBackupIntegrity() HealthCheckResult {
 	}
 }
 
-// checkFileConflicts checks for potential file conflicts
-func (m *Manager) checkFileConflicts() HealthCheckResult {
-	var conflicts []string
+// backupProblem describes what is wrong with the backup in backupDir, or
+// returns "" for a valid backup
+func backupProblem(backupDir string) string {
+	metadataPath := filepath.Join(backupDir, "metadata.json")
+	contentPath := filepath.Join(backupDir, "content")
 
-	err := filepath.Walk(m.config.ConfigsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	// Check if both metadata and content exist
+	if _, err := os.Stat(metadataPath); os.IsNotExist(err) {
+		return "backup without metadata"
+	}
+	if _, err := os.Stat(contentPath); os.IsNotExist(err) {
+		return "backup without content"
+	}
 
-		if info.IsDir() {
-			return nil
-		}
+	// Verify the checksum of the content, the ciphertext for encrypted
+	// backups, so no key is needed
+	if !backupChecksumValid(metadataPath, contentPath) {
+		return "backup content does not match its checksum"
+	}
+	return ""
+}
 
-		relPath, err := filepath.Rel(m.config.ConfigsDir, path)
-		if err != nil {
-			return err
-		}
-
-		homePath := filepath.Join(m.config.HomeDir, relPath)
-		if _, err := os.Lstat(homePath); err == nil {
-			// File exists in home directory
-			if linkPath, err := os.Readlink(homePath); err != nil {
-				// Not a symlink, potential conflict
-				conflicts = append(conflicts, relPath)
-			} else if linkPath != path {
-				// Symlink points to wrong location
-				conflicts = append(conflicts, relPath)
-			}
-		}
-		return nil
-	})
+// backupChecksumValid reports whether a backup's content matches the checksum
+// in its metadata
+func backupChecksumValid(metadataPath, contentPath string) bool {
+	data, err := os.ReadFile(metadataPath)
+	if err != nil {
+		return false
+	}
+	var backup BackupMetadata
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return false
+	}
+	content, err := os.ReadFile(contentPath)
+	return err == nil && backupChecksumMatches(backup, content)
+}
+
+// checkFileConflicts checks for potential file conflicts
+func (m *Manager) checkFileConflicts(exclude *IgnoreMatcher) HealthCheckResult {
+	statuses, unreadable, err := m.fileStatuses()
+	conflicts, excluded := splitExcluded(filterStatuses(statuses, StateConflict), exclude)
 
 	if err != nil {
 		return HealthCheckResult{
@@ -361,42 +488,39 @@ func (m *Manager) checkFileConflicts() HealthCheckResult {
 	}
 
 	if len(conflicts) > 0 {
-		return HealthCheckResult{
+		return withUnreadable(HealthCheckResult{
 			Status:    "Conflict Check",
 			Message:   fmt.Sprintf("Found %d potential conflicts: %s", len(conflicts), strings.Join(conflicts, ", ")),
 			Error:     fmt.Errorf("conflicts found"),
 			Timestamp: time.Now(),
 			Severity:  "warning",
-		}
+			Excluded:  excluded,
+		}, unreadable)
 	}
 
-	return HealthCheckResult{
+	return withUnreadable(HealthCheckResult{
 		Status:    "Conflict Check",
 		Message:   "No conflicts found",
 		Timestamp: time.Now(),
 		Severity:  "info",
-	}
+		Excluded:  excluded,
+	}, unreadable)
 }
 
 // checkOutdatedConfigs checks for outdated configuration files
-func (m *Manager) checkOutdatedConfigs() HealthCheckResult {
-	var outdated []string
-
-	err := filepath.Walk(m.config.ConfigsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
+func (m *Manager) checkOutdatedConfigs(exclude *IgnoreMatcher) HealthCheckResult {
+	var outdated, excluded []string
 
+	unreadable, err := m.walkConfigs(func(relPath string, info os.FileInfo) {
 		// Check if file hasn't been modified in the last 30 days
-		if time.Since(info.ModTime()) > 30*24*time.Hour {
-			relPath, _ := filepath.Rel(m.config.ConfigsDir, path)
-			outdated = append(outdated, relPath)
+		if time.Since(info.ModTime()) <= 30*24*time.Hour {
+			return
+		}
+		if exclude.Match(relPath) {
+			excluded = append(excluded, relPath)
+			return
 		}
-		return nil
+		outdated = append(outdated, relPath)
 	})
 
 	if err != nil {
@@ -410,20 +534,22 @@ func (m *Manager) checkOutdatedConfigs() HealthCheckResult {
 	}
 
 	if len(outdated) > 0 {
-		return HealthCheckResult{
+		return withUnreadable(HealthCheckResult{
 			Status:    "Outdated Check",
 			Message:   fmt.Sprintf("Found %d potentially outdated files: %s", len(outdated), strings.Join(outdated, ", ")),
 			Timestamp: time.Now(),
 			Severity:  "warning",
-		}
+			Excluded:  excluded,
+		}, unreadable)
 	}
 
-	return HealthCheckResult{
+	return withUnreadable(HealthCheckResult{
 		Status:    "Outdated Check",
 		Message:   "No outdated files found",
 		Timestamp: time.Now(),
 		Severity:  "info",
-	}
+		Excluded:  excluded,
+	}, unreadable)
 }
 
 // checkDiskSpace checks available disk space
@@ -471,7 +597,7 @@ func (m *Manager) checkFileChanges() HealthCheckResult {
 		}
 	}
 
-	cmd := exec.Command("git", "-C", m.config.DotmanDir, "status", "--porcelain")
+	cmd := m.git("status", "--porcelain")
 	output, err := cmd.Output()
 	if err != nil {
 		return HealthCheckResult{
@@ -499,3 +625,200 @@ func (m *Manager) checkFileChanges() HealthCheckResult {
 		Severity:  "info",
 	}
 }
+
+// checkSensitivePermissions checks that sensitive directories are not world-readable
+func (m *Manager) checkSensitivePermissions() HealthCheckResult {
+	var exposed []string
+
+	for name := range sensitiveModes {
+		for _, root := range []string{m.config.HomeDir, m.config.ConfigsDir} {
+			dir := filepath.Join(root, name)
+			info, err := os.Stat(dir)
+			if err != nil || !info.IsDir() {
+				continue
+			}
+			if info.Mode().Perm()&0004 != 0 {
+				exposed = append(exposed, dir)
+			}
+		}
+	}
+	sort.Strings(exposed)
+
+	if len(exposed) > 0 {
+		return HealthCheckResult{
+			Status:    "Sensitive Permissions",
+			Message:   fmt.Sprintf("Found %d world-readable sensitive directories: %s", len(exposed), strings.Join(exposed, ", ")),
+			Timestamp: time.Now(),
+			Severity:  "warning",
+		}
+	}
+
+	return HealthCheckResult{
+		Status:    "Sensitive Permissions",
+		Message:   "Sensitive directories are not world-readable",
+		Timestamp: time.Now(),
+		Severity:  "info",
+	}
+}
+
+// checkOverlappingPaths checks for managed paths that overlap each other
+func (m *Manager) checkOverlappingPaths() HealthCheckResult {
+	files, unreadable, err := m.listFiles()
+	if err != nil {
+		return HealthCheckResult{
+			Status:    "Overlap Check",
+			Message:   fmt.Sprintf("Error listing managed files: %v", err),
+			Error:     err,
+			Timestamp: time.Now(),
+			Severity:  "error",
+		}
+	}
+
+	var overlaps []string
+	for _, file := range files {
+		if conflicts := m.findOverlaps(file, files); len(conflicts) > 0 {
+			overlaps = append(overlaps, fmt.Sprintf("%s (overlaps %s)", file, strings.Join(conflicts, ", ")))
+		}
+	}
+
+	if len(overlaps) > 0 {
+		return withUnreadable(HealthCheckResult{
+			Status:    "Overlap Check",
+			Message:   fmt.Sprintf("Found %d overlapping managed paths: %s", len(overlaps), strings.Join(overlaps, "; ")),
+			Error:     fmt.Errorf("overlapping managed paths found"),
+			Timestamp: time.Now(),
+			Severity:  "warning",
+		}, unreadable)
+	}
+
+	return withUnreadable(HealthCheckResult{
+		Status:    "Overlap Check",
+		Message:   "No overlapping managed paths",
+		Timestamp: time.Now(),
+		Severity:  "info",
+	}, unreadable)
+}
+
+// checkLargeFiles checks for managed files above the configured max_file_size
+func (m *Manager) checkLargeFiles() HealthCheckResult {
+	if m.config.MaxFileSize <= 0 {
+		return HealthCheckResult{
+			Status:    "File Size Check",
+			Message:   "File size limit disabled",
+			Timestamp: time.Now(),
+			Severity:  "info",
+		}
+	}
+
+	files, unreadable, err := m.listFiles()
+	if err != nil {
+		return HealthCheckResult{
+			Status:    "File Size Check",
+			Message:   fmt.Sprintf("Error listing managed files: %v", err),
+			Error:     err,
+			Timestamp: time.Now(),
+			Severity:  "error",
+		}
+	}
+
+	var large []string
+	for _, file := range files {
+		// Files stored in git-lfs are expected to be large
+		if m.lfsTracked(file) {
+			continue
+		}
+		info, err := os.Stat(m.sourcePath(file))
+		if err != nil {
+			unreadable = append(unreadable, err)
+			continue
+		}
+		if info.Size() > m.config.MaxFileSize {
+			large = append(large, fmt.Sprintf("%s (%s)", file, config.FormatSize(info.Size())))
+		}
+	}
+
+	if len(large) > 0 {
+		return withUnreadable(HealthCheckResult{
+			Status: "File Size Check",
+			Message: fmt.Sprintf("Found files larger than %s; consider git-lfs or removing them: %s",
+				config.FormatSize(m.config.MaxFileSize), strings.Join(large, ", ")),
+			Timestamp: time.Now(),
+			Severity:  "warning",
+		}, unreadable)
+	}
+
+	return withUnreadable(HealthCheckResult{
+		Status:    "File Size Check",
+		Message:   fmt.Sprintf("All managed files are within %s", config.FormatSize(m.config.MaxFileSize)),
+		Timestamp: time.Now(),
+		Severity:  "info",
+	}, unreadable)
+}
+
+// checkUntrackedConfigs reports files in the configs directory that are not
+// committed as they are: files git does not track, and tracked files with
+// uncommitted changes. Ignored files are included because the default
+// .gitignore matches everything and dotman adds configs with -f.
+func (m *Manager) checkUntrackedConfigs() HealthCheckResult {
+	if !m.isGitRepo() {
+		return HealthCheckResult{
+			Status:    "Config Tracking",
+			Message:   "Not a git repository",
+			Timestamp: time.Now(),
+			Severity:  "info",
+		}
+	}
+
+	output, err := m.git("status", "--porcelain", "-z", "--untracked-files=all", "--ignored=matching", "--", m.configsDirRel()).Output()
+	if err != nil {
+		return HealthCheckResult{
+			Status:    "Config Tracking",
+			Message:   fmt.Sprintf("Error checking config tracking: %v", err),
+			Error:     err,
+			Timestamp: time.Now(),
+			Severity:  "error",
+		}
+	}
+
+	var untracked, modified []string
+	entries := strings.Split(string(output), "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		code, path := entry[:2], strings.TrimPrefix(entry[3:], m.configsRepoPath()+"/")
+		// Renames and copies are followed by their source path
+		if code[0] == 'R' || code[0] == 'C' {
+			i++
+		}
+		if code == "??" || code == "!!" {
+			untracked = append(untracked, path)
+		} else {
+			modified = append(modified, path)
+		}
+	}
+
+	if len(untracked) == 0 && len(modified) == 0 {
+		return HealthCheckResult{
+			Status:    "Config Tracking",
+			Message:   "All configs are committed",
+			Timestamp: time.Now(),
+			Severity:  "info",
+		}
+	}
+
+	var parts []string
+	if len(untracked) > 0 {
+		parts = append(parts, fmt.Sprintf("%d not under git control: %s", len(untracked), strings.Join(untracked, ", ")))
+	}
+	if len(modified) > 0 {
+		parts = append(parts, fmt.Sprintf("%d with uncommitted changes: %s", len(modified), strings.Join(modified, ", ")))
+	}
+	return HealthCheckResult{
+		Status:    "Config Tracking",
+		Message:   fmt.Sprintf("Configs differ from the repository; %s", strings.Join(parts, "; ")),
+		Timestamp: time.Now(),
+		Severity:  "warning",
+	}
+}
@@ -0,0 +1,137 @@
+package manager
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HealthReportFormats lists the formats WriteHealthReport supports
+var HealthReportFormats = []string{"json", "junit"}
+
+// reportWriter serializes the results of a health check
+type reportWriter interface {
+	writeReport(w io.Writer, summary HealthSummary) error
+}
+
+// newReportWriter returns the reportWriter for a report format
+func newReportWriter(format string) (reportWriter, error) {
+	switch format {
+	case "", "json":
+		return jsonReport{}, nil
+	case "junit":
+		return junitReport{}, nil
+	default:
+		return nil, newError(CodeInvalidArgument, "unknown report format %q (supported: %s)", format, strings.Join(HealthReportFormats, ", "))
+	}
+}
+
+// WriteHealthReport writes summary to path in format, creating its parent
+// directories. The file is replaced only once the report is complete.
+func WriteHealthReport(path, format string, summary HealthSummary) error {
+	writer, err := newReportWriter(format)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating report directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".dotman-report-*")
+	if err != nil {
+		return fmt.Errorf("error creating report: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writer.writeReport(tmp, summary); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing report: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing report: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// jsonReport writes the summary as printed by 'dotman check --output json'
+type jsonReport struct{}
+
+func (jsonReport) writeReport(w io.Writer, summary HealthSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// junitReport writes a JUnit XML test suite with one test case per check,
+// which CI systems can show like test results. Errors are failures;
+// warnings pass, with their message as output, since JUnit has no warnings.
+type junitReport struct{}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (junitReport) writeReport(w io.Writer, summary HealthSummary) error {
+	suite := junitSuite{Name: "dotman health", Tests: len(summary.Results)}
+	for _, result := range summary.Results {
+		if suite.Timestamp == "" && !result.Timestamp.IsZero() {
+			suite.Timestamp = result.Timestamp.Format("2006-01-02T15:04:05")
+		}
+
+		c := junitCase{Name: result.Status, ClassName: "dotman.health"}
+		output := fmt.Sprintf("%s: %s", result.Severity, result.Message)
+		if len(result.Excluded) > 0 {
+			output += fmt.Sprintf("\nexcluded: %s", strings.Join(result.Excluded, ", "))
+		}
+		if result.Severity == SeverityError {
+			c.Failure = &junitFailure{Message: result.Message, Type: SeverityError, Text: output}
+			suite.Failures++
+		} else {
+			c.SystemOut = output
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is the name of the ignore file in the dotman directory
+const ignoreFileName = ".dotmanignore"
+
+// IgnoreMatcher matches home-relative paths against .dotmanignore patterns
+type IgnoreMatcher struct {
+	patterns []string
+}
+
+// loadIgnoreMatcher reads the .dotmanignore file from the dotman directory.
+// A missing file yields a matcher that ignores nothing.
+func (m *Manager) loadIgnoreMatcher() (*IgnoreMatcher, error) {
+	patterns, err := readPatterns(filepath.Join(m.config.DotmanDir, ignoreFileName))
+	if os.IsNotExist(err) {
+		return &IgnoreMatcher{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &IgnoreMatcher{patterns: patterns}, nil
+}
+
+// readPatterns reads the patterns in the .dotmanignore-style file at path,
+// one per line, skipping blank lines and comments
+func readPatterns(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Skip blank lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, strings.TrimSuffix(line, "/"))
+	}
+
+	return patterns, scanner.Err()
+}
+
+// Match reports whether relPath, or any of its parent directories, matches
+// an ignore pattern. Patterns without a slash match against a single path
+// component; patterns with a slash match against the whole relative path.
+func (im *IgnoreMatcher) Match(relPath string) bool {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	parts := strings.Split(relPath, "/")
+
+	for _, pattern := range im.patterns {
+		if strings.Contains(pattern, "/") {
+			// Match the path itself and each of its parent directories
+			for i := len(parts); i > 0; i-- {
+				if ok, _ := filepath.Match(pattern, strings.Join(parts[:i], "/")); ok {
+					return true
+				}
+			}
+			continue
+		}
+
+		for _, part := range parts {
+			if ok, _ := filepath.Match(pattern, part); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
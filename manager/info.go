@@ -0,0 +1,96 @@
+package manager
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CommitInfo describes a commit in the dotman repository
+type CommitInfo struct {
+	Hash    string    `json:"hash"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+}
+
+// FileDetails gathers everything dotman knows about one managed file
+type FileDetails struct {
+	SourceInfo
+
+	// Tags and Dependencies are detected the same way as for 'dotman docs'
+	Tags         []string `json:"tags"`
+	Dependencies []string `json:"dependencies"`
+
+	// LastCommit is the most recent commit that touched the managed file;
+	// nil when it was never committed
+	LastCommit *CommitInfo `json:"last_commit,omitempty"`
+
+	// Backups are the backups of the home path, oldest first
+	Backups []BackupMetadata `json:"backups"`
+}
+
+// Info describes the managed file that provides homePath. Paths that are
+// not managed return an error.
+func (m *Manager) Info(homePath string) (FileDetails, error) {
+	source, err := m.ResolveSource(homePath)
+	if err != nil {
+		return FileDetails{}, err
+	}
+
+	content, err := os.ReadFile(source.Source)
+	if err != nil {
+		return FileDetails{}, err
+	}
+
+	info := FileDetails{
+		SourceInfo:   source,
+		Tags:         append([]string{}, m.detectConfigTags(source.Source)...),
+		Dependencies: append([]string{}, m.detectDependencies(content)...),
+		LastCommit:   m.lastCommit(source.Source),
+		Backups:      []BackupMetadata{},
+	}
+
+	backups, err := m.ListBackups()
+	if err != nil {
+		return FileDetails{}, err
+	}
+	for _, backup := range backups {
+		if absPath(backup.OriginalPath) == source.HomePath {
+			info.Backups = append(info.Backups, backup)
+		}
+	}
+	sort.Slice(info.Backups, func(i, j int) bool {
+		a, b := info.Backups[i], info.Backups[j]
+		if a.Timestamp.Equal(b.Timestamp) {
+			return a.ID < b.ID
+		}
+		return a.Timestamp.Before(b.Timestamp)
+	})
+
+	return info, nil
+}
+
+// lastCommit returns the most recent commit touching path, or nil when there
+// is none or the history cannot be read
+func (m *Manager) lastCommit(path string) *CommitInfo {
+	if !m.isGitRepo() {
+		return nil
+	}
+
+	output, err := m.git("log", "-1", "--format=%H%x00%an%x00%aI%x00%s", "--", path).Output()
+	if err != nil {
+		return nil
+	}
+	fields := strings.SplitN(strings.TrimSuffix(string(output), "\n"), "\x00", 4)
+	if len(fields) != 4 {
+		return nil
+	}
+
+	date, err := time.Parse(time.RFC3339, fields[2])
+	if err != nil {
+		return nil
+	}
+	return &CommitInfo{Hash: fields[0], Author: fields[1], Date: date, Subject: fields[3]}
+}
@@ -0,0 +1,156 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cli-config-manager/config"
+)
+
+// layoutFileName records how files are arranged in the configs directory.
+// It is committed, so every clone maps files the same way no matter what
+// its layout setting says.
+const layoutFileName = ".dotmanlayout"
+
+// Top-level directories of the xdg-split layout
+const (
+	xdgSplitConfigDir = "config"
+	xdgSplitHomeDir   = "home"
+)
+
+// configsLayout returns the layout of the configs directory. A recorded
+// layout always wins. Without one, a repository that already manages files
+// predates layouts and is home-relative; an empty one uses the setting.
+func (m *Manager) configsLayout() string {
+	if recorded, ok := m.recordedLayout(); ok {
+		return recorded
+	}
+	if m.config.Settings.Layout == "" || m.hasManagedFiles() {
+		return config.LayoutHomeRelative
+	}
+	return m.config.Settings.Layout
+}
+
+// recordedLayout returns the layout recorded in the repository, if any
+func (m *Manager) recordedLayout() (string, bool) {
+	data, err := os.ReadFile(filepath.Join(m.config.DotmanDir, layoutFileName))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+// hasManagedFiles reports whether the configs directory has any entries
+func (m *Manager) hasManagedFiles() bool {
+	entries, err := os.ReadDir(m.config.ConfigsDir)
+	return err == nil && len(entries) > 0
+}
+
+// recordLayout writes the layout about to be used for the first managed
+// file into the repository, so it keeps applying once files exist. The
+// home-relative layout is the default and is never recorded, which leaves
+// existing repositories untouched.
+func (m *Manager) recordLayout() error {
+	if _, ok := m.recordedLayout(); ok {
+		return nil
+	}
+	layout := m.configsLayout()
+	if layout == config.LayoutHomeRelative {
+		return nil
+	}
+	path := filepath.Join(m.config.DotmanDir, layoutFileName)
+	if err := os.WriteFile(path, []byte(layout+"\n"), 0644); err != nil {
+		return fmt.Errorf("error recording layout: %v", err)
+	}
+	return nil
+}
+
+// sourceRel returns where the file at relPath, relative to the home
+// directory, is stored relative to the configs directory
+func (m *Manager) sourceRel(relPath string) string {
+	return layoutSourceRel(m.configsLayout(), relPath)
+}
+
+// sourcePath returns the managed file for relPath in the configs directory
+func (m *Manager) sourcePath(relPath string) string {
+	return filepath.Join(m.config.ConfigsDir, m.sourceRel(relPath))
+}
+
+// homeRelFor returns the home-relative path of the managed file at the
+// absolute path source in the configs directory. It fails for files that
+// do not fit the layout, which no dotman command would have created.
+func (m *Manager) homeRelFor(source string) (string, error) {
+	sourceRel, err := filepath.Rel(m.config.ConfigsDir, source)
+	if err != nil {
+		return "", err
+	}
+	return layoutHomeRel(m.configsLayout(), sourceRel)
+}
+
+// layoutSourceRel maps a home-relative path into the configs directory
+func layoutSourceRel(layout, relPath string) string {
+	relPath = filepath.Clean(relPath)
+	parts := strings.Split(relPath, string(filepath.Separator))
+
+	switch layout {
+	case config.LayoutXDGSplit:
+		if parts[0] == ".config" && len(parts) > 1 {
+			return filepath.Join(xdgSplitConfigDir, filepath.Join(parts[1:]...))
+		}
+		return filepath.Join(xdgSplitHomeDir, relPath)
+	case config.LayoutPackage:
+		return filepath.Join(packageName(parts), relPath)
+	}
+	return relPath
+}
+
+// layoutHomeRel is the inverse of layoutSourceRel. Mapping the result back
+// must give sourceRel again, so no two files can share a home path.
+func layoutHomeRel(layout, sourceRel string) (string, error) {
+	sourceRel = filepath.Clean(sourceRel)
+	parts := strings.Split(sourceRel, string(filepath.Separator))
+
+	var relPath string
+	switch layout {
+	case config.LayoutXDGSplit:
+		if len(parts) < 2 {
+			return "", fmt.Errorf("%s is outside the %s and %s directories of the %s layout", sourceRel, xdgSplitConfigDir, xdgSplitHomeDir, layout)
+		}
+		switch parts[0] {
+		case xdgSplitConfigDir:
+			relPath = filepath.Join(".config", filepath.Join(parts[1:]...))
+		case xdgSplitHomeDir:
+			relPath = filepath.Join(parts[1:]...)
+		default:
+			return "", fmt.Errorf("%s is outside the %s and %s directories of the %s layout", sourceRel, xdgSplitConfigDir, xdgSplitHomeDir, layout)
+		}
+	case config.LayoutPackage:
+		if len(parts) < 2 {
+			return "", fmt.Errorf("%s is not inside a package directory", sourceRel)
+		}
+		relPath = filepath.Join(parts[1:]...)
+	default:
+		return sourceRel, nil
+	}
+
+	if layoutSourceRel(layout, relPath) != sourceRel {
+		return "", fmt.Errorf("%s does not match the %s layout; it belongs at %s", sourceRel, layout, layoutSourceRel(layout, relPath))
+	}
+	return relPath, nil
+}
+
+// packageName returns the package a home-relative path belongs to in the
+// package layout: the application directory for files under ~/.config and
+// the first path element without its leading dot otherwise
+func packageName(parts []string) string {
+	name := parts[0]
+	if name == ".config" && len(parts) > 2 {
+		name = parts[1]
+	}
+	if trimmed := strings.TrimPrefix(name, "."); trimmed != "" {
+		name = trimmed
+	}
+	return name
+}
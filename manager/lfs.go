@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gitAttributesFileName is the name of the git attributes file in the dotman directory
+const gitAttributesFileName = ".gitattributes"
+
+// lfsAttributes are the git attributes that route a pattern through git-lfs
+const lfsAttributes = "filter=lfs diff=lfs merge=lfs -text"
+
+// lfsTracked reports whether relPath matches one of the lfs_patterns settings
+func (m *Manager) lfsTracked(relPath string) bool {
+	if len(m.config.Settings.LFSPatterns) == 0 {
+		return false
+	}
+	matcher := &IgnoreMatcher{patterns: m.config.Settings.LFSPatterns}
+	return matcher.Match(relPath)
+}
+
+// lfsInstalled reports whether the git-lfs extension is available
+func (m *Manager) lfsInstalled() bool {
+	return m.newGitCmd(context.Background(), "", "lfs", "version").Run() == nil
+}
+
+// ensureLFS prepares the repository to store files matching lfs_patterns in
+// git-lfs: the lfs hooks are installed and .gitattributes lists every pattern
+func (m *Manager) ensureLFS() error {
+	if !m.lfsInstalled() {
+		return fmt.Errorf("git-lfs is not installed but the file matches lfs_patterns. Install it from https://git-lfs.com, then run 'git lfs install'")
+	}
+
+	installCmd := m.git("lfs", "install", "--local")
+	if output, err := installCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error installing git-lfs hooks: %v\nOutput: %s", err, string(output))
+	}
+
+	return m.writeLFSAttributes()
+}
+
+// writeLFSAttributes adds an lfs entry to .gitattributes for every configured
+// pattern that does not have one yet. Existing entries are left untouched.
+func (m *Manager) writeLFSAttributes() error {
+	path := filepath.Join(m.config.DotmanDir, gitAttributesFileName)
+
+	existing := make(map[string]bool)
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading %s: %v", gitAttributesFileName, err)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			existing[fields[0]] = true
+		}
+	}
+
+	var added []string
+	for _, pattern := range m.config.Settings.LFSPatterns {
+		// Patterns with a slash are home-relative, so anchor them in configs/
+		attrPattern := pattern
+		if strings.Contains(pattern, "/") {
+			attrPattern = m.configsDirRel() + "/" + strings.TrimPrefix(pattern, "/")
+		}
+		if existing[attrPattern] {
+			continue
+		}
+		existing[attrPattern] = true
+		added = append(added, fmt.Sprintf("%s %s\n", attrPattern, lfsAttributes))
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		content = append(content, '\n')
+	}
+	content = append(content, strings.Join(added, "")...)
+
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", gitAttributesFileName, err)
+	}
+	return nil
+}
+
+// pullLFS downloads git-lfs content after a clone. Repositories without lfs
+// entries in .gitattributes are left alone; a missing git-lfs only warns so
+// the rest of the repository stays usable.
+func (m *Manager) pullLFS() error {
+	content, err := os.ReadFile(filepath.Join(m.config.DotmanDir, gitAttributesFileName))
+	if err != nil || !strings.Contains(string(content), "filter=lfs") {
+		return nil
+	}
+
+	if !m.lfsInstalled() {
+		m.logf("Warning: this repository stores files in git-lfs but git-lfs is not installed. Install it from https://git-lfs.com, then run 'git lfs install' and 'git lfs pull' in %s\n", m.config.DotmanDir)
+		return nil
+	}
+
+	installCmd := m.git("lfs", "install", "--local")
+	if output, err := installCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error installing git-lfs hooks: %v\nOutput: %s", err, string(output))
+	}
+
+	m.logf("Fetching git-lfs files...\n")
+	pullCmd := m.git("lfs", "pull")
+	if output, err := pullCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error pulling git-lfs files: %v\nOutput: %s", err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LinkResult describes a symbolic link created by Link, or a copy made by
+// Mirror
+type LinkResult struct {
+	// Source is the managed file in the configs directory
+	Source string
+	// Target is the symlink or copy location in the home directory
+	Target string
+	// BackupPath is where a real file previously at Target was saved, if any
+	BackupPath string
+}
+
+// LinkOptions controls how Link and Mirror behave
+type LinkOptions struct {
+	// FailFast stops at the first file that cannot be linked instead of
+	// linking the remaining files and reporting all failures at the end
+	FailFast bool
+	// Select, if set, is asked about every file before it is placed, with
+	// its path relative to the home directory. Returning false skips the
+	// file; an error stops the run and is returned as it is.
+	Select func(relPath string) (bool, error)
+	// ForceLink replaces a non-empty real directory that is where a file
+	// should go, after backing up the files in it. Without it such a file
+	// fails with CodeDirectoryInWay, since the directory likely holds data.
+	ForceLink bool
+	// SymlinksOnly only places files whose home path is missing or a
+	// symlink into the configs directory. Real files, directories and
+	// symlinks pointing elsewhere are left alone and reported to Skipped.
+	SymlinksOnly bool
+	// Skipped, if set, is called with the home-relative path of every file
+	// SymlinksOnly left alone and the reason. Without it they are logged.
+	Skipped func(relPath, reason string)
+}
+
+// LinkFailure describes a managed file that could not be linked
+type LinkFailure struct {
+	// Path is the path relative to the configs directory
+	Path string
+	// Err is the reason the file could not be linked
+	Err error
+}
+
+// LinkError aggregates the failures of a Link run
+type LinkError struct {
+	Failures []LinkFailure
+}
+
+// Error lists every failed file
+func (e *LinkError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "failed to link %d file(s):", len(e.Failures))
+	for _, failure := range e.Failures {
+		fmt.Fprintf(&b, "\n  - %s: %v", failure.Path, failure.Err)
+	}
+	return b.String()
+}
+
+// Link creates symbolic links for all managed files and returns the links it
+// created. A file that cannot be linked does not stop the others; all failures
+// are returned together as a *LinkError unless opts.FailFast is set.
+// Cancelling ctx stops the walk between files, so every file is either fully
+// linked or left untouched.
+func (m *Manager) Link(ctx context.Context, opts LinkOptions) ([]LinkResult, error) {
+	if err := m.checkWritable("link files"); err != nil {
+		return nil, err
+	}
+	return m.placeFiles(ctx, opts, func(path string) (LinkResult, error) {
+		return m.linkFile(path, opts)
+	})
+}
+
+// placeFiles walks the managed files and calls place for each one that
+// should be present on this machine, skipping frozen files and files whose
+// required programs are missing. Failures are collected as in Link.
+func (m *Manager) placeFiles(ctx context.Context, opts LinkOptions, place func(path string) (LinkResult, error)) ([]LinkResult, error) {
+	var links []LinkResult
+	var failures []LinkFailure
+
+	frozen, err := m.loadFrozen()
+	if err != nil {
+		return nil, err
+	}
+	conditions, err := m.loadLinkConditions()
+	if err != nil {
+		return nil, err
+	}
+
+	// fail records a per-file failure, or aborts the walk in fail-fast mode
+	fail := func(path string, err error) error {
+		relPath, relErr := filepath.Rel(m.config.ConfigsDir, path)
+		if relErr != nil {
+			relPath = path
+		}
+		if opts.FailFast {
+			return fmt.Errorf("%s: %v", relPath, err)
+		}
+		failures = append(failures, LinkFailure{Path: relPath, Err: err})
+		return nil
+	}
+
+	err = filepath.Walk(m.config.ConfigsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == m.config.ConfigsDir {
+				return err
+			}
+			if ferr := fail(path, err); ferr != nil {
+				return ferr
+			}
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Stop before touching the next file if the operation was cancelled
+		if err := ctx.Err(); err != nil {
+			return cancelled(ctx, err)
+		}
+
+		// Skip submodule git metadata
+		if info.Name() == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Skip directories
+		if info.IsDir() {
+			return nil
+		}
+
+		// An empty directory kept in the repository is created, not linked
+		if info.Name() == keepMarker {
+			relPath, err := m.homeRelFor(path)
+			if err == nil {
+				err = m.checkOutsideHome(relPath)
+			}
+			if err == nil {
+				err = m.mkdirTargetParents(relPath)
+			}
+			if err != nil {
+				return fail(path, err)
+			}
+			return nil
+		}
+
+		// Leave frozen files disabled until they are thawed, and files
+		// for programs this machine does not have unlinked
+		if relPath, err := m.homeRelFor(path); err == nil {
+			if _, ok := frozen[relPath]; ok {
+				m.logf("Skipping frozen file: %s\n", relPath)
+				return nil
+			}
+			if reason := requiresReason(missingPrograms(conditions, relPath)); reason != "" {
+				m.logf("Skipping %s: %s\n", relPath, reason)
+				return nil
+			}
+			if err := m.checkOutsideHome(relPath); err != nil {
+				return fail(path, err)
+			}
+			if opts.Select != nil {
+				selected, err := opts.Select(relPath)
+				if err != nil {
+					return err
+				}
+				if !selected {
+					return nil
+				}
+			}
+			if opts.SymlinksOnly {
+				if reason := m.foreignTarget(relPath); reason != "" {
+					if opts.Skipped != nil {
+						opts.Skipped(relPath, reason)
+					} else {
+						m.logf("Skipping %s: %s\n", relPath, reason)
+					}
+					return nil
+				}
+			}
+		}
+
+		link, err := place(path)
+		if err != nil {
+			return fail(path, m.rootPermissionHint(path, err))
+		}
+
+		links = append(links, link)
+		return nil
+	})
+	if err != nil {
+		return links, err
+	}
+
+	if len(failures) > 0 {
+		return links, &LinkError{Failures: failures}
+	}
+	return links, nil
+}
+
+// foreignTarget classifies the home path of relPath like fileStatus and
+// returns why LinkOptions.SymlinksOnly must not replace it, or "" when it is
+// missing or a symlink into the configs directory
+func (m *Manager) foreignTarget(relPath string) string {
+	status := m.fileStatus(relPath)
+	if status.State != StateConflict {
+		return ""
+	}
+	if target, err := resolveLink(status.HomePath); err == nil && within(m.config.ConfigsDir, target) {
+		return ""
+	}
+	return status.Detail
+}
+
+// linkFile links a single managed file into the home directory
+func (m *Manager) linkFile(path string, opts LinkOptions) (LinkResult, error) {
+	// Get the path relative to the home directory
+	relPath, err := m.homeRelFor(path)
+	if err != nil {
+		return LinkResult{}, err
+	}
+
+	// Create target path in home directory
+	targetPath := m.targetPath(relPath)
+
+	// A parent directory linked into the configs directory would make the
+	// target resolve to the managed file itself, which must not be removed
+	if linked := m.linkedAncestors(relPath); len(linked) > 0 {
+		return LinkResult{}, fmt.Errorf("refusing to link: parent directory %s is a symlink into the configs directory", linked[0])
+	}
+
+	// A managed file that is a symlink back into the home directory must
+	// not close a loop through the link about to be created
+	if err := linkCycle(path, targetPath); err != nil {
+		return LinkResult{}, err
+	}
+
+	// Create parent directories if they don't exist
+	if err := m.mkdirTargetParents(relPath); err != nil {
+		return LinkResult{}, err
+	}
+
+	// Save a real file before it is replaced by the link
+	backupPath, err := m.backupOverwritten(targetPath, relPath, opts)
+	if err != nil {
+		return LinkResult{}, err
+	}
+
+	// Remove existing file/link if it exists
+	if err := os.RemoveAll(targetPath); err != nil {
+		return LinkResult{}, err
+	}
+
+	// Create symbolic link
+	if err := os.Symlink(m.symlinkTarget(path, targetPath), targetPath); err != nil {
+		return LinkResult{}, err
+	}
+
+	return LinkResult{Source: path, Target: targetPath, BackupPath: backupPath}, nil
+}
+
+// backupOverwritten saves the regular file at targetPath before Link replaces it
+// and returns where it was saved. Symlinks, missing files and empty
+// directories are not backed up. A directory with content is refused unless
+// opts.ForceLink is set, and then backed up by backupDirectory. When a link
+// backup directory is configured the file is mirrored there under relPath,
+// otherwise it goes to the backup store.
+func (m *Manager) backupOverwritten(targetPath, relPath string, opts LinkOptions) (string, error) {
+	info, err := os.Lstat(targetPath)
+	if err != nil {
+		return "", nil
+	}
+	if info.IsDir() {
+		return m.backupDirectory(targetPath, relPath, opts)
+	}
+	if !info.Mode().IsRegular() {
+		return "", nil
+	}
+
+	if m.config.Settings.LinkBackupDir == "" {
+		backup, err := m.backupFile(targetPath, BackupOptions{})
+		if err != nil {
+			return "", fmt.Errorf("error backing up %s: %v", targetPath, err)
+		}
+		return filepath.Join(m.config.BackupsDir(), backup.ID), nil
+	}
+
+	backupDir := m.config.ExpandHome(m.config.Settings.LinkBackupDir)
+	if err := os.MkdirAll(filepath.Join(backupDir, filepath.Dir(relPath)), m.config.DirMode); err != nil {
+		return "", fmt.Errorf("error backing up %s: %v", targetPath, err)
+	}
+
+	backupPath := filepath.Join(backupDir, relPath)
+	if err := copyFile(targetPath, backupPath, info.Mode().Perm()); err != nil {
+		return "", fmt.Errorf("error backing up %s: %v", targetPath, err)
+	}
+	return backupPath, nil
+}
+
+// backupDirectory saves the files in the real directory dir before a link
+// replaces it, refusing unless opts.ForceLink is set. The files go to the
+// link backup directory under relPath when one is configured, otherwise to
+// the backup store as one session, whose directory is returned. Only
+// regular files are saved; symlinks inside dir are not.
+func (m *Manager) backupDirectory(dir, relPath string, opts LinkOptions) (string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir {
+			if !opts.ForceLink {
+				return errDirectoryInWay
+			}
+			if info.Mode().IsRegular() {
+				files = append(files, path)
+			}
+		}
+		return nil
+	})
+	if err == errDirectoryInWay {
+		return "", newError(CodeDirectoryInWay, "%s is a directory that is not empty; use --force-link to back it up and replace it with the link", dir)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %v", dir, err)
+	}
+	if len(files) == 0 {
+		return "", nil
+	}
+
+	if m.config.Settings.LinkBackupDir == "" {
+		session, err := m.BackupFiles(files, BackupOptions{})
+		if err != nil {
+			return "", fmt.Errorf("error backing up %s: %v", dir, err)
+		}
+		return filepath.Join(m.config.BackupsDir(), sessionsDirName, session.ID), nil
+	}
+
+	backupPath := filepath.Join(m.config.ExpandHome(m.config.Settings.LinkBackupDir), relPath)
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return "", err
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", fmt.Errorf("error backing up %s: %v", file, err)
+		}
+		dest := filepath.Join(backupPath, rel)
+		if err := os.MkdirAll(filepath.Dir(dest), m.config.DirMode); err != nil {
+			return "", fmt.Errorf("error backing up %s: %v", file, err)
+		}
+		if err := copyFile(file, dest, info.Mode().Perm()); err != nil {
+			return "", fmt.Errorf("error backing up %s: %v", file, err)
+		}
+	}
+	return backupPath, nil
+}
+
+// errDirectoryInWay stops the walk of backupDirectory at the first entry
+// of a directory it may not replace
+var errDirectoryInWay = errors.New("directory in the way")
+
+// orphanedLinks returns the home paths among relPaths that are symlinks into
+// the configs directory whose managed file no longer exists
+func (m *Manager) orphanedLinks(relPaths []string) []string {
+	var orphaned []string
+	for _, relPath := range relPaths {
+		homePath := m.targetPath(relPath)
+		target, err := resolveLink(homePath)
+		if err != nil || !strings.HasPrefix(target, m.config.ConfigsDir+string(filepath.Separator)) {
+			continue
+		}
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			orphaned = append(orphaned, homePath)
+		}
+	}
+	return orphaned
+}
+
+// pruneLinks removes the orphaned links among relPaths, and the home
+// directories that held nothing else, and returns the removed home paths
+// of the links
+func (m *Manager) pruneLinks(relPaths []string) ([]string, error) {
+	var pruned []string
+	for _, homePath := range m.orphanedLinks(relPaths) {
+		if err := os.Remove(homePath); err != nil {
+			return pruned, fmt.Errorf("error pruning %s: %v", homePath, err)
+		}
+		pruned = append(pruned, homePath)
+		for _, dir := range m.pruneEmptyDirs(m.config.HomeDir, filepath.Dir(homePath)) {
+			m.logf("Removed empty directory: %s\n", dir)
+		}
+	}
+	return pruned, nil
+}
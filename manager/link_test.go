@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// directoryInTheWay manages ~/.toolrc and puts a non-empty directory where
+// its link belongs, returning the directory
+func directoryInTheWay(t *testing.T, m *Manager) string {
+	t.Helper()
+
+	writeTestFile(t, m.sourcePath(".toolrc"), "managed\n")
+	dir := m.targetPath(".toolrc")
+	writeTestFile(t, filepath.Join(dir, "state.db"), "data\n")
+	return dir
+}
+
+func TestLinkRefusesNonEmptyDirectory(t *testing.T) {
+	m := newTestManager(t)
+	dir := directoryInTheWay(t, m)
+
+	_, err := m.Link(context.Background(), LinkOptions{})
+	var linkErr *LinkError
+	if !errors.As(err, &linkErr) || len(linkErr.Failures) != 1 {
+		t.Fatalf("Link() error = %v, want one failure", err)
+	}
+	if code := ErrorCodeOf(linkErr.Failures[0].Err); code != CodeDirectoryInWay {
+		t.Errorf("error code = %s, want %s", code, CodeDirectoryInWay)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "state.db")); got != "data\n" {
+		t.Errorf("directory content = %q, want it untouched", got)
+	}
+}
+
+func TestLinkForceLinkBacksUpDirectory(t *testing.T) {
+	m := newTestManager(t)
+	dir := directoryInTheWay(t, m)
+
+	results, err := m.Link(context.Background(), LinkOptions{ForceLink: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].BackupPath == "" {
+		t.Fatalf("results = %+v, want one link with a backup", results)
+	}
+	if got, err := os.Readlink(dir); err != nil || got != m.sourcePath(".toolrc") {
+		t.Errorf("%s links to %q, %v; want the managed file", dir, got, err)
+	}
+
+	// The directory's files were saved as one backup session
+	session, err := m.loadSession(filepath.Base(results[0].BackupPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Backups) != 1 {
+		t.Fatalf("session backups = %v, want state.db", session.Backups)
+	}
+	backup, content, err := m.readBackup(session.Backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.OriginalPath != filepath.Join(dir, "state.db") || string(content) != "data\n" {
+		t.Errorf("backup of %s = %q, want state.db with its content", backup.OriginalPath, content)
+	}
+}
+
+func TestLinkForceLinkToLinkBackupDir(t *testing.T) {
+	m := newTestManager(t)
+	dir := directoryInTheWay(t, m)
+	m.config.Settings.LinkBackupDir = filepath.Join(m.config.HomeDir, "link-backups")
+
+	results, err := m.Link(context.Background(), LinkOptions{ForceLink: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(m.config.HomeDir, "link-backups", ".toolrc")
+	if len(results) != 1 || results[0].BackupPath != want {
+		t.Fatalf("results = %+v, want a backup at %s", results, want)
+	}
+	if got := readTestFile(t, filepath.Join(want, "state.db")); got != "data\n" {
+		t.Errorf("backed up state.db = %q", got)
+	}
+	if _, err := os.Readlink(dir); err != nil {
+		t.Errorf("%s was not replaced by a link: %v", dir, err)
+	}
+}
+
+func TestLinkCancelledPartway(t *testing.T) {
+	m := newTestManager(t)
+
+	// Every file has a real file in the way, which linking backs up first
+	names := []string{".a", ".b", ".c", ".d", ".e"}
+	for _, name := range names {
+		writeTestFile(t, m.sourcePath(name), "managed "+name+"\n")
+		writeTestFile(t, m.targetPath(name), "home "+name+"\n")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var selected []string
+	results, err := m.Link(ctx, LinkOptions{
+		Select: func(relPath string) (bool, error) {
+			selected = append(selected, relPath)
+			if len(selected) == 2 {
+				cancel()
+			}
+			return true, nil
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Link() error = %v, want it to wrap context.Canceled", err)
+	}
+
+	// The file selected when the run was cancelled is still placed whole;
+	// nothing after it is touched
+	if len(results) != 2 {
+		t.Fatalf("linked %d files, want the 2 selected before the cancellation", len(results))
+	}
+	for i, name := range names {
+		target := m.targetPath(name)
+		if i < 2 {
+			if got, err := os.Readlink(target); err != nil || got != m.sourcePath(name) {
+				t.Errorf("%s links to %q, %v; want its managed file", name, got, err)
+			}
+			if readTestFile(t, target) != "managed "+name+"\n" {
+				t.Errorf("%s does not resolve to its managed content", name)
+			}
+			continue
+		}
+		info, err := os.Lstat(target)
+		if err != nil || !info.Mode().IsRegular() || readTestFile(t, target) != "home "+name+"\n" {
+			t.Errorf("%s was changed after the cancellation: %v", name, err)
+		}
+	}
+
+	// Only the linked files were backed up, and nothing was left half done
+	backups, err := m.ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Errorf("%d backups, want one for each linked file", len(backups))
+	}
+	entries, err := os.ReadDir(m.config.HomeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp") || strings.HasSuffix(entry.Name(), "~") {
+			t.Errorf("temporary file %s left in the home directory", entry.Name())
+		}
+	}
+}
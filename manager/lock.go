@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// lockFileName is the lock that keeps two dotman processes from changing the
+// dotman directory at the same time
+const lockFileName = "lock"
+
+// ErrLocked is returned by Lock while another process holds the lock
+var ErrLocked = newError(CodeLocked, "another dotman operation is in progress")
+
+// Lock is an exclusive lock on the dotman directory
+type Lock struct {
+	file *os.File
+}
+
+// Lock takes the lock on the dotman directory without waiting. It fails with
+// ErrLocked, naming the process that holds it, when another dotman operation
+// is in progress. The operating system releases the lock when the process
+// exits, however it exits, so a crashed run never leaves a stale lock.
+func (m *Manager) Lock() (*Lock, error) {
+	path := filepath.Join(m.config.DotmanDir, lockFileName)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %v", err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		holder, _ := os.ReadFile(path)
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			if info := strings.TrimSpace(string(holder)); info != "" {
+				return nil, fmt.Errorf("%w (%s)", ErrLocked, info)
+			}
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("error locking %s: %v", path, err)
+	}
+
+	// Record the holder for the error message of the next process
+	if err := file.Truncate(0); err == nil {
+		fmt.Fprintf(file, "pid %d, started %s\n", os.Getpid(), time.Now().Format(time.RFC3339))
+	}
+	return &Lock{file: file}, nil
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	if err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
@@ -1,60 +1,166 @@
 package manager
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"cli-config-manager/config"
 )
 
+// defaultGitignore keeps everything in the dotman directory out of git except
+// the managed configs and the repository metadata dotman maintains
+const defaultGitignore = "# Ignore everything in this directory\n*\n# Except this file\n!.gitignore\n!.gitmodules\n!.gitattributes\n!.dotmanignore\n!.dotmanlayout\n!links.json\n!notes.json\n!configs/\n"
+
 // Manager handles dotfile operations
 type Manager struct {
 	config *config.Config
+	log    io.Writer
 }
 
-// New creates a new Manager instance
+// New creates a new Manager instance that discards progress logs
 func New(cfg *config.Config) *Manager {
+	return NewWithLogger(cfg, io.Discard)
+}
+
+// NewWithLogger creates a new Manager instance that writes progress logs to w
+func NewWithLogger(cfg *config.Config, w io.Writer) *Manager {
+	if w == nil {
+		w = io.Discard
+	}
 	return &Manager{
 		config: cfg,
+		log:    w,
 	}
 }
 
+// logf writes a progress message to the manager's log writer
+func (m *Manager) logf(format string, args ...interface{}) {
+	fmt.Fprintf(m.log, format, args...)
+}
+
+// cancelled replaces err with an error wrapping ctx.Err() when ctx has been
+// cancelled, so callers can match context.Canceled
+func cancelled(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("operation cancelled: %w", ctxErr)
+	}
+	return err
+}
+
 // ListFiles returns a list of all managed files
 func (m *Manager) ListFiles() ([]string, error) {
+	files, unreadable, err := m.listFiles()
+	if err == nil && len(unreadable) > 0 {
+		err = unreadable[0]
+	}
+	return files, err
+}
+
+// listFiles returns the managed files that could be read, along with the
+// errors for paths that could not
+func (m *Manager) listFiles() ([]string, []error, error) {
 	var files []string
+	unreadable, err := m.walkConfigs(func(relPath string, info os.FileInfo) {
+		files = append(files, relPath)
+	})
+	return files, unreadable, err
+}
+
+// walkConfigs calls fn for every managed file with its path relative to the
+// home directory. A path that cannot be read, or that does not fit the
+// layout of the configs directory, is skipped and its error collected, so
+// one bad entry does not hide the rest; only an unreadable configs
+// directory stops the walk.
+func (m *Manager) walkConfigs(fn func(relPath string, info os.FileInfo)) ([]error, error) {
+	layout := m.configsLayout()
+	var unreadable []error
 	err := filepath.Walk(m.config.ConfigsDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			return err
+			if path == m.config.ConfigsDir {
+				return err
+			}
+			unreadable = append(unreadable, err)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
-		// Skip directories and the configs directory itself
-		if info.IsDir() {
+		// Skip submodule git metadata
+		if info.Name() == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Skip directories and the configs directory itself, and the
+		// markers that keep empty directories
+		if info.IsDir() || info.Name() == keepMarker {
 			return nil
 		}
 
 		// Get relative path from configs directory
-		relPath, err := filepath.Rel(m.config.ConfigsDir, path)
+		sourceRel, err := filepath.Rel(m.config.ConfigsDir, path)
 		if err != nil {
-			return err
+			unreadable = append(unreadable, err)
+			return nil
 		}
 
-		files = append(files, relPath)
+		relPath, err := layoutHomeRel(layout, sourceRel)
+		if err != nil {
+			unreadable = append(unreadable, err)
+			return nil
+		}
+
+		fn(relPath, info)
 		return nil
 	})
 
-	return files, err
+	return unreadable, err
 }
 
 // InitializeFromExistingRepo initializes the dotman directory from an existing GitHub repository
 func (m *Manager) InitializeFromExistingRepo(repoURL string) error {
+	return m.InitializeFromExistingRepoWith(repoURL, CloneOptions{})
+}
+
+// CloneOptions controls how InitializeFromExistingRepoWith clones
+type CloneOptions struct {
+	// Depth creates a shallow clone with that many commits of history.
+	// Zero clones the full history.
+	Depth int
+	// VerifyRemote stops before scaffolding a cloned repository that does
+	// not look like a dotman repository, unless ConfirmScaffold agrees.
+	// Without it, such a repository only produces warnings.
+	VerifyRemote bool
+	// ConfirmScaffold is called with VerifyRemote when the clone lacks the
+	// expected layout. Returning an error removes the clone and stops
+	// initialization with that error.
+	ConfirmScaffold func(check RemoteCheck) error
+}
+
+// InitializeFromExistingRepoWith initializes the dotman directory from an
+// existing repository like InitializeFromExistingRepo, using opts
+func (m *Manager) InitializeFromExistingRepoWith(repoURL string, opts CloneOptions) error {
+	if err := m.checkWritable("initialize the repository"); err != nil {
+		return err
+	}
+
 	// Check if git is configured
-	gitUserCmd := exec.Command("git", "config", "user.name")
-	gitEmailCmd := exec.Command("git", "config", "user.email")
+	gitUserCmd := m.newGitCmd(context.Background(), "", "config", "user.name")
+	gitEmailCmd := m.newGitCmd(context.Background(), "", "config", "user.email")
 
 	userName, err := gitUserCmd.Output()
 	if err != nil {
@@ -77,25 +183,40 @@ func (m *Manager) InitializeFromExistingRepo(repoURL string) error {
 	}
 
 	// Clone the repository with verbose output
-	fmt.Printf("Cloning repository: %s\n", repoURL)
-	cloneCmd := exec.Command("git", "clone", repoURL, m.config.DotmanDir)
+	m.logf("Cloning repository: %s\n", repoURL)
+	cloneArgs := []string{"clone", "--recurse-submodules"}
+	if opts.Depth > 0 {
+		cloneArgs = append(cloneArgs, "--depth", strconv.Itoa(opts.Depth), "--shallow-submodules")
+	}
+	cloneCmd := m.newGitCmd(context.Background(), "", append(cloneArgs, repoURL, m.config.DotmanDir)...)
 	output, err := cloneCmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("error cloning repository: %v\nOutput: %s", err, string(output))
 	}
-	fmt.Printf("Repository cloned successfully\n")
+	m.logf("Repository cloned successfully\n")
+
+	if err := m.verifyClone(opts); err != nil {
+		return err
+	}
+
+	if err := m.pullLFS(); err != nil {
+		return err
+	}
 
 	// Create configs directory if it doesn't exist
-	configsDir := filepath.Join(m.config.DotmanDir, "configs")
-	if err := os.MkdirAll(configsDir, 0755); err != nil {
+	if err := os.MkdirAll(m.config.ConfigsDir, 0755); err != nil {
 		return fmt.Errorf("error creating configs directory: %v", err)
 	}
 
-	// Update .gitignore to include configs directory
-	gitignorePath := filepath.Join(m.config.DotmanDir, ".gitignore")
-	gitignoreContent := []byte("# Ignore everything in this directory\n*\n# Except this file\n!.gitignore\n!configs/\n")
-	if err := os.WriteFile(gitignorePath, gitignoreContent, 0644); err != nil {
-		return fmt.Errorf("error updating .gitignore: %v", err)
+	// Update .gitignore to include configs directory. A repository with the
+	// dotfiles in a subdirectory holds other content, so its .gitignore
+	// belongs to that and is left alone.
+	if m.config.Settings.ConfigsSubdir == "" {
+		gitignorePath := filepath.Join(m.config.DotmanDir, ".gitignore")
+		gitignoreContent := []byte(defaultGitignore)
+		if err := os.WriteFile(gitignorePath, gitignoreContent, 0644); err != nil {
+			return fmt.Errorf("error updating .gitignore: %v", err)
+		}
 	}
 
 	// Configure git for this repository
@@ -108,47 +229,72 @@ func (m *Manager) InitializeFromExistingRepo(repoURL string) error {
 	}
 
 	for _, cmd := range configCmds {
-		fmt.Printf("%s...\n", cmd.desc)
-		gitCmd := exec.Command("git", append([]string{"-C", m.config.DotmanDir}, cmd.args...)...)
+		m.logf("%s...\n", cmd.desc)
+		gitCmd := m.git(cmd.args...)
 		if err := gitCmd.Run(); err != nil {
 			return fmt.Errorf("error %s: %v", cmd.desc, err)
 		}
 	}
 
 	// Add and commit the configs directory
-	fmt.Println("Adding configs directory...")
-	addCmd := exec.Command("git", "-C", m.config.DotmanDir, "add", "configs", ".gitignore")
+	m.logf("Adding configs directory...\n")
+	addCmd := m.git("add", m.configsDirRel(), ".gitignore")
 	if err := addCmd.Run(); err != nil {
 		return fmt.Errorf("error adding configs directory: %v", err)
 	}
 
-	fmt.Println("Committing changes...")
-	commitCmd := exec.Command("git", "-C", m.config.DotmanDir, "commit", "-m", "Add configs directory")
+	m.logf("Committing changes...\n")
+	commitCmd := m.git("commit", "-m", "Add configs directory")
 	if err := commitCmd.Run(); err != nil {
 		// If there's nothing to commit, that's fine
 		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			fmt.Println("No changes to commit")
+			m.logf("No changes to commit\n")
 		} else {
 			return fmt.Errorf("error committing configs directory: %v", err)
 		}
 	}
 
 	// Push the changes
-	fmt.Println("Pushing changes...")
-	pushCmd := exec.Command("git", "-C", m.config.DotmanDir, "push")
+	m.logf("Pushing changes...\n")
+	pushCmd := m.git("push")
 	if err := pushCmd.Run(); err != nil {
-		fmt.Printf("Warning: Failed to push changes: %v\n", err)
+		m.logf("Warning: Failed to push changes: %v\n", err)
 	}
 
-	fmt.Println("Repository initialized successfully. You can now start adding configuration files.")
+	m.logf("Repository initialized successfully. You can now start adding configuration files.\n")
 	return nil
 }
 
+// InitOptions controls how InitializeGitRepoWith creates a new repository
+type InitOptions struct {
+	// NoRemote keeps the repository local: nothing is created on GitHub
+	// and nothing is pushed, so neither gh nor a network is needed
+	NoRemote bool
+}
+
 // InitializeGitRepo initializes a git repository and creates it on GitHub
 func (m *Manager) InitializeGitRepo(repoName string) error {
+	return m.InitializeGitRepoWith(repoName, InitOptions{})
+}
+
+// InitializeGitRepoWith initializes a git repository with the initial
+// commit on main and, unless opts.NoRemote is set, creates it on GitHub as
+// repoName and pushes it
+func (m *Manager) InitializeGitRepoWith(repoName string, opts InitOptions) error {
+	if err := m.checkWritable("initialize the repository"); err != nil {
+		return err
+	}
+
+	// Check the GitHub account before anything is created in its name
+	if !opts.NoRemote {
+		if err := m.checkGitHubAccount(); err != nil {
+			return err
+		}
+	}
+
 	// Check if git is configured
-	gitUserCmd := exec.Command("git", "config", "user.name")
-	gitEmailCmd := exec.Command("git", "config", "user.email")
+	gitUserCmd := m.newGitCmd(context.Background(), "", "config", "user.name")
+	gitEmailCmd := m.newGitCmd(context.Background(), "", "config", "user.email")
 
 	_, err := gitUserCmd.Output()
 	if err != nil {
@@ -161,14 +307,14 @@ func (m *Manager) InitializeGitRepo(repoName string) error {
 	}
 
 	// Initialize git repository
-	initCmd := exec.Command("git", "-C", m.config.DotmanDir, "init")
+	initCmd := m.git("init")
 	if err := initCmd.Run(); err != nil {
 		return fmt.Errorf("error initializing git repository: %v", err)
 	}
 
 	// Create .gitignore
 	gitignorePath := filepath.Join(m.config.DotmanDir, ".gitignore")
-	gitignoreContent := []byte("# Ignore everything in this directory\n*\n# Except this file\n!.gitignore\n!configs/\n")
+	gitignoreContent := []byte(defaultGitignore)
 	if err := os.WriteFile(gitignorePath, gitignoreContent, 0644); err != nil {
 		return fmt.Errorf("error creating .gitignore: %v", err)
 	}
@@ -180,37 +326,44 @@ func (m *Manager) InitializeGitRepo(repoName string) error {
 		return fmt.Errorf("error creating README.md: %v", err)
 	}
 
-	// Create repository on GitHub using gh CLI (public by default)
-	createRepoCmd := exec.Command("gh", "repo", "create", repoName, "--public", "--source", m.config.DotmanDir, "--remote", "origin")
-	if err := createRepoCmd.Run(); err != nil {
-		return fmt.Errorf("error creating GitHub repository: %v. Make sure you have the GitHub CLI (gh) installed and are authenticated", err)
+	// Add and commit initial files before anything is created on GitHub,
+	// so a failure here does not leave an empty repository behind. The
+	// configs directory must exist for git to accept it as a pathspec.
+	if err := os.MkdirAll(m.config.ConfigsDir, m.config.DirMode); err != nil {
+		return fmt.Errorf("error creating configs directory: %v", err)
 	}
-
-	// Add and commit initial files
-	addCmd := exec.Command("git", "-C", m.config.DotmanDir, "add", ".")
+	addCmd := m.git(append([]string{"add", "-A", "-f", "--", "README.md"}, m.trackedPaths()...)...)
 	if err := addCmd.Run(); err != nil {
 		return fmt.Errorf("error adding files: %v", err)
 	}
 
-	commitCmd := exec.Command("git", "-C", m.config.DotmanDir, "commit", "-m", "Initial commit")
+	commitCmd := m.git("commit", "-m", "Initial commit")
 	if err := commitCmd.Run(); err != nil {
 		return fmt.Errorf("error committing files: %v", err)
 	}
 
 	// Set the default branch to main
-	branchCmd := exec.Command("git", "-C", m.config.DotmanDir, "branch", "-M", "main")
+	branchCmd := m.git("branch", "-M", "main")
 	if err := branchCmd.Run(); err != nil {
 		return fmt.Errorf("error setting default branch: %v", err)
 	}
 
+	if opts.NoRemote {
+		return nil
+	}
+
+	// Create repository on GitHub using gh CLI (public by default)
+	createRepoCmd := exec.Command("gh", "repo", "create", repoName, "--public", "--source", m.config.DotmanDir, "--remote", "origin")
+	if err := createRepoCmd.Run(); err != nil {
+		return fmt.Errorf("error creating GitHub repository: %v. Make sure you have the GitHub CLI (gh) installed and are authenticated", err)
+	}
+
 	// Try to push with retries
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
-		pushCmd := exec.Command("git", "-C", m.config.DotmanDir, "push", "-u", "origin", "main")
-		if err := pushCmd.Run(); err != nil {
+		pushCmd := m.git("push", "-u", "origin", "main")
+		if output, err := pushCmd.CombinedOutput(); err != nil {
 			if i == maxRetries-1 {
-				// On last retry, try to get more detailed error information
-				output, _ := pushCmd.CombinedOutput()
 				return fmt.Errorf("error pushing to GitHub after %d attempts: %v\nOutput: %s", maxRetries, err, string(output))
 			}
 			// Wait a bit before retrying
@@ -224,77 +377,243 @@ func (m *Manager) InitializeGitRepo(repoName string) error {
 	return fmt.Errorf("failed to push to GitHub after %d attempts", maxRetries)
 }
 
-// AddFile adds a new file to be managed
+// AddFile adds a new file to be managed. Files above the configured
+// max_file_size are refused with ErrFileTooLarge.
 func (m *Manager) AddFile(filePath string) error {
+	return m.AddFileWith(filePath, AddOptions{})
+}
+
+// AddOptions controls how AddFileWith behaves
+type AddOptions struct {
+	// Force adds files above the configured max_file_size
+	Force bool
+
+	// IncludeVCS adds version control and build directories like .git and
+	// node_modules when adding a directory, instead of skipping them
+	IncludeVCS bool
+
+	// Symlink decides how a path that is a symlink is added
+	Symlink SymlinkMode
+
+	// RenameOnConflict keeps a real file that AddContent would replace by
+	// renaming it to <name>.dotman-orig-<time> instead of backing it up.
+	// RemoveFileWith with RestoreOriginal moves it back.
+	RenameOnConflict bool
+
+	// CommitMessage is a text/template for the commit message, overriding
+	// the add_commit_message setting. See AddCommitData for what it can
+	// use; empty uses "Add {{.Path}}".
+	CommitMessage string
+}
+
+// AddFileWith adds a file to dotman management like AddFile, using opts
+func (m *Manager) AddFileWith(filePath string, opts AddOptions) error {
+	if err := m.checkWritable("add files"); err != nil {
+		return err
+	}
+
+	message, err := m.addCommitTemplate(opts)
+	if err != nil {
+		return err
+	}
+
 	// Convert to absolute path
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
 		return fmt.Errorf("error getting absolute path: %v", err)
 	}
 
+	// A symlink somewhere other than its managed copy is either kept as
+	// a link or replaced by the content it points to
+	if target, ok := m.foreignLink(absPath); ok {
+		switch opts.Symlink {
+		case SymlinkKeep:
+			return m.addLink(absPath, target, message)
+		case SymlinkFollow:
+			m.logf("%s is a symlink to %s; managing the content it points to\n", absPath, target)
+		case SymlinkDereference:
+			if resolved, err := filepath.EvalSymlinks(absPath); err == nil {
+				target = resolved
+			}
+			m.logf("%s is a symlink to %s; storing its content\n", absPath, target)
+		default:
+			return fmt.Errorf("%w: %s points to %s; manage the content it points to with --follow-symlink, or the link itself with --keep-symlink",
+				ErrIsSymlink, absPath, target)
+		}
+	}
+
 	// Check if file exists
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		return fmt.Errorf("file does not exist: %s", absPath)
+	info, err := os.Stat(absPath)
+	if os.IsNotExist(err) {
+		return newError(CodeNotFound, "file does not exist: %s", absPath)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading file: %v", err)
 	}
 
+	if info.IsDir() {
+		if opts.Symlink == SymlinkFollow || opts.Symlink == SymlinkDereference {
+			if target, ok := m.foreignLink(absPath); ok {
+				return newError(CodeInvalidArgument, "%s is a symlink to the directory %s; add that directory instead, or keep the link", absPath, target)
+			}
+		}
+		return m.addDirectory(absPath, opts, message)
+	}
+
+	targetPath, relPath, lfs, err := m.addFile(absPath, info, opts)
+	if err != nil || targetPath == "" {
+		return err
+	}
+
+	return m.commitAdded([]string{targetPath}, relPath, lfs, message)
+}
+
+// addFile copies the file at absPath into the configs directory and links it
+// in its place without committing. It returns the managed copy, the
+// home-relative path and whether the file is stored in git-lfs. An empty
+// managed path means the file was already managed and up to date.
+func (m *Manager) addFile(absPath string, info os.FileInfo, opts AddOptions) (string, string, bool, error) {
 	// Get relative path from home directory
-	relPath, err := filepath.Rel(m.config.HomeDir, absPath)
+	relPath, inHome := m.homeRelPath(absPath)
+	if !inHome {
+		return "", "", false, newError(CodeInvalidArgument, "%s is outside the home directory; add a root for it to the roots setting to manage it", absPath)
+	}
+	if err := m.checkOutsideHome(relPath); err != nil {
+		return "", "", false, err
+	}
+
+	// Keep large files out of the git history unless explicitly forced.
+	// Files stored in git-lfs are exempt.
+	lfs := m.lfsTracked(relPath)
+	if !opts.Force && !lfs {
+		if err := m.checkFileSize(absPath, info.Size()); err != nil {
+			return "", "", false, err
+		}
+	}
+	if !lfs && isLikelyBinary(absPath) {
+		m.logf("Warning: %s looks like a binary file; consider adding it to lfs_patterns\n", absPath)
+	}
+	if lfs {
+		if err := m.ensureLFS(); err != nil {
+			return "", "", false, err
+		}
+	}
+
+	// Refuse to manage a path that overlaps an already-managed one
+	managed, err := m.ListFiles()
 	if err != nil {
-		return fmt.Errorf("error getting relative path: %v", err)
+		return "", "", false, fmt.Errorf("error listing managed files: %v", err)
+	}
+	if overlaps := m.findOverlaps(relPath, managed); len(overlaps) > 0 {
+		return "", "", false, fmt.Errorf("%s overlaps already-managed paths: %s", relPath, strings.Join(overlaps, ", "))
+	}
+
+	// The first managed file fixes the layout of the configs directory
+	if err := m.recordLayout(); err != nil {
+		return "", "", false, err
 	}
 
 	// Create target directory in configs
-	targetDir := filepath.Join(m.config.ConfigsDir, filepath.Dir(relPath))
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return fmt.Errorf("error creating target directory: %v", err)
+	sourceRel := m.sourceRel(relPath)
+	if err := m.mkdirAll(m.config.ConfigsDir, filepath.Dir(sourceRel)); err != nil {
+		return "", "", false, fmt.Errorf("error creating target directory: %v", err)
 	}
 
-	// Copy file to configs directory
-	targetPath := filepath.Join(m.config.ConfigsDir, relPath)
-	if err := copyFile(absPath, targetPath); err != nil {
-		return fmt.Errorf("error copying file: %v", err)
+	// Copy file to configs directory, unless the managed copy already has
+	// the same content; skipping the write keeps its modtime intact
+	targetPath := filepath.Join(m.config.ConfigsDir, sourceRel)
+	unchanged, err := sameContent(absPath, targetPath)
+	if err != nil {
+		return "", "", false, fmt.Errorf("error comparing with managed copy: %v", err)
+	}
+	if unchanged {
+		if link, err := resolveLink(absPath); err == nil && link == targetPath {
+			m.logf("No changes: %s is already managed and up to date\n", absPath)
+			return "", relPath, lfs, nil
+		}
+	} else if err := copyFile(absPath, targetPath, m.addedFileMode(relPath, info, opts)); err != nil {
+		return "", "", false, fmt.Errorf("error copying file: %v", err)
 	}
 
 	// Create parent directories for the symlink if they don't exist
-	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
-		return fmt.Errorf("error creating parent directories: %v", err)
+	if err := m.mkdirTargetParents(relPath); err != nil {
+		return "", "", false, fmt.Errorf("error creating parent directories: %v", err)
 	}
 
 	// Remove existing file/link if it exists
 	if err := os.RemoveAll(absPath); err != nil {
-		return fmt.Errorf("error removing existing file: %v", err)
+		return "", "", false, fmt.Errorf("error removing existing file: %v", err)
 	}
 
 	// Create symbolic link
-	if err := os.Symlink(targetPath, absPath); err != nil {
-		return fmt.Errorf("error creating symbolic link: %v", err)
+	if err := os.Symlink(m.symlinkTarget(targetPath, absPath), absPath); err != nil {
+		return "", "", false, fmt.Errorf("error creating symbolic link: %v", err)
 	}
 
-	fmt.Printf("Added and linked: %s -> %s\n", absPath, targetPath)
+	m.logf("Added and linked: %s -> %s\n", absPath, targetPath)
+
+	return targetPath, relPath, lfs, nil
+}
+
+// addedFileMode returns the mode of the managed copy of relPath, whose
+// source info was read through any symlinks. Dereferenced files keep their
+// own permissions, except in sensitive directories, which are never
+// loosened.
+func (m *Manager) addedFileMode(relPath string, info os.FileInfo, opts AddOptions) os.FileMode {
+	if opts.Symlink == SymlinkDereference {
+		if _, sensitive := sensitiveRoot(relPath); !sensitive {
+			return info.Mode().Perm()
+		}
+	}
+	return m.fileModeFor(relPath)
+}
 
-	// Add and commit the file
-	fmt.Println("Committing changes...")
+// commitAdded stages and commits files that were just added to the configs
+// directory, with a commit message rendered from message for relPath. lfs
+// also stages .gitattributes, which routes the files through git-lfs.
+func (m *Manager) commitAdded(targetPaths []string, relPath string, lfs bool, message *template.Template) error {
+	// Add and commit the files
+	m.logf("Committing changes...\n")
 
-	// First, ensure the file is tracked by git
-	addCmd := exec.Command("git", "-C", m.config.DotmanDir, "add", "-f", targetPath)
+	// First, ensure the files are tracked by git
+	addCmd := m.git(append([]string{"add", "-f", "--"}, targetPaths...)...)
 	if output, err := addCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("error adding file to git: %v\nOutput: %s", err, string(output))
 	}
 
+	// The recorded layout must be committed with the first file it applies to
+	if _, ok := m.recordedLayout(); ok {
+		layoutCmd := m.git("add", "-f", layoutFileName)
+		if output, err := layoutCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("error adding %s to git: %v\nOutput: %s", layoutFileName, err, string(output))
+		}
+	}
+
+	// .gitattributes routes the file through git-lfs and must be committed with it
+	if lfs {
+		attrCmd := m.git("add", "-f", gitAttributesFileName)
+		if output, err := attrCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("error adding %s to git: %v\nOutput: %s", gitAttributesFileName, err, string(output))
+		}
+	}
+
 	// Check if there are any changes to commit
-	statusCmd := exec.Command("git", "-C", m.config.DotmanDir, "status", "--porcelain")
+	statusCmd := m.git("status", "--porcelain")
 	output, err := statusCmd.Output()
 	if err != nil {
 		return fmt.Errorf("error checking git status: %v", err)
 	}
 
 	if len(output) == 0 {
-		fmt.Println("No changes to commit")
+		m.logf("No changes to commit\n")
 		return nil
 	}
 
-	commitMsg := fmt.Sprintf("Add %s", relPath)
-	commitCmd := exec.Command("git", "-C", m.config.DotmanDir, "commit", "-m", commitMsg)
+	commitMsg, err := m.addCommitMessage(message, relPath, targetPaths)
+	if err != nil {
+		return fmt.Errorf("error rendering commit message: %v", err)
+	}
+	commitCmd := m.git("commit", "-m", commitMsg)
 	if output, err := commitCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("error committing file: %v\nOutput: %s", err, string(output))
 	}
@@ -302,107 +621,293 @@ func (m *Manager) AddFile(filePath string) error {
 	return nil
 }
 
-// Link creates symbolic links for all managed files
-func (m *Manager) Link() error {
-	return filepath.Walk(m.config.ConfigsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// repoMetadataFiles are the files in the dotman directory, besides configs/,
+// that belong in the git repository
+var repoMetadataFiles = []string{".gitignore", ".gitmodules", ".gitattributes", ".dotmanignore", layoutFileName, linkConditionsFileName, notesFileName}
+
+// trackedPaths returns the paths relative to the dotman directory that dotman
+// stages: the configs directory and whichever metadata files exist
+func (m *Manager) trackedPaths() []string {
+	paths := []string{m.configsDirRel()}
+	for _, name := range repoMetadataFiles {
+		if _, err := os.Lstat(filepath.Join(m.config.DotmanDir, name)); err == nil {
+			paths = append(paths, name)
 		}
+	}
+	return paths
+}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
+// CommitAndPush commits and pushes changes to the remote repository. A
+// repository without a remote, or marked local only, is committed to but
+// not pushed.
+func (m *Manager) CommitAndPush(ctx context.Context, message string) error {
+	return m.CommitAndPushWith(ctx, message, CommitOptions{})
+}
 
-		// Get relative path from configs directory
-		relPath, err := filepath.Rel(m.config.ConfigsDir, path)
-		if err != nil {
-			return err
-		}
+// CommitOptions controls how CommitAndPushWith behaves
+type CommitOptions struct {
+	// Review is called after staging with the diffstat of what is about to
+	// be committed and pushed. Returning an error aborts before anything
+	// is committed, leaving the changes staged. It is not called when
+	// nothing is staged.
+	Review func(stat string) error
+}
+
+// CommitAndPushWith commits and pushes changes like CommitAndPush, using opts
+func (m *Manager) CommitAndPushWith(ctx context.Context, message string, opts CommitOptions) error {
+	if err := m.checkWritable("commit changes"); err != nil {
+		return err
+	}
 
-		// Create target path in home directory
-		targetPath := filepath.Join(m.config.HomeDir, relPath)
+	// Check if we're in a git repository
+	if !m.isGitRepo() {
+		return ErrNotGitRepo
+	}
 
-		// Create parent directories if they don't exist
-		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-			return err
-		}
+	// Stage only the managed files and repository metadata, so internal
+	// directories like backups/ are never committed even if .gitignore is wrong
+	if err := m.gitCommand(ctx, append([]string{"add", "-A", "-f", "--"}, m.trackedPaths()...)...).Run(); err != nil {
+		return cancelled(ctx, fmt.Errorf("error adding files: %v", err))
+	}
 
-		// Remove existing file/link if it exists
-		if err := os.RemoveAll(targetPath); err != nil {
-			return err
+	if opts.Review != nil {
+		stat, err := m.gitCommand(ctx, "diff", "--cached", "--stat").Output()
+		if err != nil {
+			return cancelled(ctx, fmt.Errorf("error summarizing changes: %v", err))
 		}
-
-		// Create symbolic link
-		if err := os.Symlink(path, targetPath); err != nil {
-			return err
+		if len(stat) > 0 {
+			if err := opts.Review(string(stat)); err != nil {
+				return err
+			}
 		}
+	}
+
+	// Commit changes
+	if err := m.gitCommand(ctx, "commit", "-m", message).Run(); err != nil {
+		return cancelled(ctx, fmt.Errorf("error committing changes: %v", err))
+	}
 
-		fmt.Printf("Linked: %s -> %s\n", targetPath, path)
+	// Push changes, unless there is nowhere to push them to
+	if reason := m.pushSkipReason(); reason != "" {
+		m.logf("Not pushing: %s\n", reason)
 		return nil
-	})
+	}
+	if err := m.gitCommand(ctx, "push").Run(); err != nil {
+		return cancelled(ctx, fmt.Errorf("error pushing changes: %v", err))
+	}
+
+	return nil
+}
+
+// Update pulls the latest changes from the remote repository and relinks all files
+func (m *Manager) Update(ctx context.Context) ([]LinkResult, error) {
+	result, err := m.UpdateWith(ctx, UpdateOptions{})
+	return result.Links, err
+}
+
+// UpdateOptions controls how UpdateWith behaves
+type UpdateOptions struct {
+	// NoRelink only pulls, leaving the links in the home directory untouched
+	NoRelink bool
+
+	// Prune removes home symlinks to managed files that the pull deleted
+	Prune bool
+
+	// Strategy is how remote changes are integrated: config.PullFFOnly,
+	// config.PullRebase or config.PullMerge. Empty uses the pull_strategy
+	// setting, which defaults to fast-forward only.
+	Strategy string
 }
 
-// CommitAndPush commits and pushes changes to the remote repository
-func (m *Manager) CommitAndPush(message string) error {
+// UpdateResult describes what UpdateWith changed in the home directory
+type UpdateResult struct {
+	// Links are the symlinks created by relinking
+	Links []LinkResult
+	// Pruned are the home paths of dangling links removed by Prune
+	Pruned []string
+}
+
+// UpdateWith pulls the latest changes like Update, using opts
+func (m *Manager) UpdateWith(ctx context.Context, opts UpdateOptions) (UpdateResult, error) {
+	if err := m.checkWritable("update"); err != nil {
+		return UpdateResult{}, err
+	}
+
+	var result UpdateResult
+
 	// Check if we're in a git repository
 	if !m.isGitRepo() {
-		return fmt.Errorf("not a git repository. Please initialize git first")
+		return result, ErrNotGitRepo
 	}
 
-	// Add all changes
-	addCmd := exec.Command("git", "-C", m.config.DotmanDir, "add", ".")
-	if err := addCmd.Run(); err != nil {
-		return fmt.Errorf("error adding files: %v", err)
+	// Remember what was managed so links to files deleted upstream can be found
+	var before []string
+	if opts.Prune {
+		files, err := m.ListFiles()
+		if err != nil {
+			return result, fmt.Errorf("error listing managed files: %v", err)
+		}
+		before = files
 	}
 
-	// Commit changes
-	commitCmd := exec.Command("git", "-C", m.config.DotmanDir, "commit", "-m", message)
-	if err := commitCmd.Run(); err != nil {
-		return fmt.Errorf("error committing changes: %v", err)
+	// Pull latest changes. In a shallow clone this only fetches the new
+	// commits, so the history stays shallow until Unshallow is called.
+	if err := m.pull(ctx, opts.Strategy); err != nil {
+		return result, err
 	}
 
-	// Push changes
-	pushCmd := exec.Command("git", "-C", m.config.DotmanDir, "push")
-	if err := pushCmd.Run(); err != nil {
-		return fmt.Errorf("error pushing changes: %v", err)
+	// Bring submodules in line with the pulled revision
+	if err := m.UpdateSubmodules(ctx); err != nil {
+		return result, err
 	}
 
-	return nil
+	// Relink files after update
+	var linkErr error
+	if !opts.NoRelink {
+		result.Links, linkErr = m.Link(ctx, LinkOptions{})
+		if ctx.Err() != nil {
+			return result, linkErr
+		}
+	}
+
+	if opts.Prune {
+		pruned, err := m.pruneLinks(before)
+		result.Pruned = pruned
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, linkErr
 }
 
-// Update pulls the latest changes from the remote repository
-func (m *Manager) Update() error {
-	// Check if we're in a git repository
+// Unshallow fetches the full history of a repository that was cloned with a
+// depth and clears the stored clone_depth preference
+func (m *Manager) Unshallow(ctx context.Context) error {
+	if err := m.checkWritable("fetch history"); err != nil {
+		return err
+	}
+
 	if !m.isGitRepo() {
-		return fmt.Errorf("not a git repository. Please initialize git first")
+		return ErrNotGitRepo
 	}
 
-	// Pull latest changes
-	pullCmd := exec.Command("git", "-C", m.config.DotmanDir, "pull")
-	if err := pullCmd.Run(); err != nil {
-		return fmt.Errorf("error pulling changes: %v", err)
+	if output, err := m.git("rev-parse", "--is-shallow-repository").Output(); err == nil && strings.TrimSpace(string(output)) == "false" {
+		m.logf("Repository already has its full history\n")
+	} else {
+		m.logf("Fetching full history...\n")
+		if output, err := m.gitCommand(ctx, "fetch", "--unshallow").CombinedOutput(); err != nil {
+			return cancelled(ctx, fmt.Errorf("error fetching full history: %v\nOutput: %s", err, string(output)))
+		}
 	}
 
-	// Relink files after update
-	return m.Link()
+	if m.config.Settings.CloneDepth != 0 {
+		m.config.Settings.CloneDepth = 0
+		if err := m.config.SaveSettings(); err != nil {
+			return fmt.Errorf("error saving settings: %v", err)
+		}
+	}
+	return nil
 }
 
-// isGitRepo checks if the dotman directory is a git repository
+// isGitRepo checks if the dotman directory is inside a git repository
 func (m *Manager) isGitRepo() bool {
-	gitDir := filepath.Join(m.config.DotmanDir, ".git")
-	_, err := os.Stat(gitDir)
-	return err == nil
+	_, ok := m.gitRoot()
+	return ok
 }
 
-// copyFile copies a file from src to dst
-func copyFile(src, dst string) error {
+// gitRoot returns the root of the git repository the dotman directory is
+// in. It is the dotman directory itself unless configs_subdir keeps the
+// dotfiles in a subdirectory of a larger repository, in which case the
+// repository may also start above it.
+func (m *Manager) gitRoot() (string, bool) {
+	dir := m.config.DotmanDir
+	for {
+		// .git is a file in worktrees and submodules
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		if m.config.Settings.ConfigsSubdir == "" {
+			return "", false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// configsDirRel returns the configs directory relative to the dotman
+// directory, where git commands run, for use in pathspecs
+func (m *Manager) configsDirRel() string {
+	relPath, err := filepath.Rel(m.config.DotmanDir, m.config.ConfigsDir)
+	if err != nil {
+		return "configs"
+	}
+	return filepath.ToSlash(relPath)
+}
+
+// copyFile copies a file from src to dst with the given mode
+func copyFile(src, dst string, mode os.FileMode) error {
 	sourceFile, err := os.ReadFile(src)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(dst, sourceFile, 0644)
+	if err := os.WriteFile(dst, sourceFile, mode); err != nil {
+		return err
+	}
+
+	// WriteFile only applies the mode to new files and is subject to the umask
+	return os.Chmod(dst, mode)
+}
+
+// sameContent reports whether the files at a and b have identical content.
+// A missing b is reported as different.
+func sameContent(a, b string) (bool, error) {
+	bInfo, err := os.Stat(b)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	if aInfo.Size() != bInfo.Size() {
+		return false, nil
+	}
+
+	aSum, err := fileChecksum(a)
+	if err != nil {
+		return false, err
+	}
+	bSum, err := fileChecksum(b)
+	if err != nil {
+		return false, err
+	}
+	return aSum == bSum, nil
+}
+
+// fileChecksum returns the SHA-256 checksum of the file at path
+func fileChecksum(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
 }
 
 // BackupMetadata represents the metadata for a backup
@@ -411,6 +916,26 @@ type BackupMetadata struct {
 	OriginalPath string    `json:"original_path"`
 	SymlinkPath  string    `json:"symlink_path,omitempty"`
 	Timestamp    time.Time `json:"timestamp"`
+
+	// Encrypted is set when the stored content is encrypted with the
+	// tool named by Encryption ("age" or "gpg")
+	Encrypted  bool   `json:"encrypted,omitempty"`
+	Encryption string `json:"encryption,omitempty"`
+
+	// Compressed is set when the content was gzipped before being stored
+	// (and encrypted). OriginalSize and CompressedSize are its size before
+	// and after compression.
+	Compressed     bool  `json:"compressed,omitempty"`
+	OriginalSize   int64 `json:"original_size,omitempty"`
+	CompressedSize int64 `json:"compressed_size,omitempty"`
+
+	// Checksum is the hex SHA-256 of the file's content, or of the stored
+	// ciphertext for encrypted backups
+	Checksum string `json:"checksum,omitempty"`
+
+	// Note is why the backup was made, as given with backup --note.
+	// Backups made before notes existed have none.
+	Note string `json:"note,omitempty"`
 }
 
 // Backup represents a complete backup
@@ -421,16 +946,40 @@ type Backup struct {
 
 // BackupFile creates a backup of a managed file
 func (m *Manager) BackupFile(filePath string) error {
+	return m.BackupFileWith(filePath, BackupOptions{})
+}
+
+// BackupOptions controls how BackupFileWith behaves
+type BackupOptions struct {
+	// Compress gzips the stored content. The backup_compress setting
+	// turns it on for every backup.
+	Compress bool
+	// Note is stored with the backup to say why it was made
+	Note string
+}
+
+// BackupFileWith creates a backup of a managed file like BackupFile, using opts
+func (m *Manager) BackupFileWith(filePath string, opts BackupOptions) error {
+	if err := m.checkWritable("create backups"); err != nil {
+		return err
+	}
+
+	_, err := m.backupFile(filePath, opts)
+	return err
+}
+
+// backupFile creates a backup of a file and returns its metadata
+func (m *Manager) backupFile(filePath string, opts BackupOptions) (BackupMetadata, error) {
 	// Ensure the backups directory exists
-	backupsDir := filepath.Join(m.config.DotmanDir, "backups")
+	backupsDir := m.config.BackupsDir()
 	if err := os.MkdirAll(backupsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create backups directory: %v", err)
+		return BackupMetadata{}, fmt.Errorf("failed to create backups directory: %v", err)
 	}
 
 	// Read the original file
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %v", err)
+		return BackupMetadata{}, fmt.Errorf("failed to read file: %v", err)
 	}
 
 	// Create backup metadata
@@ -439,6 +988,7 @@ func (m *Manager) BackupFile(filePath string) error {
 			ID:           time.Now().Format("2006-01-02-150405"),
 			OriginalPath: filePath,
 			Timestamp:    time.Now(),
+			Note:         opts.Note,
 		},
 		Content: content,
 	}
@@ -448,33 +998,70 @@ func (m *Manager) BackupFile(filePath string) error {
 		backup.SymlinkPath = linkPath
 	}
 
-	// Create backup directory
+	// Create backup directory, keeping IDs unique when several backups
+	// are taken within the same second
+	baseID := backup.ID
 	backupDir := filepath.Join(backupsDir, backup.ID)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backupDir); os.IsNotExist(err) {
+			break
+		}
+		backup.ID = fmt.Sprintf("%s-%d", baseID, i)
+		backupDir = filepath.Join(backupsDir, backup.ID)
+	}
+	// The checksum is over the file's content unless encryption replaces
+	// it below, so compressing does not change it
+	backup.Checksum = checksum(content)
+
+	// Compress before encrypting; ciphertext does not compress
+	if opts.Compress || m.config.Settings.BackupCompress {
+		compressed, err := compressBackup(content)
+		if err != nil {
+			return BackupMetadata{}, err
+		}
+		backup.Compressed = true
+		backup.OriginalSize = int64(len(content))
+		backup.CompressedSize = int64(len(compressed))
+		content = compressed
+	}
+
+	// Encrypt the content when a recipient is configured
+	if m.config.Settings.BackupEncrypt != "" {
+		ciphertext, tool, err := m.encryptBackup(content)
+		if err != nil {
+			return BackupMetadata{}, err
+		}
+		content = ciphertext
+		backup.Encrypted = true
+		backup.Encryption = tool
+		backup.Checksum = checksum(content)
+	}
+
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return fmt.Errorf("failed to create backup directory: %v", err)
+		return BackupMetadata{}, fmt.Errorf("failed to create backup directory: %v", err)
 	}
 
 	// Save the file content
 	if err := os.WriteFile(filepath.Join(backupDir, "content"), content, 0644); err != nil {
-		return fmt.Errorf("failed to save backup content: %v", err)
+		return BackupMetadata{}, fmt.Errorf("failed to save backup content: %v", err)
 	}
 
 	// Save the metadata
 	metadata, err := json.MarshalIndent(backup.BackupMetadata, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %v", err)
+		return BackupMetadata{}, fmt.Errorf("failed to marshal metadata: %v", err)
 	}
 
 	if err := os.WriteFile(filepath.Join(backupDir, "metadata.json"), metadata, 0644); err != nil {
-		return fmt.Errorf("failed to save metadata: %v", err)
+		return BackupMetadata{}, fmt.Errorf("failed to save metadata: %v", err)
 	}
 
-	return nil
+	return backup.BackupMetadata, nil
 }
 
 // ListBackups returns a list of all available backups
 func (m *Manager) ListBackups() ([]BackupMetadata, error) {
-	backupsDir := filepath.Join(m.config.DotmanDir, "backups")
+	backupsDir := m.config.BackupsDir()
 	if _, err := os.Stat(backupsDir); os.IsNotExist(err) {
 		return nil, nil
 	}
@@ -486,7 +1073,7 @@ func (m *Manager) ListBackups() ([]BackupMetadata, error) {
 
 	var backups []BackupMetadata
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		if !isBackupDir(entry) {
 			continue
 		}
 
@@ -507,65 +1094,374 @@ func (m *Manager) ListBackups() ([]BackupMetadata, error) {
 	return backups, nil
 }
 
+// LatestBackupFor returns the most recent backup whose original path is path.
+// The second return value is false when no backup exists for that path.
+func (m *Manager) LatestBackupFor(path string) (BackupMetadata, bool) {
+	backups, err := m.ListBackups()
+	if err != nil {
+		return BackupMetadata{}, false
+	}
+
+	target := absPath(m.config.ExpandHome(path))
+
+	var latest BackupMetadata
+	found := false
+	for _, backup := range backups {
+		if absPath(backup.OriginalPath) != target {
+			continue
+		}
+		// IDs break ties between backups taken within the same second
+		if !found || backup.Timestamp.After(latest.Timestamp) ||
+			(backup.Timestamp.Equal(latest.Timestamp) && backupIDLess(latest.ID, backup.ID)) {
+			latest = backup
+			found = true
+		}
+	}
+
+	return latest, found
+}
+
+// backupIDLess reports whether the backup ID a was taken before b. IDs are
+// a timestamp like 2006-01-02-150405, followed by -N for the Nth further
+// backup within that second, so the suffixes are compared as numbers:
+// -10 comes after -9.
+func backupIDLess(a, b string) bool {
+	aTime, aSeq := splitBackupID(a)
+	bTime, bSeq := splitBackupID(b)
+	if aTime != bTime {
+		return aTime < bTime
+	}
+	return aSeq < bSeq
+}
+
+// splitBackupID returns the timestamp of a backup ID and the number of its
+// suffix, which is 0 for the first backup within a second
+func splitBackupID(id string) (string, int) {
+	const timestampLen = len("2006-01-02-150405")
+	if len(id) > timestampLen+1 && id[timestampLen] == '-' {
+		if seq, err := strconv.Atoi(id[timestampLen+1:]); err == nil {
+			return id[:timestampLen], seq
+		}
+	}
+	return id, 0
+}
+
+// absPath returns the cleaned absolute form of path, or path itself if it
+// cannot be resolved
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
 // RestoreBackup restores a file from a backup
 func (m *Manager) RestoreBackup(backupID string) error {
-	backupsDir := filepath.Join(m.config.DotmanDir, "backups")
-	backupDir := filepath.Join(backupsDir, backupID)
+	return m.RestoreBackupWith(backupID, RestoreOptions{})
+}
+
+// RestoreOptions controls how RestoreBackupWith behaves
+type RestoreOptions struct {
+	// AuthorDate commits a restored managed file with the backup's
+	// timestamp as the author date and the backup ID in the message
+	AuthorDate bool
+
+	// Force restores over a file that was changed after the backup was
+	// taken without asking
+	Force bool
+
+	// ConfirmNewer is called when the file being restored over was
+	// modified after the backup was taken and differs from it. Returning
+	// an error aborts the restore with that error. Without ConfirmNewer
+	// and Force, such a restore fails with CodeNewerFile.
+	ConfirmNewer func(plan RestorePlan) error
+}
+
+// RestorePlan describes what restoring a backup would change
+type RestorePlan struct {
+	Backup BackupMetadata `json:"backup"`
+
+	// Destination is the path the backup is restored to
+	Destination string `json:"destination"`
+
+	// Existing describes what is at Destination now; empty when nothing is
+	Existing string `json:"existing,omitempty"`
+
+	// WriteTarget is the file the content is written to. It differs from
+	// Destination when Destination is a symlink, which is written through.
+	WriteTarget string `json:"write_target"`
+
+	// Overwrites is set when WriteTarget already exists and is replaced
+	Overwrites bool `json:"overwrites"`
+
+	// ExistingModTime is when WriteTarget was last modified, if it exists
+	ExistingModTime *time.Time `json:"existing_mod_time,omitempty"`
+
+	// Newer is set when WriteTarget was modified after the backup was
+	// taken, so restoring may throw away more recent edits
+	Newer bool `json:"newer"`
+
+	// CreateParents is set when the parent directory of Destination is
+	// missing and would be created
+	CreateParents bool `json:"create_parents"`
+
+	// Symlink is what the symlink recreated at Destination would point
+	// at, when the backed-up path was a symlink
+	Symlink string `json:"symlink,omitempty"`
+
+	// Commit is set when the restored file is the managed copy and would
+	// be committed because of RestoreOptions.AuthorDate
+	Commit bool `json:"commit"`
+}
+
+// PlanRestore works out what RestoreBackupWith would do for backupID
+// without changing anything, so it also works in read-only mode. The backup
+// is checked against its checksum but not decrypted.
+func (m *Manager) PlanRestore(backupID string, opts RestoreOptions) (RestorePlan, error) {
+	plan, _, err := m.planRestore(backupID, opts)
+	return plan, err
+}
+
+// planRestore is PlanRestore that also returns the stored content of the
+// backup, still encrypted and compressed
+func (m *Manager) planRestore(backupID string, opts RestoreOptions) (RestorePlan, []byte, error) {
+	backup, content, err := m.readBackup(backupID)
+	if err != nil {
+		return RestorePlan{}, nil, err
+	}
+
+	plan := RestorePlan{
+		Backup:      backup,
+		Destination: backup.OriginalPath,
+		WriteTarget: backup.OriginalPath,
+		Symlink:     backup.SymlinkPath,
+	}
+
+	if info, err := os.Lstat(backup.OriginalPath); err == nil {
+		switch {
+		case info.IsDir():
+			return plan, nil, fmt.Errorf("cannot restore backup %s: %s is a directory", backupID, backup.OriginalPath)
+		case info.Mode()&os.ModeSymlink != 0:
+			target, _ := resolveLink(backup.OriginalPath)
+			plan.Existing = fmt.Sprintf("symlink to %s", target)
+			plan.WriteTarget = target
+		default:
+			plan.Existing = "file"
+		}
+	} else if _, err := os.Stat(filepath.Dir(backup.OriginalPath)); os.IsNotExist(err) {
+		plan.CreateParents = true
+	}
+
+	if info, err := os.Stat(plan.WriteTarget); err == nil {
+		if info.IsDir() {
+			return plan, nil, fmt.Errorf("cannot restore backup %s: %s is a directory", backupID, plan.WriteTarget)
+		}
+		plan.Overwrites = true
+		modTime := info.ModTime()
+		plan.ExistingModTime = &modTime
+		plan.Newer = modTime.After(backup.Timestamp)
+	}
+
+	// The restored file is the managed copy when the link that ends up at
+	// the destination points into the configs directory
+	if relPath, inHome := m.homeRelPath(backup.OriginalPath); opts.AuthorDate && inHome {
+		final := plan.WriteTarget
+		if plan.Symlink != "" {
+			final = plan.Symlink
+			if !filepath.IsAbs(final) {
+				final = filepath.Join(filepath.Dir(backup.OriginalPath), final)
+			}
+		}
+		plan.Commit = filepath.Clean(final) == m.sourcePath(relPath)
+	}
+
+	return plan, content, nil
+}
+
+// readBackup reads the metadata and stored content of a backup and verifies
+// the content against its checksum. Encrypted and compressed content is
+// returned as stored.
+func (m *Manager) readBackup(backupID string) (BackupMetadata, []byte, error) {
+	backupDir := filepath.Join(m.config.BackupsDir(), backupID)
 
 	// Read metadata
 	metadataPath := filepath.Join(backupDir, "metadata.json")
 	metadata, err := os.ReadFile(metadataPath)
+	if os.IsNotExist(err) {
+		return BackupMetadata{}, nil, newError(CodeNotFound, "backup %s does not exist", backupID)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to read backup metadata: %v", err)
+		return BackupMetadata{}, nil, fmt.Errorf("failed to read backup metadata: %v", err)
 	}
 
 	var backup BackupMetadata
 	if err := json.Unmarshal(metadata, &backup); err != nil {
-		return fmt.Errorf("failed to parse backup metadata: %v", err)
+		return BackupMetadata{}, nil, fmt.Errorf("failed to parse backup metadata: %v", err)
 	}
 
 	// Read backup content
 	contentPath := filepath.Join(backupDir, "content")
 	content, err := os.ReadFile(contentPath)
 	if err != nil {
-		return fmt.Errorf("failed to read backup content: %v", err)
+		return BackupMetadata{}, nil, fmt.Errorf("failed to read backup content: %v", err)
+	}
+	if !backupChecksumMatches(backup, content) {
+		return BackupMetadata{}, nil, fmt.Errorf("backup %s is corrupted: content does not match its checksum", backupID)
+	}
+
+	return backup, content, nil
+}
+
+// BackupContent returns the content of the file saved in backup backupID,
+// decrypted and decompressed, without restoring it
+func (m *Manager) BackupContent(backupID string) ([]byte, error) {
+	backup, stored, err := m.readBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+	return m.backupContent(backup, stored)
+}
+
+// RestoreBackupWith restores a file from a backup like RestoreBackup, using opts
+func (m *Manager) RestoreBackupWith(backupID string, opts RestoreOptions) error {
+	if err := m.checkWritable("restore backups"); err != nil {
+		return err
+	}
+
+	plan, content, err := m.planRestore(backupID, opts)
+	if err != nil {
+		return err
+	}
+
+	backup := plan.Backup
+	if content, err = m.backupContent(backup, content); err != nil {
+		return err
+	}
+	if err := m.checkNewer(plan, content, opts); err != nil {
+		return err
+	}
+
+	if err := m.applyRestore(plan, content); err != nil {
+		return err
 	}
 
+	// Keep the historical date when the restored file is the managed copy
+	if opts.AuthorDate {
+		relPath, inHome := m.homeRelPath(plan.Destination)
+		return m.commitRestored(backup, relPath, inHome)
+	}
+	return nil
+}
+
+// checkNewer stops a restore over a file that was modified after the backup
+// was taken, unless opts.Force is set or opts.ConfirmNewer agrees. A file
+// with the same content as the backup loses nothing and passes.
+func (m *Manager) checkNewer(plan RestorePlan, content []byte, opts RestoreOptions) error {
+	if !plan.Newer || opts.Force {
+		return nil
+	}
+	if current, err := os.ReadFile(plan.WriteTarget); err == nil && bytes.Equal(current, content) {
+		return nil
+	}
+	if opts.ConfirmNewer != nil {
+		return opts.ConfirmNewer(plan)
+	}
+	return newError(CodeNewerFile, "%s was modified at %s, after backup %s was taken at %s; use --force to overwrite it",
+		plan.WriteTarget, plan.ExistingModTime.Format("2006-01-02 15:04:05"), plan.Backup.ID, plan.Backup.Timestamp.Format("2006-01-02 15:04:05"))
+}
+
+// applyRestore writes the decrypted and decompressed content of a backup as
+// planned by planRestore
+func (m *Manager) applyRestore(plan RestorePlan, content []byte) error {
 	// Create parent directory if it doesn't exist
-	if err := os.MkdirAll(filepath.Dir(backup.OriginalPath), 0755); err != nil {
+	var err error
+	relPath, inHome := m.homeRelPath(plan.Destination)
+	if inHome {
+		err = m.mkdirTargetParents(relPath)
+	} else {
+		err = os.MkdirAll(filepath.Dir(plan.Destination), m.config.DirMode)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to create parent directory: %v", err)
 	}
 
 	// Restore the file
-	if err := os.WriteFile(backup.OriginalPath, content, 0644); err != nil {
+	fileMode := m.fileModeFor(relPath)
+	if err := os.WriteFile(plan.Destination, content, fileMode); err != nil {
 		return fmt.Errorf("failed to restore file: %v", err)
 	}
+	if err := os.Chmod(plan.Destination, fileMode); err != nil {
+		return fmt.Errorf("failed to set file mode: %v", err)
+	}
 
 	// Restore symlink if it existed
-	if backup.SymlinkPath != "" {
+	if plan.Symlink != "" {
 		// Remove existing file/link if it exists
-		if err := os.Remove(backup.OriginalPath); err != nil && !os.IsNotExist(err) {
+		if err := os.Remove(plan.Destination); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("failed to remove existing file: %v", err)
 		}
 
 		// Create the symlink
-		if err := os.Symlink(backup.SymlinkPath, backup.OriginalPath); err != nil {
+		if err := os.Symlink(plan.Symlink, plan.Destination); err != nil {
 			return fmt.Errorf("failed to restore symlink: %v", err)
 		}
 	}
+	return nil
+}
+
+// commitRestored commits a restored file that became the managed copy,
+// dating the commit at the time the backup was taken. Restores that did not
+// land in the configs directory have nothing to commit.
+func (m *Manager) commitRestored(backup BackupMetadata, relPath string, inHome bool) error {
+	managedPath := m.sourcePath(relPath)
+	if resolved, err := resolveLink(backup.OriginalPath); !inHome || err != nil || resolved != managedPath {
+		m.logf("%s is not a managed file, nothing to commit\n", backup.OriginalPath)
+		return nil
+	}
+
+	addCmd := m.git("add", "-f", managedPath)
+	if output, err := addCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error adding restored file to git: %v\nOutput: %s", err, string(output))
+	}
+
+	statusCmd := m.git("status", "--porcelain", "--", managedPath)
+	output, err := statusCmd.Output()
+	if err != nil {
+		return fmt.Errorf("error checking git status: %v", err)
+	}
+	if len(output) == 0 {
+		m.logf("No changes to commit\n")
+		return nil
+	}
+
+	commitMsg := fmt.Sprintf("Restore %s from backup %s", relPath, backup.ID)
+	commitCmd := m.git("commit", "-m", commitMsg, "--", managedPath)
+	commitCmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+backup.Timestamp.Format(time.RFC3339))
+	if output, err := commitCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error committing restored file: %v\nOutput: %s", err, string(output))
+	}
 
 	return nil
 }
 
 // Push pushes committed changes to the remote repository
 func (m *Manager) Push() error {
+	if err := m.checkWritable("push changes"); err != nil {
+		return err
+	}
+
 	// Check if we're in a git repository
 	if !m.isGitRepo() {
-		return fmt.Errorf("not a git repository. Please initialize git first")
+		return ErrNotGitRepo
+	}
+
+	if reason := m.pushSkipReason(); reason != "" {
+		return newError(CodeNoRemote, "nothing to push to: %s", reason)
 	}
 
 	// Push changes
-	pushCmd := exec.Command("git", "-C", m.config.DotmanDir, "push")
+	pushCmd := m.git("push")
 	if err := pushCmd.Run(); err != nil {
 		return fmt.Errorf("error pushing changes: %v", err)
 	}
@@ -575,6 +1471,27 @@ func (m *Manager) Push() error {
 
 // RemoveFile removes a file from dotman management
 func (m *Manager) RemoveFile(filePath string) error {
+	return m.RemoveFileWith(filePath, RemoveOptions{})
+}
+
+// RemoveOptions controls RemoveFileWith
+type RemoveOptions struct {
+	// RestoreOriginal puts back the real file that was renamed out of the
+	// way when the path was added with RenameOnConflict, instead of a copy
+	// of the managed content
+	RestoreOriginal bool
+	// KeepEmptyDirs leaves the directories in the configs directory that
+	// the removal emptied, which are removed by default
+	KeepEmptyDirs bool
+}
+
+// RemoveFileWith removes a file from dotman management like RemoveFile,
+// using opts
+func (m *Manager) RemoveFileWith(filePath string, opts RemoveOptions) error {
+	if err := m.checkWritable("remove files"); err != nil {
+		return err
+	}
+
 	// Convert to absolute path
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
@@ -582,26 +1499,37 @@ func (m *Manager) RemoveFile(filePath string) error {
 	}
 
 	// Get relative path from home directory
-	relPath, err := filepath.Rel(m.config.HomeDir, absPath)
-	if err != nil {
-		return fmt.Errorf("error getting relative path: %v", err)
-	}
+	relPath, _ := m.homeRelPath(absPath)
 
 	// Check if the file is in the configs directory
-	targetPath := filepath.Join(m.config.ConfigsDir, relPath)
+	targetPath := m.sourcePath(relPath)
 	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
-		return fmt.Errorf("file is not managed by dotman: %s", filePath)
+		return newError(CodeNotManaged, "file is not managed by dotman: %s", filePath)
 	}
 
 	// Check if the file is a symlink
-	linkPath, err := os.Readlink(absPath)
+	linkPath, err := resolveLink(absPath)
 	if err != nil {
-		return fmt.Errorf("file is not a symlink: %s", filePath)
+		return newError(CodeNotManaged, "file is not a symlink: %s", filePath)
 	}
 
 	// Verify the symlink points to our configs directory
 	if !strings.HasPrefix(linkPath, m.config.ConfigsDir) {
-		return fmt.Errorf("file is not managed by dotman: %s", filePath)
+		return newError(CodeNotManaged, "file is not managed by dotman: %s", filePath)
+	}
+
+	renamed, err := m.loadRenamed()
+	if err != nil {
+		return err
+	}
+	original, hasOriginal := renamed[relPath]
+	if opts.RestoreOriginal {
+		if !hasOriginal {
+			return newError(CodeNotFound, "no renamed original recorded for %s", filePath)
+		}
+		if _, err := os.Lstat(original.Path); err != nil {
+			return newError(CodeNotFound, "renamed original of %s is gone: %s", filePath, original.Path)
+		}
 	}
 
 	// Remove the symlink
@@ -609,24 +1537,47 @@ func (m *Manager) RemoveFile(filePath string) error {
 		return fmt.Errorf("error removing symlink: %v", err)
 	}
 
-	// Copy the file back to its original location
-	if err := copyFile(targetPath, absPath); err != nil {
+	// Put the renamed original or a copy of the managed file in its place
+	if opts.RestoreOriginal {
+		if err := os.Rename(original.Path, absPath); err != nil {
+			return fmt.Errorf("error restoring %s: %v", original.Path, err)
+		}
+		m.logf("Restored original: %s -> %s\n", original.Path, absPath)
+	} else if err := copyFile(targetPath, absPath, m.fileModeFor(relPath)); err != nil {
 		return fmt.Errorf("error copying file back: %v", err)
+	} else if hasOriginal {
+		m.logf("The original %s is still at %s\n", absPath, original.Path)
+	}
+
+	// The path is no longer managed, so its rename is no longer reversible
+	if hasOriginal {
+		delete(renamed, relPath)
+		if err := m.saveRenamed(renamed); err != nil {
+			return err
+		}
 	}
 
 	// Remove the file from git
-	rmCmd := exec.Command("git", "-C", m.config.DotmanDir, "rm", "-f", targetPath)
+	rmCmd := m.git("rm", "-f", targetPath)
 	if output, err := rmCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("error removing file from git: %v\nOutput: %s", err, string(output))
 	}
 
 	// Commit the removal
 	commitMsg := fmt.Sprintf("Remove %s", relPath)
-	commitCmd := exec.Command("git", "-C", m.config.DotmanDir, "commit", "-m", commitMsg)
+	commitCmd := m.git("commit", "-m", commitMsg)
 	if output, err := commitCmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("error committing removal: %v\nOutput: %s", err, string(output))
 	}
 
-	fmt.Printf("Removed %s from dotman management\n", filePath)
+	// git removes the directories it emptied, but not those still holding
+	// untracked files or the removed file when git did not track it
+	if !opts.KeepEmptyDirs {
+		for _, dir := range m.pruneEmptyDirs(m.config.ConfigsDir, filepath.Dir(targetPath)) {
+			m.logf("Removed empty directory: %s\n", dir)
+		}
+	}
+
+	m.logf("Removed %s from dotman management\n", filePath)
 	return nil
 }
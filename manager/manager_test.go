@@ -0,0 +1,280 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"cli-config-manager/config"
+)
+
+// newTestManager returns a Manager for a fresh home directory with an
+// initialized local dotman repository
+func newTestManager(t testing.TB) *Manager {
+	t.Helper()
+
+	cfg := newTestConfig(t)
+	m := New(cfg)
+	if err := m.InitializeGitRepoWith("configs", InitOptions{NoRemote: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.EnsureDirectories(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// newTestConfig points HOME and git at a fresh home directory and returns
+// its configuration, with an empty dotman directory
+func newTestConfig(t testing.TB) *config.Config {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "dotman")
+	t.Setenv("GIT_AUTHOR_EMAIL", "dotman@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "dotman")
+	t.Setenv("GIT_COMMITTER_EMAIL", "dotman@example.com")
+	writeTestFile(t, filepath.Join(home, ".gitconfig"), "[user]\n\tname = dotman\n\temail = dotman@example.com\n")
+
+	cfg, err := config.NewWithoutDirectories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(cfg.DotmanDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// writeTestFile writes content to path, creating its parent directories
+func writeTestFile(t testing.TB, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestFile returns the content of path
+func readTestFile(t testing.TB, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// testGit runs git in the dotman directory of m and returns its output
+func testGit(t testing.TB, m *Manager, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = m.config.DotmanDir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+	return string(output)
+}
+
+func TestConfigsSubdir(t *testing.T) {
+	cfg := newTestConfig(t)
+
+	// A project repository that keeps its dotfiles under dotfiles/
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = cfg.DotmanDir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+		}
+		return string(output)
+	}
+	run("init", "-q")
+	writeTestFile(t, filepath.Join(cfg.DotmanDir, "src", "main.go"), "package main\n")
+	run("add", "-A")
+	run("commit", "-q", "-m", "Project")
+
+	if err := cfg.SetConfigsSubdir("dotfiles"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.EnsureDirectories(); err != nil {
+		t.Fatal(err)
+	}
+	m := New(cfg)
+
+	if got := m.configsDirRel(); got != "dotfiles/configs" {
+		t.Errorf("configsDirRel() = %q, want dotfiles/configs", got)
+	}
+	if got := m.trackedPaths(); len(got) == 0 || got[0] != "dotfiles/configs" {
+		t.Errorf("trackedPaths() = %v, want the configs directory first", got)
+	}
+
+	path := filepath.Join(cfg.HomeDir, ".bashrc")
+	writeTestFile(t, path, "alias ll='ls -l'\n")
+	if err := m.AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if files := run("ls-files"); !strings.Contains(files, "dotfiles/configs/.bashrc") {
+		t.Errorf("the added file is not tracked under the subdirectory: %q", files)
+	}
+
+	// A commit stages the dotfiles but not the project's own changes
+	writeTestFile(t, m.sourcePath(".bashrc"), "alias la='ls -a'\n")
+	writeTestFile(t, filepath.Join(cfg.DotmanDir, "src", "main.go"), "package main // changed\n")
+	errReviewed := errors.New("reviewed")
+	err := m.CommitAndPushWith(context.Background(), "Update", CommitOptions{
+		Review: func(string) error { return errReviewed },
+	})
+	if err != errReviewed {
+		t.Fatalf("CommitAndPushWith() error = %v", err)
+	}
+	if staged := strings.TrimSpace(run("diff", "--cached", "--name-only")); staged != "dotfiles/configs/.bashrc" {
+		t.Errorf("staged = %q, want only dotfiles/configs/.bashrc", staged)
+	}
+}
+
+func TestAddSameFileTwice(t *testing.T) {
+	m := newTestManager(t)
+	var log bytes.Buffer
+	m.log = &log
+
+	path := filepath.Join(m.config.HomeDir, ".gitconfig")
+	if err := m.AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+	head := testGit(t, m, "rev-parse", "HEAD")
+	managed := m.sourcePath(".gitconfig")
+	before, err := os.Stat(managed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := testGit(t, m, "rev-parse", "HEAD"); got != head {
+		t.Errorf("adding the file again made a commit")
+	}
+	if status := testGit(t, m, "status", "--porcelain", "--", "configs"); status != "" {
+		t.Errorf("adding the file again changed the configs directory:\n%s", status)
+	}
+	if after, err := os.Stat(managed); err != nil || !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("the managed copy was rewritten")
+	}
+	if !strings.Contains(log.String(), "already managed and up to date") {
+		t.Errorf("no message about the unchanged file in %q", log.String())
+	}
+}
+
+func TestAddUnchangedCopyOnlyLinks(t *testing.T) {
+	m := newTestManager(t)
+
+	// Another machine's checkout already holds the same content
+	writeTestFile(t, m.sourcePath(".inputrc"), "set editing-mode vi\n")
+	testGit(t, m, "add", "-f", "--", "configs")
+	testGit(t, m, "commit", "-q", "-m", "Add .inputrc")
+	path := filepath.Join(m.config.HomeDir, ".inputrc")
+	writeTestFile(t, path, "set editing-mode vi\n")
+
+	if err := m.AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if status := testGit(t, m, "status", "--porcelain", "--", "configs"); status != "" {
+		t.Errorf("adding an unchanged copy changed the configs directory:\n%s", status)
+	}
+	if got, err := os.Readlink(path); err != nil || got != m.sourcePath(".inputrc") {
+		t.Errorf("%s links to %q, %v; want the managed copy", path, got, err)
+	}
+}
+
+func TestCommitSkipsStrayBackups(t *testing.T) {
+	m := newTestManager(t)
+
+	// Even with a .gitignore that no longer ignores them, internal
+	// directories of the dotman directory are not committed
+	writeTestFile(t, filepath.Join(m.config.DotmanDir, ".gitignore"), "")
+	writeTestFile(t, filepath.Join(m.config.BackupsDir(), "stray"), "leftover\n")
+	writeTestFile(t, m.sourcePath(".profile"), "export EDITOR=vi\n")
+
+	for _, path := range m.trackedPaths() {
+		if strings.HasPrefix(path, "backups") {
+			t.Errorf("trackedPaths() includes %s", path)
+		}
+	}
+
+	errReviewed := errors.New("reviewed")
+	err := m.CommitAndPushWith(context.Background(), "Update", CommitOptions{
+		Review: func(string) error { return errReviewed },
+	})
+	if err != errReviewed {
+		t.Fatalf("CommitAndPushWith() error = %v", err)
+	}
+	staged := strings.Fields(testGit(t, m, "diff", "--cached", "--name-only"))
+	want := []string{".gitignore", "configs/.profile"}
+	if strings.Join(staged, ",") != strings.Join(want, ",") {
+		t.Errorf("staged = %v, want %v", staged, want)
+	}
+}
+
+func TestBackupIDLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"2024-01-02-150405", "2024-01-02-150405-1", true},
+		{"2024-01-02-150405-1", "2024-01-02-150405", false},
+		{"2024-01-02-150405-9", "2024-01-02-150405-10", true},
+		{"2024-01-02-150405-10", "2024-01-02-150405-9", false},
+		{"2024-01-02-150405-12", "2024-01-02-150406", true},
+		{"2024-01-02-150405-2", "2024-01-02-150405-2", false},
+	}
+	for _, tt := range tests {
+		if got := backupIDLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("backupIDLess(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLatestBackupForSameTimestamp(t *testing.T) {
+	m := newTestManager(t)
+
+	// Eleven backups within one second, as their IDs would be numbered
+	path := filepath.Join(m.config.HomeDir, ".bashrc")
+	timestamp := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	for i := 0; i <= 10; i++ {
+		id := "2024-01-02-150405"
+		if i > 0 {
+			id += "-" + strconv.Itoa(i)
+		}
+		metadata, err := json.Marshal(BackupMetadata{ID: id, OriginalPath: path, Timestamp: timestamp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, filepath.Join(m.config.BackupsDir(), id, "metadata.json"), string(metadata))
+		writeTestFile(t, filepath.Join(m.config.BackupsDir(), id, "content"), id)
+	}
+
+	latest, ok := m.LatestBackupFor(path)
+	if !ok || latest.ID != "2024-01-02-150405-10" {
+		t.Errorf("LatestBackupFor() = %q, %v; want 2024-01-02-150405-10", latest.ID, ok)
+	}
+}
@@ -0,0 +1,122 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MigratedLink is a home symlink rewritten by MigrateLinks
+type MigratedLink struct {
+	// Path is the symlink in the home directory
+	Path string `json:"path"`
+	// OldTarget is the managed file in the old dotman directory it pointed at
+	OldTarget string `json:"old_target"`
+	// NewTarget is what the symlink contains now
+	NewTarget string `json:"new_target"`
+}
+
+// MigrateLinks rewrites the home symlinks of managed files that point into
+// the dotman directory at from, where it was before it was moved, so they
+// point at the managed files in the current dotman directory, in the
+// configured symlink style. Links are found by where they resolve, so links
+// that were relative are fixed too. When from is empty it is detected from
+// the broken links of managed files; see DetectOldDotmanDir.
+func (m *Manager) MigrateLinks(from string) ([]MigratedLink, error) {
+	if err := m.checkWritable("migrate links"); err != nil {
+		return nil, err
+	}
+
+	if from == "" {
+		detected, err := m.DetectOldDotmanDir()
+		if err != nil {
+			return nil, err
+		}
+		from = detected
+	}
+	from, err := filepath.Abs(m.config.ExpandHome(from))
+	if err != nil {
+		return nil, newError(CodeInvalidArgument, "invalid old dotman directory %q: %v", from, err)
+	}
+	if from == m.config.DotmanDir {
+		return nil, newError(CodeInvalidArgument, "%s is the current dotman directory", from)
+	}
+
+	files, err := m.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var migrated []MigratedLink
+	for _, relPath := range files {
+		source := m.sourcePath(relPath)
+		inDotman, err := filepath.Rel(m.config.DotmanDir, source)
+		if err != nil {
+			continue
+		}
+		oldTarget := filepath.Join(from, inDotman)
+		homePath := m.targetPath(relPath)
+		if resolved, err := resolveLink(homePath); err != nil || resolved != oldTarget {
+			continue
+		}
+
+		newTarget := m.symlinkTarget(source, homePath)
+		if err := os.Remove(homePath); err != nil {
+			return migrated, fmt.Errorf("error removing %s: %v", homePath, err)
+		}
+		if err := os.Symlink(newTarget, homePath); err != nil {
+			return migrated, fmt.Errorf("error relinking %s: %v", homePath, err)
+		}
+		migrated = append(migrated, MigratedLink{Path: homePath, OldTarget: oldTarget, NewTarget: newTarget})
+	}
+	return migrated, nil
+}
+
+// DetectOldDotmanDir finds where the dotman directory was before it was
+// moved from the broken home symlinks of managed files: a link to
+// <old>/configs/.bashrc for the managed file configs/.bashrc gives <old>.
+// It fails when no broken link fits, or when links disagree on the old
+// directory.
+func (m *Manager) DetectOldDotmanDir() (string, error) {
+	files, err := m.ListFiles()
+	if err != nil {
+		return "", err
+	}
+
+	candidates := make(map[string]int)
+	for _, relPath := range files {
+		homePath := m.targetPath(relPath)
+		target, err := resolveLink(homePath)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			continue
+		}
+		inDotman, err := filepath.Rel(m.config.DotmanDir, m.sourcePath(relPath))
+		if err != nil {
+			continue
+		}
+		suffix := string(filepath.Separator) + inDotman
+		if old := strings.TrimSuffix(target, suffix); old != target && old != m.config.DotmanDir {
+			candidates[old]++
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", newError(CodeNotFound, "no broken links point into a previous dotman directory; pass the old location with --from")
+	case 1:
+		for old := range candidates {
+			return old, nil
+		}
+	}
+	olds := make([]string, 0, len(candidates))
+	for old, count := range candidates {
+		olds = append(olds, fmt.Sprintf("%s (%d links)", old, count))
+	}
+	sort.Strings(olds)
+	return "", newError(CodeInvalidArgument, "broken links point into several old locations: %s; pick one with --from", strings.Join(olds, ", "))
+}
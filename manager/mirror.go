@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// Mirror is Link with copy semantics: every managed file is copied into the
+// home directory as a regular file instead of being linked, for
+// environments that cannot use symlinks. Links to managed files are
+// replaced by copies and real files in the way are backed up as in Link.
+// Copies that are already up to date are left alone. Edits to the copies
+// are not seen by dotman until they are added again.
+func (m *Manager) Mirror(ctx context.Context, opts LinkOptions) ([]LinkResult, error) {
+	if err := m.checkWritable("mirror files"); err != nil {
+		return nil, err
+	}
+	return m.placeFiles(ctx, opts, func(path string) (LinkResult, error) {
+		return m.mirrorFile(path, opts)
+	})
+}
+
+// mirrorFile copies a single managed file into the home directory
+func (m *Manager) mirrorFile(path string, opts LinkOptions) (LinkResult, error) {
+	relPath, err := m.homeRelFor(path)
+	if err != nil {
+		return LinkResult{}, err
+	}
+	targetPath := m.targetPath(relPath)
+
+	// Writing through a parent directory linked into the configs directory
+	// would overwrite the managed file itself
+	if linked := m.linkedAncestors(relPath); len(linked) > 0 {
+		return LinkResult{}, fmt.Errorf("refusing to mirror: parent directory %s is a symlink into the configs directory", linked[0])
+	}
+
+	if err := m.mkdirTargetParents(relPath); err != nil {
+		return LinkResult{}, err
+	}
+
+	// Mirroring again must not back up the copies made last time
+	if info, err := os.Lstat(targetPath); err == nil && info.Mode().IsRegular() {
+		if same, err := sameContent(path, targetPath); err == nil && same {
+			return LinkResult{Source: path, Target: targetPath}, nil
+		}
+	}
+
+	backupPath, err := m.backupOverwritten(targetPath, relPath, opts)
+	if err != nil {
+		return LinkResult{}, err
+	}
+
+	if err := os.RemoveAll(targetPath); err != nil {
+		return LinkResult{}, err
+	}
+	if err := copyFile(path, targetPath, m.fileModeFor(relPath)); err != nil {
+		return LinkResult{}, err
+	}
+
+	return LinkResult{Source: path, Target: targetPath, BackupPath: backupPath}, nil
+}
@@ -0,0 +1,132 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// notesFileName holds short notes attached to managed files, such as
+// reminders to reload a program after editing. It is committed, so notes
+// travel with the files, and lives outside docs/ so regenerating the
+// documentation keeps them.
+const notesFileName = "notes.json"
+
+// loadNotes reads the notes, keyed by home-relative path with forward
+// slashes. A missing file has no notes.
+func (m *Manager) loadNotes() (map[string]string, error) {
+	notes := make(map[string]string)
+	data, err := os.ReadFile(filepath.Join(m.config.DotmanDir, notesFileName))
+	if os.IsNotExist(err) {
+		return notes, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", notesFileName, err)
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", notesFileName, err)
+	}
+	for path, note := range raw {
+		notes[filepath.ToSlash(filepath.Clean(path))] = note
+	}
+	return notes, nil
+}
+
+// saveNotes writes the notes, removing the file once there are none
+func (m *Manager) saveNotes(notes map[string]string) error {
+	path := filepath.Join(m.config.DotmanDir, notesFileName)
+	if len(notes) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %v", notesFileName, err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(notes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %v", notesFileName, err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Notes returns every note, keyed by home-relative path with forward slashes
+func (m *Manager) Notes() (map[string]string, error) {
+	return m.loadNotes()
+}
+
+// noteFor returns the note of the managed file relPath, or ""
+func (m *Manager) noteFor(relPath string) string {
+	notes, err := m.loadNotes()
+	if err != nil {
+		return ""
+	}
+	return notes[filepath.ToSlash(relPath)]
+}
+
+// SetNote attaches note to the managed file that provides homePath,
+// replacing any previous note. Commit notes.json to share it.
+func (m *Manager) SetNote(homePath, note string) error {
+	if err := m.checkWritable("set notes"); err != nil {
+		return err
+	}
+
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return newError(CodeInvalidArgument, "note must not be empty")
+	}
+
+	info, err := m.ResolveSource(homePath)
+	if err != nil {
+		return err
+	}
+
+	notes, err := m.loadNotes()
+	if err != nil {
+		return err
+	}
+	notes[filepath.ToSlash(info.Path)] = note
+	return m.saveNotes(notes)
+}
+
+// Note returns the note attached to the managed file that provides homePath
+func (m *Manager) Note(homePath string) (string, error) {
+	info, err := m.ResolveSource(homePath)
+	if err != nil {
+		return "", err
+	}
+	if info.Note == "" {
+		return "", newError(CodeNotFound, "%s has no note", info.HomePath)
+	}
+	return info.Note, nil
+}
+
+// RemoveNote removes the note of homePath. The path does not need to be
+// managed anymore, so notes left behind by removed files can be cleaned up.
+func (m *Manager) RemoveNote(homePath string) error {
+	if err := m.checkWritable("remove notes"); err != nil {
+		return err
+	}
+
+	absPath, err := filepath.Abs(m.config.ExpandHome(homePath))
+	if err != nil {
+		return fmt.Errorf("error getting absolute path: %v", err)
+	}
+	relPath, inHome := m.homeRelPath(absPath)
+	if !inHome {
+		return newError(CodeInvalidArgument, "%s is not inside the home directory", homePath)
+	}
+
+	notes, err := m.loadNotes()
+	if err != nil {
+		return err
+	}
+	key := filepath.ToSlash(relPath)
+	if _, ok := notes[key]; !ok {
+		return newError(CodeNotFound, "%s has no note", absPath)
+	}
+	delete(notes, key)
+	return m.saveNotes(notes)
+}
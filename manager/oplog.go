@@ -0,0 +1,59 @@
+package manager
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// maxLogSize is the size at which the operation log is rotated. The
+// previous log is kept as <path>.1, so the log never takes more than twice
+// this on disk.
+const maxLogSize = 1 << 20
+
+// OpenLog opens the operation log at path for appending and returns a
+// logger writing to it, along with the file to close when done. A log that
+// has grown past maxLogSize is rotated first. The log is checked once per
+// command, so a single run can take it a little over the cap.
+func OpenLog(path string) (*slog.Logger, io.Closer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, nil, err
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() >= maxLogSize {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// The log shows what was run on this machine, so keep it private
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return slog.New(slog.NewTextHandler(file, nil)), file, nil
+}
+
+// urlUserInfo matches the scheme and user info of URLs anywhere in a string
+var urlUserInfo = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/\s@]+@`)
+
+// RedactArgs returns args with credentials masked, so they can be logged:
+// the user info of URLs, such as a token in https://<token>@github.com, and
+// anything secret scanning recognizes as a credential
+func RedactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = redactArg(arg)
+	}
+	return redacted
+}
+
+// redactArg masks the credentials in a single argument or message
+func redactArg(arg string) string {
+	arg = urlUserInfo.ReplaceAllString(arg, "${1}***@")
+	for _, rule := range secretRules {
+		arg = rule.pattern.ReplaceAllStringFunc(arg, redactSecret)
+	}
+	return arg
+}
@@ -0,0 +1,102 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// findOverlaps returns managed entries that overlap with relPath. An entry
+// overlaps when it is a parent or child of relPath, or when a parent
+// directory of relPath in the home directory is itself a symlink into the
+// configs directory, which would make the file managed twice.
+func (m *Manager) findOverlaps(relPath string, managed []string) []string {
+	var overlaps []string
+	relPath = filepath.Clean(relPath)
+	sep := string(filepath.Separator)
+
+	for _, file := range managed {
+		if file == relPath {
+			continue
+		}
+		if strings.HasPrefix(relPath, file+sep) || strings.HasPrefix(file, relPath+sep) {
+			overlaps = append(overlaps, file)
+		}
+	}
+
+	overlaps = append(overlaps, m.linkedAncestors(relPath)...)
+	sort.Strings(overlaps)
+	return overlaps
+}
+
+// linkedAncestors returns the home-relative parent directories of relPath
+// that are symlinks into the configs directory
+func (m *Manager) linkedAncestors(relPath string) []string {
+	var linked []string
+	configsPrefix := m.config.ConfigsDir + string(filepath.Separator)
+
+	for dir := filepath.Dir(relPath); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		target, err := os.Readlink(filepath.Join(m.config.HomeDir, dir))
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(m.config.HomeDir, filepath.Dir(dir), target)
+		}
+		if target == m.config.ConfigsDir || strings.HasPrefix(target, configsPrefix) {
+			linked = append(linked, dir+string(filepath.Separator))
+		}
+	}
+
+	return linked
+}
+
+// maxLinkHops bounds how many symlinks linkCycle follows, like the kernel's
+// own limit on symlink resolution
+const maxLinkHops = 40
+
+// linkCycle checks the managed file source before it is linked to target.
+// A managed file that is itself a symlink is followed hop by hop; it fails
+// when the chain loops, or when it passes through target, which the new
+// link would turn into a loop. The error names every path in the chain.
+func linkCycle(source, target string) error {
+	info, err := os.Lstat(source)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+
+	chain := []string{source}
+	seen := map[string]bool{source: true}
+	for path := source; len(chain) <= maxLinkHops; {
+		next, err := resolveLink(path)
+		if err != nil {
+			break
+		}
+		chain = append(chain, next)
+		switch {
+		case next == target:
+			return fmt.Errorf("refusing to link: %s resolves to %s, so the link would form a cycle: %s",
+				source, target, strings.Join(append(chain, source), " -> "))
+		case seen[next]:
+			return fmt.Errorf("refusing to link: %s is part of a symlink cycle: %s", source, strings.Join(chain, " -> "))
+		}
+		seen[next] = true
+
+		if info, err := os.Lstat(next); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			break
+		}
+		path = next
+	}
+	if len(chain) > maxLinkHops {
+		return fmt.Errorf("refusing to link: %s goes through more than %d symlinks", source, maxLinkHops)
+	}
+
+	// Loops through symlinked parent directories are only caught by
+	// resolving the whole path
+	if _, err := filepath.EvalSymlinks(source); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("refusing to link: cannot resolve %s: %v", source, err)
+	}
+	return nil
+}
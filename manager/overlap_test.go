@@ -0,0 +1,79 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLinkRefusesSymlinkCycle(t *testing.T) {
+	m := newTestManager(t)
+
+	// Two managed files that are symlinks to each other
+	a := filepath.Join(m.config.ConfigsDir, ".a")
+	b := filepath.Join(m.config.ConfigsDir, ".b")
+	if err := os.Symlink(b, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := m.Link(context.Background(), LinkOptions{})
+	var linkErr *LinkError
+	if !errors.As(err, &linkErr) {
+		t.Fatalf("Link() error = %v, want a LinkError", err)
+	}
+	if len(linkErr.Failures) != 2 {
+		t.Fatalf("failures = %v, want one for each file in the cycle", linkErr.Failures)
+	}
+	for _, failure := range linkErr.Failures {
+		if !strings.Contains(failure.Err.Error(), "symlink cycle") {
+			t.Errorf("%s: error = %v, want a symlink cycle", failure.Path, failure.Err)
+		}
+	}
+	for _, name := range []string{".a", ".b"} {
+		if _, err := os.Lstat(filepath.Join(m.config.HomeDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was linked despite the cycle", name)
+		}
+	}
+}
+
+func TestLinkCycleThroughTarget(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "configs", ".vimrc")
+	target := filepath.Join(dir, "home", ".vimrc")
+	for _, path := range []string{source, target} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Linking target to a managed file that points back at target would
+	// make the link point at itself
+	if err := os.Symlink(target, source); err != nil {
+		t.Fatal(err)
+	}
+	err := linkCycle(source, target)
+	if err == nil || !strings.Contains(err.Error(), "would form a cycle") {
+		t.Errorf("linkCycle() = %v, want a cycle through the target", err)
+	}
+
+	// A chain that ends at a regular file is fine
+	plain := filepath.Join(dir, "plain")
+	if err := os.WriteFile(plain, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(source); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(plain, source); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkCycle(source, target); err != nil {
+		t.Errorf("linkCycle() = %v for a chain ending at a regular file", err)
+	}
+}
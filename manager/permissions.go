@@ -0,0 +1,129 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sensitiveModes holds stricter directory and file modes for well-known
+// private directories, keyed by their path relative to the home directory
+var sensitiveModes = map[string]struct {
+	dir  os.FileMode
+	file os.FileMode
+}{
+	".ssh":   {dir: 0700, file: 0600},
+	".gnupg": {dir: 0700, file: 0600},
+}
+
+// sensitiveRoot returns the sensitive directory containing relPath, if any
+func sensitiveRoot(relPath string) (string, bool) {
+	first := strings.SplitN(filepath.ToSlash(filepath.Clean(relPath)), "/", 2)[0]
+	if _, ok := sensitiveModes[first]; ok {
+		return first, true
+	}
+	return "", false
+}
+
+// dirModeFor returns the directory mode to use for a home-relative path
+func (m *Manager) dirModeFor(relPath string) os.FileMode {
+	if root, ok := sensitiveRoot(relPath); ok {
+		return sensitiveModes[root].dir
+	}
+	return m.config.DirMode
+}
+
+// fileModeFor returns the file mode to use for a home-relative path
+func (m *Manager) fileModeFor(relPath string) os.FileMode {
+	if root, ok := sensitiveRoot(relPath); ok {
+		return sensitiveModes[root].file
+	}
+	return m.config.FileMode
+}
+
+// homeRelPath returns the path relative to the home directory and whether
+// the path lies inside of it. A path under a configured root counts as
+// inside, with the root's name in place of the root directory.
+func (m *Manager) homeRelPath(path string) (string, bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path, false
+	}
+	relPath, err := filepath.Rel(m.config.HomeDir, absPath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		// Files under a configured root are managed like home files
+		if rootRel, ok := m.rootRelPath(absPath); ok {
+			return rootRel, true
+		}
+		return absPath, false
+	}
+	return relPath, true
+}
+
+// pruneEmptyDirs removes startFrom and then its parents while they are
+// empty directories below root, and returns the removed directories. It
+// stops at the first directory that still holds anything, such as other
+// managed files or user data, at directories kept with a keepMarker, and at
+// root, which is never removed.
+func (m *Manager) pruneEmptyDirs(root, startFrom string) []string {
+	root = filepath.Clean(root)
+	var removed []string
+	for dir := filepath.Clean(startFrom); dir != root && within(root, dir); dir = filepath.Dir(dir) {
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil || !info.IsDir() || m.keptDir(dir) {
+			break
+		}
+		// Remove only deletes empty directories
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+		removed = append(removed, dir)
+	}
+	return removed
+}
+
+// keptDir reports whether dir is a home directory kept empty on purpose
+// with a keepMarker in the configs directory
+func (m *Manager) keptDir(dir string) bool {
+	relPath, inHome := m.homeRelPath(dir)
+	if !inHome {
+		return false
+	}
+	_, err := os.Lstat(m.sourcePath(filepath.Join(relPath, keepMarker)))
+	return err == nil
+}
+
+// mkdirAll creates relDir below root one component at a time so that each
+// newly created directory gets the mode appropriate for its home-relative path
+func (m *Manager) mkdirAll(root, relDir string) error {
+	if err := os.MkdirAll(root, m.config.DirMode); err != nil {
+		return err
+	}
+
+	relDir = filepath.Clean(relDir)
+	if relDir == "." {
+		return nil
+	}
+
+	dir := root
+	partial := ""
+	for _, part := range strings.Split(relDir, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		partial = filepath.Join(partial, part)
+		mode := m.dirModeFor(partial)
+		if err := os.Mkdir(dir, mode); err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+			return err
+		}
+		// Mkdir is subject to the umask, so apply the mode explicitly
+		if err := os.Chmod(dir, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"cli-config-manager/config"
+)
+
+// ErrDiverged is returned by a fast-forward-only pull when local and remote
+// histories have diverged
+var ErrDiverged = newError(CodeDiverged, "local and remote histories have diverged and cannot be fast-forwarded. "+
+	"Run 'dotman update --rebase' to replay your local commits on top of the remote, "+
+	"or 'dotman update --merge' to merge them")
+
+// divergedMarkers are printed by git pull --ff-only when it cannot fast-forward
+var divergedMarkers = []string{
+	"Not possible to fast-forward",
+	"Diverging branches can't be fast-forwarded",
+}
+
+// pullStrategy returns strategy, or the configured pull_strategy when it is
+// empty
+func (m *Manager) pullStrategy(strategy string) (string, error) {
+	if strategy == "" {
+		strategy = m.config.Settings.PullStrategy
+	}
+
+	switch strategy {
+	case "", config.PullFFOnly:
+		return config.PullFFOnly, nil
+	case config.PullRebase, config.PullMerge:
+		return strategy, nil
+	}
+	return "", newError(CodeInvalidArgument, "invalid pull strategy %q: must be %q, %q or %q", strategy, config.PullFFOnly, config.PullRebase, config.PullMerge)
+}
+
+// pull pulls from the remote with the given strategy. The strategy is always
+// passed explicitly so the user's pull.rebase and pull.ff git settings
+// cannot turn an update into an unexpected merge.
+func (m *Manager) pull(ctx context.Context, strategy string) error {
+	strategy, err := m.pullStrategy(strategy)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"pull"}
+	switch strategy {
+	case config.PullFFOnly:
+		args = append(args, "--ff-only")
+	case config.PullRebase:
+		args = append(args, "--rebase")
+	case config.PullMerge:
+		args = append(args, "--no-rebase", "--no-edit")
+	}
+
+	output, err := m.gitCommand(ctx, args...).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if strategy == config.PullFFOnly {
+		for _, marker := range divergedMarkers {
+			if bytes.Contains(output, []byte(marker)) {
+				return ErrDiverged
+			}
+		}
+	}
+	return cancelled(ctx, fmt.Errorf("error pulling changes: %v\nOutput: %s", err, string(output)))
+}
@@ -0,0 +1,17 @@
+package manager
+
+import "fmt"
+
+// ErrReadOnly is returned by every operation that would modify the dotman
+// directory or the home directory while the config is in read-only mode
+var ErrReadOnly = newError(CodeReadOnly, "dotman is in read-only mode")
+
+// checkWritable returns an ErrReadOnly error naming op when the config is
+// read-only. Every exported method that modifies files or the repository
+// calls it before doing anything else.
+func (m *Manager) checkWritable(op string) error {
+	if m.config.ReadOnly {
+		return fmt.Errorf("%w: refusing to %s", ErrReadOnly, op)
+	}
+	return nil
+}
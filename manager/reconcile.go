@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"fmt"
+)
+
+// ReconcileChoice is what Reconcile does with a home file that diverged
+// from its managed file
+type ReconcileChoice string
+
+const (
+	// ReconcileKeepHome copies the home file over the managed file, commits
+	// it and replaces the home file with a link
+	ReconcileKeepHome ReconcileChoice = "keep-home"
+
+	// ReconcileKeepRepo replaces the home file with a link to the managed
+	// file. The home file is backed up first, as by Link.
+	ReconcileKeepRepo ReconcileChoice = "keep-repo"
+
+	// ReconcileSkip leaves both files alone
+	ReconcileSkip ReconcileChoice = "skip"
+)
+
+// ReconcileChoices lists the valid choices in the order they are offered
+var ReconcileChoices = []ReconcileChoice{ReconcileKeepHome, ReconcileKeepRepo, ReconcileSkip}
+
+// ReconcileOptions controls Reconcile
+type ReconcileOptions struct {
+	// Paths are the home directory paths of the managed files to reconcile.
+	// When empty, every managed file is considered.
+	Paths []string
+	// Choose is called for each home file that diverged from its managed
+	// file and decides what to do with it. Returning an error stops
+	// Reconcile with that error before anything is changed.
+	Choose func(change LocalChange) (ReconcileChoice, error)
+}
+
+// ReconcileResult reports what Reconcile did with one diverged file
+type ReconcileResult struct {
+	LocalChange
+	// Choice is what was done with the file
+	Choice ReconcileChoice `json:"choice"`
+	// BackupPath is where the home file was saved before it was replaced
+	// by the link, if it was
+	BackupPath string `json:"backup_path,omitempty"`
+}
+
+// Reconcile resolves managed files whose home path holds a real file with
+// other content, which is what is left after a conflict turned a link into
+// a separate copy. The diverged files are found as by LocalChanges, and
+// opts.Choose decides for each one whether the home or the repository
+// version is kept. Nothing is changed until every file has a choice; then
+// the kept home files are committed together and every file that was not
+// skipped is replaced by a link.
+func (m *Manager) Reconcile(opts ReconcileOptions) ([]ReconcileResult, error) {
+	if err := m.checkWritable("reconcile files"); err != nil {
+		return nil, err
+	}
+	if !m.isGitRepo() {
+		return nil, ErrNotGitRepo
+	}
+
+	changes, err := m.LocalChanges(opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ReconcileResult, 0, len(changes))
+	for _, change := range changes {
+		choice, err := opts.Choose(change)
+		if err != nil {
+			return nil, err
+		}
+		switch choice {
+		case ReconcileKeepHome, ReconcileKeepRepo, ReconcileSkip:
+		default:
+			return nil, newError(CodeInvalidArgument, "unknown reconcile choice %q for %s", choice, change.HomePath)
+		}
+		results = append(results, ReconcileResult{LocalChange: change, Choice: choice})
+	}
+
+	var sources []string
+	for _, result := range results {
+		if result.Choice != ReconcileKeepHome {
+			continue
+		}
+		m.logf("Keeping %s\n", result.HomePath)
+		if err := copyFile(result.HomePath, result.Source, m.fileModeFor(result.Path)); err != nil {
+			return results, fmt.Errorf("error copying %s: %v", result.HomePath, err)
+		}
+		sources = append(sources, result.Source)
+	}
+	if len(sources) > 0 {
+		if err := m.commitHomeCopies(sources, "Reconcile %s with the home directory", "Reconcile %d file(s) with the home directory"); err != nil {
+			return results, err
+		}
+	}
+
+	for i := range results {
+		if results[i].Choice == ReconcileSkip {
+			continue
+		}
+		link, err := m.linkFile(results[i].Source, LinkOptions{})
+		if err != nil {
+			return results, fmt.Errorf("error linking %s: %v", results[i].HomePath, err)
+		}
+		results[i].BackupPath = link.BackupPath
+	}
+	return results, nil
+}
@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"cli-config-manager/config"
+)
+
+// Reinit regenerates the dotman scaffolding: the expected directories, the
+// generated .gitignore and the layout version marker. Managed files and git
+// history are never touched. It returns a description of every fix made.
+func (m *Manager) Reinit() ([]string, error) {
+	if err := m.checkWritable("reinitialize the dotman directory"); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(m.config.DotmanDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s does not exist. Run 'dotman init' first", m.config.DotmanDir)
+	}
+
+	var fixed []string
+
+	// Recreate missing directories. backups/ is created on demand, so
+	// only the configs directory is required.
+	for _, dir := range []string{m.config.ConfigsDir} {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			continue
+		} else if err == nil {
+			return fixed, fmt.Errorf("%s exists but is not a directory; move it out of the way and run reinit again", dir)
+		}
+		if err := os.MkdirAll(dir, m.config.DirMode); err != nil {
+			return fixed, fmt.Errorf("error creating %s: %v", dir, err)
+		}
+		fixed = append(fixed, fmt.Sprintf("created missing directory %s", dir))
+	}
+
+	// Regenerate .gitignore, keeping a copy of a modified one
+	gitignorePath := filepath.Join(m.config.DotmanDir, ".gitignore")
+	content, err := os.ReadFile(gitignorePath)
+	switch {
+	case os.IsNotExist(err):
+		if err := os.WriteFile(gitignorePath, []byte(defaultGitignore), 0644); err != nil {
+			return fixed, fmt.Errorf("error creating .gitignore: %v", err)
+		}
+		fixed = append(fixed, "created missing .gitignore")
+	case err != nil:
+		return fixed, fmt.Errorf("error reading .gitignore: %v", err)
+	case string(content) != defaultGitignore:
+		backupPath := gitignorePath + ".bak"
+		if err := os.WriteFile(backupPath, content, 0644); err != nil {
+			return fixed, fmt.Errorf("error saving previous .gitignore: %v", err)
+		}
+		if err := os.WriteFile(gitignorePath, []byte(defaultGitignore), 0644); err != nil {
+			return fixed, fmt.Errorf("error writing .gitignore: %v", err)
+		}
+		fixed = append(fixed, fmt.Sprintf("regenerated .gitignore (previous version saved as %s)", backupPath))
+	}
+
+	// Restore the layout version marker. A missing marker means layout
+	// version 0, so run the migrations rather than just writing the file.
+	version, err := m.config.ReadLayoutVersion()
+	switch {
+	case err != nil:
+		if err := m.config.WriteLayoutVersion(); err != nil {
+			return fixed, fmt.Errorf("error writing layout version: %v", err)
+		}
+		fixed = append(fixed, fmt.Sprintf("replaced invalid layout version marker with version %d", config.LayoutVersion))
+	case version != config.LayoutVersion:
+		if err := m.config.Migrate(); err != nil {
+			return fixed, err
+		}
+		fixed = append(fixed, fmt.Sprintf("migrated layout from version %d to %d", version, config.LayoutVersion))
+	}
+
+	if !m.isGitRepo() {
+		m.logf("Note: %s is not a git repository; reinit does not create one. Use 'git init' or 'dotman init'\n", m.config.DotmanDir)
+	}
+
+	return fixed, nil
+}
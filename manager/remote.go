@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrNoRemote is returned when the dotman repository has no origin remote
+var ErrNoRemote = newError(CodeNoRemote, "no remote repository configured")
+
+// HasRemote reports whether commits are pushed: the repository has an
+// origin remote and is not marked local only
+func (m *Manager) HasRemote() bool {
+	return m.pushSkipReason() == ""
+}
+
+// pushSkipReason explains why changes are not pushed, or returns "" when
+// they are
+func (m *Manager) pushSkipReason() string {
+	if m.config.Settings.LocalOnly {
+		return fmt.Sprintf("the repository is local only (local_only is set in %s)", m.config.SettingsFile())
+	}
+	if err := m.git("remote", "get-url", "origin").Run(); err != nil {
+		return fmt.Sprintf("the repository has no remote; add one with 'git -C %s remote add origin <url>'", m.config.DotmanDir)
+	}
+	return ""
+}
+
+// RemoteWebURL returns the origin remote as an https URL that can be opened
+// in a browser. SSH remotes like git@github.com:user/repo.git are converted,
+// and credentials and the .git suffix are dropped.
+func (m *Manager) RemoteWebURL() (string, error) {
+	if !m.isGitRepo() {
+		return "", ErrNotGitRepo
+	}
+
+	output, err := m.git("remote", "get-url", "origin").Output()
+	if err != nil {
+		return "", ErrNoRemote
+	}
+
+	return webURL(strings.TrimSpace(string(output)))
+}
+
+// webURL converts a git remote URL to the https URL of its web page
+func webURL(remote string) (string, error) {
+	// scp-like SSH syntax: [user@]host:path
+	if !strings.Contains(remote, "://") {
+		hostPart, path, ok := strings.Cut(remote, ":")
+		if !ok {
+			return "", fmt.Errorf("cannot derive a web URL from remote %q", remote)
+		}
+		if i := strings.LastIndex(hostPart, "@"); i >= 0 {
+			hostPart = hostPart[i+1:]
+		}
+		remote = "https://" + hostPart + "/" + strings.TrimPrefix(path, "/")
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("cannot derive a web URL from remote %q", remote)
+	}
+
+	switch u.Scheme {
+	case "https", "http", "ssh", "git":
+	default:
+		return "", fmt.Errorf("cannot derive a web URL from remote %q", remote)
+	}
+
+	web := url.URL{
+		Scheme: "https",
+		Host:   u.Hostname(),
+		Path:   strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git"),
+	}
+	// SSH and git ports say nothing about the web server; http(s) ports do
+	if u.Scheme == "https" || u.Scheme == "http" {
+		web.Scheme = u.Scheme
+		web.Host = u.Host
+	}
+	return web.String(), nil
+}
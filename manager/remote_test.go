@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommitWithoutRemote(t *testing.T) {
+	m := newTestManager(t)
+	var log bytes.Buffer
+	m.log = &log
+
+	writeTestFile(t, m.sourcePath(".bashrc"), "alias ll='ls -l'\n")
+	if err := m.CommitAndPush(context.Background(), "edit bashrc"); err != nil {
+		t.Fatalf("CommitAndPush() in a repository without a remote = %v", err)
+	}
+	if subject := strings.TrimSpace(testGit(t, m, "log", "-1", "--format=%s")); subject != "edit bashrc" {
+		t.Errorf("last commit = %q, want the new commit", subject)
+	}
+	if !strings.Contains(log.String(), "Not pushing") {
+		t.Errorf("no message about the skipped push in %q", log.String())
+	}
+	if m.HasRemote() {
+		t.Error("HasRemote() = true without an origin remote")
+	}
+
+	if err := m.Push(); ErrorCodeOf(err) != CodeNoRemote {
+		t.Errorf("Push() error = %v, want %s", err, CodeNoRemote)
+	}
+}
+
+func TestCommitLocalOnlyWithOrigin(t *testing.T) {
+	m := newTestManager(t)
+	m.config.Settings.LocalOnly = true
+
+	// A remote alone does not make a local-only repository push
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	if output, err := exec.Command("git", "init", "-q", "--bare", origin).CombinedOutput(); err != nil {
+		t.Fatalf("git init --bare: %v\n%s", err, output)
+	}
+	testGit(t, m, "remote", "add", "origin", origin)
+
+	writeTestFile(t, m.sourcePath(".bashrc"), "alias ll='ls -l'\n")
+	if err := m.CommitAndPush(context.Background(), "edit bashrc"); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("git", "for-each-ref")
+	cmd.Dir = origin
+	if refs, err := cmd.Output(); err != nil || len(refs) != 0 {
+		t.Errorf("the local-only repository was pushed: %q, %v", refs, err)
+	}
+	if err := m.Push(); ErrorCodeOf(err) != CodeNoRemote {
+		t.Errorf("Push() error = %v, want %s", err, CodeNoRemote)
+	}
+}
+
+func TestCommitPushesToOrigin(t *testing.T) {
+	m := newTestManager(t)
+
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	if output, err := exec.Command("git", "init", "-q", "--bare", origin).CombinedOutput(); err != nil {
+		t.Fatalf("git init --bare: %v\n%s", err, output)
+	}
+	testGit(t, m, "remote", "add", "origin", origin)
+	testGit(t, m, "push", "-q", "-u", "origin", "main")
+
+	writeTestFile(t, m.sourcePath(".bashrc"), "alias ll='ls -l'\n")
+	if err := m.CommitAndPush(context.Background(), "edit bashrc"); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("git", "log", "-1", "--format=%s", "main")
+	cmd.Dir = origin
+	if subject, err := cmd.Output(); err != nil || strings.TrimSpace(string(subject)) != "edit bashrc" {
+		t.Errorf("origin's last commit = %q, %v; want the pushed commit", subject, err)
+	}
+}
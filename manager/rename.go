@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// renamedFileName is the index of real files that were renamed out of the
+// way when their path was added. Like the frozen index it is not committed,
+// since the renamed files only exist on this machine.
+const renamedFileName = "renamed.json"
+
+// renamedInfix is inserted between a renamed file's name and the time it
+// was renamed
+const renamedInfix = ".dotman-orig-"
+
+// RenamedOriginal is a real file that was renamed instead of replaced when
+// its path became managed
+type RenamedOriginal struct {
+	// Path is where the file was renamed to
+	Path      string    `json:"path"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// loadRenamed reads the renamed index, keyed by home-relative path. A
+// missing index is empty.
+func (m *Manager) loadRenamed() (map[string]RenamedOriginal, error) {
+	renamed := make(map[string]RenamedOriginal)
+	data, err := os.ReadFile(filepath.Join(m.config.DotmanDir, renamedFileName))
+	if os.IsNotExist(err) {
+		return renamed, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", renamedFileName, err)
+	}
+	if err := json.Unmarshal(data, &renamed); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", renamedFileName, err)
+	}
+	return renamed, nil
+}
+
+// saveRenamed writes the renamed index, removing it once it is empty
+func (m *Manager) saveRenamed(renamed map[string]RenamedOriginal) error {
+	path := filepath.Join(m.config.DotmanDir, renamedFileName)
+	if len(renamed) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %v", renamedFileName, err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(renamed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %v", renamedFileName, err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// renameOriginal moves a real file at absPath to <name>.dotman-orig-<time>
+// next to it and records the rename under relPath. Anything other than a
+// regular file is left alone and "" is returned.
+func (m *Manager) renameOriginal(absPath, relPath string) (string, error) {
+	info, err := os.Lstat(absPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", nil
+	}
+
+	renamed, err := m.loadRenamed()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	base := absPath + renamedInfix + now.Format("20060102-150405")
+	newPath := base
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(newPath); os.IsNotExist(err) {
+			break
+		}
+		newPath = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	if err := os.Rename(absPath, newPath); err != nil {
+		return "", err
+	}
+
+	renamed[relPath] = RenamedOriginal{Path: newPath, Timestamp: now}
+	if err := m.saveRenamed(renamed); err != nil {
+		return "", err
+	}
+	return newPath, nil
+}
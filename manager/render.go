@@ -0,0 +1,315 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DocRenderer renders generated documentation in a particular format.
+// RenderDoc is called concurrently for each managed file, then RenderIndex
+// is called once with all docs sorted by path.
+type DocRenderer interface {
+	// RenderDoc renders the documentation for a single file
+	RenderDoc(docsDir string, doc ConfigDoc) error
+	// RenderIndex renders the overview of all documented files
+	RenderIndex(docsDir string, docs []ConfigDoc) error
+}
+
+// DocFormats lists the supported documentation formats
+var DocFormats = []string{"markdown", "html", "json"}
+
+// NewDocRenderer returns the renderer for a documentation format
+func NewDocRenderer(format string) (DocRenderer, error) {
+	switch format {
+	case "", "markdown", "md":
+		return NewMarkdownRenderer(), nil
+	case "html":
+		return NewHTMLRenderer(), nil
+	case "json":
+		return NewJSONRenderer(), nil
+	default:
+		return nil, fmt.Errorf("unknown docs format %q (supported: %s)", format, strings.Join(DocFormats, ", "))
+	}
+}
+
+// dirCache creates directories at most once across concurrent doc writers
+type dirCache struct {
+	mu      sync.Mutex
+	created map[string]bool
+}
+
+// newDirCache creates an empty dirCache
+func newDirCache() *dirCache {
+	return &dirCache{created: make(map[string]bool)}
+}
+
+// ensure creates dir and its parents if they have not been created yet
+func (d *dirCache) ensure(dir string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.created[dir] {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	d.created[dir] = true
+	return nil
+}
+
+// markdownRenderer writes a Markdown page and a JSON metadata file per config
+type markdownRenderer struct {
+	dirs *dirCache
+}
+
+// NewMarkdownRenderer returns a renderer for Markdown documentation
+func NewMarkdownRenderer() DocRenderer {
+	return &markdownRenderer{dirs: newDirCache()}
+}
+
+// RenderDoc writes <doc path>.md and <doc path>.json
+func (r *markdownRenderer) RenderDoc(docsDir string, doc ConfigDoc) error {
+	if err := r.dirs.ensure(filepath.Dir(filepath.Join(docsDir, doc.DocPath))); err != nil {
+		return err
+	}
+
+	// Generate markdown documentation
+	if err := writeConfigDoc(filepath.Join(docsDir, doc.DocPath+".md"), doc); err != nil {
+		return err
+	}
+
+	// Save JSON metadata
+	return saveConfigMetadata(filepath.Join(docsDir, doc.DocPath+".json"), doc)
+}
+
+// RenderIndex writes the main README.md
+func (r *markdownRenderer) RenderIndex(docsDir string, docs []ConfigDoc) error {
+	readmePath := filepath.Join(docsDir, "README.md")
+
+	// Generate README content
+	var content strings.Builder
+	content.WriteString("# Dotman Configuration Documentation\n\n")
+	content.WriteString(fmt.Sprintf("Generated on: %s\n\n", time.Now().Format("2006-01-02 15:04:05")))
+
+	content.WriteString("## Managed Configuration Files\n\n")
+	for _, doc := range docs {
+		content.WriteString(fmt.Sprintf("- [%s](%s)\n", doc.Path, docHref(doc.DocPath, ".md")))
+	}
+
+	content.WriteString("\n## Quick Start\n\n")
+	content.WriteString("1. Clone this repository\n")
+	content.WriteString("2. Run `dotman link` to create symbolic links\n")
+	content.WriteString("3. Run `dotman check` to verify your configuration\n\n")
+
+	content.WriteString("## Maintenance\n\n")
+	content.WriteString("- Run `dotman check` regularly to monitor configuration health\n")
+	content.WriteString("- Use `dotman backup` before making significant changes\n")
+	content.WriteString("- Keep your configuration up to date with `dotman update`\n")
+
+	return os.WriteFile(readmePath, []byte(content.String()), 0644)
+}
+
+// docHref returns the relative URL of the page for docPath with extension
+// ext, escaping each path element
+func docHref(docPath, ext string) string {
+	parts := strings.Split(filepath.ToSlash(docPath+ext), "/")
+	for i, part := range parts {
+		// Parentheses are valid in URLs but end a Markdown link
+		parts[i] = strings.NewReplacer("(", "%28", ")", "%29").Replace(url.PathEscape(part))
+	}
+	return strings.Join(parts, "/")
+}
+
+// writeConfigDoc writes markdown documentation for a configuration file
+func writeConfigDoc(path string, doc ConfigDoc) error {
+	var content strings.Builder
+
+	content.WriteString(fmt.Sprintf("# %s\n\n", doc.Path))
+	content.WriteString(fmt.Sprintf("Last Updated: %s\n\n", doc.LastUpdated.Format("2006-01-02 15:04:05")))
+	content.WriteString(fmt.Sprintf("Mode: `%s`\n\n", doc.Mode))
+
+	if doc.Warning != "" {
+		content.WriteString(fmt.Sprintf("> **Warning:** %s\n\n", doc.Warning))
+	}
+
+	if len(doc.Tags) > 0 {
+		content.WriteString("## Tags\n\n")
+		for _, tag := range doc.Tags {
+			content.WriteString(fmt.Sprintf("- %s\n", tag))
+		}
+		content.WriteString("\n")
+	}
+
+	if len(doc.Dependencies) > 0 {
+		content.WriteString("## Dependencies\n\n")
+		for _, dep := range doc.Dependencies {
+			content.WriteString(fmt.Sprintf("- %s\n", dep))
+		}
+		content.WriteString("\n")
+	}
+
+	if doc.Description != "" {
+		content.WriteString("## Description\n\n")
+		content.WriteString(doc.Description + "\n\n")
+	}
+
+	if doc.Notes != "" {
+		content.WriteString("## Notes\n\n")
+		content.WriteString(doc.Notes + "\n\n")
+	}
+
+	return os.WriteFile(path, []byte(content.String()), 0644)
+}
+
+// saveConfigMetadata saves JSON metadata for a configuration file
+func saveConfigMetadata(path string, doc ConfigDoc) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// htmlStyle is the inline stylesheet shared by all generated HTML pages
+const htmlStyle = `body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",Helvetica,Arial,sans-serif;max-width:50em;margin:2em auto;padding:0 1em;color:#24292f;line-height:1.5}
+h1,h2{border-bottom:1px solid #d0d7de;padding-bottom:.3em}
+a{color:#0969da;text-decoration:none}
+a:hover{text-decoration:underline}
+code{background:#f6f8fa;padding:.2em .4em;border-radius:6px}
+.tag{display:inline-block;background:#ddf4ff;color:#0969da;border-radius:1em;padding:0 .6em;margin-right:.3em;font-size:.85em}
+.meta{color:#57606a}
+.warning{background:#fff8c5;border:1px solid #d4a72c;border-radius:6px;padding:.5em 1em}`
+
+// htmlRenderer writes self-contained HTML pages with an index
+type htmlRenderer struct {
+	dirs *dirCache
+}
+
+// NewHTMLRenderer returns a renderer for self-contained HTML documentation
+func NewHTMLRenderer() DocRenderer {
+	return &htmlRenderer{dirs: newDirCache()}
+}
+
+// RenderDoc writes <doc path>.html
+func (r *htmlRenderer) RenderDoc(docsDir string, doc ConfigDoc) error {
+	if err := r.dirs.ensure(filepath.Dir(filepath.Join(docsDir, doc.DocPath))); err != nil {
+		return err
+	}
+
+	// Link back to the index from nested pages
+	depth := strings.Count(filepath.ToSlash(doc.DocPath), "/")
+	indexHref := strings.Repeat("../", depth) + "index.html"
+
+	var body strings.Builder
+	body.WriteString(fmt.Sprintf("<p><a href=\"%s\">&larr; All configuration files</a></p>\n", html.EscapeString(indexHref)))
+	body.WriteString(fmt.Sprintf("<h1>%s</h1>\n", html.EscapeString(doc.Path)))
+	body.WriteString(fmt.Sprintf("<p class=\"meta\">Last Updated: %s &middot; Mode: <code>%s</code></p>\n", doc.LastUpdated.Format("2006-01-02 15:04:05"), html.EscapeString(doc.Mode)))
+
+	if doc.Warning != "" {
+		body.WriteString(fmt.Sprintf("<p class=\"warning\"><strong>Warning:</strong> %s</p>\n", html.EscapeString(doc.Warning)))
+	}
+
+	if len(doc.Tags) > 0 {
+		body.WriteString("<h2>Tags</h2>\n<p>")
+		for _, tag := range doc.Tags {
+			body.WriteString(fmt.Sprintf("<span class=\"tag\">%s</span>", html.EscapeString(tag)))
+		}
+		body.WriteString("</p>\n")
+	}
+
+	if len(doc.Dependencies) > 0 {
+		body.WriteString("<h2>Dependencies</h2>\n<ul>\n")
+		for _, dep := range doc.Dependencies {
+			body.WriteString(fmt.Sprintf("<li>%s</li>\n", html.EscapeString(dep)))
+		}
+		body.WriteString("</ul>\n")
+	}
+
+	if doc.Description != "" {
+		body.WriteString(fmt.Sprintf("<h2>Description</h2>\n<p>%s</p>\n", html.EscapeString(doc.Description)))
+	}
+
+	if doc.Notes != "" {
+		body.WriteString(fmt.Sprintf("<h2>Notes</h2>\n<p>%s</p>\n", html.EscapeString(doc.Notes)))
+	}
+
+	return writeHTMLPage(filepath.Join(docsDir, doc.DocPath+".html"), doc.Path, body.String())
+}
+
+// RenderIndex writes index.html
+func (r *htmlRenderer) RenderIndex(docsDir string, docs []ConfigDoc) error {
+	var body strings.Builder
+	body.WriteString("<h1>Dotman Configuration Documentation</h1>\n")
+	body.WriteString(fmt.Sprintf("<p class=\"meta\">Generated on: %s</p>\n", time.Now().Format("2006-01-02 15:04:05")))
+
+	body.WriteString("<h2>Managed Configuration Files</h2>\n<ul>\n")
+	for _, doc := range docs {
+		body.WriteString(fmt.Sprintf("<li><a href=\"%s\">%s</a>", html.EscapeString(docHref(doc.DocPath, ".html")), html.EscapeString(doc.Path)))
+		for _, tag := range doc.Tags {
+			body.WriteString(fmt.Sprintf(" <span class=\"tag\">%s</span>", html.EscapeString(tag)))
+		}
+		body.WriteString("</li>\n")
+	}
+	body.WriteString("</ul>\n")
+
+	body.WriteString("<h2>Quick Start</h2>\n<ol>\n")
+	body.WriteString("<li>Clone this repository</li>\n")
+	body.WriteString("<li>Run <code>dotman link</code> to create symbolic links</li>\n")
+	body.WriteString("<li>Run <code>dotman check</code> to verify your configuration</li>\n")
+	body.WriteString("</ol>\n")
+
+	return writeHTMLPage(filepath.Join(docsDir, "index.html"), "Dotman Configuration Documentation", body.String())
+}
+
+// writeHTMLPage wraps body in a complete HTML document with the inline stylesheet
+func writeHTMLPage(path, title, body string) error {
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n")
+	page.WriteString(fmt.Sprintf("<title>%s</title>\n", html.EscapeString(title)))
+	page.WriteString(fmt.Sprintf("<style>\n%s\n</style>\n", htmlStyle))
+	page.WriteString("</head>\n<body>\n")
+	page.WriteString(body)
+	page.WriteString("</body>\n</html>\n")
+
+	return os.WriteFile(path, []byte(page.String()), 0644)
+}
+
+// jsonRenderer writes a single aggregated index.json
+type jsonRenderer struct{}
+
+// NewJSONRenderer returns a renderer for a single aggregated JSON index
+func NewJSONRenderer() DocRenderer {
+	return jsonRenderer{}
+}
+
+// RenderDoc does nothing; all docs are written by RenderIndex
+func (jsonRenderer) RenderDoc(docsDir string, doc ConfigDoc) error {
+	return nil
+}
+
+// RenderIndex writes index.json containing every doc
+func (jsonRenderer) RenderIndex(docsDir string, docs []ConfigDoc) error {
+	index := struct {
+		GeneratedAt time.Time   `json:"generated_at"`
+		Files       []ConfigDoc `json:"files"`
+	}{
+		GeneratedAt: time.Now(),
+		Files:       docs,
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(docsDir, "index.json"), data, 0644)
+}
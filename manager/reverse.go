@@ -0,0 +1,170 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+)
+
+// ReverseImportOptions controls ReverseImport
+type ReverseImportOptions struct {
+	// Paths are the home directory paths of the managed files to import.
+	// When empty, every managed file is considered.
+	Paths []string
+	// DryRun only compares the files; nothing is copied, committed or
+	// linked
+	DryRun bool
+}
+
+// ReverseImportResult reports what ReverseImport did with one managed file
+type ReverseImportResult struct {
+	// Path is the path relative to the home directory
+	Path string
+	// HomePath is the file in the home directory
+	HomePath string
+	// Source is the managed file in the configs directory
+	Source string
+	// Imported is set when the home file differed from the managed file
+	// and replaced it, or would have with DryRun
+	Imported bool
+	// Reason explains why a file was not imported
+	Reason string
+	// BackupPath is where the home file was saved before it was replaced
+	// by the link, if it was
+	BackupPath string
+}
+
+// ReverseImport is the opposite of link for a home directory that is ahead
+// of the repository: every managed file whose home path holds a real file
+// with different content gets that content copied over the managed file.
+// The copies are committed together, and the home files are then replaced
+// by links as 'dotman link' would. Files that are linked, missing or
+// identical are reported with the reason and left alone.
+func (m *Manager) ReverseImport(opts ReverseImportOptions) ([]ReverseImportResult, error) {
+	if !opts.DryRun {
+		if err := m.checkWritable("reverse import files"); err != nil {
+			return nil, err
+		}
+		if !m.isGitRepo() {
+			return nil, ErrNotGitRepo
+		}
+	}
+
+	relPaths, err := m.managedRelPaths(opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ReverseImportResult, 0, len(relPaths))
+	var sources []string
+	for _, relPath := range relPaths {
+		result := ReverseImportResult{
+			Path:     relPath,
+			HomePath: m.targetPath(relPath),
+			Source:   m.sourcePath(relPath),
+		}
+		result.Reason = m.homeCopyReason(result.HomePath, result.Source)
+		result.Imported = result.Reason == ""
+		if result.Imported && !opts.DryRun {
+			m.logf("Importing %s\n", result.HomePath)
+			if err := copyFile(result.HomePath, result.Source, m.fileModeFor(relPath)); err != nil {
+				return results, fmt.Errorf("error importing %s: %v", result.HomePath, err)
+			}
+			sources = append(sources, result.Source)
+		}
+		results = append(results, result)
+	}
+
+	if len(sources) == 0 {
+		return results, nil
+	}
+	if err := m.commitHomeCopies(sources, "Import %s from the home directory", "Import %d file(s) from the home directory"); err != nil {
+		return results, err
+	}
+
+	for i := range results {
+		if !results[i].Imported {
+			continue
+		}
+		link, err := m.linkFile(results[i].Source, LinkOptions{})
+		if err != nil {
+			return results, fmt.Errorf("error linking %s: %v", results[i].HomePath, err)
+		}
+		results[i].BackupPath = link.BackupPath
+	}
+	return results, nil
+}
+
+// managedRelPaths returns the home-relative paths of the managed files
+// named by homePaths, or of every managed file when none are named. Paths
+// that are not managed are an error.
+func (m *Manager) managedRelPaths(homePaths []string) ([]string, error) {
+	if len(homePaths) == 0 {
+		return m.ListFiles()
+	}
+
+	relPaths := make([]string, 0, len(homePaths))
+	for _, homePath := range homePaths {
+		source, err := m.ResolveSource(homePath)
+		if err != nil {
+			return nil, err
+		}
+		relPaths = append(relPaths, source.Path)
+	}
+	return relPaths, nil
+}
+
+// homeCopyReason explains why the file at homePath is not a separate copy
+// of source with other content, or returns "" when it is: a real file in
+// the way of the link that ReverseImport would import and diff compares
+func (m *Manager) homeCopyReason(homePath, source string) string {
+	info, err := os.Lstat(homePath)
+	switch {
+	case os.IsNotExist(err):
+		return "missing from the home directory"
+	case err != nil:
+		return err.Error()
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := resolveLink(homePath)
+		if err != nil {
+			return err.Error()
+		}
+		if target != source {
+			return fmt.Sprintf("links to %s", target)
+		}
+		return "already linked"
+	case !info.Mode().IsRegular():
+		return "not a regular file"
+	}
+
+	same, err := sameContent(homePath, source)
+	if err != nil {
+		return err.Error()
+	}
+	if same {
+		return "identical to the managed file"
+	}
+	return ""
+}
+
+// commitHomeCopies commits the managed files that were overwritten with
+// their home files, in a single commit. The message is one with the
+// relative path for a single file, and many with the count otherwise.
+func (m *Manager) commitHomeCopies(sources []string, one, many string) error {
+	addCmd := m.git(append([]string{"add", "-f", "--"}, sources...)...)
+	if output, err := addCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error adding imported files to git: %v\nOutput: %s", err, string(output))
+	}
+
+	commitMsg := fmt.Sprintf(many, len(sources))
+	if len(sources) == 1 {
+		if relPath, err := m.homeRelFor(sources[0]); err == nil {
+			commitMsg = fmt.Sprintf(one, relPath)
+		}
+	}
+
+	commitCmd := m.git(append([]string{"commit", "-m", commitMsg, "--"}, sources...)...)
+	if output, err := commitCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error committing imported files: %v\nOutput: %s", err, string(output))
+	}
+	return nil
+}
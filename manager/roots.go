@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cli-config-manager/config"
+)
+
+// Files outside the home directory are managed through the roots setting,
+// which maps a directory such as /etc to a top-level directory of the
+// configs directory such as __etc__. Such a file is known everywhere by
+// its path below that name, so /etc/nixos/configuration.nix is the
+// "home-relative" path __etc__/nixos/configuration.nix and is stored like
+// any other file. targetPath maps it back to /etc when linking.
+
+// rootRelPath returns the path of absPath below the root that contains it,
+// prefixed with the root's name, using the innermost root when roots nest
+func (m *Manager) rootRelPath(absPath string) (string, bool) {
+	best := ""
+	for dir := range m.config.Settings.Roots {
+		rel, err := filepath.Rel(dir, absPath)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if len(dir) > len(best) {
+			best = dir
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	rel, _ := filepath.Rel(best, absPath)
+	return filepath.Join(m.config.Settings.Roots[best], rel), true
+}
+
+// rootDir returns the root directory relPath is stored under when its
+// first component names a root, and the rest of the path below it
+func (m *Manager) rootDir(relPath string) (string, string, bool) {
+	name, rest, found := strings.Cut(filepath.Clean(relPath), string(filepath.Separator))
+	if !found {
+		return "", "", false
+	}
+	for dir, rootName := range m.config.Settings.Roots {
+		if rootName == name {
+			return dir, rest, true
+		}
+	}
+	return "", "", false
+}
+
+// targetPath returns where the managed file relPath is linked: below its
+// root for files outside the home directory, otherwise in the home
+// directory
+func (m *Manager) targetPath(relPath string) string {
+	if dir, rest, ok := m.rootDir(relPath); ok {
+		return filepath.Join(dir, rest)
+	}
+	return filepath.Join(m.config.HomeDir, relPath)
+}
+
+// mkdirTargetParents creates the parent directories of the target of
+// relPath, with the modes mkdirAll picks inside the home directory
+func (m *Manager) mkdirTargetParents(relPath string) error {
+	if _, _, ok := m.rootDir(relPath); ok {
+		return os.MkdirAll(filepath.Dir(m.targetPath(relPath)), m.config.DirMode)
+	}
+	return m.mkdirAll(m.config.HomeDir, filepath.Dir(relPath))
+}
+
+// checkOutsideHome refuses to add or link relPath when it is stored under
+// a root and linking outside the home directory is not enabled, or under a
+// root that is not configured on this machine
+func (m *Manager) checkOutsideHome(relPath string) error {
+	dir, _, ok := m.rootDir(relPath)
+	if !ok {
+		name, _, _ := strings.Cut(filepath.Clean(relPath), string(filepath.Separator))
+		if config.IsRootName(name) {
+			return newError(CodeInvalidArgument, "%s is stored for the root %s, which is not configured in the roots setting of %s", relPath, name, m.config.SettingsFile())
+		}
+		return nil
+	}
+	if m.config.Settings.LinkOutsideHome {
+		return nil
+	}
+	return newError(CodeInvalidArgument, "%s is outside the home directory; set \"link_outside_home\": true in %s to manage files under %s",
+		m.targetPath(relPath), m.config.SettingsFile(), dir)
+}
+
+// rootPermissionHint explains a permission error placing the managed file
+// source under a root, where files usually belong to root
+func (m *Manager) rootPermissionHint(source string, err error) error {
+	if !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	relPath, relErr := m.homeRelFor(source)
+	if relErr != nil {
+		return err
+	}
+	if dir, _, ok := m.rootDir(relPath); ok {
+		return fmt.Errorf("%w (files under %s can usually only be changed as root; run dotman with sudo, keeping HOME, e.g. sudo --preserve-env=HOME dotman link)", err, dir)
+	}
+	return err
+}
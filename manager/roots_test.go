@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRootRoundTrip(t *testing.T) {
+	m := newTestManager(t)
+
+	// A directory outside the home directory stands in for /etc
+	root := t.TempDir()
+	m.config.Settings.Roots = map[string]string{root: "__etc__"}
+	path := filepath.Join(root, "nixos", "configuration.nix")
+	writeTestFile(t, path, "{ }\n")
+
+	if err := m.AddFile(path); ErrorCodeOf(err) != CodeInvalidArgument {
+		t.Fatalf("AddFile() without link_outside_home error = %v, want %s", err, CodeInvalidArgument)
+	}
+
+	m.config.Settings.LinkOutsideHome = true
+	if err := m.AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+	relPath := filepath.Join("__etc__", "nixos", "configuration.nix")
+	managed := m.sourcePath(relPath)
+	if got := readTestFile(t, managed); got != "{ }\n" {
+		t.Errorf("managed copy = %q", got)
+	}
+	if got, err := os.Readlink(path); err != nil || got != managed {
+		t.Errorf("%s links to %q, %v; want %s", path, got, err, managed)
+	}
+
+	// Link puts a removed link back under the root
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Link(context.Background(), LinkOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.Readlink(path); err != nil || got != managed {
+		t.Errorf("after link %s links to %q, %v; want %s", path, got, err, managed)
+	}
+
+	if err := m.RemoveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("%s is not a regular file after remove: %v", path, err)
+	}
+	if got := readTestFile(t, path); got != "{ }\n" {
+		t.Errorf("content after remove = %q", got)
+	}
+	if _, err := os.Stat(managed); !os.IsNotExist(err) {
+		t.Errorf("managed copy still exists after remove")
+	}
+}
+
+func TestLinkUnconfiguredRoot(t *testing.T) {
+	m := newTestManager(t)
+
+	// A file stored for a root this machine does not configure is not
+	// linked into the home directory
+	writeTestFile(t, m.sourcePath(filepath.Join("__etc__", "hosts")), "127.0.0.1 localhost\n")
+
+	_, err := m.Link(context.Background(), LinkOptions{})
+	var linkErr *LinkError
+	if !errors.As(err, &linkErr) || len(linkErr.Failures) != 1 {
+		t.Fatalf("Link() error = %v, want one failure", err)
+	}
+	if !strings.Contains(linkErr.Failures[0].Err.Error(), "not configured") {
+		t.Errorf("error = %v, want the root to be reported as not configured", linkErr.Failures[0].Err)
+	}
+	if _, err := os.Lstat(filepath.Join(m.config.HomeDir, "__etc__")); !os.IsNotExist(err) {
+		t.Errorf("the file was linked into the home directory")
+	}
+}
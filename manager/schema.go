@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SchemaNames are the JSON files dotman writes that Schema describes:
+// backup metadata.json files, saved health check results and the JSON
+// metadata written next to each generated doc
+var SchemaNames = []string{"backup", "health", "doc"}
+
+// schemaFiles describes the file each schema name validates
+var schemaFiles = map[string]struct {
+	title string
+	value interface{}
+	array bool
+}{
+	"backup": {"dotman backup metadata", BackupMetadata{}, false},
+	"health": {"dotman health check results", HealthCheckResult{}, true},
+	"doc":    {"dotman config documentation metadata", ConfigDoc{}, false},
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Schema returns the JSON Schema of the JSON file named by one of
+// SchemaNames. It is generated from the Go struct the file is written from,
+// so it always lists the current fields. Fields without omitempty are
+// required.
+func Schema(name string) ([]byte, error) {
+	file, ok := schemaFiles[name]
+	if !ok {
+		return nil, newError(CodeInvalidArgument, "unknown schema %q (expected %s)", name, strings.Join(SchemaNames, ", "))
+	}
+
+	schema := typeSchema(reflect.TypeOf(file.value))
+	if file.array {
+		schema = map[string]interface{}{"type": "array", "items": schema}
+	}
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = file.title
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema returns the schema of the JSON encoding of values of type t
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Implements(errorType):
+		// Errors are encoded as their message, see HealthCheckResult
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema returns the schema of a struct, with the fields of embedded
+// structs inlined as encoding/json does
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+				addFields(field.Type)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+
+			tag := strings.Split(field.Tag.Get("json"), ",")
+			name := tag[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			omitEmpty := false
+			for _, option := range tag[1:] {
+				omitEmpty = omitEmpty || option == "omitempty"
+			}
+
+			schema := typeSchema(field.Type)
+			// A nil slice or map without omitempty is encoded as null
+			if kind := field.Type.Kind(); !omitEmpty && (kind == reflect.Slice || kind == reflect.Map) {
+				schema["type"] = []string{fmt.Sprint(schema["type"]), "null"}
+			}
+			properties[name] = schema
+			if !omitEmpty {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
@@ -0,0 +1,171 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// validateSchema checks value, decoded from JSON, against the subset of JSON
+// Schema that Schema generates, including that every property of an object
+// is described. It returns one message per problem.
+func validateSchema(schema map[string]interface{}, value interface{}, path string) []string {
+	var problems []string
+
+	if types, ok := schemaTypes(schema["type"]); ok && !types[jsonType(value)] {
+		return []string{fmt.Sprintf("%s: %s is not of type %v", path, jsonType(value), schema["type"])}
+	}
+	if schema["format"] == "date-time" {
+		if _, err := time.Parse(time.RFC3339Nano, value.(string)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", path, err))
+		}
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := v[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required %s", path, name))
+			}
+		}
+		for name, field := range v {
+			switch {
+			case properties[name] != nil:
+				problems = append(problems, validateSchema(properties[name].(map[string]interface{}), field, path+"."+name)...)
+			case additional != nil:
+				problems = append(problems, validateSchema(additional, field, path+"."+name)...)
+			default:
+				problems = append(problems, fmt.Sprintf("%s: %s is not in the schema", path, name))
+			}
+		}
+	}
+	return problems
+}
+
+// schemaTypes returns the allowed types of a schema's type keyword
+func schemaTypes(keyword interface{}) (map[string]bool, bool) {
+	switch t := keyword.(type) {
+	case string:
+		return map[string]bool{t: true}, true
+	case []interface{}:
+		types := make(map[string]bool)
+		for _, name := range t {
+			types[name.(string)] = true
+		}
+		return types, true
+	}
+	return nil, false
+}
+
+// jsonType returns the JSON Schema type of a decoded JSON value
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// checkAgainstSchema validates the JSON file at path against the schema
+// called name
+func checkAgainstSchema(t *testing.T, name, path string) {
+	t.Helper()
+
+	data, err := Schema(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(readTestFile(t, path)), &value); err != nil {
+		t.Fatal(err)
+	}
+
+	problems := validateSchema(schema, value, "$")
+	sort.Strings(problems)
+	for _, problem := range problems {
+		t.Errorf("%s does not match the %s schema: %s", filepath.Base(path), name, problem)
+	}
+}
+
+func TestSchemasValidateWrittenFiles(t *testing.T) {
+	m := newTestManager(t)
+
+	path := filepath.Join(m.config.HomeDir, ".bashrc")
+	writeTestFile(t, path, "# Shell aliases\nalias ll='ls -l'\n")
+	if err := m.AddFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// A broken link gives the health check results with errors
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("backup", func(t *testing.T) {
+		backup, err := m.backupFile(m.sourcePath(".bashrc"), BackupOptions{Compress: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkAgainstSchema(t, "backup", filepath.Join(m.config.BackupsDir(), backup.ID, "metadata.json"))
+	})
+
+	t.Run("health", func(t *testing.T) {
+		m.HealthCheck()
+		files, err := filepath.Glob(filepath.Join(m.config.HealthDir(), "health-check-*.json"))
+		if err != nil || len(files) == 0 {
+			t.Fatalf("no saved health check results: %v", err)
+		}
+		checkAgainstSchema(t, "health", files[0])
+	})
+
+	t.Run("doc", func(t *testing.T) {
+		if err := m.GenerateDocs(); err != nil {
+			t.Fatal(err)
+		}
+		checkAgainstSchema(t, "doc", filepath.Join(m.config.DotmanDir, "docs", ".bashrc.json"))
+	})
+}
+
+func TestValidateSchemaReportsProblems(t *testing.T) {
+	data, err := Schema("backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	// The checks above only mean something if the validator finds problems
+	value := map[string]interface{}{"id": 1.0, "unknown": true}
+	if problems := validateSchema(schema, value, "$"); len(problems) < 3 {
+		t.Errorf("problems = %q, want a wrong type, missing fields and an unknown field", problems)
+	}
+}
@@ -0,0 +1,129 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// secretRule is a pattern for one kind of credential
+type secretRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// secretRules are the credentials that secret scanning looks for. They aim
+// at well-known token formats and explicit assignments, so they can miss
+// secrets but rarely flag ordinary configuration.
+var secretRules = []secretRule{
+	{"private key", regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY-----`)},
+	{"AWS access key ID", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"password or token assignment", regexp.MustCompile(`(?i)\b(?:password|passwd|secret|api_?key|access_?token|auth_?token)\s*[:=]\s*["']?[^\s"'$]{8,}`)},
+}
+
+// SecretFinding is a line in the git history that matches a secret rule
+type SecretFinding struct {
+	// Commit is the commit that added the line
+	Commit string `json:"commit"`
+	// Date is the author date of the commit, as YYYY-MM-DD
+	Date string `json:"date"`
+	// File is the path of the file relative to the dotman directory
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+	// Match is the matched text with all but its first characters masked
+	Match string `json:"match"`
+}
+
+// scanLine returns the secret rules that match line, each with its redacted match
+func scanLine(line string) [][2]string {
+	var matches [][2]string
+	for _, rule := range secretRules {
+		if match := rule.pattern.FindString(line); match != "" {
+			matches = append(matches, [2]string{rule.name, redactSecret(match)})
+		}
+	}
+	return matches
+}
+
+// redactSecret keeps the first characters of a match, enough to recognize
+// it, and masks the rest
+func redactSecret(match string) string {
+	const keep = 6
+	if len(match) <= keep {
+		return strings.Repeat("*", len(match))
+	}
+	return match[:keep] + strings.Repeat("*", 8)
+}
+
+// AuditSecrets scans every line ever added in the history of the dotman
+// repository, on all refs, for credentials. Each finding names the commit
+// that added the line. Removing a finding requires rewriting the history.
+func (m *Manager) AuditSecrets() ([]SecretFinding, error) {
+	if !m.isGitRepo() {
+		return nil, ErrNotGitRepo
+	}
+
+	// Each commit starts with a NUL byte, which cannot occur in diff lines
+	output, err := m.git("log", "--all", "-p", "-U0", "--no-color", "--no-ext-diff", "--format=%x00%H %as").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error reading history: %v", err)
+	}
+
+	var findings []SecretFinding
+	var commit, date, file string
+	lineNo := 0
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "\x00"):
+			commit, date, _ = strings.Cut(line[1:], " ")
+			file = ""
+		case strings.HasPrefix(line, "+++ "):
+			file = strings.TrimPrefix(strings.Trim(strings.TrimRight(line[4:], "\t"), `"`), "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+		case strings.HasPrefix(line, "@@ "):
+			lineNo = hunkStart(line)
+		case strings.HasPrefix(line, "+") && file != "":
+			for _, match := range scanLine(line[1:]) {
+				findings = append(findings, SecretFinding{
+					Commit: commit,
+					Date:   date,
+					File:   file,
+					Line:   lineNo,
+					Rule:   match[0],
+					Match:  match[1],
+				})
+			}
+			lineNo++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading history: %v", err)
+	}
+
+	return findings, nil
+}
+
+// hunkStart returns the first line number in the new file of a diff hunk
+// header like "@@ -1,2 +3,4 @@"
+func hunkStart(header string) int {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0
+	}
+	start, _, _ := strings.Cut(fields[2][1:], ",")
+	n, _ := strconv.Atoi(start)
+	return n
+}
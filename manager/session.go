@@ -0,0 +1,282 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// sessionsDirName is the directory in the backup store that holds backup
+// sessions, each in <id>/session.json. It is not a backup itself.
+const sessionsDirName = "sessions"
+
+// BackupSession groups backups that were taken together, so they can be
+// restored together
+type BackupSession struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Backups are the IDs of the backups in the session
+	Backups []string `json:"backups"`
+}
+
+// isBackupDir reports whether entry of the backup store holds a backup
+func isBackupDir(entry os.DirEntry) bool {
+	return entry.IsDir() && entry.Name() != sessionsDirName
+}
+
+// BackupFiles backs up every file in filePaths as one session. If any file
+// cannot be backed up, the backups already taken are removed again and no
+// session is recorded.
+func (m *Manager) BackupFiles(filePaths []string, opts BackupOptions) (BackupSession, error) {
+	if err := m.checkWritable("create backups"); err != nil {
+		return BackupSession{}, err
+	}
+
+	var ids []string
+	for _, filePath := range filePaths {
+		backup, err := m.backupFile(filePath, opts)
+		if err != nil {
+			for _, id := range ids {
+				os.RemoveAll(filepath.Join(m.config.BackupsDir(), id))
+			}
+			return BackupSession{}, fmt.Errorf("%s: %v", filePath, err)
+		}
+		ids = append(ids, backup.ID)
+	}
+
+	return m.saveSession(ids)
+}
+
+// saveSession records a session of the backups ids
+func (m *Manager) saveSession(ids []string) (BackupSession, error) {
+	sessionsDir := filepath.Join(m.config.BackupsDir(), sessionsDirName)
+	if err := os.MkdirAll(sessionsDir, 0755); err != nil {
+		return BackupSession{}, fmt.Errorf("failed to create sessions directory: %v", err)
+	}
+
+	session := BackupSession{
+		ID:        time.Now().Format("2006-01-02-150405"),
+		Timestamp: time.Now(),
+		Backups:   ids,
+	}
+
+	// Keep IDs unique when several sessions are recorded within a second
+	baseID := session.ID
+	sessionDir := filepath.Join(sessionsDir, session.ID)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(sessionDir); os.IsNotExist(err) {
+			break
+		}
+		session.ID = fmt.Sprintf("%s-%d", baseID, i)
+		sessionDir = filepath.Join(sessionsDir, session.ID)
+	}
+	if err := os.MkdirAll(sessionDir, 0755); err != nil {
+		return BackupSession{}, fmt.Errorf("failed to create session directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return BackupSession{}, fmt.Errorf("failed to marshal session: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sessionDir, "session.json"), data, 0644); err != nil {
+		return BackupSession{}, fmt.Errorf("failed to save session: %v", err)
+	}
+	return session, nil
+}
+
+// ListSessions returns the backup sessions, oldest first
+func (m *Manager) ListSessions() ([]BackupSession, error) {
+	sessionsDir := filepath.Join(m.config.BackupsDir(), sessionsDirName)
+	entries, err := os.ReadDir(sessionsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sessions directory: %v", err)
+	}
+
+	var sessions []BackupSession
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		session, err := m.loadSession(entry.Name())
+		if err != nil {
+			continue // Skip sessions with missing or invalid metadata
+		}
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Timestamp.Equal(sessions[j].Timestamp) {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].Timestamp.Before(sessions[j].Timestamp)
+	})
+	return sessions, nil
+}
+
+// loadSession reads the session sessionID
+func (m *Manager) loadSession(sessionID string) (BackupSession, error) {
+	path := filepath.Join(m.config.BackupsDir(), sessionsDirName, sessionID, "session.json")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return BackupSession{}, newError(CodeNotFound, "backup session %s does not exist", sessionID)
+	}
+	if err != nil {
+		return BackupSession{}, fmt.Errorf("failed to read session: %v", err)
+	}
+
+	var session BackupSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return BackupSession{}, fmt.Errorf("failed to parse session %s: %v", sessionID, err)
+	}
+	return session, nil
+}
+
+// PlanRestoreSession works out what RestoreSession would do for every backup
+// in the session without changing anything
+func (m *Manager) PlanRestoreSession(sessionID string, opts RestoreOptions) ([]RestorePlan, error) {
+	session, err := m.loadSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make([]RestorePlan, 0, len(session.Backups))
+	for _, backupID := range session.Backups {
+		plan, err := m.PlanRestore(backupID, opts)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+// RestoreSession restores every backup in the session sessionID. All backups
+// are read, verified and decrypted before anything is written, and if
+// writing one fails, the files already restored are put back the way they
+// were, so the session is restored completely or not at all. Parent
+// directories created along the way are left in place.
+func (m *Manager) RestoreSession(sessionID string, opts RestoreOptions) error {
+	if err := m.checkWritable("restore backups"); err != nil {
+		return err
+	}
+
+	session, err := m.loadSession(sessionID)
+	if err != nil {
+		return err
+	}
+
+	// Read everything first, so a corrupted or undecryptable backup stops
+	// the restore before any file is touched
+	plans := make([]RestorePlan, len(session.Backups))
+	contents := make([][]byte, len(session.Backups))
+	for i, backupID := range session.Backups {
+		plan, stored, err := m.planRestore(backupID, opts)
+		if err != nil {
+			return err
+		}
+		content, err := m.backupContent(plan.Backup, stored)
+		if err != nil {
+			return err
+		}
+		if err := m.checkNewer(plan, content, opts); err != nil {
+			return err
+		}
+		plans[i], contents[i] = plan, content
+	}
+
+	var snapshots []pathSnapshot
+	for i, plan := range plans {
+		for _, path := range []string{plan.WriteTarget, plan.Destination} {
+			snapshot, err := takeSnapshot(path)
+			if err != nil {
+				if rerr := rollback(snapshots); rerr != nil {
+					return fmt.Errorf("cannot restore session %s: %v; rolling back also failed: %v", sessionID, err, rerr)
+				}
+				return fmt.Errorf("cannot restore session %s: %v", sessionID, err)
+			}
+			snapshots = append(snapshots, snapshot)
+		}
+
+		if err := m.applyRestore(plan, contents[i]); err != nil {
+			if rerr := rollback(snapshots); rerr != nil {
+				return fmt.Errorf("restoring %s failed: %v; rolling back also failed: %v", plan.Destination, err, rerr)
+			}
+			return fmt.Errorf("restoring %s failed, restored files were rolled back: %v", plan.Destination, err)
+		}
+	}
+
+	if opts.AuthorDate {
+		for _, plan := range plans {
+			relPath, inHome := m.homeRelPath(plan.Destination)
+			if err := m.commitRestored(plan.Backup, relPath, inHome); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pathSnapshot is what was at a path before a session restore changed it
+type pathSnapshot struct {
+	path    string
+	exists  bool
+	link    string
+	content []byte
+	mode    os.FileMode
+}
+
+// takeSnapshot records what is at path: nothing, a symlink or a file
+func takeSnapshot(path string) (pathSnapshot, error) {
+	snapshot := pathSnapshot{path: path}
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return snapshot, err
+	}
+
+	snapshot.exists = true
+	snapshot.mode = info.Mode().Perm()
+	if info.Mode()&os.ModeSymlink != 0 {
+		snapshot.link, err = os.Readlink(path)
+		return snapshot, err
+	}
+	snapshot.content, err = os.ReadFile(path)
+	return snapshot, err
+}
+
+// rollback puts snapshots back, newest first, and returns the first error
+func rollback(snapshots []pathSnapshot) error {
+	var first error
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if err := snapshots[i].restore(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// restore puts the path back the way it was when the snapshot was taken
+func (s pathSnapshot) restore() error {
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	switch {
+	case !s.exists:
+		return nil
+	case s.link != "":
+		return os.Symlink(s.link, s.path)
+	}
+	if err := os.WriteFile(s.path, s.content, s.mode); err != nil {
+		return err
+	}
+	return os.Chmod(s.path, s.mode)
+}
@@ -0,0 +1,43 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"cli-config-manager/config"
+)
+
+// ErrFileTooLarge is returned by AddFile for files above the configured
+// max_file_size. Use AddFileWith with Force set to add them anyway.
+var ErrFileTooLarge = newError(CodeFileTooLarge, "file exceeds the maximum file size")
+
+// binarySniffLen is how much of a file is inspected to guess whether it is binary
+const binarySniffLen = 8000
+
+// checkFileSize returns an ErrFileTooLarge error when size is above the limit
+func (m *Manager) checkFileSize(path string, size int64) error {
+	if m.config.MaxFileSize <= 0 || size <= m.config.MaxFileSize {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is %s, limit is %s (use --force to add it anyway, or raise max_file_size)",
+		ErrFileTooLarge, path, config.FormatSize(size), config.FormatSize(m.config.MaxFileSize))
+}
+
+// isLikelyBinary reports whether the file looks binary, using the same
+// heuristic as git: a NUL byte near the start of the file
+func isLikelyBinary(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	buf := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0
+}
@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+)
+
+// LinkState classifies the home directory entry of a managed file
+type LinkState string
+
+const (
+	// StateLinked means the home path is a symlink to the managed file
+	StateLinked LinkState = "linked"
+
+	// StateMissing means nothing exists at the home path
+	StateMissing LinkState = "missing"
+
+	// StateConflict means the home path is a real file or a symlink to
+	// somewhere other than the managed file
+	StateConflict LinkState = "conflict"
+
+	// StateFrozen means the file was disabled with Freeze and its link
+	// renamed to <name>.disabled
+	StateFrozen LinkState = "frozen"
+
+	// StateUnavailable means nothing exists at the home path because a
+	// program the file requires in links.json is not installed
+	StateUnavailable LinkState = "unavailable"
+)
+
+// FileStatus describes the link state of one managed file
+type FileStatus struct {
+	// Path is the path relative to the configs directory
+	Path string `json:"path"`
+	// HomePath is where the file is linked in the home directory
+	HomePath string `json:"home_path"`
+	// State classifies the home path
+	State LinkState `json:"state"`
+	// Detail explains a conflict
+	Detail string `json:"detail,omitempty"`
+	// Note is the note attached with 'dotman note set', if any
+	Note string `json:"note,omitempty"`
+}
+
+// FileStatuses classifies the home directory entry of every managed file
+func (m *Manager) FileStatuses() ([]FileStatus, error) {
+	statuses, unreadable, err := m.fileStatuses()
+	if err == nil && len(unreadable) > 0 {
+		err = unreadable[0]
+	}
+	return statuses, err
+}
+
+// fileStatuses classifies every managed file that could be read and returns
+// the errors for paths in the configs directory that could not
+func (m *Manager) fileStatuses() ([]FileStatus, []error, error) {
+	files, unreadable, err := m.listFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	statuses := make([]FileStatus, 0, len(files))
+	for _, file := range files {
+		statuses = append(statuses, m.fileStatus(file))
+	}
+	return statuses, unreadable, nil
+}
+
+// fileStatus classifies the home directory entry of the managed file relPath
+func (m *Manager) fileStatus(relPath string) FileStatus {
+	status := FileStatus{
+		Path:     relPath,
+		HomePath: m.targetPath(relPath),
+		Note:     m.noteFor(relPath),
+	}
+
+	info, err := os.Lstat(status.HomePath)
+	switch {
+	case os.IsNotExist(err) && m.isFrozen(relPath):
+		status.State = StateFrozen
+	case os.IsNotExist(err):
+		status.State = StateMissing
+		if reason := m.unavailableReason(relPath); reason != "" {
+			status.State = StateUnavailable
+			status.Detail = reason
+		}
+	case err != nil:
+		status.State = StateConflict
+		status.Detail = err.Error()
+	case info.Mode()&os.ModeSymlink == 0:
+		status.State = StateConflict
+		status.Detail = "real file in the way"
+	default:
+		target, err := resolveLink(status.HomePath)
+		if err == nil && target == m.sourcePath(relPath) {
+			status.State = StateLinked
+		} else {
+			status.State = StateConflict
+			status.Detail = fmt.Sprintf("links to %s", target)
+		}
+	}
+
+	return status
+}
+
+// filterStatuses returns the relative paths of the statuses in the given state
+func filterStatuses(statuses []FileStatus, state LinkState) []string {
+	var paths []string
+	for _, status := range statuses {
+		if status.State == state {
+			paths = append(paths, status.Path)
+		}
+	}
+	return paths
+}
+
+// SourceInfo describes which managed file backs a path in the home directory
+type SourceInfo struct {
+	FileStatus
+	// Source is the managed file in the configs directory
+	Source string `json:"source"`
+}
+
+// ResolveSource reports the managed file that provides homePath and the
+// state of its link. Paths that are not managed return an error.
+func (m *Manager) ResolveSource(homePath string) (SourceInfo, error) {
+	relPath, inHome := m.homeRelPath(m.config.ExpandHome(homePath))
+	if !inHome {
+		return SourceInfo{}, newError(CodeInvalidArgument, "%s is not inside the home directory", homePath)
+	}
+
+	source := m.sourcePath(relPath)
+	if info, err := os.Stat(source); err != nil || info.IsDir() {
+		return SourceInfo{}, newError(CodeNotManaged, "%s is not managed by dotman", homePath)
+	}
+
+	return SourceInfo{
+		FileStatus: m.fileStatus(relPath),
+		Source:     source,
+	}, nil
+}
@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AddSubmodule registers a git submodule at the given path inside the configs directory
+func (m *Manager) AddSubmodule(repoURL, configsPath string) error {
+	if err := m.checkWritable("add submodules"); err != nil {
+		return err
+	}
+
+	// Check if we're in a git repository
+	if !m.isGitRepo() {
+		return ErrNotGitRepo
+	}
+
+	// Resolve the submodule path relative to the configs directory
+	cleanPath := filepath.Clean(configsPath)
+	if filepath.IsAbs(cleanPath) || cleanPath == "." || strings.HasPrefix(cleanPath, "..") {
+		return fmt.Errorf("submodule path must be relative to the configs directory: %s", configsPath)
+	}
+
+	targetPath := filepath.Join(m.config.ConfigsDir, cleanPath)
+	if _, err := os.Stat(targetPath); err == nil {
+		return fmt.Errorf("path already exists in configs directory: %s", cleanPath)
+	}
+
+	// Create parent directories for the submodule
+	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		return fmt.Errorf("error creating parent directories: %v", err)
+	}
+
+	// Path as seen from the repository root
+	repoPath, err := filepath.Rel(m.config.DotmanDir, targetPath)
+	if err != nil {
+		return fmt.Errorf("error getting relative path: %v", err)
+	}
+
+	m.logf("Adding submodule: %s -> %s\n", repoURL, repoPath)
+	addCmd := m.git("submodule", "add", repoURL, repoPath)
+	if output, err := addCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error adding submodule: %v\nOutput: %s", err, string(output))
+	}
+
+	// .gitmodules is ignored by the generated .gitignore, so force it in
+	stageCmd := m.git("add", "-f", ".gitmodules", repoPath)
+	if output, err := stageCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error staging submodule: %v\nOutput: %s", err, string(output))
+	}
+
+	commitMsg := fmt.Sprintf("Add submodule %s", cleanPath)
+	commitCmd := m.git("commit", "-m", commitMsg)
+	if output, err := commitCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error committing submodule: %v\nOutput: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// UpdateSubmodules initializes and updates all submodules recursively
+func (m *Manager) UpdateSubmodules(ctx context.Context) error {
+	if err := m.checkWritable("update submodules"); err != nil {
+		return err
+	}
+
+	// Nothing to do without a .gitmodules file
+	if _, err := os.Stat(filepath.Join(m.config.DotmanDir, ".gitmodules")); os.IsNotExist(err) {
+		return nil
+	}
+
+	updateCmd := m.gitCommand(ctx, "submodule", "update", "--init", "--recursive")
+	if output, err := updateCmd.CombinedOutput(); err != nil {
+		return cancelled(ctx, fmt.Errorf("error updating submodules: %v\nOutput: %s", err, string(output)))
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Suggestion is an unmanaged dotfile that could be added to dotman
+type Suggestion struct {
+	// Path is the absolute path of the file
+	Path string
+	// RelPath is the path relative to the home directory
+	RelPath string
+	// Tags are the detected configuration tags
+	Tags []string
+}
+
+// Suggest scans common dotfile locations for files that are not yet managed.
+// It looks at ~/.*rc files and files directly inside ~/.config/<app>/, skipping
+// anything matched by .dotmanignore. It never modifies the filesystem.
+func (m *Manager) Suggest() ([]Suggestion, error) {
+	ignore, err := m.loadIgnoreMatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []string
+
+	// ~/.*rc files
+	rcFiles, err := filepath.Glob(filepath.Join(m.config.HomeDir, ".*rc"))
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, rcFiles...)
+
+	// ~/.config/* files and the files of each application directory
+	configEntries, err := filepath.Glob(filepath.Join(m.config.HomeDir, ".config", "*"))
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, configEntries...)
+	appFiles, err := filepath.Glob(filepath.Join(m.config.HomeDir, ".config", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, appFiles...)
+
+	var suggestions []Suggestion
+	for _, path := range candidates {
+		relPath, err := filepath.Rel(m.config.HomeDir, path)
+		if err != nil {
+			continue
+		}
+
+		if ignore.Match(relPath) || !m.isUnmanagedFile(path, relPath) {
+			continue
+		}
+
+		suggestions = append(suggestions, Suggestion{
+			Path:    path,
+			RelPath: relPath,
+			Tags:    m.detectConfigTags(path),
+		})
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		return suggestions[i].RelPath < suggestions[j].RelPath
+	})
+
+	return suggestions, nil
+}
+
+// isUnmanagedFile reports whether path is a regular file that is neither
+// present in the configs directory nor a symlink into it
+func (m *Manager) isUnmanagedFile(path, relPath string) bool {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	if _, err := os.Stat(m.sourcePath(relPath)); err == nil {
+		return false
+	}
+
+	// Files inside a directory that links into the configs directory are managed too
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		if strings.HasPrefix(resolved, m.config.ConfigsDir+string(filepath.Separator)) {
+			return false
+		}
+	}
+
+	return true
+}
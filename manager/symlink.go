@@ -0,0 +1,149 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cli-config-manager/config"
+)
+
+// relativeLinks reports whether symlinks are created relative to their location
+func (m *Manager) relativeLinks() bool {
+	return m.config.Settings.SymlinkStyle == config.SymlinkRelative
+}
+
+// symlinkTarget returns what a symlink at linkPath should contain to point at
+// source, following the configured symlink style
+func (m *Manager) symlinkTarget(source, linkPath string) string {
+	if !m.relativeLinks() {
+		return source
+	}
+	rel, err := filepath.Rel(filepath.Dir(linkPath), source)
+	if err != nil {
+		return source
+	}
+	return rel
+}
+
+// resolveLink returns the cleaned absolute path the symlink at linkPath points to
+func resolveLink(linkPath string) (string, error) {
+	target, err := os.Readlink(linkPath)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(linkPath), target)
+	}
+	return filepath.Clean(target), nil
+}
+
+// managedLinks returns the home symlinks that point at their managed file,
+// keyed by home path with the raw link contents as value
+func (m *Manager) managedLinks() (map[string]string, error) {
+	links, unreadable, err := m.readableManagedLinks()
+	if err == nil && len(unreadable) > 0 {
+		err = unreadable[0]
+	}
+	return links, err
+}
+
+// readableManagedLinks is managedLinks for the managed files that could be
+// read, along with the errors for paths that could not
+func (m *Manager) readableManagedLinks() (map[string]string, []error, error) {
+	files, unreadable, err := m.listFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	links := make(map[string]string)
+	for _, file := range files {
+		homePath := m.targetPath(file)
+		resolved, err := resolveLink(homePath)
+		if err != nil || resolved != m.sourcePath(file) {
+			continue
+		}
+		raw, _ := os.Readlink(homePath)
+		links[homePath] = raw
+	}
+	return links, unreadable, nil
+}
+
+// Relink rewrites home symlinks that point into the configs directory so they
+// all use the configured symlink style, and returns the rewritten link paths.
+// Links that point elsewhere are never touched.
+func (m *Manager) Relink() ([]string, error) {
+	if err := m.checkWritable("relink files"); err != nil {
+		return nil, err
+	}
+
+	links, err := m.managedLinks()
+	if err != nil {
+		return nil, fmt.Errorf("error listing managed links: %v", err)
+	}
+
+	var relinked []string
+	for homePath, raw := range links {
+		if filepath.IsAbs(raw) != m.relativeLinks() {
+			continue
+		}
+
+		source, _ := resolveLink(homePath)
+		if err := os.Remove(homePath); err != nil {
+			return relinked, fmt.Errorf("error removing %s: %v", homePath, err)
+		}
+		if err := os.Symlink(m.symlinkTarget(source, homePath), homePath); err != nil {
+			return relinked, fmt.Errorf("error relinking %s: %v", homePath, err)
+		}
+		relinked = append(relinked, homePath)
+	}
+
+	sort.Strings(relinked)
+	return relinked, nil
+}
+
+// checkSymlinkStyle checks that managed links use the configured symlink style
+func (m *Manager) checkSymlinkStyle() HealthCheckResult {
+	style := config.SymlinkAbsolute
+	if m.relativeLinks() {
+		style = config.SymlinkRelative
+	}
+
+	links, unreadable, err := m.readableManagedLinks()
+	if err != nil {
+		return HealthCheckResult{
+			Status:    "Symlink Style",
+			Message:   fmt.Sprintf("Error listing managed links: %v", err),
+			Error:     err,
+			Timestamp: time.Now(),
+			Severity:  "error",
+		}
+	}
+
+	var mismatched []string
+	for homePath, raw := range links {
+		if filepath.IsAbs(raw) == m.relativeLinks() {
+			mismatched = append(mismatched, homePath)
+		}
+	}
+
+	if len(mismatched) > 0 {
+		sort.Strings(mismatched)
+		return withUnreadable(HealthCheckResult{
+			Status:    "Symlink Style",
+			Message:   fmt.Sprintf("Found %d links that are not %s; run 'dotman relink' to fix: %s", len(mismatched), style, strings.Join(mismatched, ", ")),
+			Timestamp: time.Now(),
+			Severity:  "warning",
+		}, unreadable)
+	}
+
+	return withUnreadable(HealthCheckResult{
+		Status:    "Symlink Style",
+		Message:   fmt.Sprintf("All managed links are %s", style),
+		Timestamp: time.Now(),
+		Severity:  "info",
+	}, unreadable)
+}
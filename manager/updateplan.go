@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// UpdatePlan previews what UpdateWith would change, see PlanUpdate
+type UpdatePlan struct {
+	// Changes are the incoming changes to managed files
+	Changes []FileChange `json:"changes"`
+	// Links are the links relinking would create or replace. Files that
+	// are already linked are not listed.
+	Links []PlannedLink `json:"links,omitempty"`
+	// Pruned are the home paths of the links Prune would remove
+	Pruned []string `json:"pruned,omitempty"`
+	// Dangling are the home paths of links to deleted files that are left
+	// behind because Prune is not set
+	Dangling []string `json:"dangling,omitempty"`
+}
+
+// PlannedLink is a link relinking would create or replace
+type PlannedLink struct {
+	// Path is the path relative to the home directory
+	Path string `json:"path"`
+	// HomePath is where the link would be created
+	HomePath string `json:"home_path"`
+	// Source is the managed file the link would point at
+	Source string `json:"source"`
+	// Replaces describes what is at HomePath now, or is empty when
+	// nothing is
+	Replaces string `json:"replaces,omitempty"`
+}
+
+// PlanUpdate fetches the remote like RemoteDiff and reports what UpdateWith
+// with opts would do, without pulling or touching the home directory: the
+// incoming changes, the links relinking would create or replace and the
+// links left to files the pull deletes. opts.Strategy is not checked; a pull
+// that cannot fast-forward still fails only when updating.
+func (m *Manager) PlanUpdate(opts UpdateOptions) (UpdatePlan, error) {
+	var plan UpdatePlan
+
+	changes, err := m.RemoteDiff()
+	if err != nil {
+		return plan, err
+	}
+	plan.Changes = changes
+
+	files, err := m.ListFiles()
+	if err != nil {
+		return plan, fmt.Errorf("error listing managed files: %v", err)
+	}
+
+	// The managed files after the pull, by home-relative path
+	managed := make(map[string]bool, len(files))
+	for _, relPath := range files {
+		managed[relPath] = true
+	}
+	var deleted []string
+	for _, change := range changes {
+		switch change.Status {
+		case "D":
+			if relPath, ok := m.changeHomeRel(change.Path); ok {
+				delete(managed, relPath)
+				deleted = append(deleted, relPath)
+			}
+		case "R":
+			if relPath, ok := m.changeHomeRel(change.OldPath); ok {
+				delete(managed, relPath)
+				deleted = append(deleted, relPath)
+			}
+			fallthrough
+		default:
+			if relPath, ok := m.changeHomeRel(change.Path); ok {
+				managed[relPath] = true
+			}
+		}
+	}
+
+	if !opts.NoRelink {
+		paths := make([]string, 0, len(managed))
+		for relPath := range managed {
+			paths = append(paths, relPath)
+		}
+		sort.Strings(paths)
+
+		for _, relPath := range paths {
+			if link, ok := m.plannedLink(relPath); ok {
+				plan.Links = append(plan.Links, link)
+			}
+		}
+	}
+
+	// A link to a deleted file dangles once the pull removed the file
+	for _, relPath := range deleted {
+		homePath := m.targetPath(relPath)
+		target, err := resolveLink(homePath)
+		if err != nil || target != m.sourcePath(relPath) {
+			continue
+		}
+		if opts.Prune {
+			plan.Pruned = append(plan.Pruned, homePath)
+		} else {
+			plan.Dangling = append(plan.Dangling, homePath)
+		}
+	}
+
+	return plan, nil
+}
+
+// changeHomeRel returns the home-relative path of a path from a FileChange,
+// which is relative to the configs directory
+func (m *Manager) changeHomeRel(path string) (string, bool) {
+	relPath, err := m.homeRelFor(filepath.Join(m.config.ConfigsDir, filepath.FromSlash(path)))
+	return relPath, err == nil
+}
+
+// plannedLink classifies the home path of relPath like fileStatus and
+// returns the link Link would create there, or false when the file is
+// already linked or Link would skip it
+func (m *Manager) plannedLink(relPath string) (PlannedLink, bool) {
+	link := PlannedLink{
+		Path:     relPath,
+		HomePath: m.targetPath(relPath),
+		Source:   m.sourcePath(relPath),
+	}
+
+	if m.isFrozen(relPath) || m.unavailableReason(relPath) != "" {
+		return link, false
+	}
+
+	info, err := os.Lstat(link.HomePath)
+	switch {
+	case os.IsNotExist(err):
+		return link, true
+	case err != nil:
+		link.Replaces = err.Error()
+	case info.IsDir():
+		link.Replaces = "directory"
+	case info.Mode()&os.ModeSymlink == 0:
+		link.Replaces = "real file, which is backed up"
+	default:
+		target, err := resolveLink(link.HomePath)
+		if err == nil && target == link.Source {
+			return link, false
+		}
+		link.Replaces = fmt.Sprintf("link to %s", target)
+	}
+	return link, true
+}
@@ -0,0 +1,505 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"cli-config-manager/config"
+)
+
+// ValidationIssue is a problem found in one of dotman's metadata files
+type ValidationIssue struct {
+	// File is the path of the file the problem is in
+	File string `json:"file"`
+	// Line is the 1-based line of the problem, or zero when it applies to
+	// the whole file
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// String formats the issue as file:line: message
+func (i ValidationIssue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", i.File, i.Line, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", i.File, i.Message)
+}
+
+// Validate parses every dotman metadata file and reports all problems found:
+// unknown or invalid settings, invalid ignore and lfs patterns, frozen
+// entries and notes for files that are not managed and malformed backups. Unlike
+// HealthCheck it checks the files themselves, not the state of the links
+// they describe. Settings are read from disk, so a config.json that fails
+// to load is still validated.
+func (m *Manager) Validate() []ValidationIssue {
+	if _, err := os.Stat(m.config.DotmanDir); err != nil {
+		return []ValidationIssue{{File: m.config.DotmanDir, Message: fmt.Sprintf("cannot read the dotman directory: %v", err)}}
+	}
+
+	var issues []ValidationIssue
+	issues = append(issues, m.validateSettings()...)
+	issues = append(issues, m.validateLayout()...)
+	issues = append(issues, m.validateIgnoreFile()...)
+	issues = append(issues, m.validateFrozen()...)
+	issues = append(issues, m.validateLinkConditions()...)
+	issues = append(issues, m.validateNotes()...)
+	issues = append(issues, m.validateBackups()...)
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues
+}
+
+// validateSettings checks config.json for syntax errors, unknown keys and
+// values that would be rejected when the settings are loaded
+func (m *Manager) validateSettings() []ValidationIssue {
+	path := m.config.SettingsFile()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []ValidationIssue{{File: path, Message: err.Error()}}
+	}
+
+	values, lines, issue := parseJSONObject(path, data)
+	if issue != nil {
+		return []ValidationIssue{*issue}
+	}
+
+	var issues []ValidationIssue
+	report := func(key, format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{File: path, Line: lines[key], Message: fmt.Sprintf(key+": "+format, args...)})
+	}
+
+	// Decode each key on its own so one bad value does not hide the rest
+	known := jsonKeys(reflect.TypeOf(config.Settings{}))
+	var settings config.Settings
+	for _, key := range sortedKeys(values) {
+		if !known[key] {
+			report(key, "unknown setting")
+			continue
+		}
+		single, _ := json.Marshal(map[string]json.RawMessage{key: values[key]})
+		if err := json.Unmarshal(single, &settings); err != nil {
+			report(key, "invalid value: %v", unmarshalReason(err))
+		}
+	}
+
+	if settings.GitTimeout != "" {
+		if _, err := time.ParseDuration(settings.GitTimeout); err != nil {
+			report("git_timeout", "%v", err)
+		}
+	}
+	if settings.MaxFileSize != "" {
+		if _, err := config.ParseSize(settings.MaxFileSize); err != nil {
+			report("max_file_size", "%v", err)
+		}
+	}
+	switch settings.SymlinkStyle {
+	case "", config.SymlinkAbsolute, config.SymlinkRelative:
+	default:
+		report("symlink_style", "must be %q or %q, got %q", config.SymlinkAbsolute, config.SymlinkRelative, settings.SymlinkStyle)
+	}
+	switch settings.PullStrategy {
+	case "", config.PullFFOnly, config.PullRebase, config.PullMerge:
+	default:
+		report("pull_strategy", "must be %q, %q or %q, got %q", config.PullFFOnly, config.PullRebase, config.PullMerge, settings.PullStrategy)
+	}
+	switch settings.Layout {
+	case "", config.LayoutHomeRelative, config.LayoutXDGSplit, config.LayoutPackage:
+		if recorded, ok := m.recordedLayout(); ok && settings.Layout != "" && settings.Layout != recorded {
+			report("layout", "set to %q, but the repository uses the %q layout, which takes precedence", settings.Layout, recorded)
+		}
+	default:
+		report("layout", "must be %q, %q or %q, got %q", config.LayoutHomeRelative, config.LayoutXDGSplit, config.LayoutPackage, settings.Layout)
+	}
+	for _, pattern := range settings.LFSPatterns {
+		if !validPattern(pattern) {
+			report("lfs_patterns", "invalid pattern %q", pattern)
+		}
+	}
+	for _, pattern := range settings.HealthExclude {
+		if !validPattern(pattern) {
+			report("health_exclude", "invalid pattern %q", pattern)
+		}
+	}
+	if settings.BackupIdentity != "" {
+		if _, err := os.Stat(m.config.ExpandHome(settings.BackupIdentity)); err != nil {
+			report("backup_identity", "%v", err)
+		}
+	}
+	if settings.AddCommitMessage != "" {
+		if _, err := parseAddCommitMessage(settings.AddCommitMessage); err != nil {
+			report("add_commit_message", "invalid template: %v", err)
+		}
+	}
+	if tool := strings.Fields(settings.DiffTool); len(tool) > 0 {
+		if _, err := exec.LookPath(tool[0]); err != nil {
+			report("diff_tool", "%s is not installed", tool[0])
+		}
+	}
+	if settings.LogFile != "" {
+		if info, err := os.Stat(m.config.ExpandHome(settings.LogFile)); err == nil && info.IsDir() {
+			report("log_file", "%s is a directory", settings.LogFile)
+		}
+	}
+	if settings.GitHubUser != "" && !githubLogin.MatchString(settings.GitHubUser) {
+		report("github_user", "%q is not a GitHub login", settings.GitHubUser)
+	}
+	if err := config.ValidateRoots(m.config.HomeDir, settings.Roots); err != nil {
+		report("roots", "%v", err)
+	}
+	if settings.CloneDepth < 0 {
+		report("clone_depth", "must not be negative")
+	}
+
+	return issues
+}
+
+// validateLayout checks the recorded layout and that every managed file fits
+// the layout of the configs directory
+func (m *Manager) validateLayout() []ValidationIssue {
+	var issues []ValidationIssue
+	if recorded, ok := m.recordedLayout(); ok {
+		switch recorded {
+		case config.LayoutXDGSplit, config.LayoutPackage:
+		default:
+			issues = append(issues, ValidationIssue{
+				File:    filepath.Join(m.config.DotmanDir, layoutFileName),
+				Line:    1,
+				Message: fmt.Sprintf("unknown layout %q; must be %q or %q", recorded, config.LayoutXDGSplit, config.LayoutPackage),
+			})
+			return issues
+		}
+	}
+
+	unreadable, err := m.walkConfigs(func(string, os.FileInfo) {})
+	if err != nil && !os.IsNotExist(err) {
+		unreadable = append(unreadable, err)
+	}
+	for _, err := range unreadable {
+		issues = append(issues, ValidationIssue{File: m.config.ConfigsDir, Message: err.Error()})
+	}
+	return issues
+}
+
+// validateIgnoreFile checks every pattern in .dotmanignore
+func (m *Manager) validateIgnoreFile() []ValidationIssue {
+	path := filepath.Join(m.config.DotmanDir, ignoreFileName)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []ValidationIssue{{File: path, Message: err.Error()}}
+	}
+	defer file.Close()
+
+	var issues []ValidationIssue
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if !validPattern(strings.TrimSuffix(pattern, "/")) {
+			issues = append(issues, ValidationIssue{File: path, Line: line, Message: fmt.Sprintf("invalid pattern %q", pattern)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		issues = append(issues, ValidationIssue{File: path, Message: err.Error()})
+	}
+	return issues
+}
+
+// validateFrozen checks that the frozen index parses and only lists
+// managed files
+func (m *Manager) validateFrozen() []ValidationIssue {
+	path := filepath.Join(m.config.DotmanDir, frozenFileName)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []ValidationIssue{{File: path, Message: err.Error()}}
+	}
+
+	values, lines, issue := parseJSONObject(path, data)
+	if issue != nil {
+		return []ValidationIssue{*issue}
+	}
+
+	var issues []ValidationIssue
+	for _, relPath := range sortedKeys(values) {
+		var frozenAt time.Time
+		if err := json.Unmarshal(values[relPath], &frozenAt); err != nil {
+			issues = append(issues, ValidationIssue{File: path, Line: lines[relPath], Message: fmt.Sprintf("%s: invalid freeze time: %v", relPath, unmarshalReason(err))})
+		}
+		if _, err := os.Lstat(m.sourcePath(relPath)); err != nil {
+			issues = append(issues, ValidationIssue{File: path, Line: lines[relPath], Message: fmt.Sprintf("%s: not a managed file", relPath)})
+		}
+	}
+	return issues
+}
+
+// validateNotes checks that notes.json maps managed files to strings
+func (m *Manager) validateNotes() []ValidationIssue {
+	path := filepath.Join(m.config.DotmanDir, notesFileName)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []ValidationIssue{{File: path, Message: err.Error()}}
+	}
+
+	values, lines, issue := parseJSONObject(path, data)
+	if issue != nil {
+		return []ValidationIssue{*issue}
+	}
+
+	var issues []ValidationIssue
+	for _, relPath := range sortedKeys(values) {
+		var note string
+		if err := json.Unmarshal(values[relPath], &note); err != nil {
+			issues = append(issues, ValidationIssue{File: path, Line: lines[relPath], Message: fmt.Sprintf("%s: note must be a string", relPath)})
+		}
+		if _, err := os.Lstat(m.sourcePath(filepath.FromSlash(relPath))); err != nil {
+			issues = append(issues, ValidationIssue{File: path, Line: lines[relPath], Message: fmt.Sprintf("%s: not a managed file", relPath)})
+		}
+	}
+	return issues
+}
+
+// validateLinkConditions checks links.json for conditions that cannot be
+// read and for paths that are not managed
+func (m *Manager) validateLinkConditions() []ValidationIssue {
+	path := filepath.Join(m.config.DotmanDir, linkConditionsFileName)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []ValidationIssue{{File: path, Message: err.Error()}}
+	}
+
+	values, lines, issue := parseJSONObject(path, data)
+	if issue != nil {
+		return []ValidationIssue{*issue}
+	}
+
+	var issues []ValidationIssue
+	for _, relPath := range sortedKeys(values) {
+		report := func(format string, args ...interface{}) {
+			issues = append(issues, ValidationIssue{File: path, Line: lines[relPath], Message: relPath + ": " + fmt.Sprintf(format, args...)})
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(values[relPath]))
+		dec.DisallowUnknownFields()
+		var condition LinkCondition
+		if err := dec.Decode(&condition); err != nil {
+			report("invalid condition: %v", unmarshalReason(err))
+			continue
+		}
+		if len(condition.Requires) == 0 {
+			report("requires: no programs listed")
+		}
+		for _, program := range condition.Requires {
+			if strings.TrimSpace(program) == "" {
+				report("requires: empty program name")
+			}
+		}
+		if _, err := os.Lstat(m.sourcePath(relPath)); err != nil {
+			report("not a managed file or directory")
+		}
+	}
+	return issues
+}
+
+// validateBackups checks the metadata of every backup and that its content
+// is present and matches the recorded checksum
+func (m *Manager) validateBackups() []ValidationIssue {
+	backupsDir := m.config.BackupsDir()
+	entries, err := os.ReadDir(backupsDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return []ValidationIssue{{File: backupsDir, Message: err.Error()}}
+	}
+
+	known := jsonKeys(reflect.TypeOf(BackupMetadata{}))
+
+	var issues []ValidationIssue
+	for _, entry := range entries {
+		if !isBackupDir(entry) {
+			continue
+		}
+
+		backupDir := filepath.Join(backupsDir, entry.Name())
+		metadataPath := filepath.Join(backupDir, "metadata.json")
+		contentPath := filepath.Join(backupDir, "content")
+
+		data, err := os.ReadFile(metadataPath)
+		if err != nil {
+			issues = append(issues, ValidationIssue{File: metadataPath, Message: fmt.Sprintf("cannot read backup metadata: %v", err)})
+			continue
+		}
+
+		values, lines, issue := parseJSONObject(metadataPath, data)
+		if issue != nil {
+			issues = append(issues, *issue)
+			continue
+		}
+		report := func(key, format string, args ...interface{}) {
+			issues = append(issues, ValidationIssue{File: metadataPath, Line: lines[key], Message: fmt.Sprintf(format, args...)})
+		}
+
+		for _, key := range sortedKeys(values) {
+			if !known[key] {
+				report(key, "%s: unknown field", key)
+			}
+		}
+
+		var backup BackupMetadata
+		if err := json.Unmarshal(data, &backup); err != nil {
+			issues = append(issues, ValidationIssue{File: metadataPath, Line: jsonErrorLine(data, err), Message: fmt.Sprintf("invalid value: %v", unmarshalReason(err))})
+			continue
+		}
+
+		switch {
+		case backup.ID == "":
+			report("id", "id: missing")
+		case backup.ID != entry.Name():
+			report("id", "id: %q does not match the backup directory %q", backup.ID, entry.Name())
+		}
+		if backup.OriginalPath == "" {
+			report("original_path", "original_path: missing")
+		}
+		if backup.Timestamp.IsZero() {
+			report("timestamp", "timestamp: missing")
+		}
+		if backup.Encrypted && backup.Encryption != encryptionAge && backup.Encryption != encryptionGPG {
+			report("encryption", "encryption: must be %q or %q, got %q", encryptionAge, encryptionGPG, backup.Encryption)
+		}
+
+		content, err := os.ReadFile(contentPath)
+		if err != nil {
+			issues = append(issues, ValidationIssue{File: contentPath, Message: fmt.Sprintf("cannot read backup content: %v", err)})
+			continue
+		}
+		if !backupChecksumMatches(backup, content) {
+			report("checksum", "checksum: does not match the backup content")
+		}
+	}
+	return issues
+}
+
+// parseJSONObject decodes data as a JSON object and returns its values along
+// with the line each key is on. A syntax error is returned as an issue.
+func parseJSONObject(path string, data []byte) (map[string]json.RawMessage, map[string]int, *ValidationIssue) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, nil, &ValidationIssue{File: path, Line: jsonErrorLine(data, err), Message: fmt.Sprintf("invalid JSON: %v", unmarshalReason(err))}
+	}
+
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return values, lines, nil
+	}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			break
+		}
+		if key, ok := token.(string); ok {
+			lines[key] = lineAt(data, dec.InputOffset())
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			break
+		}
+	}
+	return values, lines, nil
+}
+
+// jsonErrorLine returns the line a JSON decoding error points at, or zero
+func jsonErrorLine(data []byte, err error) int {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return lineAt(data, syntaxErr.Offset)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return lineAt(data, typeErr.Offset)
+	}
+	return 0
+}
+
+// unmarshalReason describes a JSON decoding error without Go type names
+func unmarshalReason(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("expected %s, got %s", typeErr.Type.Kind(), typeErr.Value)
+	}
+	return err.Error()
+}
+
+// lineAt returns the 1-based line of the byte at offset
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// jsonKeys returns the JSON keys of the fields of struct type t
+func jsonKeys(t reflect.Type) map[string]bool {
+	keys := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for key := range jsonKeys(field.Type) {
+				keys[key] = true
+			}
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+// sortedKeys returns the keys of values in order
+func sortedKeys(values map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validPattern reports whether pattern is a valid .dotmanignore glob
+func validPattern(pattern string) bool {
+	_, err := filepath.Match(pattern, "")
+	return err == nil
+}
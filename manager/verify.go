@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// backupVerdict is the outcome of verifying one backup in the store
+type backupVerdict struct {
+	Name    string
+	Dir     string
+	Problem string
+}
+
+// verifyBackups checks every backup in the store with backupProblem and
+// returns the verdicts in the order of the backup names. The checksums are
+// computed by a pool of workers, at most one per CPU when workers is 0 or
+// negative. progress, if not nil, is called after each backup with the
+// number verified so far; calls are serialized but not ordered by backup.
+func (m *Manager) verifyBackups(workers int, progress func(done, total int)) ([]backupVerdict, error) {
+	backupsDir := m.config.BackupsDir()
+	entries, err := os.ReadDir(backupsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var verdicts []backupVerdict
+	for _, entry := range entries {
+		if isBackupDir(entry) {
+			verdicts = append(verdicts, backupVerdict{
+				Name: entry.Name(),
+				Dir:  filepath.Join(backupsDir, entry.Name()),
+			})
+		}
+	}
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(verdicts) {
+		workers = len(verdicts)
+	}
+
+	// Each worker writes only the verdicts of the indexes it receives, so
+	// the result keeps the order of the store however the work is spread
+	jobs := make(chan int)
+	var mu sync.Mutex
+	done := 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				verdicts[index].Problem = backupProblem(verdicts[index].Dir)
+				if progress != nil {
+					mu.Lock()
+					done++
+					progress(done, len(verdicts))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for index := range verdicts {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	return verdicts, nil
+}
@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fillBackupStore takes n backups of files of size bytes with BackupFile
+// and returns the backup IDs in store order
+func fillBackupStore(tb testing.TB, m *Manager, n, size int) []string {
+	tb.Helper()
+
+	for i := 0; i < n; i++ {
+		path := filepath.Join(m.config.HomeDir, fmt.Sprintf(".rc%04d", i))
+		writeTestFile(tb, path, strings.Repeat(fmt.Sprintf("line %d\n", i), size/8))
+		if err := m.BackupFile(path); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(m.config.BackupsDir())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		if isBackupDir(entry) {
+			ids = append(ids, entry.Name())
+		}
+	}
+	if len(ids) != n {
+		tb.Fatalf("store holds %d backups, want %d", len(ids), n)
+	}
+	return ids
+}
+
+func TestVerifyBackupsKeepsStoreOrder(t *testing.T) {
+	m := newTestManager(t)
+	ids := fillBackupStore(t, m, 40, 4096)
+
+	// Corrupt every third backup, so the problems are spread over workers
+	corrupt := make(map[string]bool)
+	for i := 0; i < len(ids); i += 3 {
+		writeTestFile(t, filepath.Join(m.config.BackupsDir(), ids[i], "content"), "corrupted\n")
+		corrupt[ids[i]] = true
+	}
+
+	calls := 0
+	verdicts, err := m.verifyBackups(8, func(done, total int) {
+		calls++
+		if done != calls || total != len(ids) {
+			t.Errorf("progress(%d, %d) on call %d, want (%d, %d)", done, total, calls, calls, len(ids))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != len(ids) {
+		t.Errorf("progress called %d times, want %d", calls, len(ids))
+	}
+	if len(verdicts) != len(ids) {
+		t.Fatalf("got %d verdicts, want %d", len(verdicts), len(ids))
+	}
+	for i, verdict := range verdicts {
+		if verdict.Name != ids[i] {
+			t.Errorf("verdict %d is for %s, want %s", i, verdict.Name, ids[i])
+		}
+		if got := verdict.Problem != ""; got != corrupt[verdict.Name] {
+			t.Errorf("%s: problem = %q, corrupted = %v", verdict.Name, verdict.Problem, corrupt[verdict.Name])
+		}
+	}
+}
+
+// BenchmarkVerifyBackups compares verifying a synthetic store one backup at
+// a time with one worker per CPU
+func BenchmarkVerifyBackups(b *testing.B) {
+	m := newTestManager(b)
+	fillBackupStore(b, m, 200, 64*1024)
+
+	counts := []int{1}
+	if runtime.NumCPU() > 1 {
+		counts = append(counts, runtime.NumCPU())
+	}
+	for _, workers := range counts {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := m.verifyBackups(workers, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}